@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/data"
+	"github.com/Blue-Davinci/SavannaCart/internal/validator"
+)
+
+// createAPIKeyHandler() creates a personal API key for the user. A key can only be given
+// permissions its owner has, and the key itself is only ever shown in this response. Keys
+// without an expiry last DefaultAPIKeyExpiryTime.
+func (app *application) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string     `json:"name"`
+		Permissions []string   `json:"permissions"`
+		Expiry      *time.Time `json:"expiry"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user := app.contextGetUser(r)
+
+	apiKey := &data.APIKey{
+		UserID:      user.ID,
+		Name:        input.Name,
+		Permissions: data.Permissions{},
+		Expiry:      time.Now().Add(data.DefaultAPIKeyExpiryTime),
+	}
+	if input.Expiry != nil {
+		apiKey.Expiry = *input.Expiry
+	}
+	apiKey.Permissions = append(apiKey.Permissions, input.Permissions...)
+
+	v := validator.New()
+	if data.ValidateAPIKey(v, apiKey); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	permissions, err := app.getUserPermissions(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	for _, code := range apiKey.Permissions {
+		if !permissions.Include(code) {
+			v.AddError("permissions", "must only contain permissions you have")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	err = app.models.APIKeys.Insert(apiKey)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrPermissionNotFound):
+			v.AddError("permissions", "must only contain permissions you have")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	response := envelope{
+		"api_key": apiKey,
+		"message": "store this key somewhere safe, it will not be shown again",
+	}
+	err = app.writeJSON(w, http.StatusCreated, response, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listAPIKeysHandler() returns the user's API keys that can still be used, without their
+// secrets.
+func (app *application) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	apiKeys, err := app.models.APIKeys.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"api_keys": apiKeys}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revokeAPIKeyHandler() stops one of the user's API keys from working straight away.
+func (app *application) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	apiKeyID, err := app.readIDParam(r, "apiKeyID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	user := app.contextGetUser(r)
+
+	err = app.models.APIKeys.Revoke(user.ID, apiKeyID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "API key revoked successfully"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/data"
+)
+
+func TestCreateAPIKeyHandlerValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{"empty body", ``, http.StatusBadRequest},
+		{"unknown field", `{"name": "sync", "scopes": ["admin:read"]}`, http.StatusBadRequest},
+		{"missing name", `{"permissions": ["admin:read"]}`, http.StatusUnprocessableEntity},
+		{"badly formatted permission", `{"name": "sync", "permissions": ["admin"]}`, http.StatusUnprocessableEntity},
+		{"duplicate permissions", `{"name": "sync", "permissions": ["admin:read", "admin:read"]}`, http.StatusUnprocessableEntity},
+		{"expired", `{"name": "sync", "expiry": "2020-01-01T00:00:00Z"}`, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := createTestApp(t)
+			r := newAuthenticatedRequest(app, http.MethodPost, "/v1/api/api-keys", tt.body, 7, nil)
+			w := httptest.NewRecorder()
+
+			app.createAPIKeyHandler(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRevokeAPIKeyHandlerInvalidID(t *testing.T) {
+	app := createTestApp(t)
+	r := newAuthenticatedRequest(app, http.MethodDelete, "/v1/api/api-keys/0", "", 7, map[string]string{"apiKeyID": "0"})
+	w := httptest.NewRecorder()
+
+	app.revokeAPIKeyHandler(w, r)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d: %s", http.StatusNotFound, w.Code, w.Body.String())
+	}
+}
+
+func TestRequireSessionAuthentication(t *testing.T) {
+	tests := []struct {
+		name           string
+		apiKey         *data.APIKey
+		expectedStatus int
+	}{
+		{"session token", nil, http.StatusOK},
+		{"API key", &data.APIKey{ID: 3, UserID: 7}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := createTestApp(t)
+			r := newAuthenticatedRequest(app, http.MethodGet, "/v1/api/api-keys", "", 7, nil)
+			if tt.apiKey != nil {
+				r = app.contextSetAPIKey(r, tt.apiKey)
+			}
+			w := httptest.NewRecorder()
+
+			app.requireSessionAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})).ServeHTTP(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAuthenticatorHelperRejectsMalformedAPIKeys(t *testing.T) {
+	app := createTestApp(t)
+	for _, header := range []string{"Bearer " + data.APIKeyPrefix, "Bearer " + data.APIKeyPrefix + "short"} {
+		r := httptest.NewRequest(http.MethodGet, "/v1/orders", nil)
+		r.Header.Set("Authorization", header)
+
+		user, apiKey, err := app.aunthenticatorHelper(r)
+		if !errors.Is(err, ErrInvalidAuthentication) || user != nil || apiKey != nil {
+			t.Errorf("%q: expected ErrInvalidAuthentication, got %v, %v, %v", header, user, apiKey, err)
+		}
+	}
+}
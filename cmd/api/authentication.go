@@ -2,15 +2,17 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/Blue-Davinci/SavannaCart/internal/data"
 	"github.com/Blue-Davinci/SavannaCart/internal/validator"
-	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/tomasen/realip"
 	"go.uber.org/zap"
 	"golang.org/x/oauth2"
 )
@@ -36,44 +38,70 @@ Flow:
   - Then proceed with the same steps as above to generate the token and send it back to the frontend.
 */
 
+// InitOIDC() sets up every configured OIDC provider. The original Google configuration is
+// registered as "google" and becomes the default provider, followed by any providers listed
+// in -oidc-providers.
 func (app *application) InitOIDC() error {
-	// Validate required configuration
-	if app.config.api.oidc_client_id == "" {
-		return fmt.Errorf("OIDC client ID is required")
-	}
-	if app.config.api.oidc_client_secret == "" {
-		return fmt.Errorf("OIDC client secret is required")
-	}
-	ctx := context.Background()
-	// Initialize the OIDC provider
-	var err error
-	app.config.authenticators.provider, err = oidc.NewProvider(ctx, app.config.app_urls.provide_url)
+	var configs []oidcProviderConfig
+	if app.config.api.oidc_client_id != "" || app.config.api.oidc_client_secret != "" {
+		configs = append(configs, oidcProviderConfig{
+			id:           googleOIDCProvider,
+			issuerURL:    app.config.app_urls.provide_url,
+			clientID:     app.config.api.oidc_client_id,
+			clientSecret: app.config.api.oidc_client_secret,
+			redirectURL:  app.config.app_urls.authentication_callback_url,
+		})
+	}
+	extraConfigs, err := parseOIDCProviders(app.config.authenticators.extraProviders, app.config.app_urls.authentication_callback_url, os.Getenv)
 	if err != nil {
 		return err
 	}
-
-	// Initialize the OAuth2 configuration
-	app.config.authenticators.oauthConfig = &oauth2.Config{
-		ClientID:     app.config.api.oidc_client_id,
-		ClientSecret: app.config.api.oidc_client_secret,
-		Endpoint:     app.config.authenticators.provider.Endpoint(),
-		RedirectURL:  app.config.app_urls.authentication_callback_url,
-		Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+	configs = append(configs, extraConfigs...)
+	if len(configs) == 0 {
+		return fmt.Errorf("at least one OIDC provider is required, set the OIDC client ID and secret or -oidc-providers")
 	}
 
-	// Create an ID token verifier
-	app.config.authenticators.verifier = app.config.authenticators.provider.Verifier(&oidc.Config{ClientID: app.config.api.oidc_client_id})
+	ctx := context.Background()
+	providers := make(map[string]*oidcProvider, len(configs))
+	providerIDs := make([]string, 0, len(configs))
+	for _, cfg := range configs {
+		if _, exists := providers[cfg.id]; exists {
+			return fmt.Errorf("OIDC provider %s is configured twice", cfg.id)
+		}
+		provider, err := newOIDCProvider(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		if cfg.id == googleOIDCProvider {
+			provider.authCodeOptions = []oauth2.AuthCodeOption{
+				oauth2.AccessTypeOffline,
+				oauth2.SetAuthURLParam("prompt", "consent"), // Force consent screen to ensure fresh tokens
+				oauth2.SetAuthURLParam("include_granted_scopes", "true"),
+			}
+		}
+		providers[cfg.id] = provider
+		providerIDs = append(providerIDs, cfg.id)
+	}
+	app.config.authenticators.providers = providers
+	app.config.authenticators.providerIDs = providerIDs
 
 	return nil
 }
 
 // logoutUserHandler() is the main endpoint responsible for logging out the user.
-// Currently, we will just terminate a user's SSE connection if they have one.
+// Only the session the request was made with is ended, the user stays signed in on
+// their other devices.
 func (app *application) logoutUserHandler(w http.ResponseWriter, r *http.Request) {
 	// Get the user from the context
 	userID := app.contextGetUser(r).ID
-	// delete all their authentication tokens
-	err := app.models.Tokens.DeleteAllForUser(data.ScopeAuthentication, userID)
+	session, err := app.models.Sessions.GetForToken(data.ScopeAuthentication, app.bearerToken(r))
+	switch {
+	case err == nil:
+		err = app.models.Sessions.Revoke(userID, session.ID)
+	case errors.Is(err, data.ErrSessionNotFound):
+		// tokens issued before sessions existed, delete all their authentication tokens
+		err = app.models.Tokens.DeleteAllForUser(data.ScopeAuthentication, userID)
+	}
 	if err != nil {
 		app.logger.Error("Error deleting authentication tokens for user",
 			zap.Int64("user_id", userID),
@@ -116,9 +144,11 @@ func (app *application) updateUserInfo(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	// check if phone number has been updated
-	if input.PhoneNumber != nil {
-		// If the phone number is provided, update it
+	if input.PhoneNumber != nil && *input.PhoneNumber != user.PhoneNumber {
+		// If the phone number is provided, update it. A new number has to be verified again
+		// before we send it any SMS.
 		user.PhoneNumber = *input.PhoneNumber
+		user.PhoneVerified = false
 	}
 	// Validate the updated user data
 	v := validator.New()
@@ -174,7 +204,7 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrGeneralRecordNotFound):
-			v.AddError("token", "invalid or expired activation token")
+			v.AddError("token", "invalid or expired activation token, request a new one")
 			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
@@ -215,14 +245,14 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 			"lastName":  user.LastName,
 		}
 		// Send the welcome email, passing in the map above as dynamic data.
-		err = app.mailer.Send(user.Email, "user_succesful_activation.tmpl", data)
+		err = app.mailer.Send(user.Email, app.userEmailTemplate(user.ID, "user_succesful_activation.tmpl"), data)
 		if err != nil {
 			app.logger.Error("Error sending welcome email", zap.String("email", user.Email), zap.Error(err))
 		}
 	})
 
-	// Generate authentication token for the activated user
-	authToken, err := app.generateUserAuthenticationToken(user)
+	// Start a session for the activated user
+	sessionTokens, err := app.startUserSession(user, r)
 	if err != nil {
 		app.logger.Error("Error generating authentication token for activated user", zap.Error(err))
 		app.serverErrorResponse(w, r, err)
@@ -243,10 +273,9 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 			"last_name":  user.LastName,
 			"activated":  user.Activated,
 		},
-		"authentication_token": envelope{
-			"token":  authToken.Plaintext,
-			"expiry": authToken.Expiry,
-		},
+		"authentication_token": sessionTokens.AuthenticationToken,
+		"refresh_token":        sessionTokens.RefreshToken,
+		"session":              sessionTokens.Session,
 	}
 
 	err = app.writeJSON(w, http.StatusOK, response, nil)
@@ -256,6 +285,48 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 }
 
+// resendActivationTokenHandler() sends a new activation link to a user whose first one was
+// lost or has expired, replacing any activation tokens they still have. The response is the
+// same whether or not the user exists or is already activated, so it can't be used to find
+// out who has an account.
+func (app *application) resendActivationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetByEmail(input.Email, "")
+	switch {
+	case err == nil:
+		if !user.Activated {
+			err = app.sendUserActivation(user)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+	case !errors.Is(err, data.ErrGeneralRecordNotFound):
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	response := envelope{"message": "if an inactive account with that email address exists, you will receive a new activation link shortly"}
+	err = app.writeJSON(w, http.StatusAccepted, response, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
 // simple API Health check route
 func (app *application) healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	// Write a simple JSON response to indicate the API is healthy
@@ -269,10 +340,61 @@ func (app *application) healthCheckHandler(w http.ResponseWriter, r *http.Reques
 	app.logger.Info("Health check successful")
 }
 
+// listAuthenticationProvidersHandler() returns the IDs of the providers users can sign in
+// with, the first one is used by the routes without a provider ID.
+func (app *application) listAuthenticationProvidersHandler(w http.ResponseWriter, r *http.Request) {
+	providerIDs := app.config.authenticators.providerIDs
+	if providerIDs == nil {
+		providerIDs = []string{}
+	}
+	err := app.writeJSON(w, http.StatusOK, envelope{"providers": providerIDs}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// startAuthenticationHandler() starts an OAuth login with the provider in the route, or the
+// default provider. It issues a random state and a PKCE code verifier, stores them for a few
+// minutes and returns the provider URL the user should be sent to. The callback only accepts
+// states issued here for the same provider, each of them only once and only from this browser,
+// which a cookie ties the login to.
+func (app *application) startAuthenticationHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.oidcProviderFromRequest(r)
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+	oauthState, err := app.models.OAuthStates.New(provider.id, data.DefaultOAuthStateTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	setOAuthStateCookie(w, oauthState)
+	response := envelope{
+		"authorization_url": provider.authCodeURL(oauthState),
+		"provider":          provider.id,
+		"expiry":            oauthState.Expiry,
+	}
+	err = app.writeJSON(w, http.StatusOK, response, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
 // createAuthenticationApiKeyHandler is our main authentication endpoint handler and the hitpoint for tha auth callback
 // It will handle the OAuth2.0 flow, including redirecting to the provider, handling the callback, and generating API keys.
 // It will also handle the creation of API keys for authenticated users.
+// Logins must have been started through startAuthenticationHandler() in the same browser, the
+// state is checked and used up before anything else so it can't be replayed. Each provider
+// has its own callback route, the original route is the default provider's.
 func (app *application) createAuthenticationApiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.oidcProviderFromRequest(r)
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
 	// Get the authorization code from query parameters using helper methods
 	var input struct {
 		AuthorizationCode string `json:"code"`
@@ -287,6 +409,34 @@ func (app *application) createAuthenticationApiKeyHandler(w http.ResponseWriter,
 	input.Error = app.readString(qs, "error", "")
 	input.ErrorDescription = app.readString(qs, "error_description", "")
 
+	v := validator.New()
+	if data.ValidateOAuthState(v, input.State); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// A login only counts in the browser that started it. Without this anyone could start a
+	// login, sign in with their own account and get someone else to open the callback, who
+	// would then be signed in as them (login CSRF), or have their account linked to it.
+	if !oauthStartedHere(r, input.State) {
+		app.logger.Warn("Rejected OAuth callback from a browser that didn't start the login",
+			zap.String("provider", provider.id))
+		app.invalidOAuthStateResponse(w, r)
+		return
+	}
+	clearOAuthStateCookie(w)
+	// Make sure we issued this state and it hasn't been used yet
+	oauthState, err := app.models.OAuthStates.Consume(provider.id, input.State)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrOAuthStateNotFound), errors.Is(err, data.ErrOAuthStateExpired):
+			app.logger.Warn("Rejected OAuth callback", zap.Error(err))
+			app.invalidOAuthStateResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
 	// Check for OAuth errors first
 	if input.Error != "" {
 		app.logger.Error("OAuth error received",
@@ -304,12 +454,188 @@ func (app *application) createAuthenticationApiKeyHandler(w http.ResponseWriter,
 
 	// Log the authorization code length for debugging (don't log the actual code for security)
 	app.logger.Info("Received authorization code",
-		zap.Int("code_length", len(input.AuthorizationCode)),
-		zap.String("state", input.State))
+		zap.Int("code_length", len(input.AuthorizationCode)))
 
-	// Exchange the authorization code for tokens
-	ctx := context.Background()
-	exchange_token, err := app.config.authenticators.oauthConfig.Exchange(ctx, input.AuthorizationCode)
+	// Exchange the authorization code for tokens and read the user from the ID token
+	claims, err := app.exchangeOAuthCode(r.Context(), provider, input.AuthorizationCode, oauthState.CodeVerifier)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidAuthentication):
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.logger.Info("OAuth user authenticated",
+		zap.String("provider", provider.id),
+		zap.String("email", claims.Email),
+		zap.String("name", claims.Name),
+		zap.Bool("email_verified", claims.EmailVerified))
+
+	// A signed in user started this login to link the provider to their account
+	if oauthState.LinkUserID != 0 {
+		app.handleOAuthLink(w, r, provider, oauthState.LinkUserID, claims)
+		return
+	}
+
+	// Sign in whoever this provider account is linked to
+	identity, err := app.models.Identities.GetForSubject(provider.id, claims.Subject)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			// First time this provider account signs in
+			app.handleOAuthNewIdentity(w, r, provider, claims)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.models.Identities.RecordLogin(identity.ID, claims.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	user, err := app.models.Users.GetUserByID(identity.UserID)
+	if err != nil {
+		app.logger.Error("Error retrieving user for identity", zap.Int64("user_id", identity.UserID), zap.Error(err))
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// User exists, handle login flow
+	app.handleUserLogin(w, r, user)
+}
+
+// handleOAuthNewIdentity handles the first sign in with a provider account. If someone
+// already has an account with its email the provider is linked to them, otherwise a new user
+// is signed up.
+func (app *application) handleOAuthNewIdentity(w http.ResponseWriter, r *http.Request, provider *oidcProvider, claims *data.OAuthClaims) {
+	user, err := app.models.Users.GetByEmail(claims.Email, "")
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			// User doesn't exist, handle signup flow
+			app.handleOAuthSignup(w, r, provider, claims)
+		default:
+			app.logger.Error("Error retrieving user by email", zap.String("email", claims.Email), zap.Error(err))
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.linkOAuthIdentityByEmail(w, r, provider, user, claims)
+}
+
+// linkOAuthIdentityByEmail links a provider account to the existing user with the same email
+// and signs them in. This is only done when the provider has verified the email, otherwise
+// anyone could take over an account by claiming its email at a provider that doesn't check.
+// An account that was never activated may have been signed up by someone else with the
+// owner's email, so its password and activation link are thrown away and a new link is sent.
+func (app *application) linkOAuthIdentityByEmail(w http.ResponseWriter, r *http.Request, provider *oidcProvider, user *data.User, claims *data.OAuthClaims) {
+	if !claims.EmailVerified {
+		app.logger.Warn("Refusing to link a provider account with an unverified email",
+			zap.String("provider", provider.id),
+			zap.Int64("user_id", user.ID))
+		app.errorResponse(w, r, http.StatusConflict, "an account with this email already exists, sign in with it to link this provider")
+		return
+	}
+	if !user.Activated {
+		_, err := app.models.Identities.LinkUnactivated(user, provider.id, claims)
+		if err != nil && !errors.Is(err, data.ErrDuplicateUserIdentity) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		// a concurrent callback for the same account already did all of this
+		if err == nil {
+			app.logger.Info("Linked provider account to an unactivated user by email, dropped their password and tokens",
+				zap.String("provider", provider.id),
+				zap.Int64("user_id", user.ID))
+			err = app.sendUserActivation(user)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+		app.handleUserLogin(w, r, user)
+		return
+	}
+	_, err := app.models.Identities.Link(user.ID, provider.id, claims)
+	// a concurrent callback for the same account may have linked it already
+	if err != nil && !errors.Is(err, data.ErrDuplicateUserIdentity) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.logger.Info("Linked provider account by email", zap.String("provider", provider.id), zap.Int64("user_id", user.ID))
+	app.handleUserLogin(w, r, user)
+}
+
+// handleOAuthLink links a provider account to the signed in user who started the login
+func (app *application) handleOAuthLink(w http.ResponseWriter, r *http.Request, provider *oidcProvider, userID int64, claims *data.OAuthClaims) {
+	identity, err := app.models.Identities.Link(userID, provider.id, claims)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateUserIdentity):
+			app.errorResponse(w, r, http.StatusConflict, "this provider account is already linked to a user")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.logger.Info("Linked provider account", zap.String("provider", provider.id), zap.Int64("user_id", userID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"identity": identity}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// oauthStateCookie holds the state of the login or link the browser started, the callback
+// is only accepted with it. It is only sent to the callback routes.
+const (
+	oauthStateCookie     = "savannacart_oauth_state"
+	oauthStateCookiePath = "/v1/api/authentication"
+)
+
+// setOAuthStateCookie() ties a login or link to the browser that started it, until its state expires
+func setOAuthStateCookie(w http.ResponseWriter, oauthState *data.OAuthState) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    oauthState.State,
+		Path:     oauthStateCookiePath,
+		Expires:  oauthState.Expiry,
+		MaxAge:   int(time.Until(oauthState.Expiry).Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		// the provider redirects back with a top level GET, which Lax cookies are sent with
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func clearOAuthStateCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Path:     oauthStateCookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// oauthStartedHere() reports whether the request comes from the browser that started the
+// login or link with the state
+func oauthStartedHere(r *http.Request, state string) bool {
+	cookie, err := r.Cookie(oauthStateCookie)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) == 1
+}
+
+// exchangeOAuthCode() exchanges an authorization code, together with the PKCE code verifier
+// of the login it belongs to, for tokens and returns the claims of the verified ID token.
+// Codes or tokens the provider or verifier reject are returned as ErrInvalidAuthentication.
+func (app *application) exchangeOAuthCode(ctx context.Context, provider *oidcProvider, code, codeVerifier string) (*data.OAuthClaims, error) {
+	exchange_token, err := provider.oauthConfig.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
 	if err != nil {
 		app.logger.Error("Error exchanging authorization code for tokens",
 			zap.Error(err),
@@ -321,59 +647,34 @@ func (app *application) createAuthenticationApiKeyHandler(w http.ResponseWriter,
 				zap.Int("response_code", oauthErr.Response.StatusCode),
 				zap.String("response_body", string(oauthErr.Body)))
 		}
-
-		app.invalidCredentialsResponse(w, r)
-		return
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAuthentication, err)
 	}
 
 	// Extract the ID Token from OAuth2 token
 	rawIDToken, ok := exchange_token.Extra("id_token").(string)
 	if !ok {
 		app.logger.Error("No id_token field in OAuth2 token")
-		app.serverErrorResponse(w, r, fmt.Errorf("no id_token field in OAuth2 token"))
-		return
+		return nil, fmt.Errorf("no id_token field in OAuth2 token")
 	}
 
 	// Verify and parse the ID token
-	idToken, err := app.config.authenticators.verifier.Verify(context.Background(), rawIDToken)
+	idToken, err := provider.verifier.Verify(ctx, rawIDToken)
 	if err != nil {
 		app.logger.Error("Failed to verify ID Token", zap.Error(err))
-		app.invalidCredentialsResponse(w, r)
-		return
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAuthentication, err)
 	}
 	// Extract user information from the ID token
 	var claims data.OAuthClaims
-
 	if err := idToken.Claims(&claims); err != nil {
 		app.logger.Error("Failed to extract claims from ID token", zap.Error(err))
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-	app.logger.Info("OAuth user authenticated",
-		zap.String("email", claims.Email),
-		zap.String("name", claims.Name),
-		zap.Bool("email_verified", claims.EmailVerified))
-
-	// Check if the user exists in the database
-	user, err := app.models.Users.GetByEmail(claims.Email, "")
-	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrGeneralRecordNotFound):
-			// User doesn't exist, handle signup flow
-			app.handleOAuthSignup(w, r, &claims)
-			return
-		default:
-			app.logger.Error("Error retrieving user by email", zap.String("email", claims.Email), zap.Error(err))
-			app.serverErrorResponse(w, r, err)
-			return
-		}
+		return nil, err
 	}
-	// User exists, handle login flow
-	app.handleOAuthLogin(w, r, user)
+	return &claims, nil
 }
 
-// handleOAuthSignup handles the creation of new users from OAuth authentication
-func (app *application) handleOAuthSignup(w http.ResponseWriter, r *http.Request, claims *data.OAuthClaims) {
+// handleOAuthSignup handles the creation of new users from OAuth authentication, the provider
+// account they signed up with is linked to them straight away.
+func (app *application) handleOAuthSignup(w http.ResponseWriter, r *http.Request, provider *oidcProvider, claims *data.OAuthClaims) {
 	app.logger.Info("User not found, creating new user", zap.String("email", claims.Email))
 
 	// Extract user information from claims
@@ -390,13 +691,7 @@ func (app *application) handleOAuthSignup(w http.ResponseWriter, r *http.Request
 		Activated:        false,  // Always false for new users - they must verify email
 	}
 
-	// Set a default password (user won't use this for OAuth logins)
-	err := newUser.Password.Set("oauth_user_" + claims.Subject)
-	if err != nil {
-		app.logger.Error("Error setting password for new OAuth user", zap.Error(err))
-		app.serverErrorResponse(w, r, err)
-		return
-	}
+	// OAuth users have no password until they reset it, so they can't log in with one
 
 	// Validate the user data
 	v := validator.New()
@@ -407,8 +702,8 @@ func (app *application) handleOAuthSignup(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Create the user in the database
-	err = app.models.Users.CreateNewUser(newUser)
+	// Create the user in the database, together with their provider account
+	_, err := app.models.Identities.CreateUser(newUser, provider.id, claims)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
@@ -420,7 +715,10 @@ func (app *application) handleOAuthSignup(w http.ResponseWriter, r *http.Request
 				return
 			}
 			// Handle existing user login
-			app.handleOAuthLogin(w, r, existingUser)
+			app.linkOAuthIdentityByEmail(w, r, provider, existingUser, claims)
+			return
+		case errors.Is(err, data.ErrDuplicateUserIdentity):
+			app.errorResponse(w, r, http.StatusConflict, "this provider account is already linked to a user")
 			return
 		default:
 			app.logger.Error("Error creating new user", zap.Error(err))
@@ -434,7 +732,7 @@ func (app *application) handleOAuthSignup(w http.ResponseWriter, r *http.Request
 		zap.Int64("user_id", newUser.ID))
 
 	// Generate activation token - this is REQUIRED for new users
-	activationToken, err := app.models.Tokens.New(newUser.ID, data.DefaultTokenExpiryTime, data.ScopeActivation)
+	err = app.sendUserActivation(newUser)
 	if err != nil {
 		app.logger.Error("Error creating activation token", zap.Error(err))
 		// If we cannot generate an activation token, we need to exit here as users need to be activated
@@ -442,22 +740,6 @@ func (app *application) handleOAuthSignup(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	app.background(func() {
-		// Send activation email
-		activationURL := fmt.Sprintf("%s?token=%s", app.config.app_urls.activation_callback_url, activationToken.Plaintext)
-		emailData := map[string]any{
-			"activationURL": activationURL,
-			"firstName":     newUser.FirstName,
-			"lastName":      newUser.LastName,
-			"userID":        newUser.ID,
-		}
-		err = app.mailer.Send(newUser.Email, "user_welcome.tmpl", emailData)
-		if err != nil {
-			app.logger.Error("Error sending welcome email", zap.Error(err))
-		}
-
-	})
-
 	// Return success response - NO TOKEN GENERATION for new users
 	response := envelope{
 		"message": "Account created successfully! Please check your email to activate your account.",
@@ -478,8 +760,9 @@ func (app *application) handleOAuthSignup(w http.ResponseWriter, r *http.Request
 	}
 }
 
-// handleOAuthLogin handles authentication for existing users
-func (app *application) handleOAuthLogin(w http.ResponseWriter, r *http.Request, user *data.User) {
+// handleUserLogin signs in an existing user, whether they proved who they are through a
+// provider or with their password
+func (app *application) handleUserLogin(w http.ResponseWriter, r *http.Request, user *data.User) {
 	app.logger.Info("Existing user attempting login", zap.String("email", user.Email), zap.Int64("user_id", user.ID))
 
 	// Check if user is activated
@@ -500,8 +783,8 @@ func (app *application) handleOAuthLogin(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	// Generate authentication token using our modular helper
-	token, err := app.generateUserAuthenticationToken(user)
+	// Start a new session, any other sessions the user has stay signed in
+	sessionTokens, err := app.startUserSession(user, r)
 	if err != nil {
 		app.logger.Error("Error generating authentication token", zap.Error(err))
 		app.serverErrorResponse(w, r, err)
@@ -519,10 +802,9 @@ func (app *application) handleOAuthLogin(w http.ResponseWriter, r *http.Request,
 			"last_name":  user.LastName,
 			"activated":  user.Activated,
 		},
-		"authentication_token": envelope{
-			"token":  token.Plaintext,
-			"expiry": token.Expiry,
-		},
+		"authentication_token": sessionTokens.AuthenticationToken,
+		"refresh_token":        sessionTokens.RefreshToken,
+		"session":              sessionTokens.Session,
 	}
 
 	err = app.writeJSON(w, http.StatusOK, response, nil)
@@ -532,62 +814,71 @@ func (app *application) handleOAuthLogin(w http.ResponseWriter, r *http.Request,
 	}
 }
 
-// generateAndPrintOAuthURL creates a fresh OAuth URL and prints it to the console
-// This is called at server startup for easy copy-paste during development
+// generateAndPrintOAuthURL prints where to start a login with the default provider
+// This is called at server startup for easy copy-paste during development. A provider URL
+// can't be printed, the callback only accepts a login in the browser that started it, so the
+// start endpoint is opened in the browser instead and sets the cookie that ties the login to it.
 func (app *application) generateAndPrintOAuthURL() {
-	// Generate a more secure state parameter for CSRF protection
-	state := fmt.Sprintf("savanna_%d_%s", time.Now().Unix(), generateSecureToken(16))
-
-	// Generate the OAuth URL with additional parameters for a more robust flow
-	authURL := app.config.authenticators.oauthConfig.AuthCodeURL(state,
-		oauth2.AccessTypeOffline,
-		oauth2.SetAuthURLParam("prompt", "consent"), // Force consent screen to ensure fresh tokens
-		oauth2.SetAuthURLParam("include_granted_scopes", "true"),
-	)
-
-	// Print to console with clear formatting
-	app.logger.Info("🔗 OAuth Authentication URL Generated")
-	app.logger.Info("📋 Copy and paste this URL into your browser to test OAuth:")
-	app.logger.Info("🌐 " + authURL)
-	app.logger.Info("💡 This URL is fresh and ready to use!")
-	app.logger.Info("🔒 State parameter for CSRF protection: " + state)
+	provider, ok := app.defaultOIDCProvider()
+	if !ok {
+		return
+	}
+	startURL := app.config.app_urls.authentication_callback_url + "/start"
+
+	app.logger.Info("🔗 OAuth login start URL", zap.String("provider", provider.id))
+	app.logger.Info("📋 Open this URL in your browser, then follow its authorization_url:")
+	app.logger.Info("🌐 " + startURL)
 
 	// Also print without logger formatting for easy copy-paste
 	fmt.Println("\n" + strings.Repeat("=", 80))
-	fmt.Println("🚀 SAVANNACART OAUTH URL - Ready for Testing!")
+	fmt.Println("🚀 SAVANNACART OAUTH LOGIN - Ready for Testing!")
 	fmt.Println(strings.Repeat("=", 80))
-	fmt.Println("Copy this URL to your browser:")
+	fmt.Println("Open this URL in your browser, then follow its authorization_url:")
 	fmt.Println()
-	fmt.Println(authURL)
+	fmt.Println(startURL)
 	fmt.Println()
-	fmt.Printf("State: %s\n", state)
 	fmt.Println(strings.Repeat("=", 80))
 }
 
-// generateSecureToken creates a cryptographically secure random token
-func generateSecureToken(length int) string {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = charset[time.Now().UnixNano()%int64(len(charset))]
+// sendUserActivation replaces any activation tokens the user has with a new one and emails
+// them the link to activate their account with.
+func (app *application) sendUserActivation(user *data.User) error {
+	err := app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+	if err != nil {
+		return err
 	}
-	return string(b)
-}
-
-// generateUserAuthenticationToken generates a new authentication token for a user
-// This is a helper function to keep token generation logic modular and reusable
-func (app *application) generateUserAuthenticationToken(user *data.User) (*data.Token, error) {
-	// Delete any existing authentication tokens for this user
-	err := app.models.Tokens.DeleteAllForUser(data.ScopeAuthentication, user.ID)
+	activationToken, err := app.models.Tokens.New(user.ID, data.DefaultTokenExpiryTime, data.ScopeActivation)
 	if err != nil {
-		return nil, fmt.Errorf("failed to delete existing tokens: %w", err)
+		return err
 	}
 
-	// Generate a new authentication token with default expiry
-	token, err := app.models.Tokens.New(user.ID, data.DefaultTokenExpiryTime, data.ScopeAuthentication)
+	app.background(func() {
+		// Send activation email
+		activationURL := fmt.Sprintf("%s?token=%s", app.config.app_urls.activation_callback_url, activationToken.Plaintext)
+		emailData := map[string]any{
+			"activationURL": activationURL,
+			"firstName":     user.FirstName,
+			"lastName":      user.LastName,
+			"userID":        user.ID,
+		}
+		err := app.mailer.Send(user.Email, app.userEmailTemplate(user.ID, "user_welcome.tmpl"), emailData)
+		if err != nil {
+			app.logger.Error("Error sending welcome email", zap.Error(err))
+		}
+	})
+	return nil
+}
+
+// startUserSession starts a new session for a user on the device making the request and
+// returns its authentication and refresh tokens. The user's other sessions are left alone,
+// so logging in on one device doesn't log them out everywhere else.
+func (app *application) startUserSession(user *data.User, r *http.Request) (*data.SessionTokens, error) {
+	sessionTokens, err := app.models.Sessions.New(user.ID, data.SessionMetadata{
+		UserAgent: r.UserAgent(),
+		IPAddress: realip.FromRequest(r),
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate new token: %w", err)
+		return nil, fmt.Errorf("failed to start session: %w", err)
 	}
-
-	return token, nil
+	return sessionTokens, nil
 }
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/data"
+	"go.uber.org/zap"
+)
+
+const (
+	testOIDCClientID = "savannacart-test"
+	testOIDCCode     = "test-authorization-code"
+)
+
+// testOIDCProvider is a local stand-in for an OpenID Connect provider. It serves discovery,
+// its signing keys and a token endpoint that only accepts testOIDCCode together with the PKCE
+// verifier it expects, and answers with an ID token for the configured email.
+type testOIDCProvider struct {
+	*httptest.Server
+	key          *rsa.PrivateKey
+	codeVerifier string
+	email        string
+}
+
+func newTestOIDCProvider(t *testing.T, codeVerifier, email string) *testOIDCProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate signing key: %v", err)
+	}
+	p := &testOIDCProvider{key: key, codeVerifier: codeVerifier, email: email}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                p.URL,
+			"authorization_endpoint":                p.URL + "/authorize",
+			"token_endpoint":                        p.URL + "/token",
+			"jwks_uri":                              p.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil ||
+			r.PostForm.Get("code") != testOIDCCode ||
+			r.PostForm.Get("code_verifier") != p.codeVerifier {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid_grant"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "test-access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     p.idToken(t),
+		})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// idToken() returns an RS256 signed ID token for the provider's user.
+func (p *testOIDCProvider) idToken(t *testing.T) string {
+	t.Helper()
+
+	encode := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("Failed to encode token part: %v", err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	now := time.Now()
+	signingInput := encode(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"}) + "." + encode(map[string]any{
+		"iss":            p.URL,
+		"aud":            testOIDCClientID,
+		"sub":            "test-subject",
+		"email":          p.email,
+		"email_verified": true,
+		"name":           "Test User",
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	})
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign ID token: %v", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// createTestOIDCApp builds a test application that signs users in through the given provider.
+func createTestOIDCApp(t *testing.T, provider *testOIDCProvider) *application {
+	t.Helper()
+
+	app := createTestApp(t)
+	app.logger = zap.NewNop()
+	app.config.api.oidc_client_id = testOIDCClientID
+	app.config.api.oidc_client_secret = "test-secret"
+	app.config.app_urls.provide_url = provider.URL
+	app.config.app_urls.authentication_callback_url = "http://localhost:4000/v1/api/authentication"
+	if err := app.InitOIDC(); err != nil {
+		t.Fatalf("Failed to initialise OIDC against the test provider: %v", err)
+	}
+	return app
+}
+
+func TestOAuthAuthCodeURL(t *testing.T) {
+	provider := newTestOIDCProvider(t, "", "")
+	app := createTestOIDCApp(t, provider)
+	google, _ := app.defaultOIDCProvider()
+	oauthState := &data.OAuthState{State: "test-state", CodeVerifier: "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"}
+
+	authURL, err := url.Parse(google.authCodeURL(oauthState))
+	if err != nil {
+		t.Fatalf("Failed to parse authorization URL: %v", err)
+	}
+	query := authURL.Query()
+
+	if !strings.HasPrefix(authURL.String(), provider.URL+"/authorize") {
+		t.Errorf("Expected the provider's authorization endpoint, got %s", authURL)
+	}
+	if query.Get("state") != oauthState.State {
+		t.Errorf("Expected state %q, got %q", oauthState.State, query.Get("state"))
+	}
+	// The example verifier and challenge from RFC 7636 appendix B
+	if query.Get("code_challenge") != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" || query.Get("code_challenge_method") != "S256" {
+		t.Errorf("Unexpected PKCE challenge %q (%s)", query.Get("code_challenge"), query.Get("code_challenge_method"))
+	}
+	if query.Get("code_verifier") != "" {
+		t.Error("The code verifier must never be sent to the authorization endpoint")
+	}
+}
+
+func TestExchangeOAuthCode(t *testing.T) {
+	const codeVerifier = "x3k2JqQ0c4m8yJ5u1Zr7TnVb6PwLs9Dh-Ae_Gf0HiKo"
+	provider := newTestOIDCProvider(t, codeVerifier, "jane@example.com")
+	app := createTestOIDCApp(t, provider)
+	google, _ := app.defaultOIDCProvider()
+
+	t.Run("matching verifier", func(t *testing.T) {
+		claims, err := app.exchangeOAuthCode(context.Background(), google, testOIDCCode, codeVerifier)
+		if err != nil {
+			t.Fatalf("Failed to exchange code: %v", err)
+		}
+		if claims.Email != "jane@example.com" || claims.Subject != "test-subject" {
+			t.Errorf("Unexpected claims: %+v", claims)
+		}
+	})
+
+	t.Run("wrong verifier", func(t *testing.T) {
+		_, err := app.exchangeOAuthCode(context.Background(), google, testOIDCCode, "someone-elses-verifier")
+		if !errors.Is(err, ErrInvalidAuthentication) {
+			t.Errorf("Expected ErrInvalidAuthentication, got %v", err)
+		}
+	})
+
+	t.Run("wrong code", func(t *testing.T) {
+		_, err := app.exchangeOAuthCode(context.Background(), google, "stolen-code", codeVerifier)
+		if !errors.Is(err, ErrInvalidAuthentication) {
+			t.Errorf("Expected ErrInvalidAuthentication, got %v", err)
+		}
+	})
+}
+
+func TestAuthenticationCallbackRequiresState(t *testing.T) {
+	provider := newTestOIDCProvider(t, "", "")
+	app := createTestOIDCApp(t, provider)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/v1/api/authentication?code="+testOIDCCode, nil)
+	app.createAuthenticationApiKeyHandler(w, r)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status %d, got %d: %s", http.StatusUnprocessableEntity, w.Code, w.Body.String())
+	}
+}
+
+func TestAuthenticationCallbackFromAnotherBrowser(t *testing.T) {
+	provider := newTestOIDCProvider(t, "", "")
+	app := createTestOIDCApp(t, provider)
+
+	// the attacker started the login in their own browser and signed in with their account,
+	// the victim may have a login of their own in progress
+	attackerState := "attacker-state"
+	victimState := &data.OAuthState{State: "victim-state", Expiry: time.Now().Add(data.DefaultOAuthStateTTL)}
+	w := httptest.NewRecorder()
+	setOAuthStateCookie(w, victimState)
+	victimCookie := w.Result().Cookies()[0]
+
+	tests := []struct {
+		name    string
+		cookies []*http.Cookie
+	}{
+		{"no cookie", nil},
+		{"cookie of another login", []*http.Cookie{victimCookie}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the victim opens the callback URL the attacker sent them
+			r := httptest.NewRequest(http.MethodGet, "/v1/api/authentication?code="+testOIDCCode+"&state="+attackerState, nil)
+			for _, cookie := range tt.cookies {
+				r.AddCookie(cookie)
+			}
+			w := httptest.NewRecorder()
+
+			app.createAuthenticationApiKeyHandler(w, r)
+
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("Expected status %d, got %d: %s", http.StatusUnauthorized, w.Code, w.Body.String())
+			}
+			// the victim's own login isn't broken by it
+			if cookies := w.Result().Cookies(); len(cookies) != 0 {
+				t.Errorf("Expected the victim's cookie to be left alone, got %+v", cookies)
+			}
+		})
+	}
+}
+
+func TestOAuthStateCookie(t *testing.T) {
+	oauthState := &data.OAuthState{State: "link-state", Expiry: time.Now().Add(data.DefaultOAuthStateTTL)}
+	w := httptest.NewRecorder()
+	setOAuthStateCookie(w, oauthState)
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Expected a single cookie, got %d", len(cookies))
+	}
+	cookie := cookies[0]
+	if !cookie.HttpOnly || !cookie.Secure || cookie.Path != oauthStateCookiePath || cookie.MaxAge <= 0 {
+		t.Errorf("Expected a short lived HttpOnly cookie for the callback, got %+v", cookie)
+	}
+
+	callback := func(cookies ...*http.Cookie) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/v1/api/authentication?state="+oauthState.State, nil)
+		for _, cookie := range cookies {
+			r.AddCookie(cookie)
+		}
+		return r
+	}
+	if !oauthStartedHere(callback(cookie), oauthState.State) {
+		t.Error("Expected the browser that started the login to be accepted")
+	}
+	// someone else's browser, or the cookie of another login
+	if oauthStartedHere(callback(), oauthState.State) {
+		t.Error("Expected a browser without the cookie to be rejected")
+	}
+	if oauthStartedHere(callback(cookie), "other-state") {
+		t.Error("Expected the cookie of another login to be rejected")
+	}
+
+	w = httptest.NewRecorder()
+	clearOAuthStateCookie(w)
+	if cleared := w.Result().Cookies(); len(cleared) != 1 || cleared[0].MaxAge >= 0 {
+		t.Errorf("Expected the cookie to be removed, got %+v", cleared)
+	}
+}
+
+func TestParseOIDCProviders(t *testing.T) {
+	env := map[string]string{
+		"SAVANNACART_OIDC_MICROSOFT_CLIENT_ID":     "microsoft-client",
+		"SAVANNACART_OIDC_MICROSOFT_CLIENT_SECRET": "microsoft-secret",
+	}
+	getenv := func(key string) string { return env[key] }
+
+	tests := []struct {
+		name    string
+		spec    string
+		want    []oidcProviderConfig
+		wantErr bool
+	}{
+		{"none", "", nil, false},
+		{
+			"one provider",
+			"microsoft=https://login.microsoftonline.com/tenant/v2.0",
+			[]oidcProviderConfig{{
+				id:           "microsoft",
+				issuerURL:    "https://login.microsoftonline.com/tenant/v2.0",
+				clientID:     "microsoft-client",
+				clientSecret: "microsoft-secret",
+				redirectURL:  "http://localhost:4000/v1/api/authentication/providers/microsoft",
+			}},
+			false,
+		},
+		{
+			"credentials missing from the environment",
+			"keycloak=https://sso.example.com/realms/savannacart",
+			[]oidcProviderConfig{{
+				id:          "keycloak",
+				issuerURL:   "https://sso.example.com/realms/savannacart",
+				redirectURL: "http://localhost:4000/v1/api/authentication/providers/keycloak",
+			}},
+			false,
+		},
+		{"missing issuer", "microsoft", nil, true},
+		{"relative issuer", "microsoft=/v2.0", nil, true},
+		{"uppercase ID", "Microsoft=https://login.microsoftonline.com/tenant/v2.0", nil, true},
+		{"ID with a slash", "a/b=https://issuer.example.com", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseOIDCProviders(tt.spec, "http://localhost:4000/v1/api/authentication/", getenv)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error=%v, got %v", tt.wantErr, err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestInitOIDCRegistersEveryProvider(t *testing.T) {
+	google := newTestOIDCProvider(t, "google-verifier", "jane@gmail.example")
+	keycloak := newTestOIDCProvider(t, "keycloak-verifier", "jane@corp.example")
+	t.Setenv("SAVANNACART_OIDC_KEYCLOAK_CLIENT_ID", testOIDCClientID)
+	t.Setenv("SAVANNACART_OIDC_KEYCLOAK_CLIENT_SECRET", "keycloak-secret")
+
+	app := createTestApp(t)
+	app.logger = zap.NewNop()
+	app.config.api.oidc_client_id = testOIDCClientID
+	app.config.api.oidc_client_secret = "test-secret"
+	app.config.app_urls.provide_url = google.URL
+	app.config.app_urls.authentication_callback_url = "http://localhost:4000/v1/api/authentication"
+	app.config.authenticators.extraProviders = "keycloak=" + keycloak.URL
+	if err := app.InitOIDC(); err != nil {
+		t.Fatalf("Failed to initialise OIDC: %v", err)
+	}
+
+	if !slices.Equal(app.config.authenticators.providerIDs, []string{"google", "keycloak"}) {
+		t.Fatalf("Unexpected providers %v", app.config.authenticators.providerIDs)
+	}
+	if provider, _ := app.defaultOIDCProvider(); provider.id != "google" {
+		t.Errorf("Expected google to be the default provider, got %s", provider.id)
+	}
+	registered := app.config.authenticators.providers["keycloak"]
+	if registered.oauthConfig.RedirectURL != "http://localhost:4000/v1/api/authentication/providers/keycloak" {
+		t.Errorf("Unexpected redirect URL %s", registered.oauthConfig.RedirectURL)
+	}
+
+	// Each provider exchanges codes with its own issuer
+	claims, err := app.exchangeOAuthCode(context.Background(), registered, testOIDCCode, "keycloak-verifier")
+	if err != nil {
+		t.Fatalf("Failed to exchange code with keycloak: %v", err)
+	}
+	if claims.Email != "jane@corp.example" {
+		t.Errorf("Expected the keycloak account, got %s", claims.Email)
+	}
+
+	// and never accepts ID tokens issued by another
+	if _, err := registered.verifier.Verify(context.Background(), google.idToken(t)); err == nil {
+		t.Error("Expected keycloak to reject an ID token issued by google")
+	}
+}
+
+func TestInitOIDCRejectsBadConfiguration(t *testing.T) {
+	provider := newTestOIDCProvider(t, "", "")
+
+	tests := []struct {
+		name           string
+		clientSecret   string
+		extraProviders string
+	}{
+		{"no providers", "generic-secret", ""},
+		{"missing client secret", "", "generic=" + provider.URL},
+		{"configured twice", "generic-secret", "generic=" + provider.URL + " generic=" + provider.URL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SAVANNACART_OIDC_GENERIC_CLIENT_ID", testOIDCClientID)
+			t.Setenv("SAVANNACART_OIDC_GENERIC_CLIENT_SECRET", tt.clientSecret)
+			app := createTestApp(t)
+			app.config.authenticators.extraProviders = tt.extraProviders
+			if err := app.InitOIDC(); err == nil {
+				t.Error("Expected InitOIDC to fail")
+			}
+		})
+	}
+}
+
+func TestAuthenticationUnknownProvider(t *testing.T) {
+	provider := newTestOIDCProvider(t, "", "")
+	app := createTestOIDCApp(t, provider)
+
+	handlers := map[string]http.HandlerFunc{
+		"start":    app.startAuthenticationHandler,
+		"callback": app.createAuthenticationApiKeyHandler,
+		"link":     app.linkUserIdentityHandler,
+	}
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			r := newAuthenticatedRequest(app, http.MethodGet, "/v1/api/authentication/providers/unknown?state=abc", "", 7,
+				map[string]string{"providerID": "unknown"})
+			w := httptest.NewRecorder()
+
+			handler(w, r)
+
+			if w.Code != http.StatusNotFound {
+				t.Errorf("Expected status %d, got %d: %s", http.StatusNotFound, w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/data"
+	"github.com/Blue-Davinci/SavannaCart/internal/validator"
+)
+
+// getCartHandler() handles requests to get the authenticated user's cart.
+// The cart is always priced at the current product prices and stock levels.
+func (app *application) getCartHandler(w http.ResponseWriter, r *http.Request) {
+	cart, err := app.models.Carts.GetCart(int32(app.contextGetUser(r).ID))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"cart": cart}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// addCartItemHandler() handles requests to add a product to the user's cart.
+// It expects a JSON body with a product ID and quantity. Adding a product that is
+// already in the cart increases its quantity.
+func (app *application) addCartItemHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ProductID int32 `json:"product_id"`
+		Quantity  int32 `json:"quantity"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	// validate the input
+	v := validator.New()
+	if data.ValidateCartItem(v, input.ProductID, input.Quantity); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	cart, err := app.models.Carts.AddItem(int32(app.contextGetUser(r).ID), input.ProductID, input.Quantity)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			v.AddError("product_id", "product not found")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrInsufficientStock):
+			v.AddError("quantity", "not enough stock to add this quantity")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"cart": cart}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateCartItemHandler() handles requests to change the quantity of a product in the user's cart.
+// It expects the product ID in the URL and the new quantity in the JSON body.
+func (app *application) updateCartItemHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := app.readIDParam(r, "productID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		Quantity int32 `json:"quantity"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	// validate the input
+	v := validator.New()
+	if data.ValidateCartItem(v, int32(productID), input.Quantity); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	cart, err := app.models.Carts.UpdateItemQuantity(int32(app.contextGetUser(r).ID), int32(productID), input.Quantity)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrCartItemNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrInsufficientStock):
+			v.AddError("quantity", "not enough stock for this quantity")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"cart": cart}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// removeCartItemHandler() handles requests to remove a product from the user's cart.
+func (app *application) removeCartItemHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := app.readIDParam(r, "productID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	cart, err := app.models.Carts.RemoveItem(int32(app.contextGetUser(r).ID), int32(productID))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrCartItemNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"cart": cart}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// clearCartHandler() handles requests to empty the user's cart.
+func (app *application) clearCartHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.models.Carts.ClearCart(int32(app.contextGetUser(r).ID))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "cart cleared successfully"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkoutCartHandler() handles requests to turn the user's cart into an order.
+// The order is created with the same stock checks as createOrderHandler and the cart
+// is only emptied once the order has been placed.
+func (app *application) checkoutCartHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	order, err := app.models.Carts.Checkout(int32(app.contextGetUser(r).ID))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEmptyCart):
+			v.AddError("cart", err.Error())
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrInsufficientStock):
+			v.AddError("items", err.Error())
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			v.AddError("items", "one or more products not found")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"order": order}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -54,6 +54,51 @@ func (app *application) getAllCategoriesHandler(w http.ResponseWriter, r *http.R
 
 }
 
+// getCategoryTreeHandler() returns every category nested under its parent, for the storefront's
+// category menus. Each category has a children list, empty for the ones without subcategories.
+func (app *application) getCategoryTreeHandler(w http.ResponseWriter, r *http.Request) {
+	tree, err := app.models.Categories.GetCategoryTree()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"categories": tree}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getCategoryBreadcrumbsHandler() returns the categories from the root down to the one in the
+// URL, so the storefront can show where a category sits in the tree.
+func (app *application) getCategoryBreadcrumbsHandler(w http.ResponseWriter, r *http.Request) {
+	// get id from url
+	categoryID, err := app.readIDParam(r, "categoryID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// validate the category ID
+	v := validator.New()
+	if data.ValidateURLID(v, categoryID, "categoryID"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	breadcrumbs, err := app.models.Categories.GetCategoryBreadcrumbs(int32(categoryID))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"breadcrumbs": breadcrumbs}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
 // createNewCategoryHandler() handles the request to create a new category.
 func (app *application) createNewCategoryHandler(w http.ResponseWriter, r *http.Request) {
 	// we expect a name and optional parent_id
@@ -204,6 +249,9 @@ func (app *application) updateCategoryHandler(w http.ResponseWriter, r *http.Req
 		case errors.Is(err, data.ErrDuplicateCategoryName):
 			v.AddError("name", "a category with this name already exists")
 			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrCategoryCycle):
+			v.AddError("parent_id", "must not be one of the category's own subcategories")
+			app.failedValidationResponse(w, r, v.Errors)
 		case errors.Is(err, data.ErrGeneralRecordNotFound):
 			app.notFoundResponse(w, r)
 		default:
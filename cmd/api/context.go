@@ -15,6 +15,14 @@ type contextKey string
 // in the request context.
 const userContextKey = contextKey("user")
 
+// permissionsContextKey holds the authenticated user's permissions once they have been
+// loaded, so requests that pass through more than one permission check only look them up once.
+const permissionsContextKey = contextKey("permissions")
+
+// apiKeyContextKey holds the API key a request was authenticated with, requests made with a
+// session token don't have one.
+const apiKeyContextKey = contextKey("api_key")
+
 // The contextSetUser() method returns a new copy of the request with the provided
 // User struct added to the context. Note that we use our userContextKey constant as the
 // key.
@@ -34,3 +42,32 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 	}
 	return user
 }
+
+// contextSetPermissions() returns a new copy of the request with the user's permissions
+// added to the context.
+func (app *application) contextSetPermissions(r *http.Request, permissions data.Permissions) *http.Request {
+	ctx := context.WithValue(r.Context(), permissionsContextKey, permissions)
+	return r.WithContext(ctx)
+}
+
+// contextGetPermissions() retrieves the user's permissions from the request context. Unlike
+// the user, they are only present once a permission check has loaded them, so the second
+// return value reports whether they were found.
+func (app *application) contextGetPermissions(r *http.Request) (data.Permissions, bool) {
+	permissions, ok := r.Context().Value(permissionsContextKey).(data.Permissions)
+	return permissions, ok
+}
+
+// contextSetAPIKey() returns a new copy of the request with the API key it was
+// authenticated with added to the context.
+func (app *application) contextSetAPIKey(r *http.Request, apiKey *data.APIKey) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, apiKey)
+	return r.WithContext(ctx)
+}
+
+// contextGetAPIKey() retrieves the API key the request was authenticated with. The second
+// return value is false for requests authenticated with a session token.
+func (app *application) contextGetAPIKey(r *http.Request) (*data.APIKey, bool) {
+	apiKey, ok := r.Context().Value(apiKeyContextKey).(*data.APIKey)
+	return apiKey, ok
+}
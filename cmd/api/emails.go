@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/data"
+	"github.com/Blue-Davinci/SavannaCart/internal/mailer"
+	"github.com/Blue-Davinci/SavannaCart/internal/validator"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// userEmailTemplate() returns the template to email the user with, in the language they picked.
+// Emails still go out in English when their preferences can't be read.
+func (app *application) userEmailTemplate(userID int64, templateFile string) string {
+	preferences, err := app.models.NotificationPreferences.Get(userID)
+	if err != nil {
+		app.logger.Warn("Error getting the user's language, emailing them in English", zap.Int64("user_id", userID), zap.Error(err))
+		return templateFile
+	}
+	return mailer.LocalizedTemplate(preferences.Language, templateFile)
+}
+
+// listEmailTemplatesHandler() returns the names of the email templates and the languages they
+// can be previewed in.
+func (app *application) listEmailTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	templates, err := mailer.Templates()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	locales, err := mailer.Locales()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"templates": templates, "locales": locales}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// previewEmailTemplateHandler() renders an email template with sample data, in the language
+// asked for with ?locale=. The email is returned as JSON, or just its HTML or plain text body
+// with ?format=html or ?format=text so it can be opened in a browser. Order emails can be
+// previewed for every status with ?status=.
+func (app *application) previewEmailTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	templateName := chi.URLParam(r, "templateName")
+	var input struct {
+		Locale string
+		Format string
+		Status string
+	}
+	qs := r.URL.Query()
+	input.Locale = app.readString(qs, "locale", data.LanguageEnglish)
+	input.Format = app.readString(qs, "format", "json")
+	input.Status = strings.ToUpper(app.readString(qs, "status", data.OrderStatusShipped))
+
+	v := validator.New()
+	data.ValidateLanguage(v, input.Locale)
+	data.ValidateOrderStatus(v, input.Status)
+	v.Check(validator.PermittedValue(input.Format, "json", "html", "text"), "format", "must be json, html or text")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	email, err := mailer.Render(mailer.LocalizedTemplate(input.Locale, templateName), app.emailTemplateSampleData(input.Status))
+	if err != nil {
+		switch {
+		case errors.Is(err, mailer.ErrTemplateNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	switch input.Format {
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(email.HTMLBody))
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(email.Subject + "\n\n" + email.PlainBody))
+	default:
+		err = app.writeJSON(w, http.StatusOK, envelope{"email": email, "locale": input.Locale}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+// emailTemplateSampleData() returns made up data with every value our templates use, for
+// previewing them. Order emails are about an order with the given status.
+func (app *application) emailTemplateSampleData(status string) map[string]any {
+	orderDate := time.Date(2025, time.March, 14, 10, 30, 0, 0, time.UTC)
+	sample := map[string]any{
+		// account emails
+		"firstName":     "Wanjiru",
+		"lastName":      "Kamau",
+		"userID":        1,
+		"activationURL": fmt.Sprintf("%s?token=SAMPLEACTIVATIONTOKEN", app.config.app_urls.activation_callback_url),
+		"loginURL":      app.config.app_urls.authentication_callback_url,
+		"resetURL":      fmt.Sprintf("%s?token=SAMPLERESETTOKEN", app.config.app_urls.password_reset_url),
+		"minutes":       int(data.DefaultPasswordResetTokenExpiryTime.Minutes()),
+		// order emails
+		"orderID":     1024,
+		"status":      status,
+		"statusLower": strings.ToLower(status),
+		"totalAmount": "4750.00",
+		"orderDate":   orderDate.Format("January 2, 2006"),
+		"items": []map[string]any{
+			{"productName": "Kikoi Beach Towel", "quantity": 2, "unitPrice": "1250.00", "totalPrice": "2500.00"},
+			{"productName": "Kenyan AA Coffee, 500g", "quantity": 1, "unitPrice": "2250.00", "totalPrice": "2250.00"},
+		},
+		"unsubscribeURL": fmt.Sprintf("%s?token=SAMPLEUNSUBSCRIBETOKEN", app.config.app_urls.unsubscribe_url),
+		// the admin's new order email
+		"customerFirstName": "Wanjiru",
+		"customerLastName":  "Kamau",
+		"customerEmail":     "wanjiru@example.com",
+		"customerPhone":     "+254712345678",
+		"dashboardURL":      "https://admin.savannacart.com",
+		"currentYear":       orderDate.Year(),
+		// the admin's payment review email
+		"orderStatus":   status,
+		"paymentID":     2048,
+		"paymentAmount": "4750.00",
+		"paymentPhone":  "254712345678",
+		"receiptNumber": "SAMPLE1234",
+		"reviewReason":  "amount mismatch: expected 4750.00, received 4700.00",
+	}
+	// like the real emails, only shipped orders have a tracking link
+	if status == data.OrderStatusShipped {
+		sample["trackingURL"] = "https://track.savannacart.com/order/1024"
+	}
+	return sample
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPreviewEmailTemplateHandler(t *testing.T) {
+	tests := []struct {
+		name            string
+		templateName    string
+		query           string
+		expectedStatus  int
+		expectedType    string
+		expectedContent string
+	}{
+		{"json", "user_welcome.tmpl", "", http.StatusOK, "application/json", "Welcome to SavannaCart!"},
+		{"html", "user_password_reset.tmpl", "?format=html", http.StatusOK, "text/html; charset=utf-8", "<html"},
+		{"text", "order_status_update.tmpl", "?format=text&status=paid", http.StatusOK, "text/plain; charset=utf-8", "Order #1024 is PAID"},
+		{"swahili", "order_status_update.tmpl", "?locale=sw", http.StatusOK, "application/json", "Imesafirishwa"},
+		{"untranslated falls back to english", "admin_order_notification.tmpl", "?locale=sw", http.StatusOK, "application/json", "Wanjiru"},
+		{"payment review", "admin_payment_review.tmpl", "?format=text", http.StatusOK, "text/plain; charset=utf-8", "M-Pesa receipt: SAMPLE1234"},
+		{"unknown template", "missing.tmpl", "", http.StatusNotFound, "", ""},
+		{"outside the templates", "..%2Fmailer.go", "", http.StatusNotFound, "", ""},
+		{"unsupported locale", "user_welcome.tmpl", "?locale=fr", http.StatusUnprocessableEntity, "", ""},
+		{"unknown format", "user_welcome.tmpl", "?format=pdf", http.StatusUnprocessableEntity, "", ""},
+		{"unknown status", "order_status_update.tmpl", "?status=LOST", http.StatusUnprocessableEntity, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := createTestApp(t)
+			r := newAuthenticatedRequest(app, http.MethodGet, "/v1/admin/email-templates/"+tt.templateName+tt.query, "", 1,
+				map[string]string{"templateName": tt.templateName})
+			w := httptest.NewRecorder()
+
+			app.previewEmailTemplateHandler(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedType != "" && w.Header().Get("Content-Type") != tt.expectedType {
+				t.Errorf("Expected content type %q, got %q", tt.expectedType, w.Header().Get("Content-Type"))
+			}
+			if !strings.Contains(w.Body.String(), tt.expectedContent) {
+				t.Errorf("Expected body to contain %q, got %s", tt.expectedContent, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestListEmailTemplatesHandler(t *testing.T) {
+	app := createTestApp(t)
+	r := newAuthenticatedRequest(app, http.MethodGet, "/v1/admin/email-templates", "", 1, nil)
+	w := httptest.NewRecorder()
+
+	app.listEmailTemplatesHandler(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response struct {
+		Templates []string `json:"templates"`
+		Locales   []string `json:"locales"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Templates) != 6 {
+		t.Errorf("Expected 6 templates, got %v", response.Templates)
+	}
+	if strings.Join(response.Locales, ",") != "en,sw" {
+		t.Errorf("Expected locales en and sw, got %v", response.Locales)
+	}
+}
@@ -89,6 +89,13 @@ func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *htt
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
 }
 
+// The invalidOAuthStateResponse() method is used when an OAuth callback carries a state we
+// didn't issue, or one that has already been used or has expired.
+func (app *application) invalidOAuthStateResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid or expired login state, please start the login again"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
 // The notFoundResponse() method will be used to send a 404 Not Found status code and
 // JSON response to the client.
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
@@ -14,6 +14,7 @@ import (
 	"github.com/Blue-Davinci/SavannaCart/internal/data"
 	"github.com/Blue-Davinci/SavannaCart/internal/validator"
 	"github.com/go-chi/chi/v5"
+	"github.com/shopspring/decimal"
 )
 
 var (
@@ -232,6 +233,44 @@ func (app *application) readBoolean(qs url.Values, key string, defaultValue bool
 	return b
 }
 
+// paginationHeaders() returns the headers of a page of a listing, with a Link header pointing at
+// the next page when there is one. The next page keeps the request's filters and continues
+// after the page's cursor instead of a page number.
+func (app *application) paginationHeaders(r *http.Request, metadata data.Metadata) http.Header {
+	headers := make(http.Header)
+	if metadata.NextCursor == "" {
+		return headers
+	}
+	qs := r.URL.Query()
+	qs.Del("page")
+	qs.Set("cursor", metadata.NextCursor)
+	next := url.URL{Path: r.URL.Path, RawQuery: qs.Encode()}
+	headers.Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+	return headers
+}
+
+// readDecimal() reads a string value from the query string and converts it to a decimal,
+// such as a price, before returning. If no matching key could be found it returns the provided
+// default value. If the value couldn't be converted to a decimal, then we record an error
+// message in the provided Validator instance.
+func (app *application) readDecimal(qs url.Values, key string, defaultValue decimal.Decimal, v *validator.Validator) decimal.Decimal {
+	// Extract the value from the query string.
+	s := qs.Get(key)
+	// If no key exists (or the value is empty) then return the default value.
+	if s == "" {
+		return defaultValue
+	}
+	// Try to convert the value to a decimal. If this fails, add an error message to the
+	// validator instance and return the default value.
+	d, err := decimal.NewFromString(s)
+	if err != nil {
+		v.AddError(key, "must be a decimal value")
+		return defaultValue
+	}
+	// Otherwise, return the converted decimal value.
+	return d
+}
+
 // readDate() reads a string value from the query string and converts it to a time.Time
 // before returning. If no matching key could be found it returns the provided default value.
 // If the value couldn't be converted to a time.Time, then we record an error message in the
@@ -276,10 +315,11 @@ func validateURL(input string) error {
 }
 
 // aunthenticatorHelper() is a helper function for the authentication middleware
-// It takes in a request and returns a user and an error
+// It takes in a request and returns a user, the API key used if the request was made with
+// one, and an error.
 // It retrieves the value of the Authorization header from the request. This will
 // return the empty string "" if there is no such header found.
-func (app *application) aunthenticatorHelper(r *http.Request) (*data.User, error) {
+func (app *application) aunthenticatorHelper(r *http.Request) (*data.User, *data.APIKey, error) {
 	// Retrieve the value of the Authorization header from the request. This will
 	// return the empty string "" if there is no such header found.
 	authorizationHeader := r.Header.Get("Authorization")
@@ -288,7 +328,7 @@ func (app *application) aunthenticatorHelper(r *http.Request) (*data.User, error
 	// call the next handler in the chain and return without executing any of the
 	// code below.
 	if authorizationHeader == "" {
-		return data.AnonymousUser, nil
+		return data.AnonymousUser, nil, nil
 	}
 	// Otherwise, we expect the value of the Authorization header to be in the format
 	// "Bearer <token>". We try to split this into its constituent parts, and if the
@@ -296,11 +336,15 @@ func (app *application) aunthenticatorHelper(r *http.Request) (*data.User, error
 	// using the invalidAuthenticationTokenResponse() helper
 	headerParts := strings.Split(authorizationHeader, " ")
 	if len(headerParts) != 2 || headerParts[0] != "Bearer" {
-		return nil, ErrInvalidAuthentication
+		return nil, nil, ErrInvalidAuthentication
 	}
 	//app.logger.Info("Authentication header found", zap.String("header", authorizationHeader))
 	// Extract the actual authentication token from the header parts.
 	token := headerParts[1]
+	// Personal API keys are told apart from session tokens by their prefix
+	if strings.HasPrefix(token, data.APIKeyPrefix) {
+		return app.apiKeyAuthenticatorHelper(token)
+	}
 	//app.logger.Info("User id Connected", zap.String("Connected ID", token))
 	// Validate the token to make sure it is in a sensible format.
 	v := validator.New()
@@ -308,7 +352,7 @@ func (app *application) aunthenticatorHelper(r *http.Request) (*data.User, error
 	// helper to send a response, rather than the failedValidationResponse() helper
 	// that we'd normally use.
 	if data.ValidateTokenPlaintext(v, token); !v.Valid() {
-		return nil, ErrInvalidAuthentication
+		return nil, nil, ErrInvalidAuthentication
 	}
 	//app.logger.Info("Authentication token validated", zap.String("token", token))
 	// Retrieve the details of the user associated with the authentication token,
@@ -319,11 +363,63 @@ func (app *application) aunthenticatorHelper(r *http.Request) (*data.User, error
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrGeneralRecordNotFound):
-			return nil, ErrInvalidAuthentication
+			return nil, nil, ErrInvalidAuthentication
 		default:
-			return nil, ErrInvalidAuthentication
+			return nil, nil, ErrInvalidAuthentication
 		}
 	}
 	//app.logger.Info("[Auth Helper] User authenticated", zap.Int64("user_id", user.ID), zap.String("email", user.Email))
-	return user, nil
+	return user, nil, nil
+}
+
+// apiKeyAuthenticatorHelper() returns the owner of a personal API key along with the key.
+// Unknown, expired and revoked keys return ErrInvalidAuthentication.
+func (app *application) apiKeyAuthenticatorHelper(keyPlaintext string) (*data.User, *data.APIKey, error) {
+	v := validator.New()
+	if data.ValidateAPIKeyPlaintext(v, keyPlaintext); !v.Valid() {
+		return nil, nil, ErrInvalidAuthentication
+	}
+	apiKey, err := app.models.APIKeys.GetForKey(keyPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			return nil, nil, ErrInvalidAuthentication
+		default:
+			return nil, nil, err
+		}
+	}
+	user, err := app.models.Users.GetUserByID(apiKey.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, apiKey, nil
+}
+
+// bearerToken() returns the token from a "Bearer <token>" Authorization header, or the
+// empty string if the request doesn't have one.
+func (app *application) bearerToken(r *http.Request) string {
+	headerParts := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+		return ""
+	}
+	return headerParts[1]
+}
+
+// getUserPermissions() returns the permissions of the user making the request. If a
+// permission check has already loaded them they are taken from the request context,
+// otherwise they are read from the database. Requests made with an API key only get the
+// permissions the key was given that its owner still has.
+func (app *application) getUserPermissions(r *http.Request) (data.Permissions, error) {
+	if permissions, ok := app.contextGetPermissions(r); ok {
+		return permissions, nil
+	}
+	user := app.contextGetUser(r)
+	permissions, err := app.models.Permissions.GetAllPermissionsForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if apiKey, ok := app.contextGetAPIKey(r); ok {
+		permissions = permissions.Restrict(apiKey.Permissions)
+	}
+	return permissions, nil
 }
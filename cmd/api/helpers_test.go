@@ -6,6 +6,7 @@ import (
 	"net/url"
 	"testing"
 
+	"github.com/Blue-Davinci/SavannaCart/internal/data"
 	"github.com/Blue-Davinci/SavannaCart/internal/validator"
 	"github.com/go-chi/chi/v5"
 )
@@ -358,3 +359,30 @@ func TestValidateURL(t *testing.T) {
 		})
 	}
 }
+
+func TestPaginationHeaders(t *testing.T) {
+	app := createTestApp(t)
+
+	tests := []struct {
+		name     string
+		target   string
+		metadata data.Metadata
+		expected string
+	}{
+		{"last page", "/v1/orders?page=3", data.Metadata{CurrentPage: 3, LastPage: 3}, ""},
+		{"next page keeps the filters", "/v1/api/products?sort=-created_at&page=2&in_stock=true", data.Metadata{NextCursor: "abc.def"},
+			`</v1/api/products?cursor=abc.def&in_stock=true&sort=-created_at>; rel="next"`},
+		{"replaces the previous cursor", "/v1/orders?cursor=old.sig", data.Metadata{NextCursor: "new.sig"},
+			`</v1/orders?cursor=new.sig>; rel="next"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			headers := app.paginationHeaders(r, tt.metadata)
+			if got := headers.Get("Link"); got != tt.expected {
+				t.Errorf("Expected Link %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/data"
+)
+
+// listUserIdentitiesHandler() returns the providers the user can sign in with.
+func (app *application) listUserIdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	identities, err := app.models.Identities.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"identities": identities}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// linkUserIdentityHandler() starts an OAuth login that links the provider in the route to the
+// user's account. The user is sent to the returned URL and the provider's callback links the
+// account it returns instead of signing anyone in. A cookie ties the login to this browser,
+// the callback refuses to link from any other.
+func (app *application) linkUserIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.oidcProviderFromRequest(r)
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+	user := app.contextGetUser(r)
+
+	oauthState, err := app.models.OAuthStates.NewLink(provider.id, user.ID, data.DefaultOAuthStateTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	setOAuthStateCookie(w, oauthState)
+	response := envelope{
+		"authorization_url": provider.authCodeURL(oauthState),
+		"provider":          provider.id,
+		"expiry":            oauthState.Expiry,
+	}
+	err = app.writeJSON(w, http.StatusOK, response, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// unlinkUserIdentityHandler() removes a provider from the user's account. The last provider
+// of a user without a password can't be removed, they would have no way left to sign in.
+func (app *application) unlinkUserIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	identityID, err := app.readIDParam(r, "identityID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	user := app.contextGetUser(r)
+
+	err = app.models.Identities.Unlink(user.ID, identityID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrLastUserIdentity):
+			app.errorResponse(w, r, http.StatusConflict, "you cannot unlink the only way you can sign in, reset your password to set one first")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "provider unlinked successfully"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/data"
+	"go.uber.org/zap"
+)
+
+// startScheduledJobs() starts the jobs that run on a timer for as long as the server does.
+// They stop once ctx is cancelled.
+func (app *application) startScheduledJobs(ctx context.Context) {
+	app.startJob(ctx, "purge_expired_tokens", app.config.jobs.tokenPurgeInterval, app.purgeExpiredTokens)
+	app.startJob(ctx, "reconcile_pending_payments", app.config.jobs.paymentReconcileInterval, app.reconcilePendingPayments)
+	app.startNotificationWorkers(ctx)
+}
+
+// startJob() runs fn every interval in the background until ctx is cancelled. A run that is
+// in progress when the server shuts down is waited for like any other background task. An
+// interval of zero turns the job off.
+func (app *application) startJob(ctx context.Context, name string, interval time.Duration, fn func() error) {
+	if interval <= 0 {
+		app.logger.Info("scheduled job disabled", zap.String("job", name))
+		return
+	}
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				app.runJob(name, fn)
+			}
+		}
+	}()
+}
+
+// runJob() runs a single job, logging its error or panic so the next run still happens.
+func (app *application) runJob(name string, fn func() error) {
+	defer func() {
+		if err := recover(); err != nil {
+			app.logger.Error("scheduled job panicked", zap.String("job", name), zap.String("panic", fmt.Sprintf("%v", err)))
+		}
+	}()
+	err := fn()
+	if err != nil {
+		app.logger.Error("scheduled job failed", zap.String("job", name), zap.Error(err))
+	}
+}
+
+// purgeExpiredTokens() deletes the tokens that can no longer be used, such as activation
+// tokens nobody used and the authentication and refresh tokens of old sessions.
+func (app *application) purgeExpiredTokens() error {
+	deleted, err := app.models.Tokens.DeleteExpired(data.DefaultTokenPurgeBatchSize)
+	if err != nil {
+		return err
+	}
+	app.logger.Info("purged expired tokens", zap.Int64("deleted", deleted))
+	return nil
+}
+
+// reconcilePendingPayments() settles the payments that have waited longer than the payment
+// timeout for their callback, by asking M-Pesa what became of their STK push. Without it an
+// order whose callback was lost would stay in PENDING_PAYMENT for good. A payment that fails
+// to reconcile is logged and tried again on the next run.
+func (app *application) reconcilePendingPayments() error {
+	now := time.Now()
+	payments, err := app.models.Payments.GetStalePendingPayments(now.Add(-app.config.mpesa.paymentTimeout), data.DefaultPaymentReconcileBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, payment := range payments {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		result, settle, err := reconcilePayment(ctx, app.mpesa, payment, now)
+		cancel()
+		if err != nil {
+			app.logger.Warn("Failed to reconcile payment", zap.Int32("payment_id", payment.ID), zap.Error(err))
+			continue
+		}
+		if !settle {
+			continue
+		}
+		settled, _, err := app.models.Payments.SettlePendingPayment(payment.ID, result)
+		if err != nil {
+			app.logger.Warn("Failed to settle reconciled payment", zap.Int32("payment_id", payment.ID), zap.Error(err))
+			continue
+		}
+		app.logger.Info("reconciled payment",
+			zap.Int32("payment_id", settled.ID),
+			zap.Int32("order_id", settled.OrderID),
+			zap.String("status", settled.Status))
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStartJob(t *testing.T) {
+	app := createTestApp(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	runs := make(chan struct{}, 10)
+	failed := false
+	app.startJob(ctx, "test", 5*time.Millisecond, func() error {
+		runs <- struct{}{}
+		// a failing or panicking run must not stop the job
+		if !failed {
+			failed = true
+			panic("job failed")
+		}
+		return errors.New("job failed again")
+	})
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-runs:
+		case <-time.After(time.Second):
+			t.Fatalf("Expected the job to run at least 3 times, it ran %d", i)
+		}
+	}
+
+	// Cancelling stops the job, and shutting down waits for it
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		app.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the job to stop once cancelled")
+	}
+}
+
+func TestStartJobDisabled(t *testing.T) {
+	app := createTestApp(t)
+	app.startJob(context.Background(), "test", 0, func() error {
+		t.Error("Expected a disabled job not to run")
+		return nil
+	})
+	// a disabled job never registers with the wait group, so this returns straight away
+	app.wg.Wait()
+}
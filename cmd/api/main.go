@@ -1,10 +1,13 @@
 package main
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"expvar"
 	"flag"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -13,14 +16,13 @@ import (
 	"time"
 
 	"github.com/Blue-Davinci/SavannaCart/internal/data"
-	"github.com/Blue-Davinci/SavannaCart/internal/database"
 	"github.com/Blue-Davinci/SavannaCart/internal/logger"
 	"github.com/Blue-Davinci/SavannaCart/internal/mailer"
+	"github.com/Blue-Davinci/SavannaCart/internal/mpesa"
 	"github.com/Blue-Davinci/SavannaCart/internal/sms"
-	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
-	"golang.org/x/oauth2"
 )
 
 var (
@@ -49,12 +51,14 @@ type config struct {
 	app_urls struct {
 		authentication_callback_url string
 		activation_callback_url     string
+		password_reset_url          string
+		unsubscribe_url             string
 		provide_url                 string
 	}
 	authenticators struct {
-		provider    *oidc.Provider
-		verifier    *oidc.IDTokenVerifier
-		oauthConfig *oauth2.Config
+		extraProviders string                   // -oidc-providers, parsed by InitOIDC()
+		providerIDs    []string                 // configured providers in order, the first is the default
+		providers      map[string]*oidcProvider // provider registry keyed by ID
 	}
 	smtp struct {
 		host     string
@@ -63,15 +67,55 @@ type config struct {
 		password string
 		sender   string
 	}
+	mail struct {
+		backend    string // -mailer-backend, smtp or capture
+		captureDir string // where captured emails are written, empty keeps them in memory
+	}
 	sms struct {
+		providers  string // -sms-providers, the primary provider followed by its fallbacks
 		accountSID string
 		authToken  string
 		fromNumber string
+		atBaseURL  string
+		atUsername string
+		atAPIKey   string
+		atSenderID string
+	}
+	mpesa struct {
+		baseURL        string
+		consumerKey    string
+		consumerSecret string
+		shortCode      string
+		passKey        string
+		callbackURL    string
+		callbackToken  string
+		// paymentTimeout is how long a payment waits for its callback before we ask M-Pesa
+		paymentTimeout time.Duration
 	}
 	limiter struct {
-		rps     float64
-		burst   int
-		enabled bool
+		rps       float64
+		burst     int
+		enabled   bool
+		authRPS   float64 // registration, password login, password resets and activation resends get a much lower limit
+		authBurst int
+	}
+	cache struct {
+		ttl time.Duration
+	}
+	jobs struct {
+		tokenPurgeInterval time.Duration // how often expired tokens are deleted, 0 turns it off
+		// how often payments that timed out are reconciled with M-Pesa, 0 turns it off
+		paymentReconcileInterval time.Duration
+	}
+	notifications struct {
+		workers      int           // outbox workers, 0 leaves delivery to other servers
+		pollInterval time.Duration // how often each worker looks for due notifications
+		// unsubscribeSecret signs the unsubscribe links in emails, all servers need the same one
+		unsubscribeSecret string
+	}
+	pagination struct {
+		// cursorSecret signs the cursors of paged listings, all servers need the same one
+		cursorSecret string
 	}
 }
 
@@ -81,8 +125,9 @@ type application struct {
 	logger *zap.Logger
 	models data.Models
 	wg     sync.WaitGroup
-	mailer mailer.Mailer
+	mailer mailer.Sender
 	sms    *sms.SMSService
+	mpesa  mpesa.Client
 }
 
 func main() {
@@ -113,21 +158,55 @@ func main() {
 	// urls configuration
 	flag.StringVar(&cfg.app_urls.authentication_callback_url, "authentication-callback-url", "http://localhost:4000/v1/api/authentication", "Authentication Callback URL")
 	flag.StringVar(&cfg.app_urls.activation_callback_url, "activation-callback-url", "http://localhost:4000/v1/api/activation", "Activation Callback URL")
+	flag.StringVar(&cfg.app_urls.password_reset_url, "password-reset-url", "http://localhost:4000/v1/api/authentication/password-reset", "Password Reset URL, sent with the reset token")
+	flag.StringVar(&cfg.app_urls.unsubscribe_url, "unsubscribe-url", "http://localhost:4000/v1/api/unsubscribe", "Unsubscribe URL, sent in emails with a signed token")
 	flag.StringVar(&cfg.app_urls.provide_url, "provide-url", "https://accounts.google.com", "Provide URL")
+	// Further OIDC providers, their credentials come from SAVANNACART_OIDC_<ID>_CLIENT_ID/_CLIENT_SECRET
+	flag.StringVar(&cfg.authenticators.extraProviders, "oidc-providers", os.Getenv("SAVANNACART_OIDC_PROVIDERS"), "Additional OIDC providers (space separated id=issuer_url pairs)")
 	// SMTP configuration
 	flag.StringVar(&cfg.smtp.host, "smtp-host", os.Getenv("SAVANNACART_SMTP_HOST"), "SMTP server hostname")
 	flag.IntVar(&cfg.smtp.port, "smtp-port", 587, "SMTP server port")
 	flag.StringVar(&cfg.smtp.username, "smtp-username", os.Getenv("SAVANNACART_SMTP_USERNAME"), "SMTP server username")
 	flag.StringVar(&cfg.smtp.password, "smtp-password", os.Getenv("SAVANNACART_SMTP_PASSWORD"), "SMTP server password")
 	flag.StringVar(&cfg.smtp.sender, "smtp-sender", os.Getenv("SAVANNACART_SMTP_SENDER"), "SMTP sender email address")
+	// Where emails go, capture keeps them instead of sending them for local development
+	flag.StringVar(&cfg.mail.backend, "mailer-backend", getEnvDefault("SAVANNACART_MAILER_BACKEND", "smtp"), "Email backend (smtp|capture)")
+	flag.StringVar(&cfg.mail.captureDir, "mailer-capture-dir", os.Getenv("SAVANNACART_MAILER_CAPTURE_DIR"), "Directory captured emails are written to (empty keeps them in memory)")
 	// SMS configuration
+	flag.StringVar(&cfg.sms.providers, "sms-providers", getEnvDefault("SAVANNACART_SMS_PROVIDERS", sms.ProviderTwilio), "SMS providers to send through in order, later ones are fallbacks (space separated: twilio, africastalking, memory)")
 	flag.StringVar(&cfg.sms.accountSID, "sms-account-sid", os.Getenv("SAVANNACART_SMS_ACCOUNT_SID"), "Twilio SMS Account SID")
 	flag.StringVar(&cfg.sms.authToken, "sms-auth-token", os.Getenv("SAVANNACART_SMS_AUTH_TOKEN"), "Twilio SMS Auth Token")
 	flag.StringVar(&cfg.sms.fromNumber, "sms-from-number", os.Getenv("SAVANNACART_SMS_FROM_NUMBER"), "Twilio SMS From Number")
+	flag.StringVar(&cfg.sms.atBaseURL, "sms-at-base-url", getEnvDefault("SAVANNACART_SMS_AT_BASE_URL", sms.DefaultAfricasTalkingBaseURL), "Africa's Talking API base URL")
+	flag.StringVar(&cfg.sms.atUsername, "sms-at-username", os.Getenv("SAVANNACART_SMS_AT_USERNAME"), "Africa's Talking app username")
+	flag.StringVar(&cfg.sms.atAPIKey, "sms-at-api-key", os.Getenv("SAVANNACART_SMS_AT_API_KEY"), "Africa's Talking API key")
+	flag.StringVar(&cfg.sms.atSenderID, "sms-at-sender-id", os.Getenv("SAVANNACART_SMS_AT_SENDER_ID"), "Africa's Talking sender ID or short code (optional)")
+	// M-Pesa (Daraja) configuration
+	flag.StringVar(&cfg.mpesa.baseURL, "mpesa-base-url", getEnvDefault("SAVANNACART_MPESA_BASE_URL", mpesa.DefaultBaseURL), "Daraja API base URL")
+	flag.StringVar(&cfg.mpesa.consumerKey, "mpesa-consumer-key", os.Getenv("SAVANNACART_MPESA_CONSUMER_KEY"), "Daraja consumer key")
+	flag.StringVar(&cfg.mpesa.consumerSecret, "mpesa-consumer-secret", os.Getenv("SAVANNACART_MPESA_CONSUMER_SECRET"), "Daraja consumer secret")
+	flag.StringVar(&cfg.mpesa.shortCode, "mpesa-short-code", os.Getenv("SAVANNACART_MPESA_SHORT_CODE"), "M-Pesa paybill/till short code")
+	flag.StringVar(&cfg.mpesa.passKey, "mpesa-pass-key", os.Getenv("SAVANNACART_MPESA_PASS_KEY"), "Lipa Na M-Pesa Online pass key")
+	flag.StringVar(&cfg.mpesa.callbackURL, "mpesa-callback-url", os.Getenv("SAVANNACART_MPESA_CALLBACK_URL"), "Public URL of the M-Pesa STK callback")
+	flag.StringVar(&cfg.mpesa.callbackToken, "mpesa-callback-token", os.Getenv("SAVANNACART_MPESA_CALLBACK_TOKEN"), "Shared secret expected on M-Pesa callbacks")
+	flag.DurationVar(&cfg.mpesa.paymentTimeout, "mpesa-payment-timeout", 3*time.Minute, "How long a payment waits for its M-Pesa callback before the STK push is queried")
 	// Rate limiter flags
 	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 5, "Rate limiter maximum requests per second")
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 10, "Rate limiter maximum burst")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+	flag.Float64Var(&cfg.limiter.authRPS, "limiter-auth-rps", 0.1, "Rate limiter maximum requests per second for password login, registration, resets and activation resends")
+	flag.IntVar(&cfg.limiter.authBurst, "limiter-auth-burst", 5, "Rate limiter maximum burst for password login, registration, resets and activation resends")
+	// How long token and permission lookups are cached for, 0 disables the caches
+	flag.DurationVar(&cfg.cache.ttl, "cache-ttl", time.Minute, "Token and permission cache TTL (0 disables caching)")
+	// Scheduled jobs
+	flag.DurationVar(&cfg.jobs.tokenPurgeInterval, "token-purge-interval", time.Hour, "How often expired tokens are purged (0 disables the purge)")
+	flag.DurationVar(&cfg.jobs.paymentReconcileInterval, "payment-reconcile-interval", time.Minute, "How often timed out payments are reconciled with M-Pesa (0 disables reconciliation)")
+	// Notification outbox delivery
+	flag.IntVar(&cfg.notifications.workers, "notification-workers", 4, "Number of notification outbox workers (0 disables delivery on this server)")
+	flag.DurationVar(&cfg.notifications.pollInterval, "notification-poll-interval", 5*time.Second, "How often each notification worker polls for due notifications")
+	flag.StringVar(&cfg.notifications.unsubscribeSecret, "unsubscribe-secret", os.Getenv("SAVANNACART_UNSUBSCRIBE_SECRET"), "Secret the unsubscribe links in emails are signed with")
+	// Cursor pagination
+	flag.StringVar(&cfg.pagination.cursorSecret, "cursor-secret", os.Getenv("SAVANNACART_CURSOR_SECRET"), "Secret the cursors of paged listings are signed with")
 	// CORS configuration
 	flag.Func("cors-trusted-origins", "Trusted CORS origins (space separated)", func(val string) error {
 		cfg.cors.trustedOrigins = strings.Fields(val)
@@ -158,21 +237,48 @@ func main() {
 
 	// Load additional configuration from environment variables
 	loadConfig(&cfg)
+	// Without a secret, unsubscribe links are signed with a random one and stop working on restart
+	if cfg.notifications.unsubscribeSecret == "" {
+		cfg.notifications.unsubscribeSecret, err = randomSecret()
+		if err != nil {
+			logger.Fatal("Failed to generate an unsubscribe secret", zap.Error(err))
+		}
+		logger.Warn("No unsubscribe secret set, unsubscribe links will stop working when the server restarts")
+	}
+	// The same goes for the cursors of paged listings
+	if cfg.pagination.cursorSecret == "" {
+		cfg.pagination.cursorSecret, err = randomSecret()
+		if err != nil {
+			logger.Fatal("Failed to generate a cursor secret", zap.Error(err))
+		}
+		logger.Warn("No cursor secret set, pagination cursors will stop working when the server restarts")
+	}
 
 	// create our connection pull
 	db, err := openDB(cfg)
 	if err != nil {
 		logger.Fatal(err.Error(), zap.String("dsn", cfg.db.dsn))
 	}
+	emailSender, err := newMailer(cfg)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+	smsService, err := sms.NewFromConfig(smsConfig(cfg), logger)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
 	// Init our exp metrics variables for server metrics.
 	publishMetrics()
 	app := &application{
 		config: cfg,
 		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
-		sms:    sms.New(cfg.sms.accountSID, cfg.sms.authToken, cfg.sms.fromNumber, logger),
-	} // Initialize OIDC at startup
+		models: data.NewModels(db, cfg.cache.ttl),
+		mailer: emailSender,
+		sms:    smsService,
+		mpesa:  mpesa.New(mpesaConfig(cfg), logger),
+	} // Expose the hit and miss counts of the model caches
+	publishCacheMetrics(app.models)
+	// Initialize OIDC at startup
 	err = app.InitOIDC()
 	if err != nil {
 		logger.Fatal("Failed to initialize OIDC", zap.Error(err))
@@ -205,6 +311,39 @@ func publishMetrics() {
 	}))
 }
 
+// publishCacheMetrics exposes the hit and miss counts of the token and permission caches,
+// through expvar under "cache" and through Prometheus as savannacart_cache_{hits,misses}_total.
+func publishCacheMetrics(models data.Models) {
+	caches := map[string]interface {
+		Hits() int64
+		Misses() int64
+	}{
+		"tokens":      models.Users.TokenCache,
+		"permissions": models.Permissions.Cache,
+	}
+	expvar.Publish("cache", expvar.Func(func() any {
+		stats := make(map[string]map[string]int64, len(caches))
+		for name, c := range caches {
+			stats[name] = map[string]int64{"hits": c.Hits(), "misses": c.Misses()}
+		}
+		return stats
+	}))
+	for name, c := range caches {
+		prometheus.MustRegister(
+			prometheus.NewCounterFunc(prometheus.CounterOpts{
+				Name:        "savannacart_cache_hits_total",
+				Help:        "Lookups answered from the in-process cache.",
+				ConstLabels: prometheus.Labels{"cache": name},
+			}, func() float64 { return float64(c.Hits()) }),
+			prometheus.NewCounterFunc(prometheus.CounterOpts{
+				Name:        "savannacart_cache_misses_total",
+				Help:        "Lookups that had to go to the database.",
+				ConstLabels: prometheus.Labels{"cache": name},
+			}, func() float64 { return float64(c.Misses()) }),
+		)
+	}
+}
+
 // getCurrentPath invokes getEnvPath to get the path to the .env file based on the current working directory.
 // After that it loads the .env file using godotenv.Load to be used by the initFlags() function
 // In containerized environments, .env file is optional as environment variables are provided directly
@@ -245,7 +384,7 @@ func getEnvPath(logger *zap.Logger) string {
 
 // openDB() opens a new database connection using the provided configuration.
 // It returns a pointer to the sql.DB connection pool and an error value.
-func openDB(cfg config) (*database.Queries, error) {
+func openDB(cfg config) (*sql.DB, error) {
 	db, err := sql.Open("postgres", cfg.db.dsn)
 	if err != nil {
 		return nil, err
@@ -262,8 +401,7 @@ func openDB(cfg config) (*database.Queries, error) {
 	if err != nil {
 		return nil, err
 	}
-	queries := database.New(db)
-	return queries, nil
+	return db, nil
 }
 
 // loadConfig loads additional configuration values from environment variables
@@ -284,6 +422,61 @@ func loadConfig(cfg *config) {
 	}
 }
 
+// newMailer builds the email backend picked with -mailer-backend
+func newMailer(cfg config) (mailer.Sender, error) {
+	switch cfg.mail.backend {
+	case "smtp":
+		return mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender), nil
+	case "capture":
+		capture, err := mailer.NewCapture(cfg.mail.captureDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the email capture directory: %w", err)
+		}
+		return capture, nil
+	default:
+		return nil, fmt.Errorf("unknown mailer backend %q, must be smtp or capture", cfg.mail.backend)
+	}
+}
+
+// smsConfig builds the SMS service config, providers are listed by name in -sms-providers.
+func smsConfig(cfg config) sms.Config {
+	return sms.Config{
+		Providers: strings.Fields(strings.ToLower(cfg.sms.providers)),
+		Twilio: sms.TwilioConfig{
+			AccountSID: cfg.sms.accountSID,
+			AuthToken:  cfg.sms.authToken,
+			FromNumber: cfg.sms.fromNumber,
+		},
+		AfricasTalking: sms.AfricasTalkingConfig{
+			BaseURL:  cfg.sms.atBaseURL,
+			Username: cfg.sms.atUsername,
+			APIKey:   cfg.sms.atAPIKey,
+			SenderID: cfg.sms.atSenderID,
+		},
+	}
+}
+
+// mpesaConfig builds the Daraja client config. The callback token is added to the callback
+// URL so Daraja sends it back to us on every callback.
+func mpesaConfig(cfg config) mpesa.Config {
+	callbackURL := cfg.mpesa.callbackURL
+	if callbackURL != "" && cfg.mpesa.callbackToken != "" {
+		separator := "?"
+		if strings.Contains(callbackURL, "?") {
+			separator = "&"
+		}
+		callbackURL += separator + "token=" + url.QueryEscape(cfg.mpesa.callbackToken)
+	}
+	return mpesa.Config{
+		BaseURL:        cfg.mpesa.baseURL,
+		ConsumerKey:    cfg.mpesa.consumerKey,
+		ConsumerSecret: cfg.mpesa.consumerSecret,
+		ShortCode:      cfg.mpesa.shortCode,
+		PassKey:        cfg.mpesa.passKey,
+		CallbackURL:    callbackURL,
+	}
+}
+
 // getEnvDefault gets an environment variable with a default fallback
 func getEnvDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -291,3 +484,12 @@ func getEnvDefault(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// randomSecret returns a random 256 bit secret, hex encoded, for signing when none is configured
+func randomSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
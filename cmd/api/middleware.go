@@ -49,7 +49,7 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		w.Header().Add("Vary", "Authorization")
 		// Retrieve the value of the Authorization header from the request. This will
 		// return the empty string "" if there is no such header found.
-		user, err := app.aunthenticatorHelper(r)
+		user, apiKey, err := app.aunthenticatorHelper(r)
 		if user == data.AnonymousUser {
 			r = app.contextSetUser(r, data.AnonymousUser)
 			next.ServeHTTP(w, r)
@@ -70,6 +70,10 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		// context.
 		app.logger.Info("user authenticated", zap.String("name", user.FirstName), zap.String("email", user.Email))
 		r = app.contextSetUser(r, user)
+		// Requests made with an API key are limited to the key's permissions
+		if apiKey != nil {
+			r = app.contextSetAPIKey(r, apiKey)
+		}
 		// Call the next handler in the chain.
 		next.ServeHTTP(w, r)
 	})
@@ -108,24 +112,53 @@ func (app *application) requireActivatedUser(next http.Handler) http.Handler {
 	})
 }
 
-// requirePermission takes the first parameter for th,e permission code that
-// we require the user to have. It then proceeds to read whether the user has that
-// permission or not. If they do not, then it returns a 403 Forbidden response.
-// If they do have the permission, then it calls the next handler in the chain.
-func (app *application) requirePermission(code string) func(next http.Handler) http.Handler {
+// requireSessionAuthentication() rejects requests made with an API key. Routes that manage
+// the user's sign ins, such as sessions and API keys themselves, need a real login so a
+// leaked key can't be used to mint more credentials or sign the user out.
+func (app *application) requireSessionAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := app.contextGetAPIKey(r); ok {
+			app.errorResponse(w, r, http.StatusForbidden, "this resource can't be used with an API key, sign in instead")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requirePermission takes the permission codes that we require the user to have,
+// any one of them is enough. It then proceeds to read whether the user has one of
+// those permissions or not. If they do not, then it returns a 403 Forbidden response.
+// If they do have a permission, then it calls the next handler in the chain.
+func (app *application) requirePermission(codes ...string) func(next http.Handler) http.Handler {
+	return app.requirePermissions(func(permissions data.Permissions) bool {
+		return permissions.IncludeAny(codes...)
+	})
+}
+
+// requireAllPermissions works like requirePermission but the user must have every one
+// of the given permission codes.
+func (app *application) requireAllPermissions(codes ...string) func(next http.Handler) http.Handler {
+	return app.requirePermissions(func(permissions data.Permissions) bool {
+		return permissions.IncludeAll(codes...)
+	})
+}
+
+// requirePermissions loads the user's permissions and returns a 403 Forbidden response
+// unless allowed() accepts them. The permissions are kept in the request context so any
+// later permission check on the same request doesn't go back to the database.
+func (app *application) requirePermissions(allowed func(data.Permissions) bool) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Retrieve the user from the request context.
-			user := app.contextGetUser(r)
 			// Get the slice of permissions for the user.
-			permissions, err := app.models.Permissions.GetAllPermissionsForUser(user.ID)
+			permissions, err := app.getUserPermissions(r)
 			if err != nil {
 				app.serverErrorResponse(w, r, err)
 				return
 			}
-			// Check if the slice includes the required permission. If it doesn't, then
+			r = app.contextSetPermissions(r, permissions)
+			// Check if the slice satisfies the requirement. If it doesn't, then
 			// return a 403 Forbidden response.
-			if !permissions.Include(code) {
+			if !allowed(permissions) {
 				app.notPermittedResponse(w, r)
 				return
 			}
@@ -139,6 +172,13 @@ func (app *application) requirePermission(code string) func(next http.Handler) h
 // The rateLimit() middleware will be used to rate limit the number of requests that a
 // client can make to certain routes within a given time window.
 func (app *application) rateLimit(next http.Handler) http.Handler {
+	return app.limitRate(app.config.limiter.rps, app.config.limiter.burst)(next)
+}
+
+// limitRate() returns a middleware that allows every client IP address rps requests per
+// second with bursts of up to burst requests. Each call keeps its own set of clients, so
+// routes that share a middleware share their limit.
+func (app *application) limitRate(rps float64, burst int) func(http.Handler) http.Handler {
 	// Define a client struct to hold the rate limiter and last seen time for each
 	// client.
 	type client struct {
@@ -171,39 +211,42 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 		}
 	}()
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Only carry out the check if rate limiting is enabled.
-		if app.config.limiter.enabled {
-			// Extract the client's IP address from the request.
-			ip := realip.FromRequest(r)
-			// Lock the mutex to prevent this code from being executed concurrently.
-			mu.Lock()
-			// Check to see if the IP address already exists in the map. If it doesn't, then
-			// initialize a new rate limiter and add the IP address and limiter to the map.
-			if _, found := clients[ip]; !found {
-				clients[ip] = &client{
-					// Use the requests-per-second and burst values from the config struct.
-					limiter: rate.NewLimiter(rate.Limit(app.config.limiter.rps), app.config.limiter.burst),
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Only carry out the check if rate limiting is enabled.
+			if app.config.limiter.enabled {
+				// Extract the client's IP address from the request.
+				ip := realip.FromRequest(r)
+				// Lock the mutex to prevent this code from being executed concurrently.
+				mu.Lock()
+				// Check to see if the IP address already exists in the map. If it doesn't, then
+				// initialize a new rate limiter and add the IP address and limiter to the map.
+				if _, found := clients[ip]; !found {
+					clients[ip] = &client{
+						// Use the requests-per-second and burst values we were given.
+						limiter: rate.NewLimiter(rate.Limit(rps), burst),
+					}
 				}
-			}
-			// Update the last seen time for the client.
-			clients[ip].lastSeen = time.Now()
+				// Update the last seen time for the client.
+				clients[ip].lastSeen = time.Now()
 
-			// Call the Allow() method on the rate limiter for the current IP address. If
-			// the request isn't allowed, unlock the mutex and send a 429 Too Many Requests
-			// response, just like before.
-			if !clients[ip].limiter.Allow() {
+				// Call the Allow() method on the rate limiter for the current IP address. If
+				// the request isn't allowed, unlock the mutex and send a 429 Too Many Requests
+				// response, just like before.
+				if !clients[ip].limiter.Allow() {
+					mu.Unlock()
+					app.rateLimitExceededResponse(w, r)
+					return
+				}
+				// unlock the mutex before calling the next handler in the
+				// chain
 				mu.Unlock()
-				app.rateLimitExceededResponse(w, r)
-				return
 			}
-			// unlock the mutex before calling the next handler in the
-			// chain
-			mu.Unlock()
-		}
-		next.ServeHTTP(w, r)
-	})
+			next.ServeHTTP(w, r)
+		})
+	}
 }
+
 func (app *application) metrics(next http.Handler) http.Handler {
 	// Initialize the new expvar variables when the middleware chain is first built.
 	totalRequestsReceived := expvar.NewInt("total_requests_received")
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/data"
+)
+
+func TestRequirePermission(t *testing.T) {
+	tests := []struct {
+		name           string
+		all            bool
+		codes          []string
+		permissions    data.Permissions
+		expectedStatus int
+	}{
+		{"any of, has one", false, []string{"admin:read", "admin:write"}, data.Permissions{"admin:read"}, http.StatusOK},
+		{"any of, has none", false, []string{"admin:read", "admin:write"}, data.Permissions{"orders:read"}, http.StatusForbidden},
+		{"any of, no permissions", false, []string{"admin:read"}, data.Permissions{}, http.StatusForbidden},
+		{"all of, has all", true, []string{"admin:read", "admin:write"}, data.Permissions{"admin:write", "admin:read"}, http.StatusOK},
+		{"all of, has one", true, []string{"admin:read", "admin:write"}, data.Permissions{"admin:write"}, http.StatusForbidden},
+		{"all of, no codes", true, nil, data.Permissions{"admin:write"}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := createTestApp(t)
+			middleware := app.requirePermission(tt.codes...)
+			if tt.all {
+				middleware = app.requireAllPermissions(tt.codes...)
+			}
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			r := newAuthenticatedRequest(app, http.MethodGet, "/", "", 1, nil)
+			r = app.contextSetPermissions(r, tt.permissions)
+			w := httptest.NewRecorder()
+			middleware(next).ServeHTTP(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestLimitRate(t *testing.T) {
+	app := createTestApp(t)
+	app.config.limiter.enabled = true
+	handler := app.limitRate(0.001, 2)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	expected := []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}
+	for i, status := range expected {
+		r := httptest.NewRequest(http.MethodPost, "/v1/api/authentication/password", nil)
+		r.RemoteAddr = "203.0.113.7:1234"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != status {
+			t.Errorf("Request %d: expected status %d, got %d", i+1, status, w.Code)
+		}
+	}
+
+	// Other clients have their own limit
+	r := httptest.NewRequest(http.MethodPost, "/v1/api/authentication/password", nil)
+	r.RemoteAddr = "198.51.100.2:1234"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected another client to be let through, got %d", w.Code)
+	}
+}
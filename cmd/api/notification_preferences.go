@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/data"
+	"github.com/Blue-Davinci/SavannaCart/internal/validator"
+)
+
+// channelPreferencesInput is a change to the preferences of one channel, the events left
+// out keep their current setting.
+type channelPreferencesInput struct {
+	OrderPlaced *bool `json:"order_placed"`
+	OrderStatus *bool `json:"order_status"`
+	Marketing   *bool `json:"marketing"`
+}
+
+func (input *channelPreferencesInput) apply(preferences *data.ChannelPreferences) {
+	if input == nil {
+		return
+	}
+	if input.OrderPlaced != nil {
+		preferences.OrderPlaced = *input.OrderPlaced
+	}
+	if input.OrderStatus != nil {
+		preferences.OrderStatus = *input.OrderStatus
+	}
+	if input.Marketing != nil {
+		preferences.Marketing = *input.Marketing
+	}
+}
+
+// getNotificationPreferencesHandler() returns the notifications the user wants on each channel
+func (app *application) getNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	preferences, err := app.models.NotificationPreferences.Get(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"preferences": preferences}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateNotificationPreferencesHandler() turns notifications on or off and sets the language
+// emails are sent in. Only what is in the request changes, everything else is kept as it is.
+func (app *application) updateNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email    *channelPreferencesInput `json:"email"`
+		SMS      *channelPreferencesInput `json:"sms"`
+		Language *string                  `json:"language"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Email != nil || input.SMS != nil || input.Language != nil, "preferences", "must include the email or sms preferences or the language to change")
+	if input.Language != nil {
+		data.ValidateLanguage(v, *input.Language)
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	preferences, err := app.models.NotificationPreferences.Get(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	input.Email.apply(&preferences.Email)
+	input.SMS.apply(&preferences.SMS)
+	if input.Language != nil {
+		preferences.Language = *input.Language
+	}
+
+	err = app.models.NotificationPreferences.Update(preferences)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"preferences": preferences}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readUnsubscribeLink() reads and checks the signed token of an unsubscribe link. When it
+// isn't valid a validation error is sent and ok is false.
+func (app *application) readUnsubscribeLink(w http.ResponseWriter, r *http.Request) (userID int64, channel, event string, ok bool) {
+	token := app.readString(r.URL.Query(), "token", "")
+
+	v := validator.New()
+	userID, channel, event, err := data.ParseUnsubscribeToken([]byte(app.config.notifications.unsubscribeSecret), token)
+	if err != nil {
+		v.AddError("token", "invalid unsubscribe link")
+		app.failedValidationResponse(w, r, v.Errors)
+		return 0, "", "", false
+	}
+	if data.ValidateNotificationChannelEvent(v, channel, event); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return 0, "", "", false
+	}
+	return userID, channel, event, true
+}
+
+// showUnsubscribeHandler() answers opening an unsubscribe link from our emails. It changes
+// nothing: mail scanners and link prefetchers follow every link in an email, so only
+// confirming with a POST to the same link unsubscribes.
+func (app *application) showUnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	_, channel, event, ok := app.readUnsubscribeLink(w, r)
+	if !ok {
+		return
+	}
+
+	response := envelope{
+		"message": fmt.Sprintf("confirm to stop receiving %s notifications by %s", strings.ReplaceAll(event, "_", " "), channel),
+		"unsubscribe": map[string]string{
+			"channel": channel,
+			"event":   event,
+		},
+	}
+	err := app.writeJSON(w, http.StatusOK, response, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// unsubscribeHandler() handles confirming an unsubscribe link from our emails. The links are
+// signed instead of authenticated, so they work straight from the email. Mail clients that
+// support one click unsubscribes (RFC 8058) POST to the link as well.
+func (app *application) unsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, channel, event, ok := app.readUnsubscribeLink(w, r)
+	if !ok {
+		return
+	}
+
+	// the link outlives the account it was sent to
+	_, err := app.models.Users.GetUserByID(userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	preferences, err := app.models.NotificationPreferences.Unsubscribe(userID, channel, event)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	response := envelope{
+		"message":     fmt.Sprintf("you will no longer receive %s notifications by %s", strings.ReplaceAll(event, "_", " "), channel),
+		"preferences": preferences,
+	}
+	err = app.writeJSON(w, http.StatusOK, response, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkNotificationPreference() returns an errNotificationSkipped error when the user has turned
+// off the event on the channel, senders call it before sending anything. Otherwise the user's
+// preferences are returned, for the language to send in.
+func (app *application) checkNotificationPreference(userID int64, channel, event string) (*data.NotificationPreferences, error) {
+	preferences, err := app.models.NotificationPreferences.Get(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification preferences for user %d: %w", userID, err)
+	}
+	if !preferences.Allows(channel, event) {
+		return nil, fmt.Errorf("%w: user turned off %s notifications by %s", errNotificationSkipped, event, channel)
+	}
+	return preferences, nil
+}
+
+// unsubscribeURL() returns the signed link that turns off the event on the channel for the user
+func (app *application) unsubscribeURL(userID int64, channel, event string) string {
+	token := data.NewUnsubscribeToken([]byte(app.config.notifications.unsubscribeSecret), userID, channel, event)
+	return fmt.Sprintf("%s?token=%s", app.config.app_urls.unsubscribe_url, token)
+}
+
+// unsubscribeHeaders() returns the headers that let mail clients offer a one click
+// unsubscribe button (RFC 8058) for the link.
+func unsubscribeHeaders(unsubscribeURL string) map[string]string {
+	return map[string]string{
+		"List-Unsubscribe":      "<" + unsubscribeURL + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/data"
+)
+
+func TestUpdateNotificationPreferencesHandlerValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{"empty body", ``, http.StatusBadRequest},
+		{"nothing to change", `{}`, http.StatusUnprocessableEntity},
+		{"unknown channel", `{"push": {"order_placed": false}}`, http.StatusBadRequest},
+		{"unknown event", `{"email": {"newsletter": false}}`, http.StatusBadRequest},
+		{"not a boolean", `{"sms": {"order_placed": "no"}}`, http.StatusBadRequest},
+		{"unsupported language", `{"language": "fr"}`, http.StatusUnprocessableEntity},
+		{"empty language", `{"language": ""}`, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := createTestApp(t)
+			r := newAuthenticatedRequest(app, http.MethodPatch, "/v1/api/user/preferences", tt.body, 1, nil)
+			w := httptest.NewRecorder()
+
+			app.updateNotificationPreferencesHandler(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestUnsubscribeHandlerRejectsInvalidLinks(t *testing.T) {
+	app := createTestApp(t)
+	app.config.notifications.unsubscribeSecret = "test-secret"
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"missing token", ""},
+		{"garbage", "not-a-token"},
+		{"signed with another secret", data.NewUnsubscribeToken([]byte("other-secret"), 1, data.NotificationChannelEmail, data.NotificationEventOrderStatus)},
+		{"unknown event", data.NewUnsubscribeToken([]byte("test-secret"), 1, data.NotificationChannelEmail, "newsletter")},
+	}
+
+	handlers := map[string]http.HandlerFunc{
+		http.MethodGet:  app.showUnsubscribeHandler,
+		http.MethodPost: app.unsubscribeHandler,
+	}
+	for _, tt := range tests {
+		for method, handler := range handlers {
+			t.Run(tt.name+" "+method, func(t *testing.T) {
+				r := httptest.NewRequest(method, "/v1/api/unsubscribe?token="+tt.token, nil)
+				w := httptest.NewRecorder()
+
+				handler(w, r)
+
+				if w.Code != http.StatusUnprocessableEntity {
+					t.Errorf("Expected status %d, got %d: %s", http.StatusUnprocessableEntity, w.Code, w.Body.String())
+				}
+			})
+		}
+	}
+}
+
+func TestShowUnsubscribeHandlerOnlyConfirms(t *testing.T) {
+	// createTestApp has no database, so touching the preferences would panic
+	app := createTestApp(t)
+	app.config.notifications.unsubscribeSecret = "test-secret"
+	token := data.NewUnsubscribeToken([]byte("test-secret"), 1, data.NotificationChannelEmail, data.NotificationEventOrderStatus)
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/api/unsubscribe?token="+token, nil)
+	w := httptest.NewRecorder()
+	app.showUnsubscribeHandler(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response struct {
+		Unsubscribe map[string]string `json:"unsubscribe"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Unsubscribe["channel"] != data.NotificationChannelEmail || response.Unsubscribe["event"] != data.NotificationEventOrderStatus {
+		t.Errorf("Expected the link's channel and event, got %v", response.Unsubscribe)
+	}
+}
+
+func TestUnsubscribeURLRoundTrip(t *testing.T) {
+	app := createTestApp(t)
+	app.config.notifications.unsubscribeSecret = "test-secret"
+	app.config.app_urls.unsubscribe_url = "https://api.example.com/v1/api/unsubscribe"
+
+	link := app.unsubscribeURL(7, data.NotificationChannelEmail, data.NotificationEventOrderPlaced)
+	r := httptest.NewRequest(http.MethodGet, link, nil)
+	userID, channel, event, err := data.ParseUnsubscribeToken([]byte("test-secret"), r.URL.Query().Get("token"))
+	if err != nil {
+		t.Fatalf("Failed to parse the link's token: %v", err)
+	}
+	if userID != 7 || channel != data.NotificationChannelEmail || event != data.NotificationEventOrderPlaced {
+		t.Errorf("Expected 7 email order_placed, got %d %s %s", userID, channel, event)
+	}
+	if got := unsubscribeHeaders(link)["List-Unsubscribe"]; got != "<"+link+">" {
+		t.Errorf("Expected List-Unsubscribe <%s>, got %s", link, got)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/data"
+	"github.com/Blue-Davinci/SavannaCart/internal/validator"
+	"go.uber.org/zap"
+)
+
+const (
+	// notificationBatchSize is how many notifications a worker claims at a time
+	notificationBatchSize = 10
+	// notificationLease is how long a worker has to deliver what it claimed before other
+	// workers may pick it up again. A batch of emails that all time out takes about three
+	// minutes with the mailer's retries.
+	notificationLease = 5 * time.Minute
+)
+
+// errNotificationSkipped is returned by senders when there is nothing to deliver, such as an
+// SMS to a user without a verified phone number. The notification is done and not retried.
+var errNotificationSkipped = errors.New("notification skipped")
+
+// startNotificationWorkers() starts the workers that deliver the notification outbox. Each
+// polls for due notifications every poll interval, so several servers can share the outbox.
+func (app *application) startNotificationWorkers(ctx context.Context) {
+	for i := range app.config.notifications.workers {
+		app.startJob(ctx, fmt.Sprintf("notification_worker_%d", i+1), app.config.notifications.pollInterval, app.deliverDueNotifications)
+	}
+}
+
+// deliverDueNotifications() claims a batch of due notifications and delivers them. Failed
+// deliveries are retried with an exponential backoff until they are dead lettered.
+func (app *application) deliverDueNotifications() error {
+	notifications, err := app.models.Notifications.ClaimDue(notificationBatchSize, notificationLease)
+	if err != nil {
+		return err
+	}
+	for _, notification := range notifications {
+		app.processNotification(notification)
+	}
+	return nil
+}
+
+// processNotification() delivers a single claimed notification and records the outcome.
+func (app *application) processNotification(notification *data.Notification) {
+	logger := app.logger.With(
+		zap.Int64("notification_id", notification.ID),
+		zap.String("kind", notification.Kind),
+		zap.Int32("attempt", notification.Attempts))
+
+	err := app.deliverNotification(notification)
+	switch {
+	case err == nil:
+		if markErr := app.models.Notifications.MarkSent(notification); markErr != nil {
+			logNotificationMarkError(logger, "failed to mark notification sent", markErr)
+			return
+		}
+		logger.Info("notification sent")
+	case errors.Is(err, errNotificationSkipped):
+		if markErr := app.models.Notifications.MarkSkipped(notification, err.Error()); markErr != nil {
+			logNotificationMarkError(logger, "failed to mark notification skipped", markErr)
+			return
+		}
+		logger.Info("notification skipped", zap.String("reason", err.Error()))
+	default:
+		failed, markErr := app.models.Notifications.MarkFailed(notification, err)
+		if markErr != nil {
+			logNotificationMarkError(logger, "failed to record notification failure", markErr, zap.NamedError("delivery_error", err))
+			return
+		}
+		if failed.Status == data.NotificationStatusDead {
+			logger.Error("notification dead lettered", zap.Error(err))
+			return
+		}
+		logger.Warn("notification delivery failed, will retry", zap.Time("next_attempt_at", failed.NextAttemptAt), zap.Error(err))
+	}
+}
+
+// logNotificationMarkError() logs why the outcome of a delivery couldn't be recorded. Losing
+// the lease is expected now and then with slow deliveries, the worker that claimed the
+// notification again records the outcome instead.
+func logNotificationMarkError(logger *zap.Logger, msg string, err error, fields ...zap.Field) {
+	fields = append(fields, zap.Error(err))
+	if errors.Is(err, data.ErrNotificationLeaseLost) {
+		logger.Warn(msg+", it was claimed again after the lease ran out", fields...)
+		return
+	}
+	logger.Error(msg, fields...)
+}
+
+// deliverNotification() sends the message a notification stands for
+func (app *application) deliverNotification(notification *data.Notification) error {
+	payload := notification.Payload
+	switch notification.Kind {
+	case data.NotificationOrderConfirmationEmail:
+		return app.sendOrderConfirmationEmail(payload.OrderID)
+	case data.NotificationOrderConfirmationSMS:
+		return app.sendOrderConfirmationSMS(payload.OrderID)
+	case data.NotificationOrderAdminEmail:
+		return app.sendAdminOrderNotification(payload.OrderID, payload.Email)
+	case data.NotificationOrderStatusEmail:
+		return app.sendOrderStatusUpdateEmail(payload.OrderID, payload.Status)
+	case data.NotificationPaymentReviewEmail:
+		return app.sendAdminPaymentReviewNotification(payload.PaymentID, payload.Email)
+	default:
+		return fmt.Errorf("unknown notification kind %q", notification.Kind)
+	}
+}
+
+// listNotificationsHandler() handles admin requests to inspect the notification outbox, newest
+// first. It can be narrowed down to a status, such as dead for the deliveries that gave up.
+func (app *application) listNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Status string
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Status = app.readString(qs, "status", "")
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	// notifications are always returned newest first
+	input.Filters.Sort = app.readString(qs, "", "")
+	input.Filters.SortSafelist = []string{"", ""}
+	data.ValidateNotificationStatus(v, input.Status)
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	notifications, metadata, err := app.models.Notifications.GetAll(input.Status, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"notifications": notifications, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getNotificationHandler() handles admin requests for a single notification, with its last error
+func (app *application) getNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	notificationID, err := app.readIDParam(r, "notificationID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	notification, err := app.models.Notifications.Get(notificationID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNotificationNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"notification": notification}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// retryNotificationHandler() handles admin requests to deliver a dead notification again
+// straight away, with a fresh set of attempts. It is picked up on the next poll. Pending
+// notifications that are being delivered or waiting out their backoff can't be retried.
+func (app *application) retryNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	notificationID, err := app.readIDParam(r, "notificationID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	notification, err := app.models.Notifications.Retry(notificationID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrNotificationNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrNotificationNotRetryable):
+			app.errorResponse(w, r, http.StatusConflict, "the notification has already been sent or skipped, or is being delivered")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"notification": notification}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
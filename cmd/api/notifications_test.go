@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/data"
+)
+
+func TestNotificationHandlersValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		handler        func(*application, http.ResponseWriter, *http.Request)
+		target         string
+		notificationID string
+		expectedStatus int
+	}{
+		{"list, unknown status", (*application).listNotificationsHandler, "/v1/admin/notifications?status=failed", "", http.StatusUnprocessableEntity},
+		{"list, bad page", (*application).listNotificationsHandler, "/v1/admin/notifications?page=0", "", http.StatusUnprocessableEntity},
+		{"list, page size too big", (*application).listNotificationsHandler, "/v1/admin/notifications?page_size=101", "", http.StatusUnprocessableEntity},
+		{"get, invalid ID", (*application).getNotificationHandler, "/v1/admin/notifications/0", "0", http.StatusNotFound},
+		{"retry, invalid ID", (*application).retryNotificationHandler, "/v1/admin/notifications/0/retry", "0", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := createTestApp(t)
+			r := newAuthenticatedRequest(app, http.MethodGet, tt.target, "", 1, map[string]string{"notificationID": tt.notificationID})
+			w := httptest.NewRecorder()
+
+			tt.handler(app, w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestDeliverNotificationUnknownKind(t *testing.T) {
+	app := createTestApp(t)
+	err := app.deliverNotification(&data.Notification{Kind: "carrier_pigeon"})
+	if err == nil {
+		t.Error("Expected an error for an unknown notification kind")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/data"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/oauth2"
+)
+
+// googleOIDCProvider is the ID of the provider set up from -oidc-client-id, -oidc-client-secret
+// and -provide-url, which is Google unless -provide-url says otherwise.
+const googleOIDCProvider = "google"
+
+// oidcProviderIDRX limits provider IDs to what is safe in a URL path and in an environment
+// variable name.
+var oidcProviderIDRX = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// oidcProviderConfig is the configuration of a single OIDC provider
+type oidcProviderConfig struct {
+	id           string
+	issuerURL    string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+}
+
+// oidcProvider is a provider users can sign in with, set up from its discovery document
+type oidcProvider struct {
+	id              string
+	verifier        *oidc.IDTokenVerifier
+	oauthConfig     *oauth2.Config
+	authCodeOptions []oauth2.AuthCodeOption // extra parameters sent to the authorization endpoint
+}
+
+// parseOIDCProviders() parses the value of -oidc-providers, a space separated list of
+// id=issuer_url pairs such as "microsoft=https://login.microsoftonline.com/<tenant>/v2.0".
+// The client credentials of each provider are read from SAVANNACART_OIDC_<ID>_CLIENT_ID and
+// SAVANNACART_OIDC_<ID>_CLIENT_SECRET, and its callback is <callbackURL>/providers/<id>.
+func parseOIDCProviders(spec, callbackURL string, getenv func(string) string) ([]oidcProviderConfig, error) {
+	var configs []oidcProviderConfig
+	for _, pair := range strings.Fields(spec) {
+		id, issuerURL, found := strings.Cut(pair, "=")
+		if !found || !oidcProviderIDRX.MatchString(id) {
+			return nil, fmt.Errorf("invalid OIDC provider %q, expected id=issuer_url with a lowercase id", pair)
+		}
+		if u, err := url.Parse(issuerURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("OIDC provider %s: invalid issuer URL %q", id, issuerURL)
+		}
+		envPrefix := "SAVANNACART_OIDC_" + strings.ToUpper(id)
+		configs = append(configs, oidcProviderConfig{
+			id:           id,
+			issuerURL:    issuerURL,
+			clientID:     getenv(envPrefix + "_CLIENT_ID"),
+			clientSecret: getenv(envPrefix + "_CLIENT_SECRET"),
+			redirectURL:  strings.TrimSuffix(callbackURL, "/") + "/providers/" + id,
+		})
+	}
+	return configs, nil
+}
+
+// newOIDCProvider() fetches the provider's discovery document and sets up its OAuth2 client
+// and ID token verifier.
+func newOIDCProvider(ctx context.Context, cfg oidcProviderConfig) (*oidcProvider, error) {
+	if cfg.clientID == "" {
+		return nil, fmt.Errorf("OIDC provider %s: client ID is required", cfg.id)
+	}
+	if cfg.clientSecret == "" {
+		return nil, fmt.Errorf("OIDC provider %s: client secret is required", cfg.id)
+	}
+	provider, err := oidc.NewProvider(ctx, cfg.issuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("OIDC provider %s: %w", cfg.id, err)
+	}
+	return &oidcProvider{
+		id:       cfg.id,
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.clientID}),
+		oauthConfig: &oauth2.Config{
+			ClientID:     cfg.clientID,
+			ClientSecret: cfg.clientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  cfg.redirectURL,
+			Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+		},
+	}, nil
+}
+
+// authCodeURL() builds the provider URL for a started login, with the state and the S256
+// challenge of its code verifier.
+func (p *oidcProvider) authCodeURL(oauthState *data.OAuthState) string {
+	opts := append([]oauth2.AuthCodeOption{oauth2.S256ChallengeOption(oauthState.CodeVerifier)}, p.authCodeOptions...)
+	return p.oauthConfig.AuthCodeURL(oauthState.State, opts...)
+}
+
+// defaultOIDCProvider() returns the provider the routes without a provider ID use, which is
+// the first one configured.
+func (app *application) defaultOIDCProvider() (*oidcProvider, bool) {
+	if len(app.config.authenticators.providerIDs) == 0 {
+		return nil, false
+	}
+	return app.config.authenticators.providers[app.config.authenticators.providerIDs[0]], true
+}
+
+// oidcProviderFromRequest() returns the provider named by the providerID route parameter, or
+// the default provider on routes without one. ok is false for providers we don't know.
+func (app *application) oidcProviderFromRequest(r *http.Request) (*oidcProvider, bool) {
+	providerID := chi.URLParam(r, "providerID")
+	if providerID == "" {
+		return app.defaultOIDCProvider()
+	}
+	provider, ok := app.config.authenticators.providers[providerID]
+	return provider, ok
+}
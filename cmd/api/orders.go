@@ -8,14 +8,14 @@ import (
 	"time"
 
 	"github.com/Blue-Davinci/SavannaCart/internal/data"
+	"github.com/Blue-Davinci/SavannaCart/internal/mailer"
 	"github.com/Blue-Davinci/SavannaCart/internal/validator"
 	"github.com/shopspring/decimal"
-	"go.uber.org/zap"
 )
 
 // getAllOrdersHandler() handles requests to get all orders (admin only)
-// It supports pagination, sorting, and filtering by customer name.
-// It retrieves all orders with their items and returns them as a JSON response.
+// It supports pagination by page or by the cursor of the previous page, sorting, and filtering
+// by customer name. It retrieves all orders with their items and returns them as a JSON response.
 func (app *application) getAllOrdersHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Name string
@@ -30,6 +30,8 @@ func (app *application) getAllOrdersHandler(w http.ResponseWriter, r *http.Reque
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 	input.Filters.Sort = app.readString(qs, "sort", "")
 	input.Filters.SortSafelist = []string{"", "created_at", "-created_at", "total_kes", "-total_kes"}
+	input.Filters.Cursor = app.readString(qs, "cursor", "")
+	input.Filters.CursorSecret = []byte(app.config.pagination.cursorSecret)
 
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
@@ -47,14 +49,14 @@ func (app *application) getAllOrdersHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"orders": orders, "metadata": metadata}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"orders": orders, "metadata": metadata}, app.paginationHeaders(r, metadata))
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
 // getUserOrdersHandler() handles requests to get orders for the authenticated user
-// It supports pagination and sorting, and retrieves all orders with their items.
+// It supports pagination by page or cursor and sorting, and retrieves all orders with their items.
 // It returns the orders as a JSON response.
 func (app *application) getUserOrdersHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
@@ -68,6 +70,8 @@ func (app *application) getUserOrdersHandler(w http.ResponseWriter, r *http.Requ
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 	input.Filters.Sort = app.readString(qs, "sort", "-created_at")
 	input.Filters.SortSafelist = []string{"", "created_at", "-created_at", "total_kes", "-total_kes"}
+	input.Filters.Cursor = app.readString(qs, "cursor", "")
+	input.Filters.CursorSecret = []byte(app.config.pagination.cursorSecret)
 
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
@@ -92,7 +96,118 @@ func (app *application) getUserOrdersHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"orders": orders, "metadata": metadata}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"orders": orders, "metadata": metadata}, app.paginationHeaders(r, metadata))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getUserOrderHandler() handles requests to get a single order with its items.
+// Customers can only see their own orders, anyone else's is reported as not found.
+func (app *application) getUserOrderHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r, "orderID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	order, err := app.models.Orders.GetOrderWithItems(int32(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrOrderNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Ownership check, don't reveal that the order exists
+	if int64(order.UserID) != app.contextGetUser(r).ID {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"order": order}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// cancelUserOrderHandler() handles requests from a customer to cancel one of their orders.
+// Only orders that are still PLACED or PROCESSING can be cancelled. The items are put back
+// into stock and the customer gets the usual status update email.
+func (app *application) cancelUserOrderHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r, "orderID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	orderID := int32(id)
+
+	v := validator.New()
+	order, err := app.models.Orders.CancelOrder(orderID, int32(app.contextGetUser(r).ID))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrOrderNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrOrderCannotBeModified):
+			v.AddError("status", "only placed or processing orders can be cancelled")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"order": order}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getOrderHistoryHandler() handles requests for an order's status history. Customers can
+// see the history of their own orders, admins can see the history of any order.
+func (app *application) getOrderHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r, "orderID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	order, err := app.models.Orders.GetOrderByID(int32(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrOrderNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Ownership check, admins may see any order. Don't reveal that the order exists to anyone else.
+	user := app.contextGetUser(r)
+	if int64(order.UserID) != user.ID {
+		permissions, err := app.getUserPermissions(r)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !permissions.IncludeAny(data.PermissionAdminRead, data.PermissionAdminWrite) {
+			app.notFoundResponse(w, r)
+			return
+		}
+	}
+
+	history, err := app.models.Orders.GetOrderStatusHistory(order.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"history": history}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -231,20 +346,6 @@ func (app *application) createOrderHandler(w http.ResponseWriter, r *http.Reques
 		}
 		return
 	}
-	// Send order confirmation email in background
-	app.background(func() {
-		app.sendOrderConfirmationEmail(order.ID)
-	})
-	// Send admin order notification email in background
-	app.background(func() {
-		app.sendAdminOrderNotification(order.ID)
-	})
-
-	// Send SMS notification to user in background
-	app.background(func() {
-		app.sendOrderConfirmationSMS(order.ID)
-	})
-
 	err = app.writeJSON(w, http.StatusCreated, envelope{"order": order}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -265,6 +366,7 @@ func (app *application) updateOrderStatusHandler(w http.ResponseWriter, r *http.
 	var input struct {
 		Status  string `json:"status"`
 		Version int32  `json:"version"`
+		Note    string `json:"note"`
 	}
 
 	err = app.readJSON(w, r, &input)
@@ -276,19 +378,20 @@ func (app *application) updateOrderStatusHandler(w http.ResponseWriter, r *http.
 	// Validate status
 	v := validator.New()
 	data.ValidateOrderStatus(v, input.Status)
+	data.ValidateOrderStatusNote(v, input.Note)
 	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	// Update order status
-	order, err := app.models.Orders.UpdateOrderStatus(orderID, input.Status, input.Version)
+	// Update order status, recording the admin who made the change
+	order, err := app.models.Orders.UpdateOrderStatus(orderID, input.Status, input.Version, app.contextGetUser(r).ID, input.Note)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrOrderNotFound):
 			app.notFoundResponse(w, r)
 		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
-		case errors.Is(err, data.ErrInvalidOrderStatus):
+		case errors.Is(err, data.ErrInvalidOrderStatus), errors.Is(err, data.ErrOrderStatusReserved):
 			v.AddError("status", err.Error())
 			app.failedValidationResponse(w, r, v.Errors)
 		default:
@@ -297,37 +400,33 @@ func (app *application) updateOrderStatusHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
-	// Send order status update email in background
-	app.background(func() {
-		app.sendOrderStatusUpdateEmail(orderID, input.Status)
-	})
-
 	err = app.writeJSON(w, http.StatusOK, envelope{"order": order}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
-// sendOrderStatusUpdateEmail sends an email notification to the user when order status changes
-func (app *application) sendOrderStatusUpdateEmail(orderID int32, newStatus string) {
+// sendOrderStatusUpdateEmail sends an email notification to the user when order status changes,
+// unless they turned status emails off
+func (app *application) sendOrderStatusUpdateEmail(orderID int32, newStatus string) error {
 	// Get full order details with items
 	fullOrder, err := app.models.Orders.GetOrderWithItems(orderID)
 	if err != nil {
-		app.logger.Error("Failed to get order details for email notification",
-			zap.Int32("order_id", orderID),
-			zap.Error(err))
-		return
+		return fmt.Errorf("failed to get order details: %w", err)
 	}
 
 	// Get user details using the UserID from the order
 	user, err := app.models.Users.GetUserByID(int64(fullOrder.UserID))
 	if err != nil {
-		app.logger.Error("Failed to get user details for email notification",
-			zap.Int32("order_id", orderID),
-			zap.Int32("user_id", fullOrder.UserID),
-			zap.Error(err))
-		return
+		return fmt.Errorf("failed to get user %d: %w", fullOrder.UserID, err)
+	}
+
+	// Only if the user still wants status updates by email
+	preferences, err := app.checkNotificationPreference(user.ID, data.NotificationChannelEmail, data.NotificationEventOrderStatus)
+	if err != nil {
+		return err
 	}
+	unsubscribeURL := app.unsubscribeURL(user.ID, data.NotificationChannelEmail, data.NotificationEventOrderStatus)
 
 	// Prepare order items for email template
 	var emailItems []map[string]any
@@ -350,48 +449,39 @@ func (app *application) sendOrderStatusUpdateEmail(orderID int32, newStatus stri
 		"items":       emailItems,
 	}
 
+	// The signed link that turns these emails off, mail clients get it as a header too
+	data["unsubscribeURL"] = unsubscribeURL
+
 	// Add tracking URL if order is shipped (you can modify this based on your tracking system)
 	if newStatus == "SHIPPED" {
 		data["trackingURL"] = fmt.Sprintf("https://track.savannacart.com/order/%d", fullOrder.ID)
 	}
 
 	// Send the order status update email
-	err = app.mailer.Send(user.Email, "order_status_update.tmpl", data)
-	if err != nil {
-		app.logger.Error("Error sending order status update email",
-			zap.String("email", user.Email),
-			zap.Int32("order_id", fullOrder.ID),
-			zap.String("status", newStatus),
-			zap.Error(err))
-		return
-	}
-
-	app.logger.Info("Order status update email sent successfully",
-		zap.String("email", user.Email),
-		zap.Int32("order_id", fullOrder.ID),
-		zap.String("status", newStatus))
+	return app.mailer.SendWithHeaders(user.Email, mailer.LocalizedTemplate(preferences.Language, "order_status_update.tmpl"), data, unsubscribeHeaders(unsubscribeURL))
 }
 
-// sendOrderConfirmationEmail sends a confirmation email to the user when a new order is created
-func (app *application) sendOrderConfirmationEmail(orderID int32) {
+// sendOrderConfirmationEmail sends a confirmation email to the user when a new order is created,
+// unless they turned order confirmation emails off
+func (app *application) sendOrderConfirmationEmail(orderID int32) error {
 	// Get full order details with items
 	fullOrder, err := app.models.Orders.GetOrderWithItems(orderID)
 	if err != nil {
-		app.logger.Error("Failed to get order details for confirmation email",
-			zap.Int32("order_id", orderID),
-			zap.Error(err))
-		return
+		return fmt.Errorf("failed to get order details: %w", err)
 	}
 
 	// Get user details using the UserID from the order
 	user, err := app.models.Users.GetUserByID(int64(fullOrder.UserID))
 	if err != nil {
-		app.logger.Error("Failed to get user details for confirmation email",
-			zap.Int32("order_id", orderID),
-			zap.Int32("user_id", fullOrder.UserID),
-			zap.Error(err))
-		return
+		return fmt.Errorf("failed to get user %d: %w", fullOrder.UserID, err)
+	}
+
+	// Only if the user still wants order confirmations by email
+	preferences, err := app.checkNotificationPreference(user.ID, data.NotificationChannelEmail, data.NotificationEventOrderPlaced)
+	if err != nil {
+		return err
 	}
+	unsubscribeURL := app.unsubscribeURL(user.ID, data.NotificationChannelEmail, data.NotificationEventOrderPlaced)
 
 	// Prepare order items for email template
 	var emailItems []map[string]any
@@ -414,55 +504,27 @@ func (app *application) sendOrderConfirmationEmail(orderID int32) {
 		"items":       emailItems,
 	}
 
+	// The signed link that turns these emails off, mail clients get it as a header too
+	data["unsubscribeURL"] = unsubscribeURL
+
 	// Send the order confirmation email (reusing the order_status_update template)
-	err = app.mailer.Send(user.Email, "order_status_update.tmpl", data)
-	if err != nil {
-		app.logger.Error("Error sending order confirmation email",
-			zap.String("email", user.Email),
-			zap.Int32("order_id", fullOrder.ID),
-			zap.Error(err))
-		return
-	}
-	app.logger.Info("Order confirmation email sent successfully",
-		zap.String("email", user.Email),
-		zap.Int32("order_id", fullOrder.ID))
+	return app.mailer.SendWithHeaders(user.Email, mailer.LocalizedTemplate(preferences.Language, "order_status_update.tmpl"), data, unsubscribeHeaders(unsubscribeURL))
 }
 
-// sendAdminOrderNotification sends email notifications to all super users about new orders
-func (app *application) sendAdminOrderNotification(orderID int32) {
+// sendAdminOrderNotification sends the new order email to one of the admins. Every admin
+// has their own notification in the outbox. These are part of the job, so they ignore the
+// admins' notification preferences.
+func (app *application) sendAdminOrderNotification(orderID int32, adminEmail string) error {
 	// Get full order details with items
 	fullOrder, err := app.models.Orders.GetOrderWithItems(orderID)
 	if err != nil {
-		app.logger.Error("Failed to get order details for admin notification",
-			zap.Int32("order_id", orderID),
-			zap.Error(err))
-		return
+		return fmt.Errorf("failed to get order details: %w", err)
 	}
 
 	// Get customer details using the UserID from the order
 	customer, err := app.models.Users.GetUserByID(int64(fullOrder.UserID))
 	if err != nil {
-		app.logger.Error("Failed to get customer details for admin notification",
-			zap.Int32("order_id", orderID),
-			zap.Int32("user_id", fullOrder.UserID),
-			zap.Error(err))
-		return
-	}
-
-	// Get all super users with permissions
-	superUsers, err := app.models.Permissions.GetAllSuperUsersWithPermissions()
-	if err != nil {
-		app.logger.Error("Failed to get super users for admin notification",
-			zap.Int32("order_id", orderID),
-			zap.Error(err))
-		return
-	}
-
-	// If no super users found, log and return
-	if len(superUsers) == 0 {
-		app.logger.Warn("No super users found for admin notification",
-			zap.Int32("order_id", orderID))
-		return
+		return fmt.Errorf("failed to get customer %d: %w", fullOrder.UserID, err)
 	}
 
 	// Prepare order items for email template
@@ -500,100 +562,53 @@ func (app *application) sendAdminOrderNotification(orderID int32) {
 		data["customerPhone"] = nil
 	}
 
-	// Create a map to track unique emails (to avoid sending duplicate emails to same admin)
-	uniqueEmails := make(map[string]bool)
-	var adminEmails []string
-
-	// Collect unique admin emails
-	for _, superUser := range superUsers {
-		if !uniqueEmails[superUser.UserEmail] {
-			uniqueEmails[superUser.UserEmail] = true
-			adminEmails = append(adminEmails, superUser.UserEmail)
-		}
-	}
-
-	// Send email to each unique admin
-	successCount := 0
-	failureCount := 0
-
-	for _, adminEmail := range adminEmails {
-		err = app.mailer.Send(adminEmail, "admin_order_notification.tmpl", data)
-		if err != nil {
-			app.logger.Error("Error sending admin order notification email",
-				zap.String("admin_email", adminEmail),
-				zap.Int32("order_id", fullOrder.ID),
-				zap.Error(err))
-			failureCount++
-		} else {
-			app.logger.Info("Admin order notification email sent successfully",
-				zap.String("admin_email", adminEmail),
-				zap.Int32("order_id", fullOrder.ID))
-			successCount++
-		}
-	}
-	// Log summary
-	app.logger.Info("Admin order notification summary",
-		zap.Int32("order_id", fullOrder.ID),
-		zap.Int("total_admins", len(adminEmails)),
-		zap.Int("success_count", successCount),
-		zap.Int("failure_count", failureCount))
+	return app.mailer.Send(adminEmail, "admin_order_notification.tmpl", data)
 }
 
-// sendOrderConfirmationSMS sends a simple confirmation SMS to the user when a new order is created
-func (app *application) sendOrderConfirmationSMS(orderID int32) {
+// sendOrderConfirmationSMS sends a simple confirmation SMS to the user when a new order is
+// created. Users we can't text, or who turned these off, are skipped with errNotificationSkipped.
+func (app *application) sendOrderConfirmationSMS(orderID int32) error {
 	// Get full order details with items
 	fullOrder, err := app.models.Orders.GetOrderWithItems(orderID)
 	if err != nil {
-		app.logger.Error("Failed to get order details for SMS confirmation",
-			zap.Int32("order_id", orderID),
-			zap.Error(err))
-		return
+		return fmt.Errorf("failed to get order details: %w", err)
 	}
 
 	// Get user details using the UserID from the order
 	user, err := app.models.Users.GetUserByID(int64(fullOrder.UserID))
 	if err != nil {
-		app.logger.Error("Failed to get user details for SMS confirmation",
-			zap.Int32("order_id", orderID),
-			zap.Int32("user_id", fullOrder.UserID),
-			zap.Error(err))
-		return
+		return fmt.Errorf("failed to get user %d: %w", fullOrder.UserID, err)
+	}
+
+	// Only if the user still wants order confirmations by SMS
+	_, err = app.checkNotificationPreference(user.ID, data.NotificationChannelSMS, data.NotificationEventOrderPlaced)
+	if err != nil {
+		return err
 	}
 
 	// Check if user has a phone number
 	if user.PhoneNumber == "" {
-		app.logger.Info("User has no phone number, skipping SMS confirmation",
-			zap.Int32("order_id", orderID),
-			zap.Int32("user_id", fullOrder.UserID))
-		return
+		return fmt.Errorf("%w: user has no phone number", errNotificationSkipped)
+	}
+
+	// Only text numbers the user has proven are theirs
+	if !user.PhoneVerified {
+		return fmt.Errorf("%w: user's phone number is not verified", errNotificationSkipped)
 	}
 
 	// Check if SMS service is enabled
 	if !app.sms.IsEnabled() {
-		app.logger.Info("SMS service is disabled, skipping SMS confirmation",
-			zap.Int32("order_id", orderID))
-		return
+		return fmt.Errorf("%w: SMS service is disabled", errNotificationSkipped)
 	}
 
 	// Send SMS confirmation
 	err = app.sms.SendOrderConfirmation(user.PhoneNumber, fullOrder.ID, fullOrder.TotalKES.StringFixed(2))
 	if err != nil {
-		// Check if it's a trial account limitation and log appropriately
+		// Trial accounts can't text this number however often we try
 		if strings.Contains(err.Error(), "Trial accounts") || strings.Contains(err.Error(), "restricted") {
-			app.logger.Info("SMS sending restricted due to trial account limitations",
-				zap.String("phone_number", user.PhoneNumber),
-				zap.Int32("order_id", fullOrder.ID),
-				zap.String("solution", "Verify phone number in Twilio console or upgrade account"))
-		} else {
-			app.logger.Error("Error sending order confirmation SMS",
-				zap.String("phone_number", user.PhoneNumber),
-				zap.Int32("order_id", fullOrder.ID),
-				zap.Error(err))
+			return fmt.Errorf("%w: %v", errNotificationSkipped, err)
 		}
-		return
+		return err
 	}
-
-	app.logger.Info("Order confirmation SMS sent successfully",
-		zap.String("phone_number", user.PhoneNumber),
-		zap.Int32("order_id", fullOrder.ID))
+	return nil
 }
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/data"
+	"github.com/Blue-Davinci/SavannaCart/internal/validator"
+	"go.uber.org/zap"
+)
+
+// registerUserHandler() signs up a user with an email and password, for customers who can't
+// sign in through one of our OIDC providers. Like OAuth sign ups, the account has to be
+// activated through the emailed link before the user can log in.
+func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+		Email     string `json:"email"`
+		Password  string `json:"password"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := &data.User{
+		FirstName:        input.FirstName,
+		LastName:         input.LastName,
+		Email:            input.Email,
+		ProfileAvatarURL: data.GravatarURL(input.Email),
+		RoleLevel:        "user",
+		Activated:        false,
+	}
+
+	// The password is checked before it is hashed, bcrypt refuses long ones
+	v := validator.New()
+	data.ValidateUser(v, user)
+	data.ValidatePasswordPlaintext(v, input.Password)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = user.Password.Set(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Users.CreateNewUser(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email address already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.sendUserActivation(user)
+	if err != nil {
+		app.logger.Error("Error creating activation token", zap.Error(err))
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	response := envelope{
+		"message":   "Account created successfully! Please check your email to activate your account.",
+		"user":      user,
+		"next_step": "Click the activation link in your email to complete registration",
+	}
+	err = app.writeJSON(w, http.StatusCreated, response, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createPasswordAuthenticationTokenHandler() logs a user in with their email and password,
+// starting a session just like an OAuth login does.
+func (app *application) createPasswordAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateEmail(v, input.Email)
+	data.ValidatePasswordPlaintext(v, input.Password)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetByEmail(input.Email, "")
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// users who only sign in through a provider have no password, nothing matches for them
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !match {
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	app.handleUserLogin(w, r, user)
+}
+
+// createPasswordResetTokenHandler() emails a password reset link to the user with the given
+// email. The response is the same whether or not the user exists, so it can't be used to
+// find out who has an account. Users who sign in through a provider can use this to set a
+// password too.
+func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetByEmail(input.Email, "")
+	switch {
+	case err == nil:
+		err = app.sendPasswordReset(user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	case !errors.Is(err, data.ErrGeneralRecordNotFound):
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	response := envelope{"message": "if an account with that email address exists, you will receive password reset instructions shortly"}
+	err = app.writeJSON(w, http.StatusAccepted, response, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// sendPasswordReset replaces any password reset tokens the user has with a new one and
+// emails them the link to use it with.
+func (app *application) sendPasswordReset(user *data.User) error {
+	err := app.models.Tokens.DeleteAllForUser(data.ScopePasswordReset, user.ID)
+	if err != nil {
+		return err
+	}
+	resetToken, err := app.models.Tokens.New(user.ID, data.DefaultPasswordResetTokenExpiryTime, data.ScopePasswordReset)
+	if err != nil {
+		return err
+	}
+
+	app.background(func() {
+		emailData := map[string]any{
+			"resetURL":  fmt.Sprintf("%s?token=%s", app.config.app_urls.password_reset_url, resetToken.Plaintext),
+			"firstName": user.FirstName,
+			"lastName":  user.LastName,
+			"minutes":   int(data.DefaultPasswordResetTokenExpiryTime.Minutes()),
+		}
+		err := app.mailer.Send(user.Email, app.userEmailTemplate(user.ID, "user_password_reset.tmpl"), emailData)
+		if err != nil {
+			app.logger.Error("Error sending password reset email", zap.Int64("user_id", user.ID), zap.Error(err))
+		}
+	})
+	return nil
+}
+
+// updateUserPasswordHandler() sets a new password using a password reset token. Every
+// session the user has is signed out, whoever knew the old password is no longer let in.
+func (app *application) updateUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password       string `json:"password"`
+		TokenPlaintext string `json:"token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidatePasswordPlaintext(v, input.Password)
+	data.ValidateTokenPlaintext(v, input.TokenPlaintext)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(data.ScopePasswordReset, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			v.AddError("token", "invalid or expired password reset token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = user.Password.Set(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.models.Users.UpdateUser(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(data.ScopePasswordReset, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.models.Sessions.RevokeAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "your password was successfully reset"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
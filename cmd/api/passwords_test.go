@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPasswordHandlersValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		handler        func(*application, http.ResponseWriter, *http.Request)
+		body           string
+		expectedStatus int
+	}{
+		{"register, empty body", (*application).registerUserHandler, ``, http.StatusBadRequest},
+		{"register, missing fields", (*application).registerUserHandler, `{}`, http.StatusUnprocessableEntity},
+		{"register, short password", (*application).registerUserHandler, `{"first_name": "Jane", "last_name": "Doe", "email": "jane@example.com", "password": "short"}`, http.StatusUnprocessableEntity},
+		{"register, password too long", (*application).registerUserHandler, `{"first_name": "Jane", "last_name": "Doe", "email": "jane@example.com", "password": "` + strings.Repeat("a", 73) + `"}`, http.StatusUnprocessableEntity},
+		{"login, empty body", (*application).createPasswordAuthenticationTokenHandler, ``, http.StatusBadRequest},
+		{"login, bad email", (*application).createPasswordAuthenticationTokenHandler, `{"email": "not-an-email", "password": "correct horse battery"}`, http.StatusUnprocessableEntity},
+		{"login, missing password", (*application).createPasswordAuthenticationTokenHandler, `{"email": "jane@example.com"}`, http.StatusUnprocessableEntity},
+		{"reset request, empty body", (*application).createPasswordResetTokenHandler, ``, http.StatusBadRequest},
+		{"reset request, bad email", (*application).createPasswordResetTokenHandler, `{"email": "not-an-email"}`, http.StatusUnprocessableEntity},
+		{"resend activation, empty body", (*application).resendActivationTokenHandler, ``, http.StatusBadRequest},
+		{"resend activation, bad email", (*application).resendActivationTokenHandler, `{"email": "not-an-email"}`, http.StatusUnprocessableEntity},
+		{"reset, empty body", (*application).updateUserPasswordHandler, ``, http.StatusBadRequest},
+		{"reset, missing token", (*application).updateUserPasswordHandler, `{"password": "correct horse battery"}`, http.StatusUnprocessableEntity},
+		{"reset, short password", (*application).updateUserPasswordHandler, `{"password": "short", "token": "ABCDEFGHIJKLMNOPQRSTUVWXYZ"}`, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := createTestApp(t)
+			r := httptest.NewRequest(http.MethodPost, "/v1/api/users", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			tt.handler(app, w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
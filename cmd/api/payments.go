@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/data"
+	"github.com/Blue-Davinci/SavannaCart/internal/mpesa"
+	"github.com/Blue-Davinci/SavannaCart/internal/validator"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+)
+
+// checkoutAttachAttempts is how many times we try to store the checkout request of a sent
+// STK push, waiting checkoutAttachBackoff longer after every failure
+const (
+	checkoutAttachAttempts = 3
+	checkoutAttachBackoff  = 200 * time.Millisecond
+)
+
+// initiateOrderPaymentHandler() handles requests from a customer to pay for one of their orders
+// with M-Pesa. It opens a payment, moves the order to PENDING_PAYMENT and sends an STK push
+// to the customer's phone. The result arrives later on the M-Pesa callback. The payment is only
+// failed here when M-Pesa certainly didn't send the prompt, otherwise it stays pending for the
+// callback or reconciliation to settle.
+func (app *application) initiateOrderPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r, "orderID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	orderID := int32(id)
+
+	// The phone number is optional, send an empty object to use the one on the profile
+	var input struct {
+		PhoneNumber string `json:"phone_number"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if !app.mpesa.Enabled() {
+		app.errorResponse(w, r, http.StatusServiceUnavailable, "M-Pesa payments are currently unavailable")
+		return
+	}
+
+	user := app.contextGetUser(r)
+	// Default to the phone number on the user's profile
+	if input.PhoneNumber == "" {
+		input.PhoneNumber = user.PhoneNumber
+	}
+	v := validator.New()
+	phoneNumber, err := mpesa.FormatPhoneNumber(input.PhoneNumber)
+	if err != nil {
+		v.AddError("phone_number", "must be a valid Safaricom number")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	payment, err := app.models.Payments.StartPayment(orderID, int32(user.ID), phoneNumber)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrOrderNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrPaymentInProgress):
+			app.errorResponse(w, r, http.StatusConflict, err.Error())
+		case errors.Is(err, data.ErrOrderCannotBeModified):
+			v.AddError("status", "only placed orders can be paid for")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The push goes on if the customer disconnects, once it is on its way the prompt may
+	// reach their phone whatever happens to this request
+	stkResponse, err := app.mpesa.STKPush(context.WithoutCancel(r.Context()), mpesa.STKPushRequest{
+		PhoneNumber:      phoneNumber,
+		Amount:           payment.AmountKES.IntPart(),
+		AccountReference: fmt.Sprintf("ORDER-%d", orderID),
+		TransactionDesc:  fmt.Sprintf("SavannaCart order %d", orderID),
+	})
+	if err != nil {
+		app.logger.Error("Failed to send STK push",
+			zap.Int32("order_id", orderID),
+			zap.Int32("payment_id", payment.ID),
+			zap.Error(err))
+		if !errors.Is(err, mpesa.ErrSTKPushNotSent) {
+			// The prompt may still arrive, the callback is matched to the payment by phone
+			// number and amount, and reconciliation releases the order if it never comes
+			err = app.writeJSON(w, http.StatusAccepted, envelope{"payment": payment, "message": "We could not confirm the payment request was sent. If no prompt arrives on your phone, try again in a few minutes."}, nil)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		// Release the order so the customer can try again
+		if failErr := app.models.Payments.FailPayment(payment.ID, "STK push could not be sent"); failErr != nil {
+			app.serverErrorResponse(w, r, failErr)
+			return
+		}
+		app.errorResponse(w, r, http.StatusBadGateway, "the payment request could not be sent, please try again")
+		return
+	}
+
+	// The prompt is on the customer's phone now, so the payment stays pending whatever happens
+	// here. Without its checkout request the callback can only be matched by phone number and
+	// amount, and reconciliation has nothing to query, so the attach is retried a few times.
+	var attached *data.Payment
+	for attempt := 1; attempt <= checkoutAttachAttempts; attempt++ {
+		attached, err = app.models.Payments.AttachCheckoutRequest(payment.ID, stkResponse.MerchantRequestID, stkResponse.CheckoutRequestID)
+		if err == nil || attempt == checkoutAttachAttempts {
+			break
+		}
+		time.Sleep(time.Duration(attempt) * checkoutAttachBackoff)
+	}
+	if err != nil {
+		// log the IDs so the payment can still be traced by hand
+		app.logger.Error("Failed to attach checkout request to payment",
+			zap.Int32("order_id", orderID),
+			zap.Int32("payment_id", payment.ID),
+			zap.String("merchant_request_id", stkResponse.MerchantRequestID),
+			zap.String("checkout_request_id", stkResponse.CheckoutRequestID),
+			zap.Error(err))
+	} else {
+		payment = attached
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"payment": payment, "message": stkResponse.CustomerMessage}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getOrderPaymentsHandler() handles requests to list the payment attempts for one of the
+// authenticated user's orders.
+func (app *application) getOrderPaymentsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r, "orderID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	order, err := app.models.Orders.GetOrderByID(int32(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrOrderNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// Ownership check, don't reveal that the order exists
+	if int64(order.UserID) != app.contextGetUser(r).ID {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	payments, err := app.models.Payments.GetPaymentsForOrder(order.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"payments": payments}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// resolvePaymentReviewHandler() handles admin requests to resolve a payment in REVIEW, once
+// the money has been looked at. SUCCESS accepts the payment and marks its order PAID, REFUNDED
+// records that the customer got their money back and releases the order.
+func (app *application) resolvePaymentReviewHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r, "paymentID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Status string `json:"status"`
+		Note   string `json:"note"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidatePaymentResolution(v, input.Status)
+	data.ValidateOrderStatusNote(v, input.Note)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	payment, order, err := app.models.Payments.ResolvePaymentReview(int32(id), input.Status, app.contextGetUser(r).ID, input.Note)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrPaymentNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrPaymentNotInReview):
+			app.errorResponse(w, r, http.StatusConflict, err.Error())
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"payment": payment, "order": order}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// sendAdminPaymentReviewNotification() tells one of the admins that a payment was put in
+// REVIEW. Like the new order email it ignores the admins' notification preferences.
+func (app *application) sendAdminPaymentReviewNotification(paymentID int32, adminEmail string) error {
+	payment, err := app.models.Payments.GetPayment(paymentID)
+	if err != nil {
+		return fmt.Errorf("failed to get payment %d: %w", paymentID, err)
+	}
+	order, err := app.models.Orders.GetOrderByID(payment.OrderID)
+	if err != nil {
+		return fmt.Errorf("failed to get order %d: %w", payment.OrderID, err)
+	}
+	customer, err := app.models.Users.GetUserByID(int64(order.UserID))
+	if err != nil {
+		return fmt.Errorf("failed to get customer %d: %w", order.UserID, err)
+	}
+
+	data := map[string]any{
+		"orderID":           order.ID,
+		"orderStatus":       order.Status,
+		"paymentID":         payment.ID,
+		"paymentAmount":     payment.AmountKES.StringFixed(2),
+		"paymentPhone":      payment.PhoneNumber,
+		"receiptNumber":     payment.MpesaReceiptNumber,
+		"reviewReason":      payment.ResultDesc,
+		"customerFirstName": customer.FirstName,
+		"customerLastName":  customer.LastName,
+		"customerEmail":     customer.Email,
+		"dashboardURL":      "https://admin.savannacart.com",
+		"currentYear":       payment.UpdatedAt.Year(),
+	}
+	return app.mailer.Send(adminEmail, "admin_payment_review.tmpl", data)
+}
+
+// reconcilePayment() works out what to settle a payment that timed out with, by asking M-Pesa
+// for the result of its STK push. It returns false when the payment should be left pending for
+// now, because the customer can still answer the prompt. Payments we never got a checkout request
+// for can't be queried and fail straight away, a successful callback would have matched them by
+// now. Ones M-Pesa can't tell us about are given up on after a day.
+func reconcilePayment(ctx context.Context, client mpesa.Client, payment *data.Payment, now time.Time) (data.PaymentResult, bool, error) {
+	if payment.CheckoutRequestID == "" {
+		return data.PaymentResult{ResultDesc: "payment timed out without a checkout request from M-Pesa"}, true, nil
+	}
+	query, err := client.STKQuery(ctx, payment.CheckoutRequestID)
+	if err != nil {
+		if now.Sub(payment.CreatedAt) > data.DefaultPaymentAbandonAfter {
+			return data.PaymentResult{ResultDesc: "no result from M-Pesa: " + err.Error()}, true, nil
+		}
+		if errors.Is(err, mpesa.ErrPaymentProcessing) {
+			return data.PaymentResult{}, false, nil
+		}
+		return data.PaymentResult{}, false, err
+	}
+	resultCode, err := strconv.Atoi(query.ResultCode)
+	if err != nil {
+		return data.PaymentResult{}, false, fmt.Errorf("unexpected STK query result code %q", query.ResultCode)
+	}
+	return data.PaymentResult{
+		CheckoutRequestID: payment.CheckoutRequestID,
+		Successful:        query.Successful(),
+		ResultCode:        int32(resultCode),
+		ResultDesc:        query.ResultDesc,
+		// the query doesn't say how much was paid, only that the push we sent was
+		AmountKES: payment.AmountKES,
+	}, true, nil
+}
+
+// mpesaCallbackHandler() receives STK push results from Daraja. The route is public, so the
+// request must carry the shared callback token we registered in the callback URL. The result
+// is recorded against the payment and, when the order is paid, the customer is emailed.
+func (app *application) mpesaCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if app.config.mpesa.callbackToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(app.config.mpesa.callbackToken)) != 1 {
+		app.errorResponse(w, r, http.StatusForbidden, "invalid callback token")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 65_536))
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	callback, err := mpesa.ParseCallback(body)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// the PAID status email is queued together with the result
+	payment, _, err := app.models.Payments.RecordPaymentResult(data.PaymentResult{
+		CheckoutRequestID: callback.CheckoutRequestID,
+		MerchantRequestID: callback.MerchantRequestID,
+		Successful:        callback.Successful(),
+		ResultCode:        int32(callback.ResultCode),
+		ResultDesc:        callback.ResultDesc,
+		AmountKES:         decimal.NewFromInt(callback.Amount),
+		ReceiptNumber:     callback.MpesaReceiptNumber,
+		PhoneNumber:       callback.PhoneNumber,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrPaymentNotFound):
+			// It has been stored for someone to trace, acknowledge so Daraja doesn't keep trying
+			app.logger.Error("M-Pesa callback for unknown checkout request",
+				zap.String("checkout_request_id", callback.CheckoutRequestID),
+				zap.String("mpesa_receipt_number", callback.MpesaReceiptNumber),
+				zap.Int64("amount", callback.Amount))
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	} else {
+		app.logger.Info("M-Pesa callback recorded",
+			zap.Int32("payment_id", payment.ID),
+			zap.Int32("order_id", payment.OrderID),
+			zap.String("status", payment.Status))
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"ResultCode": 0, "ResultDesc": "Accepted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
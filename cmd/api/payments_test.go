@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/data"
+	"github.com/Blue-Davinci/SavannaCart/internal/mpesa"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+)
+
+// stubMpesaClient is an mpesa.Client that never talks to Daraja.
+type stubMpesaClient struct {
+	enabled  bool
+	pushes   int
+	query    *mpesa.STKQueryResponse // what status queries answer with
+	queryErr error
+	queries  int
+}
+
+func (c *stubMpesaClient) STKPush(ctx context.Context, req mpesa.STKPushRequest) (*mpesa.STKPushResponse, error) {
+	c.pushes++
+	return &mpesa.STKPushResponse{CheckoutRequestID: "ws_CO_stub", ResponseCode: "0"}, nil
+}
+
+func (c *stubMpesaClient) STKQuery(ctx context.Context, checkoutRequestID string) (*mpesa.STKQueryResponse, error) {
+	c.queries++
+	return c.query, c.queryErr
+}
+
+func (c *stubMpesaClient) Enabled() bool {
+	return c.enabled
+}
+
+func TestMpesaCallbackHandler(t *testing.T) {
+	validBody := `{"Body":{"stkCallback":{"MerchantRequestID":"1","CheckoutRequestID":"ws_CO_1","ResultCode":1032,"ResultDesc":"Request cancelled by user"}}}`
+	tests := []struct {
+		name           string
+		callbackToken  string
+		query          string
+		body           string
+		expectedStatus int
+	}{
+		{"missing token", "callback-secret", "", validBody, http.StatusForbidden},
+		{"wrong token", "callback-secret", "?token=guess", validBody, http.StatusForbidden},
+		{"no token configured", "", "?token=", validBody, http.StatusForbidden},
+		{"malformed body", "callback-secret", "?token=callback-secret", `{"Body":`, http.StatusBadRequest},
+		{"missing checkout request", "callback-secret", "?token=callback-secret", `{"Body":{"stkCallback":{"ResultCode":0}}}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := createTestApp(t)
+			app.config.mpesa.callbackToken = tt.callbackToken
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/payments/mpesa/callback"+tt.query, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			app.mpesaCallbackHandler(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestReconcilePayment(t *testing.T) {
+	now := time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC)
+	pushed := &data.Payment{ID: 7, CheckoutRequestID: "ws_CO_7", AmountKES: decimal.NewFromInt(1500), CreatedAt: now.Add(-10 * time.Minute)}
+	abandoned := &data.Payment{ID: 8, CheckoutRequestID: "ws_CO_8", AmountKES: decimal.NewFromInt(1500), CreatedAt: now.Add(-25 * time.Hour)}
+	neverPushed := &data.Payment{ID: 9, AmountKES: decimal.NewFromInt(1500), CreatedAt: now.Add(-10 * time.Minute)}
+
+	tests := []struct {
+		name         string
+		payment      *data.Payment
+		query        *mpesa.STKQueryResponse
+		queryErr     error
+		expectSettle bool
+		expectErr    bool
+		expected     data.PaymentResult
+	}{
+		{
+			name:         "paid",
+			payment:      pushed,
+			query:        &mpesa.STKQueryResponse{ResponseCode: "0", ResultCode: "0", ResultDesc: "The service request is processed successfully."},
+			expectSettle: true,
+			expected:     data.PaymentResult{CheckoutRequestID: "ws_CO_7", Successful: true, ResultDesc: "The service request is processed successfully.", AmountKES: decimal.NewFromInt(1500)},
+		},
+		{
+			name:         "customer ignored the prompt",
+			payment:      pushed,
+			query:        &mpesa.STKQueryResponse{ResponseCode: "0", ResultCode: "1037", ResultDesc: "DS timeout user cannot be reached"},
+			expectSettle: true,
+			expected:     data.PaymentResult{CheckoutRequestID: "ws_CO_7", ResultCode: 1037, ResultDesc: "DS timeout user cannot be reached", AmountKES: decimal.NewFromInt(1500)},
+		},
+		{name: "still processing", payment: pushed, queryErr: mpesa.ErrPaymentProcessing},
+		{name: "query failed", payment: pushed, queryErr: errors.New("connection refused"), expectErr: true},
+		{
+			name:         "no answer for a day",
+			payment:      abandoned,
+			queryErr:     mpesa.ErrPaymentProcessing,
+			expectSettle: true,
+			expected:     data.PaymentResult{ResultDesc: "no result from M-Pesa: the STK push is still being processed"},
+		},
+		{
+			name:         "never pushed",
+			payment:      neverPushed,
+			expectSettle: true,
+			expected:     data.PaymentResult{ResultDesc: "payment timed out without a checkout request from M-Pesa"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &stubMpesaClient{enabled: true, query: tt.query, queryErr: tt.queryErr}
+
+			result, settle, err := reconcilePayment(context.Background(), client, tt.payment, now)
+
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("Expected error %v, got %v", tt.expectErr, err)
+			}
+			if settle != tt.expectSettle {
+				t.Fatalf("Expected settle %v, got %v", tt.expectSettle, settle)
+			}
+			if result.CheckoutRequestID != tt.expected.CheckoutRequestID || result.Successful != tt.expected.Successful ||
+				result.ResultCode != tt.expected.ResultCode || result.ResultDesc != tt.expected.ResultDesc || !result.AmountKES.Equal(tt.expected.AmountKES) {
+				t.Errorf("Expected result %+v, got %+v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestInitiateOrderPaymentHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		enabled        bool
+		body           string
+		expectedStatus int
+	}{
+		{"payments disabled", false, `{}`, http.StatusServiceUnavailable},
+		{"empty body", true, ``, http.StatusBadRequest},
+		{"invalid phone number", true, `{"phone_number": "+15551234567"}`, http.StatusUnprocessableEntity},
+		{"no phone number on profile", true, `{}`, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := createTestApp(t)
+			client := &stubMpesaClient{enabled: tt.enabled}
+			app.mpesa = client
+
+			r := newAuthenticatedRequest(app, http.MethodPost, "/v1/orders/1/pay", tt.body, 1, map[string]string{"orderID": "1"})
+			w := httptest.NewRecorder()
+
+			app.initiateOrderPaymentHandler(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if client.pushes != 0 {
+				t.Errorf("Expected no STK push, got %d", client.pushes)
+			}
+		})
+	}
+}
+
+func TestResolvePaymentReviewHandlerValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{"empty body", ``, http.StatusBadRequest},
+		{"missing status", `{}`, http.StatusUnprocessableEntity},
+		{"not a resolution", `{"status": "FAILED"}`, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := createTestApp(t)
+
+			r := newAuthenticatedRequest(app, http.MethodPost, "/v1/admin/payments/1/resolve", tt.body, 1, map[string]string{"paymentID": "1"})
+			w := httptest.NewRecorder()
+
+			app.resolvePaymentReviewHandler(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestMpesaConfig(t *testing.T) {
+	var cfg config
+	cfg.mpesa.callbackURL = "https://api.savannacart.com/v1/payments/mpesa/callback"
+	cfg.mpesa.callbackToken = "s3cret&more"
+
+	if got := mpesaConfig(cfg).CallbackURL; got != cfg.mpesa.callbackURL+"?token=s3cret%26more" {
+		t.Errorf("Unexpected callback URL %q", got)
+	}
+
+	cfg.mpesa.callbackURL += "?source=daraja"
+	if got := mpesaConfig(cfg).CallbackURL; !strings.HasSuffix(got, "?source=daraja&token=s3cret%26more") {
+		t.Errorf("Unexpected callback URL %q", got)
+	}
+
+	// The client stays disabled without credentials
+	if mpesa.New(mpesaConfig(cfg), zap.NewNop()).Enabled() {
+		t.Error("Expected the M-Pesa client to be disabled without credentials")
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/data"
+	"github.com/Blue-Davinci/SavannaCart/internal/validator"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// getAllPermissionsHandler() handles admin requests to list every permission code that can
+// be granted.
+func (app *application) getAllPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	permissions, err := app.models.Permissions.GetAllPermissions()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"permissions": permissions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getAllSuperUsersHandler() handles admin requests to list every user holding at least one
+// permission, together with their permission codes.
+func (app *application) getAllSuperUsersHandler(w http.ResponseWriter, r *http.Request) {
+	superUsers, err := app.models.Permissions.GetAllSuperUsersWithPermissions()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if superUsers == nil {
+		superUsers = []*data.SuperUsersWithPermissions{}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"super_users": superUsers}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getUserPermissionsHandler() handles admin requests to list the permissions of a single user.
+func (app *application) getUserPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := app.readIDParam(r, "userID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user, err := app.models.Users.GetUserByID(userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	permissions, err := app.models.Permissions.GetAllPermissionsForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if permissions == nil {
+		permissions = data.Permissions{}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user_id": user.ID, "permissions": permissions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// grantUserPermissionsHandler() handles admin requests to grant one or more permissions to a
+// user. Every code must exist and none may already be held by the user.
+func (app *application) grantUserPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := app.readIDParam(r, "userID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Permissions []string `json:"permissions"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	userPermission := &data.UserPermission{
+		UserID:      userID,
+		Permissions: input.Permissions,
+	}
+	v := validator.New()
+	if data.ValidatePermissionsAddition(v, userPermission); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Only codes that exist can be granted
+	knownPermissions, err := app.models.Permissions.GetAllPermissions()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	knownCodes := make([]string, 0, len(knownPermissions))
+	for _, permission := range knownPermissions {
+		knownCodes = append(knownCodes, permission.Code)
+	}
+	for _, code := range input.Permissions {
+		if !validator.PermittedValue(code, knownCodes...) {
+			v.AddError("permissions", "unknown permission code "+code)
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	user, err := app.models.Users.GetUserByID(userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	admin := app.contextGetUser(r)
+	granted, err := app.models.Permissions.AddPermissionsForUser(admin.ID, user.ID, input.Permissions...)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicatePermission):
+			app.errorResponse(w, r, http.StatusConflict, "the user already has one or more of these permissions")
+		case errors.Is(err, data.ErrPermissionNotFound):
+			v.AddError("permissions", "unknown permission code")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.logger.Info("Permissions granted",
+		zap.Int64("admin_id", admin.ID),
+		zap.Int64("user_id", user.ID),
+		zap.Strings("permissions", input.Permissions))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"permissions": granted}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revokeUserPermissionHandler() handles admin requests to revoke a single permission from a
+// user. Admins cannot revoke their own admin:write permission so the last admin can't lock
+// everyone out.
+func (app *application) revokeUserPermissionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := app.readIDParam(r, "userID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	permissionCode := chi.URLParam(r, "permissionCode")
+
+	v := validator.New()
+	data.ValidatePermissionsDeletion(v, userID, permissionCode)
+	data.ValidatePermission(v, permissionCode)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	admin := app.contextGetUser(r)
+	if admin.ID == userID && permissionCode == data.PermissionAdminWrite {
+		v.AddError("permissions", "you cannot revoke your own admin:write permission")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.Permissions.DeletePermissionsForUser(admin.ID, userID, permissionCode)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrPermissionNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.logger.Info("Permission revoked",
+		zap.Int64("admin_id", admin.ID),
+		zap.Int64("user_id", userID),
+		zap.String("permission", permissionCode))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "permission revoked successfully"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getPermissionAuditLogHandler() handles admin requests to list permission changes, newest
+// first. It can be narrowed down to a single user with the user_id query parameter.
+func (app *application) getPermissionAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		UserID int
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.UserID = app.readInt(qs, "user_id", 0, v)
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	// entries are always returned newest first
+	input.Filters.Sort = app.readString(qs, "", "")
+	input.Filters.SortSafelist = []string{"", ""}
+	v.Check(input.UserID >= 0, "user_id", "must be a positive integer")
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	entries, metadata, err := app.models.Permissions.GetPermissionAuditLog(int64(input.UserID), input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"audit_log": entries, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
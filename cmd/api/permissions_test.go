@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/data"
+	"github.com/go-chi/chi/v5"
+)
+
+// newAuthenticatedRequest builds a request as the given user with the chi URL parameters set, so
+// a handler can be called directly without going through the router and its middleware.
+func newAuthenticatedRequest(app *application, method, target, body string, userID int64, params map[string]string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	routeContext := chi.NewRouteContext()
+	for key, value := range params {
+		routeContext.URLParams.Add(key, value)
+	}
+	r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, routeContext))
+	return app.contextSetUser(r, &data.User{ID: userID, Activated: true})
+}
+
+func TestRevokeUserPermissionHandlerValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		userID         string
+		permissionCode string
+		expectedStatus int
+	}{
+		{"own admin:write", "7", "admin:write", http.StatusUnprocessableEntity},
+		{"badly formatted code", "8", "admin", http.StatusUnprocessableEntity},
+		{"invalid user ID", "0", "admin:read", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := createTestApp(t)
+			r := newAuthenticatedRequest(app, http.MethodDelete, "/v1/admin/permissions/users/"+tt.userID+"/"+tt.permissionCode, "", 7,
+				map[string]string{"userID": tt.userID, "permissionCode": tt.permissionCode})
+			w := httptest.NewRecorder()
+
+			app.revokeUserPermissionHandler(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestGrantUserPermissionsHandlerValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{"empty body", ``, http.StatusBadRequest},
+		{"unknown field", `{"codes": ["admin:read"]}`, http.StatusBadRequest},
+		{"no permissions", `{"permissions": []}`, http.StatusUnprocessableEntity},
+		{"badly formatted permission", `{"permissions": ["admin"]}`, http.StatusUnprocessableEntity},
+		{"duplicate permissions", `{"permissions": ["admin:read", "admin:read"]}`, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := createTestApp(t)
+			r := newAuthenticatedRequest(app, http.MethodPost, "/v1/admin/permissions/users/2", tt.body, 1,
+				map[string]string{"userID": "2"})
+			w := httptest.NewRecorder()
+
+			app.grantUserPermissionsHandler(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
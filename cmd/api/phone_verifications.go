@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/data"
+	"github.com/Blue-Davinci/SavannaCart/internal/validator"
+	"go.uber.org/zap"
+)
+
+// createPhoneVerificationHandler() texts a 6 digit code to the user's phone number, which
+// they send back to verifyPhoneNumberHandler() to prove the number is theirs. Any code sent
+// before stops working.
+func (app *application) createPhoneVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := app.models.Users.GetUserByID(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(user.PhoneNumber != "", "phone_number", "must be set before it can be verified")
+	v.Check(!user.PhoneVerified, "phone_number", "is already verified")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if !app.sms.IsEnabled() {
+		app.errorResponse(w, r, http.StatusServiceUnavailable, "phone numbers can't be verified at the moment")
+		return
+	}
+
+	code, err := app.models.PhoneVerifications.New(user.ID, user.PhoneNumber)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.background(func() {
+		err := app.sms.SendVerificationCode(user.PhoneNumber, code, data.DefaultPhoneVerificationExpiryTime)
+		if err != nil {
+			app.logger.Error("Error sending phone verification code", zap.Int64("user_id", user.ID), zap.Error(err))
+		}
+	})
+
+	response := envelope{"message": "a verification code has been sent to your phone number"}
+	err = app.writeJSON(w, http.StatusAccepted, response, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// verifyPhoneNumberHandler() marks the user's phone number as verified once they send back
+// the code we texted them. After MaxPhoneVerificationAttempts wrong codes a new one has to
+// be requested.
+func (app *application) verifyPhoneNumberHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code string `json:"code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidatePhoneVerificationCode(v, input.Code); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetUserByID(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.models.PhoneVerifications.Verify(user.ID, user.PhoneNumber, input.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidPhoneVerificationCode):
+			v.AddError("code", "is incorrect")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrPhoneVerificationNotFound):
+			v.AddError("code", "has expired or was never sent, request a new one")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrTooManyPhoneVerificationAttempts):
+			app.errorResponse(w, r, http.StatusTooManyRequests, "too many incorrect codes, request a new one")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "your phone number has been verified"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
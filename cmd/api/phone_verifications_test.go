@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVerifyPhoneNumberHandlerValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{"empty body", ``, http.StatusBadRequest},
+		{"missing code", `{}`, http.StatusUnprocessableEntity},
+		{"short code", `{"code": "123"}`, http.StatusUnprocessableEntity},
+		{"letters", `{"code": "12345a"}`, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := createTestApp(t)
+			r := newAuthenticatedRequest(app, http.MethodPut, "/v1/api/user/phone/verification", tt.body, 1, nil)
+			w := httptest.NewRecorder()
+
+			app.verifyPhoneNumberHandler(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -1,38 +1,72 @@
 package main
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/Blue-Davinci/SavannaCart/internal/data"
 	"github.com/Blue-Davinci/SavannaCart/internal/validator"
 	"github.com/shopspring/decimal"
 )
 
+// getAllProductsHandler() lists the products in the catalog. Customers can search the names and
+// descriptions, narrow the list down to a category and its subcategories, a price range or
+// products in stock, and sort it by price, newest or name. Listings sorted by created_at can
+// also be paged with the cursor of the previous page.
 func (app *application) getAllProductsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	categoryID := app.readInt(r.URL.Query(), "category_id", 0, v)
+	app.listProducts(w, r, categoryID, v)
+}
+
+// getCategoryProductsHandler() lists the products in a category and all of its subcategories.
+// It takes the same searches, filters, sorts and cursors as getAllProductsHandler().
+func (app *application) getCategoryProductsHandler(w http.ResponseWriter, r *http.Request) {
+	categoryID, err := app.readIDParam(r, "categoryID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	v := validator.New()
+	data.ValidateURLID(v, categoryID, "categoryID")
+	app.listProducts(w, r, int(categoryID), v)
+}
+
+// listProducts() reads the searches, filters and pagination of a product listing from the query
+// string and writes the page of products in the category and its subcategories, or in every
+// category when categoryID is 0. Errors already found by the caller are reported with the rest.
+func (app *application) listProducts(w http.ResponseWriter, r *http.Request, categoryID int, v *validator.Validator) {
 	// make a struct to hold what we would want from the queries
 	var input struct {
-		Name string
+		data.ProductSearch
 		data.Filters
 	}
-	v := validator.New()
 	// Call r.URL.Query() to get the url.Values map containing the query string data.
 	qs := r.URL.Query()
-	// get our parameters
-	input.Name = app.readString(qs, "name", "")
+	// get our parameters, "name" is what the search used to be called
+	input.Search = app.readString(qs, "search", app.readString(qs, "name", ""))
+	input.CategoryID = categoryID
+	input.MinPrice = app.readDecimal(qs, "min_price", decimal.Zero, v)
+	input.MaxPrice = app.readDecimal(qs, "max_price", decimal.Zero, v)
+	input.InStock = app.readBoolean(qs, "in_stock", false, v)
 	//get the page & pagesizes as ints and set to the embedded struct
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
-	// We don't use any sort for this endpoint
-	input.Filters.Sort = app.readString(qs, "", "")
-	// None of the sort values are supported for this endpoint
-	input.Filters.SortSafelist = []string{"", ""}
-	// Perform validation
+	// No sort lists the best matches of a search first, and products by name otherwise
+	input.Filters.Sort = app.readString(qs, "sort", "")
+	input.Filters.SortSafelist = []string{"", "name", "-name", "price_kes", "-price_kes", "created_at", "-created_at"}
+	input.Filters.Cursor = app.readString(qs, "cursor", "")
+	input.Filters.CursorSecret = []byte(app.config.pagination.cursorSecret)
+	// Perform validation, cursors are positions in a listing by created_at
+	data.ValidateProductSearch(v, input.ProductSearch)
+	v.Check(input.Filters.Cursor == "" || strings.TrimPrefix(input.Filters.Sort, "-") == "created_at", "cursor", "can only be used when sorting by created_at")
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 	// now get our actual products
-	products, metadata, err := app.models.Products.GetAllProducts(input.Name, input.Filters)
+	products, metadata, err := app.models.Products.GetAllProducts(input.ProductSearch, input.Filters)
 	if err != nil {
 		switch {
 		case err == data.ErrGeneralRecordNotFound:
@@ -43,7 +77,7 @@ func (app *application) getAllProductsHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 	// Return the products as a JSON response.
-	err = app.writeJSON(w, http.StatusOK, envelope{"products": products, "metadata": metadata}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"products": products, "metadata": metadata}, app.paginationHeaders(r, metadata))
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -107,3 +141,283 @@ func (app *application) createNewProductsHandler(w http.ResponseWriter, r *http.
 	}
 
 }
+
+// getProductByIDHandler handles the request to get a single product by its ID.
+// It expects the product ID to be provided in the URL as a path parameter.
+func (app *application) getProductByIDHandler(w http.ResponseWriter, r *http.Request) {
+	// get id from url
+	productID, err := app.readIDParam(r, "productID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// validate the product ID
+	v := validator.New()
+	if data.ValidateURLID(v, productID, "productID"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	product, err := app.models.Products.GetProductByID(int32(productID))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// Return the product as a JSON response.
+	err = app.writeJSON(w, http.StatusOK, envelope{"product": product}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateProductHandler handles the request to update a product.
+// It expects the product ID and version ID to be provided in the URL as path parameters,
+// and the fields to change in the request body as JSON. Stock is not updated here,
+// use the stock adjustment endpoint for that so the change is recorded with a reason.
+func (app *application) updateProductHandler(w http.ResponseWriter, r *http.Request) {
+	// get the product ID from the URL
+	productID, err := app.readIDParam(r, "productID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// get versionID from the URL
+	versionID, err := app.readIDParam(r, "versionID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	v := validator.New()
+	// validate the product ID
+	if data.ValidateURLID(v, productID, "productID"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// validate the version ID
+	if data.ValidateURLID(v, versionID, "versionID"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// only the supplied fields are updated
+	var input struct {
+		Name        *string          `json:"name"`
+		PriceKES    *decimal.Decimal `json:"price_kes"`
+		CategoryID  *int32           `json:"category_id"`
+		Description *string          `json:"description"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	// check if the exact product version exists
+	product, err := app.models.Products.GetProductByIDAndVersion(int32(productID), int32(versionID))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// check to see which fields we want to update
+	if input.Name != nil {
+		product.Name = *input.Name
+	}
+	if input.PriceKES != nil {
+		product.PriceKES = *input.PriceKES
+	}
+	if input.CategoryID != nil {
+		product.CategoryID = *input.CategoryID
+	}
+	if input.Description != nil {
+		product.Description = *input.Description
+	}
+	// validate the updated product
+	if data.ValidateProduct(v, product); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// update the product in the database
+	err = app.models.Products.UpdateProduct(product)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateProductName):
+			v.AddError("name", "a product with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrInvalidCategoryID):
+			v.AddError("category_id", "the provided category ID is invalid")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// reload so the response carries the (possibly new) category details
+	product, err = app.models.Products.GetProductByID(product.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Return the updated product as a JSON response.
+	err = app.writeJSON(w, http.StatusOK, envelope{"product": product}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteProductByIDHandler handles the request to delete a product by its ID.
+// Products that have already been ordered cannot be deleted, their stock should be
+// adjusted to 0 instead.
+func (app *application) deleteProductByIDHandler(w http.ResponseWriter, r *http.Request) {
+	// get id from url
+	productID, err := app.readIDParam(r, "productID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// validate the product ID
+	v := validator.New()
+	if data.ValidateURLID(v, productID, "productID"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// delete the product from the database
+	err = app.models.Products.DeleteProductByID(int32(productID))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrProductHasOrders):
+			app.errorResponse(w, r, http.StatusConflict, err.Error())
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "product deleted successfully"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// adjustProductStockHandler handles the admin request to change a product's stock.
+// It expects a JSON body with a signed quantity_change and a reason, which is recorded
+// together with the admin who made the change.
+func (app *application) adjustProductStockHandler(w http.ResponseWriter, r *http.Request) {
+	// get id from url
+	productID, err := app.readIDParam(r, "productID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// validate the product ID
+	v := validator.New()
+	if data.ValidateURLID(v, productID, "productID"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	var input struct {
+		QuantityChange int32  `json:"quantity_change"`
+		Reason         string `json:"reason"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if data.ValidateStockAdjustment(v, input.QuantityChange, input.Reason); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// get the product so we can validate the stock it would end up with
+	product, err := app.models.Products.GetProductByID(int32(productID))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	product.StockQuantity += input.QuantityChange
+	if data.ValidateProduct(v, product); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// apply the adjustment, the stock is re-checked under a row lock
+	adjustment, err := app.models.Products.AdjustProductStock(int32(productID), int32(app.contextGetUser(r).ID), input.QuantityChange, input.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrInsufficientStock):
+			v.AddError("quantity_change", "would take the stock below 0")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	product, err = app.models.Products.GetProductByID(int32(productID))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"product": product, "stock_adjustment": adjustment}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getProductStockAdjustmentsHandler handles the admin request to list the recorded stock
+// adjustments for a product, newest first.
+func (app *application) getProductStockAdjustmentsHandler(w http.ResponseWriter, r *http.Request) {
+	// get id from url
+	productID, err := app.readIDParam(r, "productID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	// validate the product ID
+	v := validator.New()
+	if data.ValidateURLID(v, productID, "productID"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	var input struct {
+		data.Filters
+	}
+	qs := r.URL.Query()
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	// adjustments are always returned newest first
+	input.Filters.Sort = app.readString(qs, "", "")
+	input.Filters.SortSafelist = []string{"", ""}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	adjustments, metadata, err := app.models.Products.GetProductStockAdjustments(int32(productID), input.Filters)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrGeneralRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"stock_adjustments": adjustments, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetAllProductsHandlerValidation(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		expectedField string
+	}{
+		{"unknown sort", "?sort=stock_quantity", "sort"},
+		{"category not a number", "?category_id=towels", "category_id"},
+		{"negative category", "?category_id=-1", "category_id"},
+		{"price not a number", "?min_price=cheap", "min_price"},
+		{"negative price", "?max_price=-5", "max_price"},
+		{"max below min", "?min_price=500&max_price=100", "max_price"},
+		{"in stock not a boolean", "?in_stock=maybe", "in_stock"},
+		{"page size too large", "?page_size=101", "page_size"},
+		{"cursor we didn't sign", "?sort=-created_at&cursor=bm90.c2lnbmVk", "cursor"},
+		{"cursor without sorting by created_at", "?sort=price_kes&cursor=bm90.c2lnbmVk", "cursor"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := createTestApp(t)
+			r := httptest.NewRequest(http.MethodGet, "/v1/api/products"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			app.getAllProductsHandler(w, r)
+
+			if w.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusUnprocessableEntity, w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), `"`+tt.expectedField+`"`) {
+				t.Errorf("Expected an error for %q, got %s", tt.expectedField, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetCategoryProductsHandlerValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		categoryID     string
+		query          string
+		expectedStatus int
+		expectedField  string
+	}{
+		{"invalid category ID", "0", "", http.StatusNotFound, ""},
+		{"category out of range", "2147483648", "", http.StatusUnprocessableEntity, "category_id"},
+		{"unknown sort", "1", "?sort=stock_quantity", http.StatusUnprocessableEntity, "sort"},
+		{"max below min", "1", "?min_price=500&max_price=100", http.StatusUnprocessableEntity, "max_price"},
+		{"cursor without sorting by created_at", "1", "?cursor=bm90.c2lnbmVk", http.StatusUnprocessableEntity, "cursor"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := createTestApp(t)
+			r := newAuthenticatedRequest(app, http.MethodGet, "/v1/categories/"+tt.categoryID+"/products"+tt.query, "", 1,
+				map[string]string{"categoryID": tt.categoryID})
+			w := httptest.NewRecorder()
+
+			app.getCategoryProductsHandler(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedField != "" && !strings.Contains(w.Body.String(), `"`+tt.expectedField+`"`) {
+				t.Errorf("Expected an error for %q, got %s", tt.expectedField, w.Body.String())
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"expvar"
 	"net/http"
 
+	"github.com/Blue-Davinci/SavannaCart/internal/data"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/cors"
 	"github.com/justinas/alice"
@@ -13,37 +14,50 @@ import (
 // routes() is a method that returns a http.Handler that contains all the routes for the application
 func (app *application) routes() http.Handler {
 	router := chi.NewRouter()
+	// credentials are allowed so browsers keep the cookie set when a provider link is started
 	router.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   app.config.cors.trustedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "PATCH"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
 		ExposedHeaders:   []string{"link"},
-		AllowCredentials: false,
+		AllowCredentials: true,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	})) // Make our categorized routes
 	//Use alice to make a global middleware chain.
 	globalMiddleware := alice.New(app.metrics, app.recoverPanic, app.rateLimit, app.authenticate).Then
 
-	// dynamic protected middleware
-	dynamicMiddleware := alice.New(app.requireAuthenticatedUser, app.requireActivatedUser)
-	// Permission Middleware, this will apply to specific routes that are capped by the permissions
-	adminPermissionMiddleware := alice.New(app.requirePermission("admin:write"))
-
 	// Apply the global middleware to the router
 	router.Use(globalMiddleware)
 
+	// Mount the v1Router to the main base router
+	router.Mount("/v1", app.v1Routes())
+	return router
+}
+
+// v1Routes() is a method that returns a chi.Router that contains every v1 route. It expects
+// the global middleware to have already put the user in the request context.
+func (app *application) v1Routes() chi.Router {
+	// dynamic protected middleware
+	dynamicMiddleware := alice.New(app.requireAuthenticatedUser, app.requireActivatedUser)
+	// Permission Middleware, this will apply to specific routes that are capped by the permissions.
+	// Read only routes accept either admin permission, anything that changes data needs admin:write.
+	adminReadMiddleware := alice.New(app.requirePermission(data.PermissionAdminRead, data.PermissionAdminWrite))
+	adminWriteMiddleware := alice.New(app.requirePermission(data.PermissionAdminWrite))
+
 	v1Router := chi.NewRouter()
 
 	v1Router.Mount("/", app.generalRoutes())
 	v1Router.Mount("/api", app.apiKeyRoutes(&dynamicMiddleware))
 	// this are hybrid routes
-	v1Router.With(dynamicMiddleware.Then).Mount("/categories", app.categoryRoutes(&adminPermissionMiddleware))
-	v1Router.With(dynamicMiddleware.Then).Mount("/products", app.productRoutes(&adminPermissionMiddleware))
-	v1Router.With(dynamicMiddleware.Then).Mount("/orders", app.orderRoutes(&dynamicMiddleware))
-
-	// Mount the v1Router to the main base router
-	router.Mount("/v1", v1Router)
-	return router
+	v1Router.With(dynamicMiddleware.Then).Mount("/categories", app.categoryRoutes(&adminWriteMiddleware))
+	v1Router.With(dynamicMiddleware.Then).Mount("/products", app.productRoutes(&adminReadMiddleware, &adminWriteMiddleware))
+	v1Router.With(dynamicMiddleware.Then).Mount("/orders", app.orderRoutes(&adminReadMiddleware, &adminWriteMiddleware))
+	v1Router.With(dynamicMiddleware.Then).Mount("/cart", app.cartRoutes())
+	v1Router.With(dynamicMiddleware.Then).Mount("/admin", app.adminRoutes(&adminReadMiddleware, &adminWriteMiddleware))
+	// payment provider callbacks, these verify their own shared secret
+	v1Router.Mount("/payments", app.paymentRoutes())
+
+	return v1Router
 }
 
 // generalRoutes() is a method that returns a chi.Router that contains all the general routes
@@ -58,60 +72,176 @@ func (app *application) generalRoutes() chi.Router {
 
 func (app *application) apiKeyRoutes(dynamicMiddleware *alice.Chain) chi.Router {
 	apiKeyRoutes := chi.NewRouter()
+	// managing sign ins needs a real login, API keys can't be used for it
+	sessionMiddleware := dynamicMiddleware.Append(app.requireSessionAuthentication)
+	// password guessing and the emails anyone can ask us to send are limited far more than
+	// everything else
+	authRateLimit := app.limitRate(app.config.limiter.authRPS, app.config.limiter.authBurst)
 	// OAuth callback endpoint - must be GET since Google redirects with GET
 	apiKeyRoutes.Get("/authentication", app.createAuthenticationApiKeyHandler)
+	// Start an OAuth login, returns the provider URL to send the user to
+	apiKeyRoutes.Get("/authentication/start", app.startAuthenticationHandler)
+	// The same with any configured provider, each has its own callback
+	apiKeyRoutes.Get("/authentication/providers", app.listAuthenticationProvidersHandler)
+	apiKeyRoutes.Get("/authentication/providers/{providerID}", app.createAuthenticationApiKeyHandler)
+	apiKeyRoutes.Get("/authentication/providers/{providerID}/start", app.startAuthenticationHandler)
+	// Exchange a refresh token for a new authentication and refresh token
+	apiKeyRoutes.Post("/authentication/refresh", app.refreshAuthenticationTokenHandler)
 	apiKeyRoutes.Put("/activation", app.activateUserHandler)
+	// Send a new activation link, for when the first is lost or has expired
+	apiKeyRoutes.With(authRateLimit).Post("/activation", app.resendActivationTokenHandler)
+	// Email and password accounts, for those who can't use one of the providers
+	apiKeyRoutes.With(authRateLimit).Post("/users", app.registerUserHandler)
+	apiKeyRoutes.With(authRateLimit).Post("/authentication/password", app.createPasswordAuthenticationTokenHandler)
+	apiKeyRoutes.With(authRateLimit).Post("/authentication/password-reset", app.createPasswordResetTokenHandler)
+	apiKeyRoutes.With(authRateLimit).Put("/authentication/password-reset", app.updateUserPasswordHandler)
 	apiKeyRoutes.Get("/healthcheck", app.healthCheckHandler)
 
 	// updateUserInfo
 	apiKeyRoutes.With(dynamicMiddleware.Then).Patch("/user", app.updateUserInfo)
+	// prove the user's phone number is theirs before we send it any SMS, codes cost money
+	// so sending them shares the stricter limit
+	apiKeyRoutes.With(dynamicMiddleware.Then, authRateLimit).Post("/user/phone/verification", app.createPhoneVerificationHandler)
+	apiKeyRoutes.With(dynamicMiddleware.Then).Put("/user/phone/verification", app.verifyPhoneNumberHandler)
+	// the notifications a user wants by email and SMS
+	apiKeyRoutes.With(dynamicMiddleware.Then).Get("/user/preferences", app.getNotificationPreferencesHandler)
+	apiKeyRoutes.With(dynamicMiddleware.Then).Patch("/user/preferences", app.updateNotificationPreferencesHandler)
+	// one click unsubscribe links from our emails, the signed token stands in for a login.
+	// Opening the link only asks to confirm, scanners open links too. Confirming POSTs to it,
+	// as do mail clients when the user hits their unsubscribe button.
+	apiKeyRoutes.Get("/unsubscribe", app.showUnsubscribeHandler)
+	apiKeyRoutes.Post("/unsubscribe", app.unsubscribeHandler)
+	// the providers a user signs in with, they can link more and unlink them
+	apiKeyRoutes.With(sessionMiddleware.Then).Get("/user/identities", app.listUserIdentitiesHandler)
+	apiKeyRoutes.With(sessionMiddleware.Then).Post("/user/identities/providers/{providerID}", app.linkUserIdentityHandler)
+	apiKeyRoutes.With(sessionMiddleware.Then).Delete("/user/identities/{identityID:[0-9]+}", app.unlinkUserIdentityHandler)
 	// prometheus expose using promhttp.Handler()
 	apiKeyRoutes.Handle("/metrics", promhttp.Handler())
 	// logout route only applies to people who are registered
-	apiKeyRoutes.With(dynamicMiddleware.Then).Post("/logout", app.logoutUserHandler)
+	apiKeyRoutes.With(sessionMiddleware.Then).Post("/logout", app.logoutUserHandler)
+	// the devices a user is signed in on, they can sign out of one or all of them
+	apiKeyRoutes.With(sessionMiddleware.Then).Get("/sessions", app.listSessionsHandler)
+	apiKeyRoutes.With(sessionMiddleware.Then).Delete("/sessions", app.revokeAllSessionsHandler)
+	apiKeyRoutes.With(sessionMiddleware.Then).Delete("/sessions/{sessionID:[0-9]+}", app.revokeSessionHandler)
+	// personal API keys for machine clients, limited to the permissions they are given
+	apiKeyRoutes.With(sessionMiddleware.Then).Get("/api-keys", app.listAPIKeysHandler)
+	apiKeyRoutes.With(sessionMiddleware.Then).Post("/api-keys", app.createAPIKeyHandler)
+	apiKeyRoutes.With(sessionMiddleware.Then).Delete("/api-keys/{apiKeyID:[0-9]+}", app.revokeAPIKeyHandler)
 	return apiKeyRoutes
 }
 
-// category routes
-func (app *application) categoryRoutes(adminMIddleware *alice.Chain) chi.Router {
+// category routes, every admin route here changes data so they all need admin:write
+func (app *application) categoryRoutes(adminWriteMiddleware *alice.Chain) chi.Router {
 	categoryRoutes := chi.NewRouter()
 	// Get all categories, open to everyone who is authenticated
 	categoryRoutes.Get("/", app.getAllCategoriesHandler)
 
 	// Get category average price, open to everyone who is authenticated
 	categoryRoutes.Get("/{categoryID:[0-9]+}", app.getCategoryAveragePriceHandler)
+	// The category tree, a category's breadcrumbs and the products in it and its subcategories
+	categoryRoutes.Get("/tree", app.getCategoryTreeHandler)
+	categoryRoutes.Get("/{categoryID:[0-9]+}/breadcrumbs", app.getCategoryBreadcrumbsHandler)
+	categoryRoutes.Get("/{categoryID:[0-9]+}/products", app.getCategoryProductsHandler)
 
 	// Admin only routes
-	categoryRoutes.With(adminMIddleware.Then).Post("/", app.createNewCategoryHandler)
-	categoryRoutes.With(adminMIddleware.Then).Patch("/{categoryID:[0-9]+}/{versionID:[0-9]+}", app.updateCategoryHandler)
-	categoryRoutes.With(adminMIddleware.Then).Delete("/{categoryID:[0-9]+}", app.deleteCategoryByIDHandler)
+	categoryRoutes.With(adminWriteMiddleware.Then).Post("/", app.createNewCategoryHandler)
+	categoryRoutes.With(adminWriteMiddleware.Then).Patch("/{categoryID:[0-9]+}/{versionID:[0-9]+}", app.updateCategoryHandler)
+	categoryRoutes.With(adminWriteMiddleware.Then).Delete("/{categoryID:[0-9]+}", app.deleteCategoryByIDHandler)
 
 	return categoryRoutes
 }
 
 // productRoutes() is a method that returns a chi.Router that contains all the product routes
-func (app *application) productRoutes(adminMIddleware *alice.Chain) chi.Router {
+func (app *application) productRoutes(adminReadMiddleware, adminWriteMiddleware *alice.Chain) chi.Router {
 	productRoutes := chi.NewRouter()
 	// get all products, open to everyone who is authenticated
 	productRoutes.Get("/", app.getAllProductsHandler)
+	// get a single product, open to everyone who is authenticated
+	productRoutes.Get("/{productID:[0-9]+}", app.getProductByIDHandler)
 
-	// Create a new product, open to everyone who is authenticated
-	productRoutes.With(adminMIddleware.Then).Post("/", app.createNewProductsHandler)
+	// Admin only routes
+	productRoutes.With(adminWriteMiddleware.Then).Post("/", app.createNewProductsHandler)
+	productRoutes.With(adminWriteMiddleware.Then).Patch("/{productID:[0-9]+}/{versionID:[0-9]+}", app.updateProductHandler)
+	productRoutes.With(adminWriteMiddleware.Then).Delete("/{productID:[0-9]+}", app.deleteProductByIDHandler)
+	productRoutes.With(adminWriteMiddleware.Then).Post("/{productID:[0-9]+}/stock", app.adjustProductStockHandler)
+	productRoutes.With(adminReadMiddleware.Then).Get("/{productID:[0-9]+}/stock/adjustments", app.getProductStockAdjustmentsHandler)
 
 	return productRoutes
 }
 
-func (app *application) orderRoutes(adminPermissionMiddleware *alice.Chain) chi.Router {
+func (app *application) orderRoutes(adminReadMiddleware, adminWriteMiddleware *alice.Chain) chi.Router {
 	orderRoutes := chi.NewRouter()
 	// Create a new order, open to everyone who is authenticated
 	orderRoutes.Post("/", app.createOrderHandler)
 	// Get all orders, open to everyone who is authenticated
 	orderRoutes.Get("/", app.getUserOrdersHandler)
+	// Get or cancel one of the user's own orders
+	orderRoutes.Get("/{orderID:[0-9]+}", app.getUserOrderHandler)
+	orderRoutes.Post("/{orderID:[0-9]+}/cancel", app.cancelUserOrderHandler)
+	// Status history, for the order's owner and admins
+	orderRoutes.Get("/{orderID:[0-9]+}/history", app.getOrderHistoryHandler)
+	// Pay for one of the user's own orders with M-Pesa and list the attempts
+	orderRoutes.Post("/{orderID:[0-9]+}/pay", app.initiateOrderPaymentHandler)
+	orderRoutes.Get("/{orderID:[0-9]+}/payments", app.getOrderPaymentsHandler)
 
 	// admin only routes
-	orderRoutes.With(adminPermissionMiddleware.Then).Get("/admin", app.getAllOrdersHandler)
-	orderRoutes.With(adminPermissionMiddleware.Then).Get("/statistics", app.getOrderStatisticsHandler)
-	orderRoutes.With(adminPermissionMiddleware.Then).Patch("/{orderID:[0-9]+}", app.updateOrderStatusHandler)
+	orderRoutes.With(adminReadMiddleware.Then).Get("/admin", app.getAllOrdersHandler)
+	orderRoutes.With(adminReadMiddleware.Then).Get("/statistics", app.getOrderStatisticsHandler)
+	orderRoutes.With(adminWriteMiddleware.Then).Patch("/{orderID:[0-9]+}", app.updateOrderStatusHandler)
 
 	return orderRoutes
 }
+
+// cartRoutes() is a method that returns a chi.Router that contains all the cart routes.
+// Every cart route acts on the authenticated user's own cart.
+func (app *application) cartRoutes() chi.Router {
+	cartRoutes := chi.NewRouter()
+	cartRoutes.Get("/", app.getCartHandler)
+	cartRoutes.Delete("/", app.clearCartHandler)
+	cartRoutes.Post("/items", app.addCartItemHandler)
+	cartRoutes.Patch("/items/{productID:[0-9]+}", app.updateCartItemHandler)
+	cartRoutes.Delete("/items/{productID:[0-9]+}", app.removeCartItemHandler)
+	// Turn the cart into an order
+	cartRoutes.Post("/checkout", app.checkoutCartHandler)
+
+	return cartRoutes
+}
+
+// adminRoutes() is a method that returns a chi.Router that contains the admin only routes
+// that don't belong to any other resource. Every route requires one of the admin permissions,
+// and the ones that change data require admin:write.
+func (app *application) adminRoutes(adminReadMiddleware, adminWriteMiddleware *alice.Chain) chi.Router {
+	adminRoutes := chi.NewRouter()
+	adminRoutes.Use(adminReadMiddleware.Then)
+
+	// Permission management, every grant and revoke is audit logged
+	adminRoutes.Get("/permissions", app.getAllPermissionsHandler)
+	adminRoutes.Get("/permissions/superusers", app.getAllSuperUsersHandler)
+	adminRoutes.Get("/permissions/audit", app.getPermissionAuditLogHandler)
+	adminRoutes.Get("/permissions/users/{userID:[0-9]+}", app.getUserPermissionsHandler)
+	adminRoutes.With(adminWriteMiddleware.Then).Post("/permissions/users/{userID:[0-9]+}", app.grantUserPermissionsHandler)
+	adminRoutes.With(adminWriteMiddleware.Then).Delete("/permissions/users/{userID:[0-9]+}/{permissionCode}", app.revokeUserPermissionHandler)
+
+	// The notification outbox, failed deliveries can be sent again
+	adminRoutes.Get("/notifications", app.listNotificationsHandler)
+	adminRoutes.Get("/notifications/{notificationID:[0-9]+}", app.getNotificationHandler)
+	adminRoutes.With(adminWriteMiddleware.Then).Post("/notifications/{notificationID:[0-9]+}/retry", app.retryNotificationHandler)
+
+	// Payments that took the customer's money but couldn't settle their order
+	adminRoutes.With(adminWriteMiddleware.Then).Post("/payments/{paymentID:[0-9]+}/resolve", app.resolvePaymentReviewHandler)
+
+	// Email templates rendered with sample data, to check them without sending anything
+	adminRoutes.Get("/email-templates", app.listEmailTemplatesHandler)
+	adminRoutes.Get("/email-templates/{templateName}", app.previewEmailTemplateHandler)
+
+	return adminRoutes
+}
+
+// paymentRoutes() is a method that returns a chi.Router that contains the payment provider
+// callbacks. They are called by the provider, not by users, so they are not authenticated.
+func (app *application) paymentRoutes() chi.Router {
+	paymentRoutes := chi.NewRouter()
+	paymentRoutes.Post("/mpesa/callback", app.mpesaCallbackHandler)
+
+	return paymentRoutes
+}
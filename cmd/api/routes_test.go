@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/data"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// newPermissionTestRouter mounts the v1 routes behind a middleware that signs in an activated
+// user holding the given permissions. The permissions are put straight into the request
+// context, so the permission checks never need the database. Handlers that get past them
+// without a database panic and are answered with a 500 by recoverPanic.
+func newPermissionTestRouter(app *application, permissions data.Permissions) http.Handler {
+	router := chi.NewRouter()
+	router.Use(app.recoverPanic)
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = app.contextSetUser(r, &data.User{ID: 1, Activated: true})
+			r = app.contextSetPermissions(r, permissions)
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.Mount("/v1", app.v1Routes())
+	return router
+}
+
+func TestAdminRoutePermissions(t *testing.T) {
+	const (
+		customer = ""
+		read     = "read"
+		write    = "write"
+	)
+	routes := []struct {
+		method   string
+		path     string
+		requires string
+	}{
+		// customer routes must not be affected by the admin permissions
+		{http.MethodGet, "/v1/orders", customer},
+		{http.MethodGet, "/v1/cart", customer},
+		{http.MethodGet, "/v1/categories", customer},
+		{http.MethodGet, "/v1/categories/tree", customer},
+		{http.MethodGet, "/v1/categories/1/breadcrumbs", customer},
+		{http.MethodGet, "/v1/categories/1/products", customer},
+
+		{http.MethodGet, "/v1/orders/admin", read},
+		{http.MethodGet, "/v1/orders/statistics", read},
+		{http.MethodGet, "/v1/products/1/stock/adjustments", read},
+		{http.MethodGet, "/v1/admin/permissions", read},
+		{http.MethodGet, "/v1/admin/permissions/superusers", read},
+		{http.MethodGet, "/v1/admin/permissions/audit", read},
+		{http.MethodGet, "/v1/admin/permissions/users/2", read},
+		{http.MethodGet, "/v1/admin/notifications", read},
+		{http.MethodGet, "/v1/admin/notifications/1", read},
+		{http.MethodGet, "/v1/admin/email-templates", read},
+		{http.MethodGet, "/v1/admin/email-templates/user_welcome.tmpl", read},
+
+		{http.MethodPost, "/v1/categories", write},
+		{http.MethodPatch, "/v1/categories/1/1", write},
+		{http.MethodDelete, "/v1/categories/1", write},
+		{http.MethodPost, "/v1/products", write},
+		{http.MethodPatch, "/v1/products/1/1", write},
+		{http.MethodDelete, "/v1/products/1", write},
+		{http.MethodPost, "/v1/products/1/stock", write},
+		{http.MethodPatch, "/v1/orders/1", write},
+		{http.MethodPost, "/v1/admin/permissions/users/2", write},
+		{http.MethodDelete, "/v1/admin/permissions/users/2/admin:read", write},
+		{http.MethodPost, "/v1/admin/notifications/1/retry", write},
+	}
+	users := []struct {
+		name        string
+		permissions data.Permissions
+		canRead     bool
+		canWrite    bool
+	}{
+		{"customer", data.Permissions{}, false, false},
+		{"support staff", data.Permissions{data.PermissionAdminRead}, true, false},
+		{"write only admin", data.Permissions{data.PermissionAdminWrite}, true, true},
+		{"admin", data.Permissions{data.PermissionAdminRead, data.PermissionAdminWrite}, true, true},
+	}
+
+	app := createTestApp(t)
+	app.logger = zap.NewNop()
+
+	for _, user := range users {
+		router := newPermissionTestRouter(app, user.permissions)
+		for _, route := range routes {
+			t.Run(user.name+" "+route.method+" "+route.path, func(t *testing.T) {
+				allowed := route.requires == customer ||
+					(route.requires == read && user.canRead) ||
+					(route.requires == write && user.canWrite)
+
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest(route.method, route.path, nil))
+
+				if w.Code == http.StatusNotFound || w.Code == http.StatusMethodNotAllowed {
+					t.Fatalf("Route is not registered, got status %d", w.Code)
+				}
+				if forbidden := w.Code == http.StatusForbidden; forbidden == allowed {
+					t.Errorf("Expected allowed=%v, got status %d: %s", allowed, w.Code, w.Body.String())
+				}
+			})
+		}
+	}
+}
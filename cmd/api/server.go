@@ -23,6 +23,10 @@ func (app *application) server() error {
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 60 * time.Second,
 	}
+	// start the scheduled jobs, they are stopped before we wait for the background tasks
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	app.startScheduledJobs(jobsCtx)
 	// make a channel to listen for shutdown signals
 	shutdownChan := make(chan error)
 	// start a background routine, this will listen to any shutdown signals
@@ -46,6 +50,7 @@ func (app *application) server() error {
 		// complete their tasks.
 		app.logger.Info("completing background tasks...", zap.String("addr", srv.Addr))
 		// wait for any background tasks to complete
+		stopJobs()
 		app.wg.Wait()
 
 		// Call Shutdown() on our server, passing in the context we just made.
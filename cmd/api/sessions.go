@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/data"
+	"github.com/Blue-Davinci/SavannaCart/internal/validator"
+	"go.uber.org/zap"
+)
+
+// refreshAuthenticationTokenHandler() exchanges a refresh token for a new authentication and
+// refresh token. Each refresh token works once, presenting one again signs its session out.
+func (app *application) refreshAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateRefreshToken(v, input.RefreshToken); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	sessionTokens, err := app.models.Sessions.Refresh(input.RefreshToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRefreshTokenReused):
+			app.logger.Warn("Refresh token reused, session revoked",
+				zap.String("ip_address", r.RemoteAddr),
+				zap.String("user_agent", r.UserAgent()))
+			app.invalidAuthenticationTokenResponse(w, r)
+		case errors.Is(err, data.ErrInvalidRefreshToken):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{
+		"authentication_token": sessionTokens.AuthenticationToken,
+		"refresh_token":        sessionTokens.RefreshToken,
+		"session":              sessionTokens.Session,
+	}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listSessionsHandler() returns the devices the user is signed in on, marking the one the
+// request was made from.
+func (app *application) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	sessions, err := app.models.Sessions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	currentSessionID, err := app.currentSessionID(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	for _, session := range sessions {
+		session.Current = session.ID == currentSessionID
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"sessions": sessions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revokeSessionHandler() signs the user out of one of their sessions.
+func (app *application) revokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := app.readIDParam(r, "sessionID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	user := app.contextGetUser(r)
+
+	err = app.models.Sessions.Revoke(user.ID, sessionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrSessionNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "session revoked successfully"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revokeAllSessionsHandler() signs the user out on every device, including this one.
+func (app *application) revokeAllSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	err := app.models.Sessions.RevokeAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "all sessions revoked successfully"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// currentSessionID() returns the ID of the session the request's authentication token
+// belongs to, or 0 for tokens issued before sessions existed.
+func (app *application) currentSessionID(r *http.Request) (int64, error) {
+	session, err := app.models.Sessions.GetForToken(data.ScopeAuthentication, app.bearerToken(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrSessionNotFound):
+			return 0, nil
+		default:
+			return 0, err
+		}
+	}
+	return session.ID, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRefreshAuthenticationTokenHandlerValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{"empty body", ``, http.StatusBadRequest},
+		{"unknown field", `{"token": "ABCDEFGHIJKLMNOPQRSTUVWXYZ"}`, http.StatusBadRequest},
+		{"missing token", `{}`, http.StatusUnprocessableEntity},
+		{"badly formatted token", `{"refresh_token": "too-short"}`, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := createTestApp(t)
+			r := httptest.NewRequest(http.MethodPost, "/v1/api/authentication/refresh", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			app.refreshAuthenticationTokenHandler(w, r)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRevokeSessionHandlerInvalidID(t *testing.T) {
+	app := createTestApp(t)
+	r := newAuthenticatedRequest(app, http.MethodDelete, "/v1/api/sessions/0", "", 7, map[string]string{"sessionID": "0"})
+	w := httptest.NewRecorder()
+
+	app.revokeSessionHandler(w, r)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d: %s", http.StatusNotFound, w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,13 @@
+-- Create product_stock_adjustments table
+CREATE TABLE product_stock_adjustments (
+    id                SERIAL PRIMARY KEY,
+    product_id        INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    adjusted_by       INTEGER REFERENCES users(id) ON DELETE SET NULL, -- Admin who made the change
+    quantity_change   INTEGER NOT NULL CHECK (quantity_change <> 0),
+    previous_quantity INTEGER NOT NULL,
+    new_quantity      INTEGER NOT NULL CHECK (new_quantity >= 0),
+    reason            TEXT NOT NULL,
+    created_at        TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_product_stock_adjustments_product ON product_stock_adjustments(product_id, created_at DESC);
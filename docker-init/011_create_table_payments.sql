@@ -0,0 +1,20 @@
+-- Create payments table
+CREATE TABLE payments (
+    id                   SERIAL PRIMARY KEY,
+    order_id             INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    provider             VARCHAR(20) NOT NULL DEFAULT 'MPESA',
+    phone_number         VARCHAR(20) NOT NULL,
+    amount_kes           NUMERIC(14,2) NOT NULL CHECK (amount_kes > 0),
+    status               VARCHAR(20) NOT NULL DEFAULT 'PENDING' CHECK (status IN ('PENDING', 'SUCCESS', 'FAILED')),
+    merchant_request_id  TEXT,
+    checkout_request_id  TEXT UNIQUE,
+    mpesa_receipt_number TEXT UNIQUE,
+    result_code          INTEGER,
+    result_desc          TEXT,
+    created_at           TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at           TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_payments_order ON payments(order_id, created_at DESC);
+-- At most one payment attempt in flight per order
+CREATE UNIQUE INDEX ux_payments_order_pending ON payments(order_id) WHERE status = 'PENDING';
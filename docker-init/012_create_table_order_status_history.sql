@@ -0,0 +1,12 @@
+-- Create order_status_history table
+CREATE TABLE order_status_history (
+    id          SERIAL PRIMARY KEY,
+    order_id    INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    from_status TEXT, -- NULL for the entry recorded when the order is placed
+    to_status   TEXT NOT NULL,
+    changed_by  INTEGER REFERENCES users(id) ON DELETE SET NULL, -- NULL for system changes such as payment callbacks
+    note        TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_order_status_history_order ON order_status_history(order_id, created_at);
@@ -0,0 +1,11 @@
+-- Create permission_audit_log table
+CREATE TABLE permission_audit_log (
+    id              BIGSERIAL PRIMARY KEY,
+    actor_id        BIGINT REFERENCES users(id) ON DELETE SET NULL, -- Admin who made the change
+    user_id         BIGINT REFERENCES users(id) ON DELETE SET NULL, -- User whose permissions changed
+    action          TEXT NOT NULL CHECK (action IN ('GRANT', 'REVOKE')),
+    permission_code TEXT NOT NULL,
+    created_at      TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_permission_audit_log_user ON permission_audit_log(user_id, created_at DESC);
@@ -0,0 +1,9 @@
+-- Create oauth_states table
+CREATE TABLE IF NOT EXISTS oauth_states (
+    state_hash    BYTEA PRIMARY KEY, -- SHA-256 of the state sent to the provider
+    code_verifier TEXT NOT NULL,     -- PKCE verifier, only ever sent to the provider's token endpoint
+    expiry        TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    created_at    TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_oauth_states_expiry ON oauth_states(expiry);
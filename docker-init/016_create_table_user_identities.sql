@@ -0,0 +1,25 @@
+-- Create user_identities table
+CREATE TABLE IF NOT EXISTS user_identities (
+    id            BIGSERIAL PRIMARY KEY,
+    user_id       BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider      TEXT NOT NULL,                 -- ID of the configured OIDC provider, e.g. google
+    subject       TEXT NOT NULL,                 -- The provider's subject identifier for the user
+    email         CITEXT NOT NULL,               -- Email the provider last reported
+    created_at    TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_login_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (provider, subject)
+);
+
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
+
+-- Every existing user signed up with Google
+INSERT INTO user_identities (user_id, provider, subject, email)
+SELECT id, 'google', oidc_sub, email FROM users WHERE oidc_sub <> '';
+
+-- Subjects are only unique per provider, user_identities keeps track of them now
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_oidc_sub_key;
+
+-- Logins remember the provider they were started with, and the user when linking a provider
+ALTER TABLE oauth_states
+    ADD COLUMN provider     TEXT NOT NULL DEFAULT 'google',
+    ADD COLUMN link_user_id BIGINT REFERENCES users(id) ON DELETE CASCADE;
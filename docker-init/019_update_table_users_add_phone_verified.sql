@@ -0,0 +1,5 @@
+-- Add phone_verified to users and attempts to tokens
+ALTER TABLE users ADD COLUMN phone_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Wrong guesses at a one time code, the code stops working after a few of them
+ALTER TABLE tokens ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
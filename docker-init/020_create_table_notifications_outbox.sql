@@ -0,0 +1,19 @@
+-- Create notifications_outbox table
+CREATE TABLE IF NOT EXISTS notifications_outbox (
+    id              BIGSERIAL PRIMARY KEY,
+    idempotency_key TEXT NOT NULL UNIQUE,            -- Enqueuing the same notification twice is a no-op
+    kind            TEXT NOT NULL,                   -- What to send, such as order_status_email
+    payload         JSONB NOT NULL DEFAULT '{}',     -- What the sender needs to build the message
+    status          TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'skipped', 'dead')),
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    max_attempts    INTEGER NOT NULL,
+    next_attempt_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(), -- Pushed back while a worker holds it and after each failure
+    last_error      TEXT NOT NULL DEFAULT '',
+    created_at      TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    sent_at         TIMESTAMP(0) WITH TIME ZONE
+);
+
+-- Workers only look for pending notifications that are due
+CREATE INDEX idx_notifications_outbox_due ON notifications_outbox(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX idx_notifications_outbox_status ON notifications_outbox(status, created_at);
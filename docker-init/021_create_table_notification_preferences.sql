@@ -0,0 +1,13 @@
+-- Create notification_preferences table
+-- Which notifications a user wants, by channel and event. Users without a row get the defaults,
+-- everything about their orders and no marketing.
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id            BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    email_order_placed BOOLEAN NOT NULL DEFAULT TRUE,
+    email_order_status BOOLEAN NOT NULL DEFAULT TRUE,
+    email_marketing    BOOLEAN NOT NULL DEFAULT FALSE,
+    sms_order_placed   BOOLEAN NOT NULL DEFAULT TRUE,
+    sms_order_status   BOOLEAN NOT NULL DEFAULT TRUE,
+    sms_marketing      BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at         TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,3 @@
+-- Add language to notification_preferences
+-- The language emails are sent to the user in, templates without a translation are sent in English
+ALTER TABLE notification_preferences ADD COLUMN language TEXT NOT NULL DEFAULT 'en';
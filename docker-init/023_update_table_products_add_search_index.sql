@@ -0,0 +1,7 @@
+-- Add the product search and created_at indexes
+CREATE INDEX idx_products_search ON products USING GIN (
+    (setweight(to_tsvector('simple', name), 'A') || setweight(to_tsvector('simple', coalesce(description, '')), 'B'))
+);
+
+-- Newest first is a common sort when browsing products
+CREATE INDEX idx_products_created_at ON products (created_at, id);
@@ -0,0 +1,4 @@
+-- Add the indexes order listings are paged by
+CREATE INDEX idx_orders_created_at ON orders (created_at DESC, id DESC);
+
+CREATE INDEX idx_orders_user_created_at ON orders (user_id, created_at DESC, id DESC);
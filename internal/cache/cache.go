@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Cache is an in-process key/value store whose entries expire a fixed TTL after they were
+// set. It is safe for concurrent use and counts its hits and misses so they can be exported
+// as metrics. A nil *Cache, or one with a TTL of zero, never stores anything, so models work
+// the same way with caching switched off.
+type Cache[K comparable, V any] struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	entries   map[K]entry[V]
+	lastSweep time.Time
+	hits      atomic.Int64
+	misses    atomic.Int64
+	now       func() time.Time // swapped out in tests
+}
+
+type entry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+// New() returns an empty cache whose entries live for ttl.
+func New[K comparable, V any](ttl time.Duration) *Cache[K, V] {
+	return &Cache[K, V]{
+		ttl:     ttl,
+		entries: make(map[K]entry[V]),
+		now:     time.Now,
+	}
+}
+
+// Get() returns the value stored under key if it hasn't expired yet.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	var zero V
+	if c == nil {
+		return zero, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if ok && c.now().Before(e.expires) {
+		c.hits.Add(1)
+		return e.value, true
+	}
+	if ok {
+		delete(c.entries, key)
+	}
+	c.misses.Add(1)
+	return zero, false
+}
+
+// Set() stores value under key. Expired entries are swept out at most once per TTL, here
+// rather than in a background goroutine, so an idle cache doesn't cost anything.
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.SetUntil(key, value, time.Time{})
+}
+
+// SetUntil() stores value under key like Set(), but the entry expires at expires if that comes
+// before the TTL is up. It is for values that go stale at a known time, such as a token that
+// expires. A zero expires only applies the TTL.
+func (c *Cache[K, V]) SetUntil(key K, value V, expires time.Time) {
+	if c == nil || c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if now.Sub(c.lastSweep) > c.ttl {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.lastSweep = now
+	}
+	entryExpires := now.Add(c.ttl)
+	if !expires.IsZero() && expires.Before(entryExpires) {
+		entryExpires = expires
+	}
+	if !now.Before(entryExpires) {
+		return
+	}
+	c.entries[key] = entry[V]{value: value, expires: entryExpires}
+}
+
+// Delete() removes the entry stored under key, if any.
+func (c *Cache[K, V]) Delete(key K) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// DeleteFunc() removes every entry for which del returns true. It is used to invalidate
+// entries by something other than their key, such as every token belonging to a user.
+func (c *Cache[K, V]) DeleteFunc(del func(key K, value V) bool) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, e := range c.entries {
+		if del(k, e.value) {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// Len() returns the number of entries currently held, including expired ones that have not
+// been swept yet.
+func (c *Cache[K, V]) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Hits() returns how many lookups were answered from the cache.
+func (c *Cache[K, V]) Hits() int64 {
+	if c == nil {
+		return 0
+	}
+	return c.hits.Load()
+}
+
+// Misses() returns how many lookups had to fall through to the caller.
+func (c *Cache[K, V]) Misses() int64 {
+	if c == nil {
+		return 0
+	}
+	return c.misses.Load()
+}
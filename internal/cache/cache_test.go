@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCacheGetAndSet(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := New[int64, string](time.Minute)
+	c.now = func() time.Time { return now }
+
+	if _, ok := c.Get(1); ok {
+		t.Fatal("Expected a miss on an empty cache")
+	}
+	c.Set(1, "admin:read")
+	if value, ok := c.Get(1); !ok || value != "admin:read" {
+		t.Fatalf("Expected a hit with admin:read, got %q, %v", value, ok)
+	}
+
+	// Entries expire once the TTL has passed
+	now = now.Add(time.Minute)
+	if _, ok := c.Get(1); ok {
+		t.Error("Expected the entry to have expired")
+	}
+	if c.Len() != 0 {
+		t.Errorf("Expected the expired entry to be removed, %d left", c.Len())
+	}
+
+	if c.Hits() != 1 || c.Misses() != 2 {
+		t.Errorf("Expected 1 hit and 2 misses, got %d and %d", c.Hits(), c.Misses())
+	}
+}
+
+func TestCacheSetUntil(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := New[int64, string](time.Minute)
+	c.now = func() time.Time { return now }
+
+	// the entry is gone when it expires, before the TTL is up
+	c.SetUntil(1, "token", now.Add(10*time.Second))
+	// an expiry after the TTL doesn't keep the entry any longer
+	c.SetUntil(2, "token", now.Add(time.Hour))
+	// values that already went stale aren't stored at all
+	c.SetUntil(3, "token", now)
+
+	now = now.Add(10 * time.Second)
+	if _, ok := c.Get(1); ok {
+		t.Error("Expected the entry to expire with its value")
+	}
+	if _, ok := c.Get(2); !ok {
+		t.Error("Expected the entry to be kept until the TTL is up")
+	}
+	if _, ok := c.Get(3); ok {
+		t.Error("Expected a stale value not to be stored")
+	}
+	now = now.Add(50 * time.Second)
+	if _, ok := c.Get(2); ok {
+		t.Error("Expected the entry to expire with the TTL")
+	}
+}
+
+func TestCacheSweepsExpiredEntries(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := New[int64, string](time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.Set(1, "a")
+	c.Set(2, "b")
+	now = now.Add(2 * time.Minute)
+	c.Set(3, "c")
+
+	if c.Len() != 1 {
+		t.Errorf("Expected only the fresh entry to be kept, got %d entries", c.Len())
+	}
+}
+
+func TestCacheDelete(t *testing.T) {
+	c := New[string, int64](time.Minute)
+	c.Set("token-a", 1)
+	c.Set("token-b", 1)
+	c.Set("token-c", 2)
+
+	c.Delete("token-c")
+	if _, ok := c.Get("token-c"); ok {
+		t.Error("Expected token-c to be deleted")
+	}
+
+	c.DeleteFunc(func(_ string, userID int64) bool { return userID == 1 })
+	if c.Len() != 0 {
+		t.Errorf("Expected every entry for user 1 to be deleted, %d left", c.Len())
+	}
+}
+
+func TestCacheDisabled(t *testing.T) {
+	var nilCache *Cache[int64, string]
+	disabled := New[int64, string](0)
+
+	for name, c := range map[string]*Cache[int64, string]{"nil": nilCache, "zero TTL": disabled} {
+		t.Run(name, func(t *testing.T) {
+			c.Set(1, "admin:read")
+			if _, ok := c.Get(1); ok {
+				t.Error("Expected a disabled cache to never hit")
+			}
+			c.Delete(1)
+			c.DeleteFunc(func(int64, string) bool { return true })
+			if c.Len() != 0 || c.Hits() != 0 {
+				t.Errorf("Expected an empty cache, got %d entries and %d hits", c.Len(), c.Hits())
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/database"
+	"github.com/Blue-Davinci/SavannaCart/internal/validator"
+)
+
+const (
+	// APIKeyPrefix starts every API key, which is how they are told apart from session tokens
+	APIKeyPrefix = "sck_"
+	// apiKeyPlaintextLength is the prefix followed by 32 random bytes in unpadded base32
+	apiKeyPlaintextLength = len(APIKeyPrefix) + 52
+	// apiKeyDisplayLength is how much of the key is kept in the clear so users can tell keys apart
+	apiKeyDisplayLength = len(APIKeyPrefix) + 8
+	// API keys last this long unless their owner asks for something else
+	DefaultAPIKeyExpiryTime = 90 * 24 * time.Hour
+	MaxAPIKeyExpiryTime     = 365 * 24 * time.Hour
+)
+
+// APIKeyModel manages personal API keys, the long lived credentials machine clients use
+// instead of a user's login session.
+type APIKeyModel struct {
+	DB   *database.Queries
+	Conn *sql.DB // a key and its permissions are created together
+}
+
+// APIKey is a personal API key. It acts as its owner, but only with the permissions it was
+// given. The plaintext key is only known when the key is created, we keep its hash.
+type APIKey struct {
+	ID          int64       `json:"id"`
+	UserID      int64       `json:"-"`
+	Name        string      `json:"name"`
+	Prefix      string      `json:"prefix"`
+	Plaintext   string      `json:"key,omitempty"`
+	Permissions Permissions `json:"permissions"`
+	CreatedAt   time.Time   `json:"created_at"`
+	LastUsedAt  *time.Time  `json:"last_used_at"`
+	Expiry      time.Time   `json:"expiry"`
+}
+
+// ValidateAPIKey() checks a key a user wants to create
+func ValidateAPIKey(v *validator.Validator, key *APIKey) {
+	v.Check(key.Name != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(validator.Unique(key.Permissions), "permissions", "must not contain duplicate values")
+	for _, code := range key.Permissions {
+		if !IsValidPermissionFormat(code) {
+			v.AddError("permissions", "must be in the format 'permission:code'")
+			break
+		}
+	}
+	v.Check(key.Expiry.After(time.Now()), "expiry", "must be in the future")
+	v.Check(key.Expiry.Before(time.Now().Add(MaxAPIKeyExpiryTime)), "expiry", "must be within a year")
+}
+
+// ValidateAPIKeyPlaintext() checks an API key looks like one we issued
+func ValidateAPIKeyPlaintext(v *validator.Validator, keyPlaintext string) {
+	v.Check(strings.HasPrefix(keyPlaintext, APIKeyPrefix), "api_key", "must be valid")
+	v.Check(len(keyPlaintext) == apiKeyPlaintextLength, "api_key", "must be valid")
+}
+
+// generateAPIKey() returns a new random API key and its hash
+func generateAPIKey() (string, []byte, error) {
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", nil, err
+	}
+	plaintext := APIKeyPrefix + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	hash := sha256.Sum256([]byte(plaintext))
+	return plaintext, hash[:], nil
+}
+
+// Insert() generates the key's secret and saves it with its permissions, filling in the
+// key's ID, prefix, plaintext and creation time. Permission codes that don't exist return
+// ErrPermissionNotFound.
+func (m APIKeyModel) Insert(key *APIKey) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultTokenDBContextTimeout)
+	defer cancel()
+
+	plaintext, hash, err := generateAPIKey()
+	if err != nil {
+		return err
+	}
+	return withTransaction(ctx, m.Conn, func(qtx *database.Queries) error {
+		apiKey, err := qtx.CreateAPIKey(ctx, database.CreateAPIKeyParams{
+			UserID: key.UserID,
+			Name:   key.Name,
+			Prefix: plaintext[:apiKeyDisplayLength],
+			Hash:   hash,
+			Expiry: key.Expiry,
+		})
+		if err != nil {
+			return err
+		}
+		if len(key.Permissions) > 0 {
+			permissionIDs, err := qtx.AddPermissionsForAPIKey(ctx, database.AddPermissionsForAPIKeyParams{
+				ApiKeyID: apiKey.ID,
+				Column2:  key.Permissions,
+			})
+			if err != nil {
+				return err
+			}
+			if len(permissionIDs) != len(key.Permissions) {
+				return ErrPermissionNotFound
+			}
+		}
+		key.ID = apiKey.ID
+		key.Prefix = apiKey.Prefix
+		key.Plaintext = plaintext
+		key.CreatedAt = apiKey.CreatedAt
+		key.Expiry = apiKey.Expiry
+		return nil
+	})
+}
+
+// GetForKey() returns the API key with the given plaintext, and notes that it was used.
+// Keys that don't exist, have expired or have been revoked return ErrGeneralRecordNotFound.
+func (m APIKeyModel) GetForKey(keyPlaintext string) (*APIKey, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultTokenDBContextTimeout)
+	defer cancel()
+
+	keyHash := sha256.Sum256([]byte(keyPlaintext))
+	row, err := m.DB.GetAPIKeyForHash(ctx, database.GetAPIKeyForHashParams{
+		Hash:   keyHash[:],
+		Expiry: time.Now(),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrGeneralRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	// only written once a minute, so busy clients don't update the row on every request
+	err = m.DB.TouchAPIKey(ctx, row.ID)
+	if err != nil {
+		return nil, err
+	}
+	return populateAPIKey(database.GetAPIKeysForUserRow(row)), nil
+}
+
+// GetAllForUser() returns the user's API keys that can still be used, newest first.
+func (m APIKeyModel) GetAllForUser(userID int64) ([]*APIKey, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultTokenDBContextTimeout)
+	defer cancel()
+
+	rows, err := m.DB.GetAPIKeysForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	keys := []*APIKey{}
+	for _, row := range rows {
+		keys = append(keys, populateAPIKey(row))
+	}
+	return keys, nil
+}
+
+// Revoke() stops one of the user's API keys from working. Keys that don't exist, belong to
+// someone else or are already revoked return ErrGeneralRecordNotFound.
+func (m APIKeyModel) Revoke(userID, keyID int64) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultTokenDBContextTimeout)
+	defer cancel()
+
+	_, err := m.DB.RevokeAPIKey(ctx, database.RevokeAPIKeyParams{
+		ID:     keyID,
+		UserID: userID,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrGeneralRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// populateAPIKey() converts a database API key into an APIKey
+func populateAPIKey(row database.GetAPIKeysForUserRow) *APIKey {
+	key := &APIKey{
+		ID:          row.ID,
+		UserID:      row.UserID,
+		Name:        row.Name,
+		Prefix:      row.Prefix,
+		Permissions: Permissions{},
+		CreatedAt:   row.CreatedAt,
+		Expiry:      row.Expiry,
+	}
+	key.Permissions = append(key.Permissions, row.Permissions...)
+	if row.LastUsedAt.Valid {
+		key.LastUsedAt = &row.LastUsedAt.Time
+	}
+	return key
+}
@@ -0,0 +1,115 @@
+package data
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/validator"
+)
+
+func TestValidateAPIKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   APIKey
+		valid bool
+	}{
+		{"valid", APIKey{Name: "stock sync", Permissions: Permissions{"admin:read"}, Expiry: time.Now().Add(time.Hour)}, true},
+		{"no permissions", APIKey{Name: "orders export", Expiry: time.Now().Add(time.Hour)}, true},
+		{"missing name", APIKey{Expiry: time.Now().Add(time.Hour)}, false},
+		{"name too long", APIKey{Name: strings.Repeat("a", 101), Expiry: time.Now().Add(time.Hour)}, false},
+		{"duplicate permissions", APIKey{Name: "sync", Permissions: Permissions{"admin:read", "admin:read"}, Expiry: time.Now().Add(time.Hour)}, false},
+		{"badly formatted permission", APIKey{Name: "sync", Permissions: Permissions{"admin"}, Expiry: time.Now().Add(time.Hour)}, false},
+		{"expired", APIKey{Name: "sync", Expiry: time.Now().Add(-time.Hour)}, false},
+		{"expiry too far away", APIKey{Name: "sync", Expiry: time.Now().Add(MaxAPIKeyExpiryTime + time.Hour)}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateAPIKey(v, &tt.key)
+			if v.Valid() != tt.valid {
+				t.Errorf("Expected valid=%v, got errors %v", tt.valid, v.Errors)
+			}
+		})
+	}
+}
+
+func TestValidateAPIKeyPlaintext(t *testing.T) {
+	plaintext, hash, err := generateAPIKey()
+	if err != nil {
+		t.Fatalf("Failed to generate API key: %v", err)
+	}
+	if len(hash) != 32 {
+		t.Errorf("Expected a SHA-256 hash, got %d bytes", len(hash))
+	}
+
+	tests := []struct {
+		name      string
+		plaintext string
+		valid     bool
+	}{
+		{"generated key", plaintext, true},
+		{"session token", "ABCDEFGHIJKLMNOPQRSTUVWXYZ", false},
+		{"truncated key", plaintext[:len(plaintext)-1], false},
+		{"prefix only", APIKeyPrefix, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateAPIKeyPlaintext(v, tt.plaintext)
+			if v.Valid() != tt.valid {
+				t.Errorf("Expected valid=%v, got errors %v", tt.valid, v.Errors)
+			}
+		})
+	}
+}
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	db := openTestDB(t)
+	models := NewModels(db, 0)
+	userID := seedTestUser(t, db)
+
+	key := &APIKey{UserID: userID, Name: "stock sync", Permissions: Permissions{"admin:read"}, Expiry: time.Now().Add(time.Hour)}
+	if err := models.APIKeys.Insert(key); err != nil {
+		t.Fatalf("Failed to create API key: %v", err)
+	}
+	if !strings.HasPrefix(key.Plaintext, key.Prefix) || len(key.Prefix) >= len(key.Plaintext) {
+		t.Errorf("Expected the prefix %q to be the start of the key", key.Prefix)
+	}
+
+	found, err := models.APIKeys.GetForKey(key.Plaintext)
+	if err != nil {
+		t.Fatalf("Failed to get API key: %v", err)
+	}
+	if found.ID != key.ID || found.UserID != userID || !found.Permissions.IncludeAll("admin:read") || found.Plaintext != "" {
+		t.Errorf("Unexpected API key %+v", found)
+	}
+	keys, err := models.APIKeys.GetAllForUser(userID)
+	if err != nil {
+		t.Fatalf("Failed to list API keys: %v", err)
+	}
+	if len(keys) != 1 || keys[0].ID != key.ID || keys[0].LastUsedAt == nil {
+		t.Errorf("Expected the used key to be listed, got %+v", keys)
+	}
+
+	unknown := &APIKey{UserID: userID, Name: "bad", Permissions: Permissions{"nothing:here"}, Expiry: time.Now().Add(time.Hour)}
+	if err := models.APIKeys.Insert(unknown); !errors.Is(err, ErrPermissionNotFound) {
+		t.Errorf("Expected ErrPermissionNotFound for an unknown permission, got %v", err)
+	}
+
+	if err := models.APIKeys.Revoke(userID+1, key.ID); !errors.Is(err, ErrGeneralRecordNotFound) {
+		t.Errorf("Expected ErrGeneralRecordNotFound for someone else's key, got %v", err)
+	}
+	if err := models.APIKeys.Revoke(userID, key.ID); err != nil {
+		t.Fatalf("Failed to revoke API key: %v", err)
+	}
+	if _, err := models.APIKeys.GetForKey(key.Plaintext); !errors.Is(err, ErrGeneralRecordNotFound) {
+		t.Errorf("Expected a revoked key to stop working, got %v", err)
+	}
+	if err := models.APIKeys.Revoke(userID, key.ID); !errors.Is(err, ErrGeneralRecordNotFound) {
+		t.Errorf("Expected ErrGeneralRecordNotFound when revoking twice, got %v", err)
+	}
+}
@@ -0,0 +1,320 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/database"
+	"github.com/Blue-Davinci/SavannaCart/internal/validator"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	ErrCartItemNotFound = errors.New("cart item not found")
+	ErrEmptyCart        = errors.New("cart must contain at least one item before checkout")
+)
+
+// Define the CartModel type
+type CartModel struct {
+	DB   *database.Queries
+	Conn *sql.DB // used to open transactions for multi-statement operations
+}
+
+// Cart represents a user's persistent shopping cart, priced at the current product prices
+type Cart struct {
+	ID           int32           `json:"id"`
+	UserID       int32           `json:"user_id"`
+	Items        []*CartItem     `json:"items"`
+	TotalItems   int32           `json:"total_items"`
+	SubtotalKES  decimal.Decimal `json:"subtotal_kes"`
+	Checkoutable bool            `json:"checkoutable"` // false if any line exceeds the available stock
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+}
+
+// CartItem represents a single product line within a cart
+type CartItem struct {
+	ID             int32           `json:"id"`
+	ProductID      int32           `json:"product_id"`
+	ProductName    string          `json:"product_name"`
+	Quantity       int32           `json:"quantity"`
+	UnitPriceKES   decimal.Decimal `json:"unit_price_kes"`
+	LineTotalKES   decimal.Decimal `json:"line_total_kes"`
+	AvailableStock int32           `json:"available_stock"`
+	StockStatus    string          `json:"stock_status"` // "in_stock", "low_stock", "out_of_stock"
+	IsAvailable    bool            `json:"is_available"` // whether the requested quantity can currently be fulfilled
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+// Timeout constants for our module
+const (
+	DefaultCartDBContextTimeout = 10 * time.Second
+)
+
+// ValidateCartItem checks the product and quantity supplied for a cart line
+func ValidateCartItem(v *validator.Validator, productID int32, quantity int32) {
+	v.Check(productID > 0, "product_id", "must be a valid product ID")
+	v.Check(quantity > 0, "quantity", "must be greater than 0")
+	v.Check(quantity <= 1000, "quantity", "must not be more than 1000")
+}
+
+// populateCartItem converts a database cart item row into a CartItem struct.
+func populateCartItem(cartItemRow any) *CartItem {
+	switch item := cartItemRow.(type) {
+	case database.GetCartItemsWithProductsRow:
+		cartItem := &CartItem{
+			ID:             item.ID,
+			ProductID:      item.ProductID,
+			ProductName:    item.ProductName,
+			Quantity:       item.Quantity,
+			AvailableStock: item.StockQuantity,
+			StockStatus:    generateStockStatus(item.StockQuantity),
+			IsAvailable:    item.Quantity <= item.StockQuantity,
+			CreatedAt:      item.CreatedAt,
+			UpdatedAt:      item.UpdatedAt,
+		}
+		cartItem.UnitPriceKES, _ = decimal.NewFromString(item.PriceKes)
+		cartItem.LineTotalKES = cartItem.UnitPriceKES.Mul(decimal.NewFromInt32(item.Quantity))
+		return cartItem
+	default:
+		return nil // Return nil if the type does not match
+	}
+}
+
+// summarizeCart fills in the cart totals from its items.
+func summarizeCart(cart *Cart) {
+	cart.TotalItems = 0
+	cart.SubtotalKES = decimal.Zero
+	cart.Checkoutable = len(cart.Items) > 0
+	for _, item := range cart.Items {
+		cart.TotalItems += item.Quantity
+		cart.SubtotalKES = cart.SubtotalKES.Add(item.LineTotalKES)
+		if !item.IsAvailable {
+			cart.Checkoutable = false
+		}
+	}
+}
+
+// loadCart builds the priced cart summary for a cart row using the supplied queries.
+func loadCart(ctx context.Context, q *database.Queries, dbCart database.Cart) (*Cart, error) {
+	rows, err := q.GetCartItemsWithProducts(ctx, dbCart.ID)
+	if err != nil {
+		return nil, err
+	}
+	cart := &Cart{
+		ID:        dbCart.ID,
+		UserID:    dbCart.UserID,
+		Items:     []*CartItem{},
+		CreatedAt: dbCart.CreatedAt,
+		UpdatedAt: dbCart.UpdatedAt,
+	}
+	for _, row := range rows {
+		cart.Items = append(cart.Items, populateCartItem(row))
+	}
+	summarizeCart(cart)
+	return cart, nil
+}
+
+// GetCart returns the priced cart summary for a user. Users who have never added
+// anything get an empty cart rather than an error.
+func (m CartModel) GetCart(userID int32) (*Cart, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultCartDBContextTimeout)
+	defer cancel()
+
+	dbCart, err := m.DB.GetCartByUserID(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return &Cart{UserID: userID, Items: []*CartItem{}}, nil
+		default:
+			return nil, err
+		}
+	}
+	return loadCart(ctx, m.DB, dbCart)
+}
+
+// AddItem adds a product to the user's cart, creating the cart if needed. Adding a
+// product that is already in the cart increases its quantity. The resulting quantity
+// may not exceed the product's current stock.
+func (m CartModel) AddItem(userID, productID, quantity int32) (*Cart, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultCartDBContextTimeout)
+	defer cancel()
+
+	var cart *Cart
+	err := withTransaction(ctx, m.Conn, func(qtx *database.Queries) error {
+		product, err := qtx.GetProductByIdOnly(ctx, productID)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrGeneralRecordNotFound
+			default:
+				return err
+			}
+		}
+		dbCart, err := qtx.UpsertCartForUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+		cartItem, err := qtx.AddCartItem(ctx, database.AddCartItemParams{
+			CartID:    dbCart.ID,
+			ProductID: productID,
+			Quantity:  quantity,
+		})
+		if err != nil {
+			switch {
+			case strings.Contains(err.Error(), "cart_items_product_id_fkey"):
+				return ErrGeneralRecordNotFound
+			default:
+				return err
+			}
+		}
+		if cartItem.Quantity > product.StockQuantity {
+			return ErrInsufficientStock
+		}
+		cart, err = loadCart(ctx, qtx, dbCart)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cart, nil
+}
+
+// UpdateItemQuantity sets the quantity of a product that is already in the user's cart.
+func (m CartModel) UpdateItemQuantity(userID, productID, quantity int32) (*Cart, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultCartDBContextTimeout)
+	defer cancel()
+
+	var cart *Cart
+	err := withTransaction(ctx, m.Conn, func(qtx *database.Queries) error {
+		dbCart, err := qtx.GetCartByUserID(ctx, userID)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrCartItemNotFound
+			default:
+				return err
+			}
+		}
+		_, err = qtx.UpdateCartItemQuantity(ctx, database.UpdateCartItemQuantityParams{
+			CartID:    dbCart.ID,
+			ProductID: productID,
+			Quantity:  quantity,
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrCartItemNotFound
+			default:
+				return err
+			}
+		}
+		product, err := qtx.GetProductByIdOnly(ctx, productID)
+		if err != nil {
+			return err
+		}
+		if quantity > product.StockQuantity {
+			return ErrInsufficientStock
+		}
+		cart, err = loadCart(ctx, qtx, dbCart)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cart, nil
+}
+
+// RemoveItem removes a product line from the user's cart.
+func (m CartModel) RemoveItem(userID, productID int32) (*Cart, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultCartDBContextTimeout)
+	defer cancel()
+
+	dbCart, err := m.DB.GetCartByUserID(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrCartItemNotFound
+		default:
+			return nil, err
+		}
+	}
+	_, err = m.DB.DeleteCartItem(ctx, database.DeleteCartItemParams{
+		CartID:    dbCart.ID,
+		ProductID: productID,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrCartItemNotFound
+		default:
+			return nil, err
+		}
+	}
+	return loadCart(ctx, m.DB, dbCart)
+}
+
+// ClearCart removes every line from the user's cart.
+func (m CartModel) ClearCart(userID int32) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultCartDBContextTimeout)
+	defer cancel()
+
+	dbCart, err := m.DB.GetCartByUserID(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil // nothing to clear
+		default:
+			return err
+		}
+	}
+	return m.DB.ClearCart(ctx, dbCart.ID)
+}
+
+// Checkout turns the user's cart into an order. It goes through the same locked,
+// transactional path as OrderModel.CreateOrder, and empties the cart in that same
+// transaction so the cart is only cleared if the order was actually placed.
+func (m CartModel) Checkout(userID int32) (*Order, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultOrderDBContextTimeout)
+	defer cancel()
+
+	var order *Order
+	err := withTransaction(ctx, m.Conn, func(qtx *database.Queries) error {
+		dbCart, err := qtx.GetCartByUserID(ctx, userID)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrEmptyCart
+			default:
+				return err
+			}
+		}
+		rows, err := qtx.GetCartItemsWithProducts(ctx, dbCart.ID)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return ErrEmptyCart
+		}
+		req := &CreateOrderRequest{UserID: userID}
+		for _, row := range rows {
+			req.Items = append(req.Items, &CreateOrderItemRequest{
+				ProductID: row.ProductID,
+				Quantity:  row.Quantity,
+			})
+		}
+		order, err = createOrderTx(ctx, qtx, req)
+		if err != nil {
+			return err
+		}
+		return qtx.ClearCart(ctx, dbCart.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
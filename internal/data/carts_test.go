@@ -0,0 +1,154 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/database"
+	"github.com/Blue-Davinci/SavannaCart/internal/validator"
+	"github.com/shopspring/decimal"
+)
+
+// newTestCartModel() builds a CartModel on top of a real test database.
+func newTestCartModel(db *sql.DB) CartModel {
+	return CartModel{DB: database.New(db), Conn: db}
+}
+
+func TestValidateCartItem(t *testing.T) {
+	tests := []struct {
+		name           string
+		productID      int32
+		quantity       int32
+		expectedErrors []string
+	}{
+		{"valid item", 1, 2, []string{}},
+		{"maximum quantity", 1, 1000, []string{}},
+		{"invalid product ID", 0, 2, []string{"product_id"}},
+		{"zero quantity", 1, 0, []string{"quantity"}},
+		{"negative quantity", 1, -3, []string{"quantity"}},
+		{"quantity too large", 1, 1001, []string{"quantity"}},
+		{"everything invalid", -1, 0, []string{"product_id", "quantity"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateCartItem(v, tt.productID, tt.quantity)
+
+			if len(tt.expectedErrors) == 0 && !v.Valid() {
+				t.Errorf("Expected no validation errors, got %v", v.Errors)
+			}
+			for _, field := range tt.expectedErrors {
+				if _, exists := v.Errors[field]; !exists {
+					t.Errorf("Expected validation error for field %q, got %v", field, v.Errors)
+				}
+			}
+		})
+	}
+}
+
+func TestSummarizeCart(t *testing.T) {
+	inStock := populateCartItem(database.GetCartItemsWithProductsRow{
+		ID: 1, ProductID: 1, ProductName: "Phone", PriceKes: "1500.50", StockQuantity: 10, Quantity: 2,
+	})
+	overStock := populateCartItem(database.GetCartItemsWithProductsRow{
+		ID: 2, ProductID: 2, ProductName: "Cable", PriceKes: "200.00", StockQuantity: 1, Quantity: 3,
+	})
+
+	if !inStock.LineTotalKES.Equal(decimal.RequireFromString("3001.00")) {
+		t.Errorf("Expected line total of 3001.00, got %s", inStock.LineTotalKES)
+	}
+
+	cart := &Cart{Items: []*CartItem{inStock}}
+	summarizeCart(cart)
+	if cart.TotalItems != 2 || !cart.Checkoutable {
+		t.Errorf("Expected 2 checkoutable items, got %d (checkoutable=%v)", cart.TotalItems, cart.Checkoutable)
+	}
+
+	cart.Items = append(cart.Items, overStock)
+	summarizeCart(cart)
+	if cart.TotalItems != 5 {
+		t.Errorf("Expected 5 items, got %d", cart.TotalItems)
+	}
+	if !cart.SubtotalKES.Equal(decimal.RequireFromString("3601.00")) {
+		t.Errorf("Expected subtotal of 3601.00, got %s", cart.SubtotalKES)
+	}
+	if cart.Checkoutable {
+		t.Error("Expected a cart with an over-stock line not to be checkoutable")
+	}
+
+	empty := &Cart{}
+	summarizeCart(empty)
+	if empty.Checkoutable {
+		t.Error("Expected an empty cart not to be checkoutable")
+	}
+}
+
+func TestCartCheckoutPlacesOrderAndClearsCart(t *testing.T) {
+	db := openTestDB(t)
+	carts := newTestCartModel(db)
+
+	userID := int32(seedTestUser(t, db))
+	productID := seedTestProduct(t, db, "250.00", 5)
+
+	if _, err := carts.AddItem(userID, productID, 1); err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+	// Adding the same product again increases the quantity
+	cart, err := carts.AddItem(userID, productID, 2)
+	if err != nil {
+		t.Fatalf("Failed to add item: %v", err)
+	}
+	if len(cart.Items) != 1 || cart.Items[0].Quantity != 3 {
+		t.Fatalf("Expected a single line with quantity 3, got %+v", cart.Items)
+	}
+
+	order, err := carts.Checkout(userID)
+	if err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	if !order.TotalKES.Equal(decimal.RequireFromString("750.00")) {
+		t.Errorf("Expected order total of 750.00, got %s", order.TotalKES)
+	}
+	if stock := productStock(t, db, productID); stock != 2 {
+		t.Errorf("Expected stock of 2 after checkout, got %d", stock)
+	}
+
+	cart, err = carts.GetCart(userID)
+	if err != nil {
+		t.Fatalf("Failed to get cart: %v", err)
+	}
+	if len(cart.Items) != 0 {
+		t.Errorf("Expected cart to be empty after checkout, got %d items", len(cart.Items))
+	}
+}
+
+func TestCartCheckoutEmptyCart(t *testing.T) {
+	db := openTestDB(t)
+	carts := newTestCartModel(db)
+
+	userID := int32(seedTestUser(t, db))
+	if _, err := carts.Checkout(userID); !errors.Is(err, ErrEmptyCart) {
+		t.Fatalf("Expected ErrEmptyCart, got %v", err)
+	}
+}
+
+func TestCartAddItemRejectsMoreThanStock(t *testing.T) {
+	db := openTestDB(t)
+	carts := newTestCartModel(db)
+
+	userID := int32(seedTestUser(t, db))
+	productID := seedTestProduct(t, db, "100.00", 2)
+
+	if _, err := carts.AddItem(userID, productID, 3); !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("Expected ErrInsufficientStock, got %v", err)
+	}
+	cart, err := carts.GetCart(userID)
+	if err != nil {
+		t.Fatalf("Failed to get cart: %v", err)
+	}
+	if len(cart.Items) != 0 {
+		t.Errorf("Expected the rejected line to be rolled back, got %d items", len(cart.Items))
+	}
+}
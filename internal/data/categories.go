@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
@@ -15,11 +16,13 @@ import (
 
 var (
 	ErrDuplicateCategoryName = errors.New("category with this name already exists, please choose a different name")
+	ErrCategoryCycle         = errors.New("a category can't be moved under one of its own subcategories")
 )
 
 // Define the TokenModel type.
 type CategoryModel struct {
-	DB *database.Queries
+	DB   *database.Queries
+	Conn *sql.DB
 }
 
 type Category struct {
@@ -31,6 +34,12 @@ type Category struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// CategoryNode is a category in the category tree, with its subcategories sorted by name
+type CategoryNode struct {
+	*Category
+	Children []*CategoryNode `json:"children"`
+}
+
 type CategoryAveragePrice struct {
 	CategoryID   int32           `json:"category_id"`
 	AveragePrice decimal.Decimal `json:"average_price"`
@@ -52,6 +61,8 @@ func ValidateUpdatedCategory(v *validator.Validator, category *Category) {
 	v.Check(category.Name != "", "name", "must be provided")
 	// Validate the version
 	v.Check(category.Version > 0, "version", "must be greater than 0")
+	// A category can't be its own parent
+	v.Check(category.ParentId != category.ID, "parent_id", "must not be the category itself")
 }
 
 func (m CategoryModel) GetCategoryByID(categoryID, categoryVersion int32) (*Category, error) {
@@ -149,14 +160,38 @@ func (m CategoryModel) CreateNewCategory(category *Category) error {
 func (m CategoryModel) UpdateCategory(category *Category) error {
 	ctx, cancel := contextGenerator(context.Background(), DefaultCategoryDBContextTimeout)
 	defer cancel()
-	// Convert 0 or invalid parent_id to NULL for root categories
-	parentID := convertValueToNullInt32(category.ParentId)
-	// Call the database query to update the category
-	updatedCategory, err := m.DB.UpdateCategory(ctx, database.UpdateCategoryParams{
-		ID:       category.ID,
-		Name:     category.Name,
-		ParentID: parentID,
-		Version:  category.Version,
+	var updatedCategory database.UpdateCategoryRow
+	err := withTransaction(ctx, m.Conn, func(qtx *database.Queries) error {
+		// Moving the category under itself or one of its subcategories would make a loop
+		// that the tree, breadcrumbs and subtree listings would never get out of
+		if category.ParentId > 0 {
+			// Moves wait for each other, two moves checked against the same tree (A under B
+			// and B under A) would both pass and make a loop together
+			if err := qtx.LockCategoryMoves(ctx); err != nil {
+				return err
+			}
+			inSubtree, err := qtx.IsCategoryInSubtree(ctx, database.IsCategoryInSubtreeParams{
+				Column1: category.ID,
+				Column2: category.ParentId,
+			})
+			if err != nil {
+				return err
+			}
+			if inSubtree {
+				return ErrCategoryCycle
+			}
+		}
+		// Convert 0 or invalid parent_id to NULL for root categories
+		parentID := convertValueToNullInt32(category.ParentId)
+		// Call the database query to update the category
+		var err error
+		updatedCategory, err = qtx.UpdateCategory(ctx, database.UpdateCategoryParams{
+			ID:       category.ID,
+			Name:     category.Name,
+			ParentID: parentID,
+			Version:  category.Version,
+		})
+		return err
 	})
 	if err != nil {
 		switch {
@@ -194,6 +229,80 @@ func (m CategoryModel) DeleteCategoryByID(categoryID int32) error {
 	return nil
 }
 
+// GetCategoryTree() returns every category nested under its parent, the root categories
+// and the subcategories at every level sorted by name.
+func (m CategoryModel) GetCategoryTree() ([]*CategoryNode, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultCategoryDBContextTimeout)
+	defer cancel()
+
+	categoryRows, err := m.DB.GetCategoryTree(ctx)
+	if err != nil {
+		return nil, err
+	}
+	categories := make([]*Category, 0, len(categoryRows))
+	for _, categoryRow := range categoryRows {
+		categories = append(categories, populateCategories(categoryRow))
+	}
+	return buildCategoryTree(categories), nil
+}
+
+// GetCategoryBreadcrumbs() returns the path from the root category down to the given one,
+// ending with the category itself. If the category doesn't exist, it returns ErrGeneralRecordNotFound.
+func (m CategoryModel) GetCategoryBreadcrumbs(categoryID int32) ([]*Category, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultCategoryDBContextTimeout)
+	defer cancel()
+
+	ancestorRows, err := m.DB.GetCategoryAncestors(ctx, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	if len(ancestorRows) == 0 {
+		return nil, ErrGeneralRecordNotFound
+	}
+	ancestors := make([]*Category, 0, len(ancestorRows))
+	for _, ancestorRow := range ancestorRows {
+		ancestors = append(ancestors, populateCategories(ancestorRow))
+	}
+	return orderBreadcrumbs(categoryID, ancestors), nil
+}
+
+// buildCategoryTree() nests the categories under their parents, keeping the order they come
+// in at every level. Categories whose parent isn't in the list become roots.
+func buildCategoryTree(categories []*Category) []*CategoryNode {
+	nodes := make(map[int32]*CategoryNode, len(categories))
+	for _, category := range categories {
+		nodes[category.ID] = &CategoryNode{Category: category, Children: []*CategoryNode{}}
+	}
+	roots := []*CategoryNode{}
+	for _, category := range categories {
+		node := nodes[category.ID]
+		parent, ok := nodes[category.ParentId]
+		if !ok || category.ParentId == category.ID {
+			roots = append(roots, node)
+			continue
+		}
+		parent.Children = append(parent.Children, node)
+	}
+	return roots
+}
+
+// orderBreadcrumbs() follows the parents up from the category and returns the categories it
+// passes root first. Categories it never reaches are left out.
+func orderBreadcrumbs(categoryID int32, ancestors []*Category) []*Category {
+	byID := make(map[int32]*Category, len(ancestors))
+	for _, ancestor := range ancestors {
+		byID[ancestor.ID] = ancestor
+	}
+	breadcrumbs := []*Category{}
+	seen := make(map[int32]bool, len(ancestors))
+	for category, ok := byID[categoryID]; ok && !seen[category.ID]; category, ok = byID[category.ParentId] {
+		seen[category.ID] = true
+		breadcrumbs = append(breadcrumbs, category)
+	}
+	slices.Reverse(breadcrumbs)
+	return breadcrumbs
+}
+
 // GetCategoryAveragePrice calculates the average price of all products in a category and its children.
 // It takes a category ID and returns a CategoryAveragePrice struct with the results and any error that occurs.
 func (m CategoryModel) GetCategoryAveragePrice(categoryID int32) (*CategoryAveragePrice, error) {
@@ -241,6 +350,15 @@ func populateCategories(categoryRow any) *Category {
 			CreatedAt: category.CreatedAt,
 			UpdatedAt: category.UpdatedAt,
 		}
+	case database.GetCategoryAncestorsRow:
+		return &Category{
+			ID:        category.ID,
+			Name:      category.Name,
+			ParentId:  category.ParentID.Int32,
+			Version:   category.Version,
+			CreatedAt: category.CreatedAt,
+			UpdatedAt: category.UpdatedAt,
+		}
 	case database.Category:
 		return &Category{
 			ID:        category.ID,
@@ -0,0 +1,242 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/database"
+	"github.com/Blue-Davinci/SavannaCart/internal/validator"
+)
+
+func TestValidateUpdatedCategory(t *testing.T) {
+	tests := []struct {
+		name           string
+		category       *Category
+		expectedErrors []string
+	}{
+		{"valid root category", &Category{ID: 1, Name: "Textiles", Version: 1}, nil},
+		{"valid subcategory", &Category{ID: 2, Name: "Towels", ParentId: 1, Version: 1}, nil},
+		{"own parent", &Category{ID: 2, Name: "Towels", ParentId: 2, Version: 1}, []string{"parent_id"}},
+		{"missing name and version", &Category{ID: 2}, []string{"name", "version"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateUpdatedCategory(v, tt.category)
+
+			if len(v.Errors) != len(tt.expectedErrors) {
+				t.Errorf("Expected %d errors, got %v", len(tt.expectedErrors), v.Errors)
+			}
+			for _, expectedField := range tt.expectedErrors {
+				if _, exists := v.Errors[expectedField]; !exists {
+					t.Errorf("Expected error for field '%s', but it was not found", expectedField)
+				}
+			}
+		})
+	}
+}
+
+// categoryNames() flattens a tree into "parent>child" paths, to compare trees in one line
+func categoryNames(nodes []*CategoryNode, prefix string) []string {
+	names := []string{}
+	for _, node := range nodes {
+		path := prefix + node.Name
+		names = append(names, path)
+		names = append(names, categoryNames(node.Children, path+">")...)
+	}
+	return names
+}
+
+func TestBuildCategoryTree(t *testing.T) {
+	// sorted by name, like GetCategoryTree returns them
+	categories := []*Category{
+		{ID: 4, Name: "Beach Towels", ParentId: 3},
+		{ID: 2, Name: "Coffee"},
+		{ID: 5, Name: "Kikois", ParentId: 1},
+		{ID: 6, Name: "Orphan", ParentId: 99},
+		{ID: 1, Name: "Textiles"},
+		{ID: 3, Name: "Towels", ParentId: 1},
+	}
+
+	tree := buildCategoryTree(categories)
+
+	expected := []string{"Coffee", "Orphan", "Textiles", "Textiles>Kikois", "Textiles>Towels", "Textiles>Towels>Beach Towels"}
+	if got := categoryNames(tree, ""); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected tree %v, got %v", expected, got)
+	}
+	// leaves have an empty list of children, not null
+	if tree[0].Children == nil {
+		t.Error("Expected an empty list of children for a category without subcategories")
+	}
+	if len(buildCategoryTree(nil)) != 0 {
+		t.Error("Expected an empty tree without categories")
+	}
+}
+
+func TestOrderBreadcrumbs(t *testing.T) {
+	ancestors := []*Category{
+		{ID: 3, Name: "Towels", ParentId: 1},
+		{ID: 1, Name: "Textiles"},
+		{ID: 4, Name: "Beach Towels", ParentId: 3},
+	}
+	names := func(list []*Category) []string {
+		got := []string{}
+		for _, category := range list {
+			got = append(got, category.Name)
+		}
+		return got
+	}
+
+	tests := []struct {
+		name       string
+		categoryID int32
+		expected   []string
+	}{
+		{"root first", 4, []string{"Textiles", "Towels", "Beach Towels"}},
+		{"root category", 1, []string{"Textiles"}},
+		{"unknown category", 9, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := names(orderBreadcrumbs(tt.categoryID, ancestors)); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected breadcrumbs %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	// a loop left over from before cycles were rejected still ends
+	loop := []*Category{{ID: 1, Name: "A", ParentId: 2}, {ID: 2, Name: "B", ParentId: 1}}
+	if got := names(orderBreadcrumbs(1, loop)); !reflect.DeepEqual(got, []string{"B", "A"}) {
+		t.Errorf("Expected breadcrumbs [B A], got %v", got)
+	}
+}
+
+func TestCategoryTreeBreadcrumbsAndCycles(t *testing.T) {
+	db := openTestDB(t)
+	categories := CategoryModel{DB: database.New(db), Conn: db}
+
+	// textiles > towels > beach towels
+	suffix := fmt.Sprintf("%s_%d", t.Name(), time.Now().UnixNano())
+	seedCategory := func(name string, parentID *int32) int32 {
+		t.Helper()
+		var categoryID int32
+		if err := db.QueryRow(`INSERT INTO categories (name, parent_id) VALUES ($1, $2) RETURNING id`, name+"_"+suffix, parentID).Scan(&categoryID); err != nil {
+			t.Fatalf("Failed to seed category: %v", err)
+		}
+		return categoryID
+	}
+	textiles := seedCategory("textiles", nil)
+	towels := seedCategory("towels", &textiles)
+	beachTowels := seedCategory("beach towels", &towels)
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM categories WHERE id IN ($1, $2, $3)`, textiles, towels, beachTowels)
+	})
+
+	t.Run("tree", func(t *testing.T) {
+		tree, err := categories.GetCategoryTree()
+		if err != nil {
+			t.Fatalf("Failed to get the category tree: %v", err)
+		}
+		var found *CategoryNode
+		for _, node := range tree {
+			if node.ID == textiles {
+				found = node
+			}
+		}
+		if found == nil {
+			t.Fatal("Expected the seeded root category in the tree")
+		}
+		expected := []string{"textiles_" + suffix, "textiles_" + suffix + ">towels_" + suffix, "textiles_" + suffix + ">towels_" + suffix + ">beach towels_" + suffix}
+		if got := categoryNames([]*CategoryNode{found}, ""); !reflect.DeepEqual(got, expected) {
+			t.Errorf("Expected tree %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("breadcrumbs", func(t *testing.T) {
+		breadcrumbs, err := categories.GetCategoryBreadcrumbs(beachTowels)
+		if err != nil {
+			t.Fatalf("Failed to get breadcrumbs: %v", err)
+		}
+		got := []int32{}
+		for _, category := range breadcrumbs {
+			got = append(got, category.ID)
+		}
+		if expected := []int32{textiles, towels, beachTowels}; !reflect.DeepEqual(got, expected) {
+			t.Errorf("Expected breadcrumbs %v, got %v", expected, got)
+		}
+
+		_, err = categories.GetCategoryBreadcrumbs(-1)
+		if !errors.Is(err, ErrGeneralRecordNotFound) {
+			t.Errorf("Expected ErrGeneralRecordNotFound, got %v", err)
+		}
+	})
+
+	t.Run("cycles are rejected", func(t *testing.T) {
+		for _, parentID := range []int32{textiles, towels, beachTowels} {
+			category, err := categories.GetCategoryByID(textiles, 1)
+			if err != nil {
+				t.Fatalf("Failed to get category: %v", err)
+			}
+			category.ParentId = parentID
+			if err := categories.UpdateCategory(category); !errors.Is(err, ErrCategoryCycle) {
+				t.Errorf("Expected ErrCategoryCycle moving under %d, got %v", parentID, err)
+			}
+		}
+
+		// moving a subcategory up the tree is fine
+		category, err := categories.GetCategoryByID(beachTowels, 1)
+		if err != nil {
+			t.Fatalf("Failed to get category: %v", err)
+		}
+		category.ParentId = textiles
+		if err := categories.UpdateCategory(category); err != nil {
+			t.Fatalf("Failed to move the category: %v", err)
+		}
+		if category.ParentId != textiles || category.Version != 2 {
+			t.Errorf("Expected parent %d and version 2, got parent %d and version %d", textiles, category.ParentId, category.Version)
+		}
+	})
+
+	t.Run("concurrent moves can't make a loop together", func(t *testing.T) {
+		// towels and beach towels are now siblings, moving each under the other at once
+		// has to leave one of them where it is
+		moves := []struct{ categoryID, version, parentID int32 }{
+			{towels, 1, beachTowels},
+			{beachTowels, 2, towels},
+		}
+		errs := make(chan error, len(moves))
+		var wg sync.WaitGroup
+		for _, move := range moves {
+			category, err := categories.GetCategoryByID(move.categoryID, move.version)
+			if err != nil {
+				t.Fatalf("Failed to get category: %v", err)
+			}
+			category.ParentId = move.parentID
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- categories.UpdateCategory(category)
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		cycles := 0
+		for err := range errs {
+			switch {
+			case errors.Is(err, ErrCategoryCycle):
+				cycles++
+			case err != nil:
+				t.Fatalf("Failed to move the category: %v", err)
+			}
+		}
+		if cycles != 1 {
+			t.Errorf("Expected exactly one move to be rejected as a loop, got %d", cycles)
+		}
+	})
+}
@@ -1,27 +1,51 @@
 package data
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"math"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Blue-Davinci/SavannaCart/internal/validator"
 )
 
-// Define a new Metadata struct for holding the pagination metadata.
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Define a new Metadata struct for holding the pagination metadata. Listings paged with a
+// cursor only fill in the page size and the cursor of the next page.
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
 }
 
-// Add a SortSafelist field to hold the supported sort values.
+// Add a SortSafelist field to hold the supported sort values. Listings ordered by
+// (created_at, id) can also be paged with a cursor, which keeps working as records are added
+// and doesn't slow down on deep pages like an offset does.
 type Filters struct {
 	Page         int
 	PageSize     int
 	Sort         string
 	SortSafelist []string
+	Cursor       string // the next_cursor of the previous page, used instead of Page
+	CursorSecret []byte // signs the cursors handed out, no cursors are handed out without it
+}
+
+// Cursor is where a page of a listing ordered by (created_at, id) ended, the next page
+// starts right after it
+type Cursor struct {
+	CreatedAt time.Time
+	ID        int32
 }
 
 func ValidateFilters(v *validator.Validator, f Filters) {
@@ -32,6 +56,11 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
 	// Check that the sort parameter matches a value in the safelist.
 	v.Check(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+	// Check that the cursor is one we handed out.
+	if f.Cursor != "" {
+		_, _, err := f.after()
+		v.Check(err == nil, "cursor", "invalid cursor")
+	}
 }
 
 // Check that the client-provided Sort field matches one of the entries in our safelist
@@ -55,13 +84,102 @@ func (f Filters) sortDirection() string {
 	return "ASC"
 }
 
+// Pages after a cursor aren't counted, they fetch one record more than they hold instead and
+// the extra record tells whether there is a next page.
 func (f Filters) limit() int {
+	if f.Cursor != "" {
+		return f.PageSize + 1
+	}
 	return f.PageSize
 }
+
+// Pages after a cursor start right after it, the page number is ignored.
 func (f Filters) offset() int {
+	if f.Cursor != "" {
+		return 0
+	}
 	return (f.Page - 1) * f.PageSize
 }
 
+// after() returns the position the cursor points at, ok is false when the listing isn't
+// paged with a cursor. Cursors that weren't signed with our secret return ErrInvalidCursor.
+func (f Filters) after() (cursor Cursor, ok bool, err error) {
+	if f.Cursor == "" {
+		return Cursor{}, false, nil
+	}
+	payload, signature, found := strings.Cut(f.Cursor, ".")
+	if !found || len(f.CursorSecret) == 0 {
+		return Cursor{}, false, ErrInvalidCursor
+	}
+	decodedSignature, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(decodedSignature, signCursorPayload(f.CursorSecret, payload)) {
+		return Cursor{}, false, ErrInvalidCursor
+	}
+	decodedPayload, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return Cursor{}, false, ErrInvalidCursor
+	}
+	createdAt, id, found := strings.Cut(string(decodedPayload), ":")
+	if !found {
+		return Cursor{}, false, ErrInvalidCursor
+	}
+	micros, err := strconv.ParseInt(createdAt, 10, 64)
+	if err != nil {
+		return Cursor{}, false, ErrInvalidCursor
+	}
+	parsedID, err := strconv.ParseInt(id, 10, 32)
+	if err != nil {
+		return Cursor{}, false, ErrInvalidCursor
+	}
+	return Cursor{CreatedAt: time.UnixMicro(micros).UTC(), ID: int32(parsedID)}, true, nil
+}
+
+// encodeCursor() returns the opaque, signed cursor of a position, or "" without a secret
+func (f Filters) encodeCursor(cursor Cursor) string {
+	if len(f.CursorSecret) == 0 {
+		return ""
+	}
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", cursor.CreatedAt.UnixMicro(), cursor.ID)))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(signCursorPayload(f.CursorSecret, payload))
+}
+
+func signCursorPayload(secret []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("cursor:" + payload))
+	return mac.Sum(nil)
+}
+
+// keysetMetadata() returns the metadata of a page of a listing ordered by (created_at, id)
+// whose last record is at last. fetched is the number of records the query returned. Numbered
+// pages have a next page when totalRecords, which counts every matching record, runs past
+// them. Pages after a cursor have no count, they have a next page when the extra record
+// limit() asks for came back, callers drop it from the page.
+func (f Filters) keysetMetadata(totalRecords, fetched int, last Cursor) Metadata {
+	metadata := Metadata{}
+	hasNext := false
+	switch {
+	case f.Cursor == "":
+		metadata = calculateMetadata(totalRecords, f.Page, f.PageSize)
+		hasNext = fetched > 0 && totalRecords-f.offset() > fetched
+	case fetched > 0:
+		metadata.PageSize = f.PageSize
+		hasNext = fetched > f.PageSize
+	}
+	if hasNext {
+		metadata.NextCursor = f.encodeCursor(last)
+	}
+	return metadata
+}
+
+// keysetPage() drops the extra record a page after a cursor fetches to tell whether there is
+// a next page, once keysetMetadata() has looked at it.
+func keysetPage[T any](f Filters, records []T) []T {
+	if len(records) > f.PageSize {
+		return records[:f.PageSize]
+	}
+	return records
+}
+
 // The calculateMetadata() function calculates the appropriate pagination metadata
 // values given the total number of records, current page, and page size values. Note
 // that the last page value is calculated using the math.Ceil() function, which rounds
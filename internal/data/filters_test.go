@@ -1,7 +1,11 @@
 package data
 
 import (
+	"encoding/base64"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Blue-Davinci/SavannaCart/internal/validator"
 )
@@ -391,6 +395,11 @@ func TestFiltersLimit(t *testing.T) {
 			}
 		})
 	}
+
+	// pages after a cursor fetch one more to tell whether there is a next page
+	if result := (Filters{PageSize: 20, Cursor: "cursor"}).limit(); result != 21 {
+		t.Errorf("limit() after a cursor = %d, want 21", result)
+	}
 }
 
 func TestFiltersOffset(t *testing.T) {
@@ -445,3 +454,137 @@ func TestFiltersOffset(t *testing.T) {
 		})
 	}
 }
+
+func TestFiltersCursor(t *testing.T) {
+	secret := []byte("test-secret")
+	position := Cursor{CreatedAt: time.Date(2025, time.March, 14, 10, 30, 0, 0, time.UTC), ID: 42}
+	token := Filters{CursorSecret: secret}.encodeCursor(position)
+	if token == "" {
+		t.Fatal("Expected a cursor to be encoded")
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		after, ok, err := Filters{Cursor: token, CursorSecret: secret}.after()
+		if err != nil || !ok {
+			t.Fatalf("Expected the cursor to decode, got ok=%v err=%v", ok, err)
+		}
+		if !after.CreatedAt.Equal(position.CreatedAt) || after.ID != position.ID {
+			t.Errorf("Expected %+v, got %+v", position, after)
+		}
+	})
+
+	t.Run("no cursor", func(t *testing.T) {
+		_, ok, err := Filters{CursorSecret: secret}.after()
+		if err != nil || ok {
+			t.Errorf("Expected no cursor, got ok=%v err=%v", ok, err)
+		}
+	})
+
+	t.Run("no secret hands out no cursors", func(t *testing.T) {
+		if token := (Filters{}).encodeCursor(position); token != "" {
+			t.Errorf("Expected no cursor without a secret, got %q", token)
+		}
+	})
+
+	payload, _, _ := strings.Cut(token, ".")
+	forged := base64.RawURLEncoding.EncodeToString([]byte("1741948200000000:1"))
+	invalid := []struct {
+		name   string
+		cursor string
+		secret []byte
+	}{
+		{"garbage", "not-a-cursor", secret},
+		{"signed with another secret", token, []byte("other-secret")},
+		{"no secret to check it with", token, nil},
+		{"changed position", forged + "." + strings.SplitN(token, ".", 2)[1], secret},
+		{"missing signature", payload, secret},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			filters := Filters{Page: 1, PageSize: 20, SortSafelist: []string{""}, Cursor: tt.cursor, CursorSecret: tt.secret}
+			if _, _, err := filters.after(); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("Expected ErrInvalidCursor, got %v", err)
+			}
+			v := validator.New()
+			ValidateFilters(v, filters)
+			if _, exists := v.Errors["cursor"]; !exists {
+				t.Errorf("Expected a cursor validation error, got %v", v.Errors)
+			}
+		})
+	}
+
+	t.Run("pages after a cursor have no offset", func(t *testing.T) {
+		if offset := (Filters{Page: 5, PageSize: 20, Cursor: token, CursorSecret: secret}).offset(); offset != 0 {
+			t.Errorf("Expected an offset of 0, got %d", offset)
+		}
+	})
+}
+
+func TestFiltersKeysetMetadata(t *testing.T) {
+	secret := []byte("test-secret")
+	last := Cursor{CreatedAt: time.Date(2025, time.March, 14, 10, 30, 0, 0, time.UTC), ID: 7}
+	nextCursor := Filters{CursorSecret: secret}.encodeCursor(last)
+	cursor := Filters{CursorSecret: secret}.encodeCursor(Cursor{CreatedAt: last.CreatedAt, ID: 20})
+
+	tests := []struct {
+		name         string
+		filters      Filters
+		totalRecords int
+		fetched      int
+		expected     Metadata
+	}{
+		{
+			name:         "first page of many",
+			filters:      Filters{Page: 1, PageSize: 10, CursorSecret: secret},
+			totalRecords: 25,
+			fetched:      10,
+			expected:     Metadata{CurrentPage: 1, PageSize: 10, FirstPage: 1, LastPage: 3, TotalRecords: 25, NextCursor: nextCursor},
+		},
+		{
+			name:         "last page",
+			filters:      Filters{Page: 3, PageSize: 10, CursorSecret: secret},
+			totalRecords: 25,
+			fetched:      5,
+			expected:     Metadata{CurrentPage: 3, PageSize: 10, FirstPage: 1, LastPage: 3, TotalRecords: 25},
+		},
+		{
+			name:         "without a secret",
+			filters:      Filters{Page: 1, PageSize: 10},
+			totalRecords: 25,
+			fetched:      10,
+			expected:     Metadata{CurrentPage: 1, PageSize: 10, FirstPage: 1, LastPage: 3, TotalRecords: 25},
+		},
+		{
+			name:     "after a cursor with more to come",
+			filters:  Filters{Page: 1, PageSize: 10, Cursor: cursor, CursorSecret: secret},
+			fetched:  11,
+			expected: Metadata{PageSize: 10, NextCursor: nextCursor},
+		},
+		{
+			name:     "after a cursor with exactly a page left",
+			filters:  Filters{Page: 1, PageSize: 10, Cursor: cursor, CursorSecret: secret},
+			fetched:  10,
+			expected: Metadata{PageSize: 10},
+		},
+		{
+			name:     "after a cursor at the end",
+			filters:  Filters{Page: 1, PageSize: 10, Cursor: cursor, CursorSecret: secret},
+			fetched:  4,
+			expected: Metadata{PageSize: 10},
+		},
+		{
+			name:     "after the last record",
+			filters:  Filters{Page: 1, PageSize: 10, Cursor: cursor, CursorSecret: secret},
+			expected: Metadata{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := tt.filters.keysetMetadata(tt.totalRecords, tt.fetched, last)
+			if metadata != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, metadata)
+			}
+		})
+	}
+}
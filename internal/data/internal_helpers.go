@@ -3,7 +3,10 @@ package data
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"time"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/database"
 )
 
 func contextGenerator(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
@@ -16,3 +19,30 @@ func convertValueToNullInt32(value int32) sql.NullInt32 {
 	}
 	return sql.NullInt32{Int32: value, Valid: true}
 }
+
+// withTransaction() runs fn inside a single database transaction. The queries handed to
+// fn are bound to the transaction, so every statement fn executes either commits together
+// or, if fn returns an error (or panics), is rolled back together.
+func withTransaction(ctx context.Context, db *sql.DB, fn func(qtx *database.Queries) error) (err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Make sure we never leave a dangling transaction behind
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				err = fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+			}
+		}
+	}()
+	err = fn(database.New(tx))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
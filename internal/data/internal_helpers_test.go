@@ -3,10 +3,117 @@ package data
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"os"
 	"testing"
 	"time"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/database"
+	_ "github.com/lib/pq"
 )
 
+// openTestDB() connects to the Postgres database named by SAVANNACART_TEST_DB_DSN, which
+// must already have the migrations applied. Tests that need a real database are skipped
+// when the variable is not set.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("SAVANNACART_TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("SAVANNACART_TEST_DB_DSN not set, skipping database test")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// seedTestUser() inserts a throwaway user and removes it (and, through the cascades, its
+// orders) once the test finishes.
+func seedTestUser(t *testing.T, db *sql.DB) int64 {
+	t.Helper()
+
+	suffix := fmt.Sprintf("%s_%d", t.Name(), time.Now().UnixNano())
+	var userID int64
+	err := db.QueryRow(`
+		INSERT INTO users (first_name, last_name, email, profile_avatar_url, password, oidc_sub, activated)
+		VALUES ('Test', 'User', $1, 'https://example.com/avatar.png', NULL, $2, true)
+		RETURNING id`, "test_"+suffix+"@example.com", "test_sub_"+suffix).Scan(&userID)
+	if err != nil {
+		t.Fatalf("Failed to seed test user: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM users WHERE id = $1`, userID)
+	})
+	return userID
+}
+
+// seedTestProduct() inserts a category and a product with the given price and stock, and
+// removes both once the test finishes. Cleanups run last-in first-out, so any orders
+// created against the product are already gone by then.
+func seedTestProduct(t *testing.T, db *sql.DB, priceKES string, stock int32) int32 {
+	t.Helper()
+
+	suffix := fmt.Sprintf("%s_%d", t.Name(), time.Now().UnixNano())
+	var categoryID, productID int32
+	err := db.QueryRow(`INSERT INTO categories (name) VALUES ($1) RETURNING id`, "category_"+suffix).Scan(&categoryID)
+	if err != nil {
+		t.Fatalf("Failed to seed test category: %v", err)
+	}
+	err = db.QueryRow(`
+		INSERT INTO products (name, price_kes, category_id, stock_quantity)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`, "product_"+suffix, priceKES, categoryID, stock).Scan(&productID)
+	if err != nil {
+		t.Fatalf("Failed to seed test product: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM order_items WHERE product_id = $1`, productID)
+		db.Exec(`DELETE FROM products WHERE id = $1`, productID)
+		db.Exec(`DELETE FROM categories WHERE id = $1`, categoryID)
+	})
+	return productID
+}
+
+// productStock() reads the current stock of a product straight from the database.
+func productStock(t *testing.T, db *sql.DB, productID int32) int32 {
+	t.Helper()
+
+	var stock int32
+	if err := db.QueryRow(`SELECT stock_quantity FROM products WHERE id = $1`, productID).Scan(&stock); err != nil {
+		t.Fatalf("Failed to read product stock: %v", err)
+	}
+	return stock
+}
+
+func TestWithTransactionRollsBackOnError(t *testing.T) {
+	db := openTestDB(t)
+	productID := seedTestProduct(t, db, "100.00", 10)
+
+	errBoom := errors.New("boom")
+	err := withTransaction(context.Background(), db, func(qtx *database.Queries) error {
+		if _, err := qtx.DecrementProductStock(context.Background(), database.DecrementProductStockParams{
+			ID:            productID,
+			StockQuantity: 4,
+		}); err != nil {
+			return err
+		}
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("Expected error %v, got %v", errBoom, err)
+	}
+	if stock := productStock(t, db, productID); stock != 10 {
+		t.Errorf("Expected stock to be rolled back to 10, got %d", stock)
+	}
+}
+
 func TestContextGenerator(t *testing.T) {
 	tests := []struct {
 		name    string
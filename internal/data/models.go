@@ -1,8 +1,11 @@
 package data
 
 import (
+	"database/sql"
 	"errors"
+	"time"
 
+	"github.com/Blue-Davinci/SavannaCart/internal/cache"
 	"github.com/Blue-Davinci/SavannaCart/internal/database"
 )
 
@@ -12,21 +15,45 @@ var (
 )
 
 type Models struct {
-	Users       UserModel
-	Tokens      TokenModel
-	Permissions PermissionModel
-	Categories  CategoryModel
-	Products    ProductModel
-	Orders      OrderModel
+	Users                   UserModel
+	Tokens                  TokenModel
+	Permissions             PermissionModel
+	Categories              CategoryModel
+	Products                ProductModel
+	Orders                  OrderModel
+	Carts                   CartModel
+	Payments                PaymentModel
+	OAuthStates             OAuthStateModel
+	Sessions                SessionModel
+	Identities              UserIdentityModel
+	APIKeys                 APIKeyModel
+	PhoneVerifications      PhoneVerificationModel
+	Notifications           NotificationModel
+	NotificationPreferences NotificationPreferenceModel
 }
 
-func NewModels(db *database.Queries) Models {
+// NewModels() wires up all our models. Models that need to run several statements
+// atomically also receive the underlying *sql.DB so they can open transactions.
+// The token and permission lookups made on every authenticated request are cached for
+// cacheTTL, a TTL of zero turns the caches off.
+func NewModels(db *sql.DB, cacheTTL time.Duration) Models {
+	queries := database.New(db)
+	tokenCache := cache.New[tokenCacheKey, User](cacheTTL)
 	return Models{
-		Users:       UserModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Permissions: PermissionModel{DB: db},
-		Categories:  CategoryModel{DB: db},
-		Products:    ProductModel{DB: db},
-		Orders:      OrderModel{DB: db},
+		Users:                   UserModel{DB: queries, TokenCache: tokenCache},
+		Tokens:                  TokenModel{DB: queries, TokenCache: tokenCache},
+		Permissions:             PermissionModel{DB: queries, Conn: db, Cache: cache.New[int64, Permissions](cacheTTL)},
+		Categories:              CategoryModel{DB: queries, Conn: db},
+		Products:                ProductModel{DB: queries, Conn: db},
+		Orders:                  OrderModel{DB: queries, Conn: db},
+		Carts:                   CartModel{DB: queries, Conn: db},
+		Payments:                PaymentModel{DB: queries, Conn: db},
+		OAuthStates:             OAuthStateModel{DB: queries},
+		Sessions:                SessionModel{DB: queries, Conn: db, TokenCache: tokenCache},
+		Identities:              UserIdentityModel{DB: queries, Conn: db, TokenCache: tokenCache},
+		APIKeys:                 APIKeyModel{DB: queries, Conn: db},
+		PhoneVerifications:      PhoneVerificationModel{DB: queries, Conn: db, TokenCache: tokenCache},
+		Notifications:           NotificationModel{DB: queries},
+		NotificationPreferences: NotificationPreferenceModel{DB: queries},
 	}
 }
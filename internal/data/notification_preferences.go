@@ -0,0 +1,234 @@
+package data
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/database"
+	"github.com/Blue-Davinci/SavannaCart/internal/validator"
+)
+
+var (
+	ErrInvalidUnsubscribeToken = errors.New("invalid unsubscribe token")
+)
+
+// The languages emails can be sent in
+const (
+	LanguageEnglish = "en"
+	LanguageSwahili = "sw"
+)
+
+// The channels we notify users through
+const (
+	NotificationChannelEmail = "email"
+	NotificationChannelSMS   = "sms"
+)
+
+// The events users can choose to be notified about on each channel
+const (
+	NotificationEventOrderPlaced = "order_placed"
+	NotificationEventOrderStatus = "order_status"
+	NotificationEventMarketing   = "marketing"
+)
+
+const (
+	DefaultNotificationPreferenceDBContextTimeout = 5 * time.Second
+)
+
+// NotificationPreferenceModel stores which notifications each user wants
+type NotificationPreferenceModel struct {
+	DB *database.Queries
+}
+
+// NotificationPreferences are the notifications a user wants on each channel, and the
+// language they want them in
+type NotificationPreferences struct {
+	UserID    int64              `json:"-"`
+	Email     ChannelPreferences `json:"email"`
+	SMS       ChannelPreferences `json:"sms"`
+	Language  string             `json:"language"`
+	UpdatedAt *time.Time         `json:"updated_at,omitempty"` // nil until the user changes anything
+}
+
+// ChannelPreferences are the events a user wants to hear about on a single channel
+type ChannelPreferences struct {
+	OrderPlaced bool `json:"order_placed"`
+	OrderStatus bool `json:"order_status"`
+	Marketing   bool `json:"marketing"`
+}
+
+// DefaultNotificationPreferences returns the preferences of a user who never changed them,
+// every notification about their orders in English and no marketing.
+func DefaultNotificationPreferences(userID int64) *NotificationPreferences {
+	defaults := ChannelPreferences{OrderPlaced: true, OrderStatus: true, Marketing: false}
+	return &NotificationPreferences{UserID: userID, Email: defaults, SMS: defaults, Language: LanguageEnglish}
+}
+
+// ValidateLanguage checks the language a user wants their emails in
+func ValidateLanguage(v *validator.Validator, language string) {
+	v.Check(validator.PermittedValue(language, LanguageEnglish, LanguageSwahili), "language", "must be en or sw")
+}
+
+// ValidateNotificationChannelEvent checks a channel and event pair, such as the one an
+// unsubscribe link is for
+func ValidateNotificationChannelEvent(v *validator.Validator, channel, event string) {
+	v.Check(validator.PermittedValue(channel, NotificationChannelEmail, NotificationChannelSMS), "channel", "must be email or sms")
+	v.Check(validator.PermittedValue(event, NotificationEventOrderPlaced, NotificationEventOrderStatus, NotificationEventMarketing),
+		"event", "must be one of order_placed, order_status or marketing")
+}
+
+// Allows reports whether the user wants the event on the channel. Unknown pairs are never allowed.
+func (p *NotificationPreferences) Allows(channel, event string) bool {
+	if setting := p.setting(channel, event); setting != nil {
+		return *setting
+	}
+	return false
+}
+
+// Set turns the event on the channel on or off, unknown pairs are ignored
+func (p *NotificationPreferences) Set(channel, event string, enabled bool) {
+	if setting := p.setting(channel, event); setting != nil {
+		*setting = enabled
+	}
+}
+
+func (p *NotificationPreferences) setting(channel, event string) *bool {
+	var channelPreferences *ChannelPreferences
+	switch channel {
+	case NotificationChannelEmail:
+		channelPreferences = &p.Email
+	case NotificationChannelSMS:
+		channelPreferences = &p.SMS
+	default:
+		return nil
+	}
+	switch event {
+	case NotificationEventOrderPlaced:
+		return &channelPreferences.OrderPlaced
+	case NotificationEventOrderStatus:
+		return &channelPreferences.OrderStatus
+	case NotificationEventMarketing:
+		return &channelPreferences.Marketing
+	default:
+		return nil
+	}
+}
+
+// Get returns the user's preferences, or the defaults if they never changed them
+func (m NotificationPreferenceModel) Get(userID int64) (*NotificationPreferences, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultNotificationPreferenceDBContextTimeout)
+	defer cancel()
+
+	row, err := m.DB.GetNotificationPreferences(ctx, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return DefaultNotificationPreferences(userID), nil
+		default:
+			return nil, err
+		}
+	}
+	return populateNotificationPreferences(row), nil
+}
+
+// Update saves the user's preferences and fills in when they were updated
+func (m NotificationPreferenceModel) Update(preferences *NotificationPreferences) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultNotificationPreferenceDBContextTimeout)
+	defer cancel()
+
+	row, err := m.DB.UpsertNotificationPreferences(ctx, database.UpsertNotificationPreferencesParams{
+		UserID:           preferences.UserID,
+		EmailOrderPlaced: preferences.Email.OrderPlaced,
+		EmailOrderStatus: preferences.Email.OrderStatus,
+		EmailMarketing:   preferences.Email.Marketing,
+		SmsOrderPlaced:   preferences.SMS.OrderPlaced,
+		SmsOrderStatus:   preferences.SMS.OrderStatus,
+		SmsMarketing:     preferences.SMS.Marketing,
+		Language:         preferences.Language,
+	})
+	if err != nil {
+		return err
+	}
+	preferences.UpdatedAt = &row.UpdatedAt
+	return nil
+}
+
+// Unsubscribe turns off a single event on a single channel and returns the user's preferences
+func (m NotificationPreferenceModel) Unsubscribe(userID int64, channel, event string) (*NotificationPreferences, error) {
+	preferences, err := m.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+	preferences.Set(channel, event, false)
+	err = m.Update(preferences)
+	if err != nil {
+		return nil, err
+	}
+	return preferences, nil
+}
+
+func populateNotificationPreferences(row database.NotificationPreference) *NotificationPreferences {
+	return &NotificationPreferences{
+		UserID: row.UserID,
+		Email: ChannelPreferences{
+			OrderPlaced: row.EmailOrderPlaced,
+			OrderStatus: row.EmailOrderStatus,
+			Marketing:   row.EmailMarketing,
+		},
+		SMS: ChannelPreferences{
+			OrderPlaced: row.SmsOrderPlaced,
+			OrderStatus: row.SmsOrderStatus,
+			Marketing:   row.SmsMarketing,
+		},
+		Language:  row.Language,
+		UpdatedAt: &row.UpdatedAt,
+	}
+}
+
+// NewUnsubscribeToken returns the token of a one click unsubscribe link, signed with secret so
+// it can't be changed to unsubscribe somebody else. It names the user, channel and event and
+// doesn't expire, old emails keep working.
+func NewUnsubscribeToken(secret []byte, userID int64, channel, event string) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%s:%s", userID, channel, event)))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(signUnsubscribePayload(secret, payload))
+}
+
+// ParseUnsubscribeToken checks an unsubscribe token's signature and returns the user, channel
+// and event it is for. Tokens that were tampered with return ErrInvalidUnsubscribeToken.
+func ParseUnsubscribeToken(secret []byte, token string) (userID int64, channel, event string, err error) {
+	payload, signature, found := strings.Cut(token, ".")
+	if !found {
+		return 0, "", "", ErrInvalidUnsubscribeToken
+	}
+	decodedSignature, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(decodedSignature, signUnsubscribePayload(secret, payload)) {
+		return 0, "", "", ErrInvalidUnsubscribeToken
+	}
+	decodedPayload, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return 0, "", "", ErrInvalidUnsubscribeToken
+	}
+	parts := strings.Split(string(decodedPayload), ":")
+	if len(parts) != 3 {
+		return 0, "", "", ErrInvalidUnsubscribeToken
+	}
+	userID, err = strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || userID < 1 {
+		return 0, "", "", ErrInvalidUnsubscribeToken
+	}
+	return userID, parts[1], parts[2], nil
+}
+
+func signUnsubscribePayload(secret []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("unsubscribe:" + payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,119 @@
+package data
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestUnsubscribeToken(t *testing.T) {
+	secret := []byte("test-secret")
+	token := NewUnsubscribeToken(secret, 42, NotificationChannelEmail, NotificationEventOrderStatus)
+
+	userID, channel, event, err := ParseUnsubscribeToken(secret, token)
+	if err != nil {
+		t.Fatalf("Failed to parse token: %v", err)
+	}
+	if userID != 42 || channel != NotificationChannelEmail || event != NotificationEventOrderStatus {
+		t.Errorf("Expected 42 email order_status, got %d %s %s", userID, channel, event)
+	}
+
+	otherToken := NewUnsubscribeToken(secret, 43, NotificationChannelEmail, NotificationEventOrderStatus)
+	payload, _, _ := strings.Cut(token, ".")
+	_, otherSignature, _ := strings.Cut(otherToken, ".")
+
+	tests := []struct {
+		name   string
+		secret []byte
+		token  string
+	}{
+		{"empty", secret, ""},
+		{"no signature", secret, payload},
+		{"wrong secret", []byte("other-secret"), token},
+		{"another user's signature", secret, payload + "." + otherSignature},
+		{"bad encoding", secret, "!!!." + otherSignature},
+		{"truncated signature", secret, token[:len(token)-4]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, _, err := ParseUnsubscribeToken(tt.secret, tt.token); !errors.Is(err, ErrInvalidUnsubscribeToken) {
+				t.Errorf("Expected ErrInvalidUnsubscribeToken, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNotificationPreferencesAllows(t *testing.T) {
+	preferences := DefaultNotificationPreferences(1)
+	preferences.Set(NotificationChannelSMS, NotificationEventOrderStatus, false)
+	preferences.Set("push", NotificationEventOrderPlaced, true)
+
+	tests := []struct {
+		channel  string
+		event    string
+		expected bool
+	}{
+		{NotificationChannelEmail, NotificationEventOrderPlaced, true},
+		{NotificationChannelEmail, NotificationEventOrderStatus, true},
+		{NotificationChannelEmail, NotificationEventMarketing, false},
+		{NotificationChannelSMS, NotificationEventOrderPlaced, true},
+		{NotificationChannelSMS, NotificationEventOrderStatus, false},
+		{NotificationChannelSMS, NotificationEventMarketing, false},
+		{"push", NotificationEventOrderPlaced, false},
+		{NotificationChannelEmail, "newsletter", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.channel+" "+tt.event, func(t *testing.T) {
+			if got := preferences.Allows(tt.channel, tt.event); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestNotificationPreferencesLifecycle(t *testing.T) {
+	db := openTestDB(t)
+	models := NewModels(db, 0)
+	userID := seedTestUser(t, db)
+
+	// Users start with the defaults, nothing is stored for them
+	preferences, err := models.NotificationPreferences.Get(userID)
+	if err != nil {
+		t.Fatalf("Failed to get preferences: %v", err)
+	}
+	if *preferences != *DefaultNotificationPreferences(userID) {
+		t.Errorf("Expected the default preferences, got %+v", preferences)
+	}
+
+	preferences.Email.Marketing = true
+	preferences.SMS.OrderPlaced = false
+	preferences.Language = LanguageSwahili
+	if err := models.NotificationPreferences.Update(preferences); err != nil {
+		t.Fatalf("Failed to update preferences: %v", err)
+	}
+	if preferences.UpdatedAt == nil {
+		t.Error("Expected UpdatedAt to be set")
+	}
+
+	preferences, err = models.NotificationPreferences.Unsubscribe(userID, NotificationChannelEmail, NotificationEventOrderStatus)
+	if err != nil {
+		t.Fatalf("Failed to unsubscribe: %v", err)
+	}
+	preferences, err = models.NotificationPreferences.Get(userID)
+	if err != nil {
+		t.Fatalf("Failed to get preferences: %v", err)
+	}
+	expected := ChannelPreferences{OrderPlaced: true, OrderStatus: false, Marketing: true}
+	if preferences.Email != expected {
+		t.Errorf("Expected email preferences %+v, got %+v", expected, preferences.Email)
+	}
+	expected = ChannelPreferences{OrderPlaced: false, OrderStatus: true, Marketing: false}
+	if preferences.SMS != expected {
+		t.Errorf("Expected SMS preferences %+v, got %+v", expected, preferences.SMS)
+	}
+	if preferences.Language != LanguageSwahili {
+		t.Errorf("Expected the language to be kept, got %q", preferences.Language)
+	}
+}
@@ -0,0 +1,355 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/database"
+	"github.com/Blue-Davinci/SavannaCart/internal/validator"
+)
+
+var (
+	ErrNotificationNotFound     = errors.New("notification not found")
+	ErrNotificationLeaseLost    = errors.New("the notification was claimed again after our lease ran out")
+	ErrNotificationNotRetryable = errors.New("only dead notifications and pending ones that are not being delivered can be retried")
+)
+
+// Notification status constants. Pending notifications are waiting to be delivered, sent and
+// skipped ones are done and dead ones failed too many times and are left for an admin.
+const (
+	NotificationStatusPending = "pending"
+	NotificationStatusSent    = "sent"
+	NotificationStatusSkipped = "skipped"
+	NotificationStatusDead    = "dead"
+)
+
+// The kinds of notification we send, each has its own sender
+const (
+	NotificationOrderConfirmationEmail = "order_confirmation_email"
+	NotificationOrderConfirmationSMS   = "order_confirmation_sms"
+	NotificationOrderAdminEmail        = "order_admin_email"
+	NotificationOrderStatusEmail       = "order_status_email"
+	NotificationPaymentReviewEmail     = "payment_review_email"
+)
+
+const (
+	DefaultNotificationDBContextTimeout = 5 * time.Second
+	// DefaultNotificationMaxAttempts is how many times a notification is tried before it is
+	// dead lettered, with the backoff that is a little over two hours of retries.
+	DefaultNotificationMaxAttempts = 8
+	// NotificationBaseBackoff is the wait after the first failure, it doubles with every
+	// failure after that up to NotificationMaxBackoff.
+	NotificationBaseBackoff = time.Minute
+	NotificationMaxBackoff  = time.Hour
+)
+
+// NotificationModel is the outbox of emails and SMS we owe users. Notifications are written
+// in the same transaction as the change they are about, so they are never lost when a
+// delivery fails or the server restarts, and workers deliver them afterwards.
+type NotificationModel struct {
+	DB *database.Queries
+}
+
+// Notification is a message in the outbox
+type Notification struct {
+	ID             int64               `json:"id"`
+	IdempotencyKey string              `json:"idempotency_key"`
+	Kind           string              `json:"kind"`
+	Payload        NotificationPayload `json:"payload"`
+	Status         string              `json:"status"`
+	Attempts       int32               `json:"attempts"`
+	MaxAttempts    int32               `json:"max_attempts"`
+	NextAttemptAt  time.Time           `json:"next_attempt_at"`
+	LastError      string              `json:"last_error,omitempty"`
+	CreatedAt      time.Time           `json:"created_at"`
+	UpdatedAt      time.Time           `json:"updated_at"`
+	SentAt         *time.Time          `json:"sent_at,omitempty"`
+}
+
+// NotificationPayload is what a sender needs to build its message. Messages are built when
+// they are delivered, so they show the order as it is then.
+type NotificationPayload struct {
+	OrderID   int32  `json:"order_id,omitempty"`
+	PaymentID int32  `json:"payment_id,omitempty"` // the payment a payment review email is about
+	Status    string `json:"status,omitempty"`     // the status an order status email is about
+	Email     string `json:"email,omitempty"`      // the recipient, for notifications not sent to the order's owner
+}
+
+// ValidateNotificationStatus checks the status notifications are filtered by, empty means all
+func ValidateNotificationStatus(v *validator.Validator, status string) {
+	v.Check(status == "" || validator.PermittedValue(status, NotificationStatusPending, NotificationStatusSent, NotificationStatusSkipped, NotificationStatusDead),
+		"status", "must be one of pending, sent, skipped or dead")
+}
+
+// NotificationBackoff returns how long to wait before trying a notification again after its
+// attempts-th failure.
+func NotificationBackoff(attempts int32) time.Duration {
+	backoff := NotificationBaseBackoff
+	for i := int32(1); i < attempts && backoff < NotificationMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, NotificationMaxBackoff)
+}
+
+// enqueueNotificationTx adds a notification to the outbox inside the caller's transaction.
+// Notifications are identified by their idempotency key, enqueuing the same key again does
+// nothing so a repeated change can't message anyone twice.
+func enqueueNotificationTx(ctx context.Context, qtx *database.Queries, kind, idempotencyKey string, payload NotificationPayload) error {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = qtx.EnqueueNotification(ctx, database.EnqueueNotificationParams{
+		IdempotencyKey: idempotencyKey,
+		Kind:           kind,
+		Payload:        payloadJSON,
+		MaxAttempts:    DefaultNotificationMaxAttempts,
+	})
+	return err
+}
+
+// enqueueNewOrderNotificationsTx queues the confirmation email and SMS for the customer and
+// a notification email for every admin when an order is placed.
+func enqueueNewOrderNotificationsTx(ctx context.Context, qtx *database.Queries, orderID int32) error {
+	keyPrefix := fmt.Sprintf("order:%d:placed", orderID)
+	payload := NotificationPayload{OrderID: orderID}
+	if err := enqueueNotificationTx(ctx, qtx, NotificationOrderConfirmationEmail, keyPrefix+":email", payload); err != nil {
+		return err
+	}
+	if err := enqueueNotificationTx(ctx, qtx, NotificationOrderConfirmationSMS, keyPrefix+":sms", payload); err != nil {
+		return err
+	}
+	return enqueueAdminNotificationsTx(ctx, qtx, NotificationOrderAdminEmail, keyPrefix, payload)
+}
+
+// enqueuePaymentReviewNotificationsTx lets every admin know that a payment was put in REVIEW
+// and someone has to refund or accept it.
+func enqueuePaymentReviewNotificationsTx(ctx context.Context, qtx *database.Queries, orderID, paymentID int32) error {
+	keyPrefix := fmt.Sprintf("payment:%d:review", paymentID)
+	return enqueueAdminNotificationsTx(ctx, qtx, NotificationPaymentReviewEmail, keyPrefix, NotificationPayload{
+		OrderID:   orderID,
+		PaymentID: paymentID,
+	})
+}
+
+// enqueueAdminNotificationsTx queues one notification of kind for every admin, so a failure
+// only resends to the admins who missed it. The payload is sent to each admin's email.
+func enqueueAdminNotificationsTx(ctx context.Context, qtx *database.Queries, kind, keyPrefix string, payload NotificationPayload) error {
+	// Admins with several permissions are listed once per permission
+	superUsers, err := qtx.GetAllSuperUsersWithPermissions(ctx)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, superUser := range superUsers {
+		if seen[superUser.Email] {
+			continue
+		}
+		seen[superUser.Email] = true
+		payload.Email = superUser.Email
+		if err := enqueueNotificationTx(ctx, qtx, kind, keyPrefix+":admin:"+superUser.Email, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enqueueOrderStatusNotificationTx queues the status update email for an order that has just
+// changed status. Every change bumps the order's version, which keeps the key unique per change.
+func enqueueOrderStatusNotificationTx(ctx context.Context, qtx *database.Queries, order *Order) error {
+	key := fmt.Sprintf("order:%d:status:%d", order.ID, order.Version)
+	return enqueueNotificationTx(ctx, qtx, NotificationOrderStatusEmail, key, NotificationPayload{
+		OrderID: order.ID,
+		Status:  order.Status,
+	})
+}
+
+// ClaimDue hands out up to limit notifications that are due for delivery and counts an
+// attempt on each. They are pushed back by lease while the caller delivers them, so if the
+// caller dies without reporting back they are picked up again once the lease is over.
+// Concurrent callers never get the same notification.
+func (m NotificationModel) ClaimDue(limit int, lease time.Duration) ([]*Notification, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultNotificationDBContextTimeout)
+	defer cancel()
+
+	rows, err := m.DB.ClaimDueNotifications(ctx, database.ClaimDueNotificationsParams{
+		Limit:   int32(limit),
+		Column2: int32(lease.Seconds()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	notifications := []*Notification{}
+	for _, row := range rows {
+		notifications = append(notifications, populateNotification(row))
+	}
+	return notifications, nil
+}
+
+// MarkSent records that the claimed notification was delivered. Like MarkSkipped and
+// MarkFailed, it returns ErrNotificationLeaseLost and changes nothing when the notification
+// was claimed again after the caller's lease ran out, the outcome is the new owner's to record.
+func (m NotificationModel) MarkSent(notification *Notification) error {
+	return m.complete(notification, NotificationStatusSent, "")
+}
+
+// MarkSkipped records that there was nothing to deliver, such as an SMS to a user without a
+// verified phone number, and why
+func (m NotificationModel) MarkSkipped(notification *Notification, reason string) error {
+	return m.complete(notification, NotificationStatusSkipped, reason)
+}
+
+func (m NotificationModel) complete(notification *Notification, status, reason string) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultNotificationDBContextTimeout)
+	defer cancel()
+
+	// the attempt we claimed it with tells us it is still ours
+	rows, err := m.DB.CompleteNotification(ctx, database.CompleteNotificationParams{
+		ID:        notification.ID,
+		Status:    status,
+		LastError: reason,
+		Attempts:  notification.Attempts,
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotificationLeaseLost
+	}
+	return nil
+}
+
+// MarkFailed records a failed delivery. The notification is tried again after
+// NotificationBackoff, or dead lettered once it has used up its attempts. The updated
+// notification is returned.
+func (m NotificationModel) MarkFailed(notification *Notification, deliveryErr error) (*Notification, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultNotificationDBContextTimeout)
+	defer cancel()
+
+	failed := *notification
+	failed.LastError = deliveryErr.Error()
+	if failed.Attempts >= failed.MaxAttempts {
+		failed.Status = NotificationStatusDead
+	} else {
+		failed.Status = NotificationStatusPending
+		failed.NextAttemptAt = time.Now().Add(NotificationBackoff(failed.Attempts))
+	}
+	rows, err := m.DB.RescheduleNotification(ctx, database.RescheduleNotificationParams{
+		ID:            failed.ID,
+		Status:        failed.Status,
+		NextAttemptAt: failed.NextAttemptAt,
+		LastError:     failed.LastError,
+		Attempts:      failed.Attempts,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rows == 0 {
+		return nil, ErrNotificationLeaseLost
+	}
+	return &failed, nil
+}
+
+// Get returns a single notification, or ErrNotificationNotFound
+func (m NotificationModel) Get(id int64) (*Notification, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultNotificationDBContextTimeout)
+	defer cancel()
+
+	row, err := m.DB.GetNotificationByID(ctx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotificationNotFound
+		default:
+			return nil, err
+		}
+	}
+	return populateNotification(row), nil
+}
+
+// GetAll returns the notifications with the given status, or every notification when status
+// is empty, newest first.
+func (m NotificationModel) GetAll(status string, filters Filters) ([]*Notification, Metadata, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultNotificationDBContextTimeout)
+	defer cancel()
+
+	rows, err := m.DB.GetNotifications(ctx, database.GetNotificationsParams{
+		Column1: status,
+		Limit:   int32(filters.limit()),
+		Offset:  int32(filters.offset()),
+	})
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	notifications := []*Notification{}
+	totalRecords := 0
+	for _, row := range rows {
+		totalRecords = int(row.TotalCount)
+		notifications = append(notifications, populateNotification(database.NotificationsOutbox{
+			ID:             row.ID,
+			IdempotencyKey: row.IdempotencyKey,
+			Kind:           row.Kind,
+			Payload:        row.Payload,
+			Status:         row.Status,
+			Attempts:       row.Attempts,
+			MaxAttempts:    row.MaxAttempts,
+			NextAttemptAt:  row.NextAttemptAt,
+			LastError:      row.LastError,
+			CreatedAt:      row.CreatedAt,
+			UpdatedAt:      row.UpdatedAt,
+			SentAt:         row.SentAt,
+		}))
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return notifications, metadata, nil
+}
+
+// Retry makes a dead notification, or a pending one that is due, due straight away with a
+// fresh set of attempts. A pending notification whose next attempt is still ahead may have
+// been claimed by a worker, retrying it would have a second worker send it again, so it returns
+// ErrNotificationNotRetryable like the ones that were sent or skipped.
+func (m NotificationModel) Retry(id int64) (*Notification, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultNotificationDBContextTimeout)
+	defer cancel()
+
+	row, err := m.DB.RetryNotification(ctx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			// tell a missing notification apart from one that is already done
+			if _, err := m.Get(id); err != nil {
+				return nil, err
+			}
+			return nil, ErrNotificationNotRetryable
+		default:
+			return nil, err
+		}
+	}
+	return populateNotification(row), nil
+}
+
+// populateNotification converts an outbox row into a Notification. Payloads are always
+// written by enqueueNotificationTx, one that doesn't decode is left empty.
+func populateNotification(row database.NotificationsOutbox) *Notification {
+	notification := &Notification{
+		ID:             row.ID,
+		IdempotencyKey: row.IdempotencyKey,
+		Kind:           row.Kind,
+		Status:         row.Status,
+		Attempts:       row.Attempts,
+		MaxAttempts:    row.MaxAttempts,
+		NextAttemptAt:  row.NextAttemptAt,
+		LastError:      row.LastError,
+		CreatedAt:      row.CreatedAt,
+		UpdatedAt:      row.UpdatedAt,
+	}
+	_ = json.Unmarshal(row.Payload, &notification.Payload)
+	if row.SentAt.Valid {
+		notification.SentAt = &row.SentAt.Time
+	}
+	return notification
+}
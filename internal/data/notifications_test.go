@@ -0,0 +1,239 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/database"
+	"github.com/Blue-Davinci/SavannaCart/internal/validator"
+)
+
+func TestNotificationBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int32
+		expected time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{6, 32 * time.Minute},
+		{7, time.Hour},
+		{50, time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("attempt %d", tt.attempts), func(t *testing.T) {
+			if got := NotificationBackoff(tt.attempts); got != tt.expected {
+				t.Errorf("NotificationBackoff(%d) = %v, want %v", tt.attempts, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateNotificationStatus(t *testing.T) {
+	tests := []struct {
+		status string
+		valid  bool
+	}{
+		{"", true},
+		{NotificationStatusPending, true},
+		{NotificationStatusDead, true},
+		{"failed", false},
+		{"DEAD", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			v := validator.New()
+			ValidateNotificationStatus(v, tt.status)
+			if v.Valid() != tt.valid {
+				t.Errorf("Expected valid to be %v for %q, got %v", tt.valid, tt.status, v.Valid())
+			}
+		})
+	}
+}
+
+// orderNotifications() returns the outbox entries of an order by kind, and removes every
+// entry of the order once the test finishes.
+func orderNotifications(t *testing.T, db *sql.DB, models Models, orderID int32) map[string][]*Notification {
+	t.Helper()
+
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM notifications_outbox WHERE payload->>'order_id' = $1`, fmt.Sprint(orderID))
+	})
+	notifications, _, err := models.Notifications.GetAll("", Filters{Page: 1, PageSize: 100})
+	if err != nil {
+		t.Fatalf("Failed to list notifications: %v", err)
+	}
+	byKind := make(map[string][]*Notification)
+	for _, notification := range notifications {
+		if notification.Payload.OrderID == orderID {
+			byKind[notification.Kind] = append(byKind[notification.Kind], notification)
+		}
+	}
+	return byKind
+}
+
+func TestOrderChangesQueueNotifications(t *testing.T) {
+	db := openTestDB(t)
+	models := NewModels(db, 0)
+	userID := seedTestUser(t, db)
+	productID := seedTestProduct(t, db, "100.00", 5)
+
+	order, err := models.Orders.CreateOrder(&CreateOrderRequest{
+		UserID: int32(userID),
+		Items:  []*CreateOrderItemRequest{{ProductID: productID, Quantity: 1}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+	if _, err := models.Orders.UpdateOrderStatus(order.ID, OrderStatusProcessing, order.Version, userID, ""); err != nil {
+		t.Fatalf("Failed to update order status: %v", err)
+	}
+
+	queued := orderNotifications(t, db, models, order.ID)
+	for _, kind := range []string{NotificationOrderConfirmationEmail, NotificationOrderConfirmationSMS, NotificationOrderStatusEmail} {
+		if len(queued[kind]) != 1 {
+			t.Errorf("Expected one %s notification, got %d", kind, len(queued[kind]))
+		}
+	}
+	if status := queued[NotificationOrderStatusEmail]; len(status) == 1 && status[0].Payload.Status != OrderStatusProcessing {
+		t.Errorf("Expected the status email to be about %s, got %q", OrderStatusProcessing, status[0].Payload.Status)
+	}
+	for _, admin := range queued[NotificationOrderAdminEmail] {
+		if admin.Payload.Email == "" {
+			t.Errorf("Expected admin notifications to name their recipient, got %+v", admin.Payload)
+		}
+	}
+
+	// A failed order change queues nothing
+	if _, err := models.Orders.UpdateOrderStatus(order.ID, OrderStatusShipped, order.Version, userID, ""); !errors.Is(err, ErrEditConflict) {
+		t.Fatalf("Expected ErrEditConflict, got %v", err)
+	}
+	if queued := orderNotifications(t, db, models, order.ID); len(queued[NotificationOrderStatusEmail]) != 1 {
+		t.Errorf("Expected the conflicting update not to queue an email, got %d", len(queued[NotificationOrderStatusEmail]))
+	}
+}
+
+func TestNotificationDeliveryLifecycle(t *testing.T) {
+	db := openTestDB(t)
+	models := NewModels(db, 0)
+	ctx := context.Background()
+
+	// Enqueuing the same key twice leaves a single notification
+	orderID := int32(time.Now().UnixNano() % 1_000_000_000)
+	payload := NotificationPayload{OrderID: orderID, Status: OrderStatusShipped}
+	key := fmt.Sprintf("order:%d:status:test", orderID)
+	for range 2 {
+		err := withTransaction(ctx, db, func(qtx *database.Queries) error {
+			return enqueueNotificationTx(ctx, qtx, NotificationOrderStatusEmail, key, payload)
+		})
+		if err != nil {
+			t.Fatalf("Failed to enqueue notification: %v", err)
+		}
+	}
+	queued := orderNotifications(t, db, models, orderID)[NotificationOrderStatusEmail]
+	if len(queued) != 1 {
+		t.Fatalf("Expected the duplicate to be dropped, got %d notifications", len(queued))
+	}
+	notification := queued[0]
+
+	claim := func() *Notification {
+		t.Helper()
+		claimed, err := models.Notifications.ClaimDue(100, time.Hour)
+		if err != nil {
+			t.Fatalf("Failed to claim notifications: %v", err)
+		}
+		for _, c := range claimed {
+			if c.ID == notification.ID {
+				return c
+			}
+		}
+		return nil
+	}
+
+	// Every failure pushes the next attempt back, the last one dead letters it
+	for attempt := int32(1); attempt <= DefaultNotificationMaxAttempts; attempt++ {
+		// make the notification due again without waiting for the backoff
+		if _, err := db.Exec(`UPDATE notifications_outbox SET next_attempt_at = NOW() WHERE id = $1`, notification.ID); err != nil {
+			t.Fatalf("Failed to make notification due: %v", err)
+		}
+		claimed := claim()
+		if claimed == nil {
+			t.Fatalf("Expected attempt %d to be claimed", attempt)
+		}
+		if claimed.Attempts != attempt {
+			t.Fatalf("Expected attempt %d, got %d", attempt, claimed.Attempts)
+		}
+		if claim() != nil {
+			t.Fatalf("Expected a claimed notification not to be handed out twice")
+		}
+		failed, err := models.Notifications.MarkFailed(claimed, errors.New("smtp down"))
+		if err != nil {
+			t.Fatalf("Failed to mark notification failed: %v", err)
+		}
+		wantStatus := NotificationStatusPending
+		if attempt == DefaultNotificationMaxAttempts {
+			wantStatus = NotificationStatusDead
+		}
+		if failed.Status != wantStatus {
+			t.Fatalf("Expected status %s after attempt %d, got %s", wantStatus, attempt, failed.Status)
+		}
+	}
+
+	dead, err := models.Notifications.Get(notification.ID)
+	if err != nil {
+		t.Fatalf("Failed to get notification: %v", err)
+	}
+	if dead.Status != NotificationStatusDead || dead.LastError != "smtp down" {
+		t.Fatalf("Expected a dead notification with its last error, got %+v", dead)
+	}
+
+	// Retrying starts it over, once it is sent it can't be retried again
+	retried, err := models.Notifications.Retry(notification.ID)
+	if err != nil {
+		t.Fatalf("Failed to retry notification: %v", err)
+	}
+	if retried.Status != NotificationStatusPending || retried.Attempts != 0 {
+		t.Fatalf("Expected a fresh pending notification, got %+v", retried)
+	}
+	claimed := claim()
+	if claimed == nil {
+		t.Fatal("Expected the retried notification to be due")
+	}
+	// while a worker holds it, retrying would have another worker send it a second time
+	if _, err := models.Notifications.Retry(notification.ID); !errors.Is(err, ErrNotificationNotRetryable) {
+		t.Errorf("Expected ErrNotificationNotRetryable for a claimed notification, got %v", err)
+	}
+
+	// once the lease runs out another worker claims it, the first one can't record anything
+	if _, err := db.Exec(`UPDATE notifications_outbox SET next_attempt_at = NOW() WHERE id = $1`, notification.ID); err != nil {
+		t.Fatalf("Failed to expire the lease: %v", err)
+	}
+	reclaimed := claim()
+	if reclaimed == nil {
+		t.Fatal("Expected the notification to be claimed again once the lease ran out")
+	}
+	if err := models.Notifications.MarkSent(claimed); !errors.Is(err, ErrNotificationLeaseLost) {
+		t.Errorf("Expected ErrNotificationLeaseLost marking a reclaimed notification sent, got %v", err)
+	}
+	if err := models.Notifications.MarkSent(reclaimed); err != nil {
+		t.Fatalf("Failed to mark notification sent: %v", err)
+	}
+	if _, err := models.Notifications.MarkFailed(claimed, errors.New("smtp timeout")); !errors.Is(err, ErrNotificationLeaseLost) {
+		t.Errorf("Expected ErrNotificationLeaseLost failing a sent notification, got %v", err)
+	}
+	if sent, err := models.Notifications.Get(notification.ID); err != nil || sent.Status != NotificationStatusSent {
+		t.Errorf("Expected the notification to stay sent, got %+v (%v)", sent, err)
+	}
+	if _, err := models.Notifications.Retry(notification.ID); !errors.Is(err, ErrNotificationNotRetryable) {
+		t.Errorf("Expected ErrNotificationNotRetryable for a sent notification, got %v", err)
+	}
+	if _, err := models.Notifications.Retry(-1); !errors.Is(err, ErrNotificationNotFound) {
+		t.Errorf("Expected ErrNotificationNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/database"
+	"github.com/Blue-Davinci/SavannaCart/internal/validator"
+)
+
+var (
+	ErrOAuthStateNotFound = errors.New("unknown or already used OAuth state")
+	ErrOAuthStateExpired  = errors.New("OAuth state has expired")
+)
+
+// DefaultOAuthStateTTL is how long a user has to finish signing in with the provider
+const DefaultOAuthStateTTL = 10 * time.Minute
+
+// OAuthStateModel stores the state and PKCE verifier of every OAuth login that has been
+// started, so the callback can check it is answering a login we started.
+type OAuthStateModel struct {
+	DB *database.Queries
+}
+
+// OAuthState is a started OAuth login. The state is sent to the provider and comes back on
+// the callback, the code verifier never leaves the server until the code is exchanged.
+type OAuthState struct {
+	State        string    `json:"state"`
+	CodeVerifier string    `json:"-"`
+	Expiry       time.Time `json:"expiry"`
+	Provider     string    `json:"provider"`
+	LinkUserID   int64     `json:"-"` // set when a signed in user is linking the provider to their account
+}
+
+// ValidateOAuthState() checks the state returned on the callback looks like one we issued.
+func ValidateOAuthState(v *validator.Validator, state string) {
+	v.Check(state != "", "state", "must be provided")
+	v.Check(len(state) <= 128, "state", "must not be more than 128 bytes long")
+}
+
+// randomURLSafeString() returns n random bytes encoded as unpadded base64url. 32 bytes give
+// a 43 character string, which is also a valid PKCE code verifier.
+func randomURLSafeString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// New() starts an OAuth login with the given provider, generating a random state and PKCE
+// code verifier that are valid for ttl.
+func (m OAuthStateModel) New(provider string, ttl time.Duration) (*OAuthState, error) {
+	return m.insert(provider, 0, ttl)
+}
+
+// NewLink() starts an OAuth login that links the provider to the user's account rather than
+// signing them in.
+func (m OAuthStateModel) NewLink(provider string, userID int64, ttl time.Duration) (*OAuthState, error) {
+	return m.insert(provider, userID, ttl)
+}
+
+// insert() stores a new OAuth login. Only a hash of the state is stored. States that have
+// already expired are cleared out first.
+func (m OAuthStateModel) insert(provider string, linkUserID int64, ttl time.Duration) (*OAuthState, error) {
+	state, err := randomURLSafeString(32)
+	if err != nil {
+		return nil, err
+	}
+	codeVerifier, err := randomURLSafeString(32)
+	if err != nil {
+		return nil, err
+	}
+	oauthState := &OAuthState{
+		State:        state,
+		CodeVerifier: codeVerifier,
+		Expiry:       time.Now().Add(ttl),
+		Provider:     provider,
+		LinkUserID:   linkUserID,
+	}
+
+	ctx, cancel := contextGenerator(context.Background(), DefaultTokenDBContextTimeout)
+	defer cancel()
+	err = m.DB.DeleteExpiredOAuthStates(ctx, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	stateHash := sha256.Sum256([]byte(state))
+	err = m.DB.CreateOAuthState(ctx, database.CreateOAuthStateParams{
+		StateHash:    stateHash[:],
+		CodeVerifier: oauthState.CodeVerifier,
+		Expiry:       oauthState.Expiry,
+		Provider:     oauthState.Provider,
+		LinkUserID:   sql.NullInt64{Int64: linkUserID, Valid: linkUserID != 0},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return oauthState, nil
+}
+
+// Consume() looks up and deletes a state in one go, so each state can only be used once.
+// Unknown or already used states, and states started with a different provider, return
+// ErrOAuthStateNotFound. States used too late return ErrOAuthStateExpired.
+func (m OAuthStateModel) Consume(provider, state string) (*OAuthState, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultTokenDBContextTimeout)
+	defer cancel()
+
+	stateHash := sha256.Sum256([]byte(state))
+	row, err := m.DB.ConsumeOAuthState(ctx, stateHash[:])
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrOAuthStateNotFound
+		default:
+			return nil, err
+		}
+	}
+	// a code from one provider must never be exchanged with another
+	if row.Provider != provider {
+		return nil, ErrOAuthStateNotFound
+	}
+	if !time.Now().Before(row.Expiry) {
+		return nil, ErrOAuthStateExpired
+	}
+	return &OAuthState{
+		State:        state,
+		CodeVerifier: row.CodeVerifier,
+		Expiry:       row.Expiry,
+		Provider:     row.Provider,
+		LinkUserID:   row.LinkUserID.Int64,
+	}, nil
+}
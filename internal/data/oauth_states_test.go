@@ -0,0 +1,111 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/database"
+	"github.com/Blue-Davinci/SavannaCart/internal/validator"
+)
+
+func TestValidateOAuthState(t *testing.T) {
+	tests := []struct {
+		name  string
+		state string
+		valid bool
+	}{
+		{"issued state", "x3k2JqQ0c4m8yJ5u1Zr7TnVb6PwLs9Dh-Ae_Gf0HiKo", true},
+		{"missing state", "", false},
+		{"too long", string(make([]byte, 129)), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateOAuthState(v, tt.state)
+			if v.Valid() != tt.valid {
+				t.Errorf("Expected valid=%v, got errors %v", tt.valid, v.Errors)
+			}
+		})
+	}
+}
+
+func TestRandomURLSafeString(t *testing.T) {
+	first, err := randomURLSafeString(32)
+	if err != nil {
+		t.Fatalf("Failed to generate string: %v", err)
+	}
+	second, _ := randomURLSafeString(32)
+
+	// RFC 7636 code verifiers must be 43 to 128 characters long
+	if len(first) != 43 {
+		t.Errorf("Expected 43 characters, got %d", len(first))
+	}
+	if first == second {
+		t.Error("Expected two different strings")
+	}
+}
+
+func TestOAuthStateConsume(t *testing.T) {
+	db := openTestDB(t)
+	states := OAuthStateModel{DB: database.New(db)}
+
+	started, err := states.New("google", DefaultOAuthStateTTL)
+	if err != nil {
+		t.Fatalf("Failed to start OAuth login: %v", err)
+	}
+	consumed, err := states.Consume("google", started.State)
+	if err != nil {
+		t.Fatalf("Failed to consume state: %v", err)
+	}
+	if consumed.CodeVerifier != started.CodeVerifier || consumed.LinkUserID != 0 {
+		t.Errorf("Expected code verifier %q and no user to link, got %+v", started.CodeVerifier, consumed)
+	}
+
+	// A state can only be used once
+	if _, err := states.Consume("google", started.State); !errors.Is(err, ErrOAuthStateNotFound) {
+		t.Errorf("Expected ErrOAuthStateNotFound for a reused state, got %v", err)
+	}
+	if _, err := states.Consume("google", "never-issued"); !errors.Is(err, ErrOAuthStateNotFound) {
+		t.Errorf("Expected ErrOAuthStateNotFound for an unknown state, got %v", err)
+	}
+
+	expired, err := states.New("google", -time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to start OAuth login: %v", err)
+	}
+	if _, err := states.Consume("google", expired.State); !errors.Is(err, ErrOAuthStateExpired) {
+		t.Errorf("Expected ErrOAuthStateExpired, got %v", err)
+	}
+}
+
+func TestOAuthStateIsBoundToItsProvider(t *testing.T) {
+	db := openTestDB(t)
+	states := OAuthStateModel{DB: database.New(db)}
+	userID := seedTestUser(t, db)
+
+	started, err := states.NewLink("microsoft", userID, DefaultOAuthStateTTL)
+	if err != nil {
+		t.Fatalf("Failed to start OAuth login: %v", err)
+	}
+	// Returning to another provider's callback uses the state up without accepting it
+	if _, err := states.Consume("google", started.State); !errors.Is(err, ErrOAuthStateNotFound) {
+		t.Errorf("Expected ErrOAuthStateNotFound on another provider's callback, got %v", err)
+	}
+	if _, err := states.Consume("microsoft", started.State); !errors.Is(err, ErrOAuthStateNotFound) {
+		t.Errorf("Expected the state to be used up, got %v", err)
+	}
+
+	linking, err := states.NewLink("microsoft", userID, DefaultOAuthStateTTL)
+	if err != nil {
+		t.Fatalf("Failed to start OAuth login: %v", err)
+	}
+	consumed, err := states.Consume("microsoft", linking.State)
+	if err != nil {
+		t.Fatalf("Failed to consume state: %v", err)
+	}
+	if consumed.LinkUserID != userID || consumed.Provider != "microsoft" {
+		t.Errorf("Expected a microsoft link for user %d, got %+v", userID, consumed)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/Blue-Davinci/SavannaCart/internal/database"
@@ -19,33 +20,49 @@ var (
 	ErrInvalidOrderStatus    = errors.New("invalid order status")
 	ErrOrderCannotBeModified = errors.New("order cannot be modified in current status")
 	ErrEmptyOrder            = errors.New("order must contain at least one item")
+	ErrOrderStatusReserved   = errors.New("order status is set by payments and cannot be changed by hand")
 )
 
 // Order status constants
 const (
-	OrderStatusPlaced     = "PLACED"
-	OrderStatusProcessing = "PROCESSING"
-	OrderStatusShipped    = "SHIPPED"
-	OrderStatusDelivered  = "DELIVERED"
-	OrderStatusCancelled  = "CANCELLED"
+	OrderStatusPlaced         = "PLACED"
+	OrderStatusPendingPayment = "PENDING_PAYMENT" // an M-Pesa prompt has been sent and we are waiting on the callback
+	OrderStatusPaid           = "PAID"
+	OrderStatusProcessing     = "PROCESSING"
+	OrderStatusShipped        = "SHIPPED"
+	OrderStatusDelivered      = "DELIVERED"
+	OrderStatusCancelled      = "CANCELLED"
 )
 
 // Define the OrderModel type
 type OrderModel struct {
-	DB *database.Queries
+	DB   *database.Queries
+	Conn *sql.DB // used to open transactions for multi-statement operations
 }
 
 // Order represents an order in the system
 type Order struct {
-	ID        int32           `json:"id"`
-	UserID    int32           `json:"user_id"`
-	TotalKES  decimal.Decimal `json:"total_kes"`
-	Status    string          `json:"status"`
-	Version   int32           `json:"version"`
-	CreatedAt time.Time       `json:"created_at"`
-	UpdatedAt time.Time       `json:"updated_at"`
-	Items     []*OrderItem    `json:"items,omitempty"`
-	User      *UserInfo       `json:"user,omitempty"`
+	ID        int32                `json:"id"`
+	UserID    int32                `json:"user_id"`
+	TotalKES  decimal.Decimal      `json:"total_kes"`
+	Status    string               `json:"status"`
+	Version   int32                `json:"version"`
+	CreatedAt time.Time            `json:"created_at"`
+	UpdatedAt time.Time            `json:"updated_at"`
+	Items     []*OrderItem         `json:"items,omitempty"`
+	User      *UserInfo            `json:"user,omitempty"`
+	History   []*OrderStatusChange `json:"history,omitempty"`
+}
+
+// OrderStatusChange is a single entry in an order's status history
+type OrderStatusChange struct {
+	ID         int32     `json:"id"`
+	OrderID    int32     `json:"order_id"`
+	FromStatus string    `json:"from_status,omitempty"` // empty for the entry recorded when the order is placed
+	ToStatus   string    `json:"to_status"`
+	ChangedBy  *int32    `json:"changed_by,omitempty"` // nil for system changes such as payment callbacks
+	Note       string    `json:"note,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
 }
 
 // OrderItem represents an item within an order
@@ -105,6 +122,10 @@ const (
 	DefaultOrderDBContextTimeout = 10 * time.Second
 )
 
+const (
+	MaxOrderStatusNoteLength = 500
+)
+
 // populateOrder converts a database Order row into an Order struct.
 func populateOrder(orderRow any) *Order {
 	switch order := orderRow.(type) {
@@ -124,6 +145,27 @@ func populateOrder(orderRow any) *Order {
 	}
 }
 
+// populateOrderStatusChange converts a database order_status_history row into an OrderStatusChange struct.
+func populateOrderStatusChange(historyRow any) *OrderStatusChange {
+	switch history := historyRow.(type) {
+	case database.OrderStatusHistory:
+		change := &OrderStatusChange{
+			ID:         history.ID,
+			OrderID:    history.OrderID,
+			FromStatus: history.FromStatus.String,
+			ToStatus:   history.ToStatus,
+			Note:       history.Note,
+			CreatedAt:  history.CreatedAt,
+		}
+		if history.ChangedBy.Valid {
+			change.ChangedBy = &history.ChangedBy.Int32
+		}
+		return change
+	default:
+		return nil
+	}
+}
+
 // populateOrderItem converts a database OrderItem row into an OrderItem struct.
 func populateOrderItem(orderItemRow any) *OrderItem {
 	switch item := orderItemRow.(type) {
@@ -176,6 +218,8 @@ func ValidateCreateOrderRequest(v *validator.Validator, req *CreateOrderRequest)
 func ValidateOrderStatus(v *validator.Validator, status string) {
 	validStatuses := []string{
 		OrderStatusPlaced,
+		OrderStatusPendingPayment,
+		OrderStatusPaid,
 		OrderStatusProcessing,
 		OrderStatusShipped,
 		OrderStatusDelivered,
@@ -186,14 +230,24 @@ func ValidateOrderStatus(v *validator.Validator, status string) {
 	v.Check(validator.PermittedValue(status, validStatuses...), "status", "must be a valid status")
 }
 
+// ValidateOrderStatusNote validates the optional note an admin leaves on a status change
+func ValidateOrderStatusNote(v *validator.Validator, note string) {
+	v.Check(len(note) <= MaxOrderStatusNoteLength, "note", fmt.Sprintf("must not be more than %d bytes long", MaxOrderStatusNoteLength))
+}
+
 // isValidStatusTransition checks if the status transition is valid
 func isValidStatusTransition(currentStatus, newStatus string) bool {
 	validTransitions := map[string][]string{
-		OrderStatusPlaced:     {OrderStatusProcessing, OrderStatusCancelled},
-		OrderStatusProcessing: {OrderStatusShipped, OrderStatusCancelled},
-		OrderStatusShipped:    {OrderStatusDelivered},
-		OrderStatusDelivered:  {}, // No further transitions allowed
-		OrderStatusCancelled:  {}, // No further transitions allowed
+		OrderStatusPlaced: {OrderStatusPendingPayment, OrderStatusProcessing, OrderStatusCancelled},
+		// A failed or abandoned payment puts the order back to PLACED so it can be paid again.
+		// It cannot be cancelled while a payment prompt is still outstanding, payments whose
+		// callback never comes are settled by reconciliation once they time out.
+		OrderStatusPendingPayment: {OrderStatusPaid, OrderStatusPlaced},
+		OrderStatusPaid:           {OrderStatusProcessing},
+		OrderStatusProcessing:     {OrderStatusShipped, OrderStatusCancelled},
+		OrderStatusShipped:        {OrderStatusDelivered},
+		OrderStatusDelivered:      {}, // No further transitions allowed
+		OrderStatusCancelled:      {}, // No further transitions allowed
 	}
 
 	allowedTransitions, exists := validTransitions[currentStatus]
@@ -210,6 +264,14 @@ func isValidStatusTransition(currentStatus, newStatus string) bool {
 	return false
 }
 
+// isPaymentStatusTransition reports whether moving an order between these statuses is the
+// payment code's job. An order only goes to PENDING_PAYMENT or PAID, or leaves PENDING_PAYMENT,
+// when a payment starts or settles, so nobody can mark an order paid while its payment is
+// unresolved or release it while a prompt is still on the customer's phone.
+func isPaymentStatusTransition(currentStatus, newStatus string) bool {
+	return currentStatus == OrderStatusPendingPayment || newStatus == OrderStatusPendingPayment || newStatus == OrderStatusPaid
+}
+
 // CheckProductAvailability checks if a product has sufficient stock
 func (m OrderModel) CheckProductAvailability(productID int32, requiredQuantity int32) (*ProductAvailability, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), DefaultOrderDBContextTimeout)
@@ -245,35 +307,76 @@ func (m OrderModel) CheckProductAvailability(productID int32, requiredQuantity i
 	return availability, nil
 }
 
-// CreateOrder creates a new order with the provided items
+// CreateOrder creates a new order with the provided items.
+// The stock checks, the order, its items and the stock decrements all run in a single
+// transaction, so concurrent checkouts cannot oversell and a failure part way through
+// leaves nothing behind. The order's confirmations are queued in the same transaction.
 func (m OrderModel) CreateOrder(req *CreateOrderRequest) (*Order, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), DefaultOrderDBContextTimeout)
 	defer cancel()
 
-	// Check product availability and calculate total in one pass
-	var totalAmount decimal.Decimal
-	productAvailabilityMap := make(map[int32]*ProductAvailability)
+	var order *Order
+	err := withTransaction(ctx, m.Conn, func(qtx *database.Queries) error {
+		var err error
+		order, err = createOrderTx(ctx, qtx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// createOrderTx() does the actual work of CreateOrder using queries that are already bound
+// to a transaction. Every product in the order is locked with SELECT ... FOR UPDATE, in
+// ascending ID order so that two checkouts touching the same products cannot deadlock,
+// before any stock is checked or decremented.
+func createOrderTx(ctx context.Context, qtx *database.Queries, req *CreateOrderRequest) (*Order, error) {
+	if len(req.Items) == 0 {
+		return nil, ErrEmptyOrder
+	}
 
+	// The same product may appear more than once, so total up what we need per product
+	requiredQuantities := make(map[int32]int32)
 	for _, item := range req.Items {
-		availability, err := m.CheckProductAvailability(item.ProductID, item.Quantity)
+		requiredQuantities[item.ProductID] += item.Quantity
+	}
+	productIDs := make([]int32, 0, len(requiredQuantities))
+	for productID := range requiredQuantities {
+		productIDs = append(productIDs, productID)
+	}
+	sort.Slice(productIDs, func(i, j int) bool { return productIDs[i] < productIDs[j] })
+
+	// Lock and check every product before writing anything
+	lockedProducts := make(map[int32]database.GetProductForUpdateRow)
+	for _, productID := range productIDs {
+		product, err := qtx.GetProductForUpdate(ctx, productID)
 		if err != nil {
-			return nil, err
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return nil, ErrGeneralRecordNotFound
+			default:
+				return nil, err
+			}
 		}
-
-		if !availability.IsAvailable {
-			return nil, fmt.Errorf("product %s: %w", availability.Name, ErrInsufficientStock)
+		if product.StockQuantity < requiredQuantities[productID] {
+			return nil, fmt.Errorf("product %s: %w", product.Name, ErrInsufficientStock)
 		}
+		lockedProducts[productID] = product
+	}
 
-		// Store availability data for later use
-		productAvailabilityMap[item.ProductID] = availability
-
-		// Calculate item total
-		itemTotal := availability.CurrentPrice.Mul(decimal.NewFromInt32(item.Quantity))
-		totalAmount = totalAmount.Add(itemTotal)
+	// Calculate the total from the locked prices
+	var totalAmount decimal.Decimal
+	for _, item := range req.Items {
+		price, err := decimal.NewFromString(lockedProducts[item.ProductID].PriceKes)
+		if err != nil {
+			return nil, err
+		}
+		totalAmount = totalAmount.Add(price.Mul(decimal.NewFromInt32(item.Quantity)))
 	}
 
 	// Create the order
-	dbOrder, err := m.DB.CreateOrder(ctx, database.CreateOrderParams{
+	dbOrder, err := qtx.CreateOrder(ctx, database.CreateOrderParams{
 		UserID:   req.UserID,
 		TotalKes: totalAmount.String(),
 		Status:   OrderStatusPlaced,
@@ -282,17 +385,16 @@ func (m OrderModel) CreateOrder(req *CreateOrderRequest) (*Order, error) {
 		return nil, err
 	}
 
-	// Create order items using cached availability data
+	// Create the order items using the locked product data
 	var items []*OrderItem
 	for _, item := range req.Items {
-		// Get cached availability data
-		availability := productAvailabilityMap[item.ProductID]
+		product := lockedProducts[item.ProductID]
 
-		dbOrderItem, err := m.DB.CreateOrderItem(ctx, database.CreateOrderItemParams{
+		dbOrderItem, err := qtx.CreateOrderItem(ctx, database.CreateOrderItemParams{
 			OrderID:      dbOrder.ID,
 			ProductID:    item.ProductID,
 			Quantity:     item.Quantity,
-			UnitPriceKes: availability.CurrentPrice.String(),
+			UnitPriceKes: product.PriceKes,
 		})
 		if err != nil {
 			return nil, err
@@ -300,20 +402,37 @@ func (m OrderModel) CreateOrder(req *CreateOrderRequest) (*Order, error) {
 
 		orderItem := populateOrderItem(dbOrderItem)
 		if orderItem != nil {
-			orderItem.ProductName = availability.Name
+			orderItem.ProductName = product.Name
 			items = append(items, orderItem)
 		}
+	}
 
-		// Update product stock using cached data
-		err = m.DB.UpdateProductStockQuantity(ctx, database.UpdateProductStockQuantityParams{
-			ID:            item.ProductID,
-			StockQuantity: availability.StockQuantity - item.Quantity,
+	// Decrement the stock. The guarded decrement never lets stock go below zero, even
+	// if the lock above were somehow bypassed.
+	for _, productID := range productIDs {
+		_, err := qtx.DecrementProductStock(ctx, database.DecrementProductStockParams{
+			ID:            productID,
+			StockQuantity: requiredQuantities[productID],
 		})
 		if err != nil {
-			return nil, err
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return nil, fmt.Errorf("product %s: %w", lockedProducts[productID].Name, ErrInsufficientStock)
+			default:
+				return nil, err
+			}
 		}
 	}
 
+	// Start the order's status history
+	if err := recordStatusChangeTx(ctx, qtx, dbOrder.ID, "", OrderStatusPlaced, int64(req.UserID), "order placed"); err != nil {
+		return nil, err
+	}
+	// The confirmations are only queued if the order is actually placed
+	if err := enqueueNewOrderNotificationsTx(ctx, qtx, dbOrder.ID); err != nil {
+		return nil, err
+	}
+
 	// Populate and return the order
 	order := populateOrder(dbOrder)
 	if order != nil {
@@ -395,13 +514,21 @@ func (m OrderModel) GetOrderWithItems(orderID int32) (*Order, error) {
 	return order, nil
 }
 
-// GetAllOrdersWithItems retrieves all orders with their items (admin view)
+// GetAllOrdersWithItems retrieves all orders with their items (admin view), newest first.
+// Pages can also be read after a cursor, from the next_cursor of the previous page.
 func (m OrderModel) GetAllOrdersWithItems(name string, filters Filters) ([]*Order, Metadata, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), DefaultOrderDBContextTimeout)
 	defer cancel()
 
+	after, hasCursor, err := filters.after()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
 	rows, err := m.DB.GetAllOrdersWithItems(ctx, database.GetAllOrdersWithItemsParams{
 		Column1: name,
+		Column2: hasCursor,
+		Column3: after.CreatedAt,
+		Column4: after.ID,
 		Limit:   int32(filters.limit()),
 		Offset:  int32(filters.offset()),
 	})
@@ -418,8 +545,10 @@ func (m OrderModel) GetAllOrdersWithItems(name string, filters Filters) ([]*Orde
 		return []*Order{}, Metadata{}, nil
 	}
 
-	// Group rows by order ID
+	// Group rows by order ID, keeping the orders in the order they were listed. Every order on
+	// the page comes with all of its items, total_count counts the orders.
 	orderMap := make(map[int32]*Order)
+	orders := []*Order{}
 	var totalRecords int64
 
 	for _, row := range rows {
@@ -446,6 +575,7 @@ func (m OrderModel) GetAllOrdersWithItems(name string, filters Filters) ([]*Orde
 			order.TotalKES, _ = decimal.NewFromString(row.TotalKes)
 			order.Items = []*OrderItem{}
 			orderMap[row.OrderID] = order
+			orders = append(orders, order)
 		}
 
 		// Add order item if it exists
@@ -463,27 +593,48 @@ func (m OrderModel) GetAllOrdersWithItems(name string, filters Filters) ([]*Orde
 		}
 	}
 
-	// Convert map to slice
-	orders := make([]*Order, 0, len(orderMap))
-	for _, order := range orderMap {
-		orders = append(orders, order)
+	// Calculate metadata, the next page starts after the last order kept on this one
+	fetched := len(orders)
+	orders = keysetPage(filters, orders)
+	last := orders[len(orders)-1]
+	metadata := filters.keysetMetadata(int(totalRecords), fetched, Cursor{CreatedAt: last.CreatedAt, ID: last.ID})
+
+	orderIDs := make([]int32, 0, len(orders))
+	for _, order := range orders {
+		orderIDs = append(orderIDs, order.ID)
 	}
 
-	// Calculate metadata
-	metadata := calculateMetadata(int(totalRecords), filters.Page, filters.PageSize)
+	// Admins see who moved each order and when, loaded for the whole page in one query
+	historyRows, err := m.DB.GetOrderStatusHistoryForOrders(ctx, orderIDs)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	for _, row := range historyRows {
+		if order, exists := orderMap[row.OrderID]; exists {
+			order.History = append(order.History, populateOrderStatusChange(row))
+		}
+	}
 
 	return orders, metadata, nil
 }
 
-// GetUserOrdersWithItems retrieves orders for a specific user
+// GetUserOrdersWithItems retrieves orders for a specific user, newest first. Pages can also
+// be read after a cursor, from the next_cursor of the previous page.
 func (m OrderModel) GetUserOrdersWithItems(userID int32, filters Filters) ([]*Order, Metadata, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), DefaultOrderDBContextTimeout)
 	defer cancel()
 
+	after, hasCursor, err := filters.after()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
 	rows, err := m.DB.GetUserOrdersWithItems(ctx, database.GetUserOrdersWithItemsParams{
-		UserID: userID,
-		Limit:  int32(filters.limit()),
-		Offset: int32(filters.offset()),
+		UserID:  userID,
+		Column2: hasCursor,
+		Column3: after.CreatedAt,
+		Column4: after.ID,
+		Limit:   int32(filters.limit()),
+		Offset:  int32(filters.offset()),
 	})
 	if err != nil {
 		switch {
@@ -498,8 +649,10 @@ func (m OrderModel) GetUserOrdersWithItems(userID int32, filters Filters) ([]*Or
 		return []*Order{}, Metadata{}, nil
 	}
 
-	// Group rows by order ID
+	// Group rows by order ID, keeping the orders in the order they were listed. Every order on
+	// the page comes with all of its items, total_count counts the orders.
 	orderMap := make(map[int32]*Order)
+	orders := []*Order{}
 	var totalRecords int64
 
 	for _, row := range rows {
@@ -520,6 +673,7 @@ func (m OrderModel) GetUserOrdersWithItems(userID int32, filters Filters) ([]*Or
 			order.TotalKES, _ = decimal.NewFromString(row.TotalKes)
 			order.Items = []*OrderItem{}
 			orderMap[row.OrderID] = order
+			orders = append(orders, order)
 		}
 
 		// Add order item if it exists
@@ -537,14 +691,11 @@ func (m OrderModel) GetUserOrdersWithItems(userID int32, filters Filters) ([]*Or
 		}
 	}
 
-	// Convert map to slice
-	orders := make([]*Order, 0, len(orderMap))
-	for _, order := range orderMap {
-		orders = append(orders, order)
-	}
-
-	// Calculate metadata
-	metadata := calculateMetadata(int(totalRecords), filters.Page, filters.PageSize)
+	// Calculate metadata, the next page starts after the last order kept on this one
+	fetched := len(orders)
+	orders = keysetPage(filters, orders)
+	last := orders[len(orders)-1]
+	metadata := filters.keysetMetadata(int(totalRecords), fetched, Cursor{CreatedAt: last.CreatedAt, ID: last.ID})
 
 	return orders, metadata, nil
 }
@@ -667,48 +818,173 @@ func (m OrderModel) GetOrderStatistics(startDate, endDate time.Time) (*OrderStat
 	return stats, nil
 }
 
-// UpdateOrderStatus updates the status of an order
-func (m OrderModel) UpdateOrderStatus(orderID int32, newStatus string, expectedVersion int32) (*Order, error) {
+// UpdateOrderStatus updates the status of an order on behalf of changedBy and records the
+// change, with the optional note, in the order's status history. Moving an order to CANCELLED
+// puts the stock of every item back in the same transaction as the status change, which also
+// queues the customer's status update email. Changes that belong to payments return
+// ErrOrderStatusReserved, see isPaymentStatusTransition.
+func (m OrderModel) UpdateOrderStatus(orderID int32, newStatus string, expectedVersion int32, changedBy int64, note string) (*Order, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), DefaultOrderDBContextTimeout)
 	defer cancel()
 
-	// Get current order to validate status transition
-	currentOrder, err := m.DB.GetOrderById(ctx, orderID)
-	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return nil, ErrOrderNotFound
-		default:
-			return nil, err
+	var order *Order
+	err := withTransaction(ctx, m.Conn, func(qtx *database.Queries) error {
+		// Get and lock the current order to validate the status transition
+		currentOrder, err := qtx.GetOrderForUpdate(ctx, orderID)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrOrderNotFound
+			default:
+				return err
+			}
 		}
-	}
 
-	// Check version for optimistic locking
-	if currentOrder.Version != expectedVersion {
-		return nil, ErrEditConflict
-	}
+		// Check version for optimistic locking
+		if currentOrder.Version != expectedVersion {
+			return ErrEditConflict
+		}
+
+		// Validate status transition
+		if !isValidStatusTransition(currentOrder.Status, newStatus) {
+			return ErrInvalidOrderStatus
+		}
+		if changedBy != 0 && isPaymentStatusTransition(currentOrder.Status, newStatus) {
+			return ErrOrderStatusReserved
+		}
+
+		// Update the order status
+		updatedOrder, err := qtx.UpdateOrderStatus(ctx, database.UpdateOrderStatusParams{
+			ID:      orderID,
+			Status:  newStatus,
+			Version: expectedVersion,
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrEditConflict
+			default:
+				return err
+			}
+		}
+
+		// Return the items to stock when the order is cancelled
+		if newStatus == OrderStatusCancelled {
+			if err := restockOrderTx(ctx, qtx, orderID); err != nil {
+				return err
+			}
+		}
+
+		if err := recordStatusChangeTx(ctx, qtx, orderID, currentOrder.Status, newStatus, changedBy, note); err != nil {
+			return err
+		}
 
-	// Validate status transition
-	if !isValidStatusTransition(currentOrder.Status, newStatus) {
-		return nil, ErrInvalidOrderStatus
+		// Convert to service order
+		order = populateOrder(updatedOrder)
+		return enqueueOrderStatusNotificationTx(ctx, qtx, order)
+	})
+	if err != nil {
+		return nil, err
 	}
+	return order, nil
+}
 
-	// Update the order status
-	updatedOrder, err := m.DB.UpdateOrderStatus(ctx, database.UpdateOrderStatusParams{
-		ID:      orderID,
-		Status:  newStatus,
-		Version: expectedVersion,
+// CancelOrder cancels an order on behalf of the customer who placed it. Orders belonging
+// to someone else are reported as not found. Only orders that may still move to CANCELLED
+// (PLACED or PROCESSING) can be cancelled, anything else returns ErrOrderCannotBeModified.
+// The status change, the restocking of every item and the customer's status update email
+// are all written in one transaction.
+func (m OrderModel) CancelOrder(orderID, userID int32) (*Order, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultOrderDBContextTimeout)
+	defer cancel()
+
+	var order *Order
+	err := withTransaction(ctx, m.Conn, func(qtx *database.Queries) error {
+		// Lock the order so a concurrent status change cannot slip in between
+		currentOrder, err := qtx.GetOrderForUpdate(ctx, orderID)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrOrderNotFound
+			default:
+				return err
+			}
+		}
+		if currentOrder.UserID != userID {
+			return ErrOrderNotFound
+		}
+		if !isValidStatusTransition(currentOrder.Status, OrderStatusCancelled) {
+			return ErrOrderCannotBeModified
+		}
+		updatedOrder, err := qtx.UpdateOrderStatus(ctx, database.UpdateOrderStatusParams{
+			ID:      orderID,
+			Status:  OrderStatusCancelled,
+			Version: currentOrder.Version,
+		})
+		if err != nil {
+			return err
+		}
+		if err := restockOrderTx(ctx, qtx, orderID); err != nil {
+			return err
+		}
+		if err := recordStatusChangeTx(ctx, qtx, orderID, currentOrder.Status, OrderStatusCancelled, int64(userID), "cancelled by customer"); err != nil {
+			return err
+		}
+		order = populateOrder(updatedOrder)
+		return enqueueOrderStatusNotificationTx(ctx, qtx, order)
 	})
 	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return nil, ErrEditConflict
-		default:
-			return nil, err
+		return nil, err
+	}
+	return order, nil
+}
+
+// restockOrderTx returns the quantities of every item on an order to product stock.
+// Products are updated in ascending ID order, the same order createOrderTx locks them in,
+// so a cancellation and a checkout touching the same products cannot deadlock.
+func restockOrderTx(ctx context.Context, qtx *database.Queries, orderID int32) error {
+	items, err := qtx.GetOrderItemQuantities(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		err := qtx.IncrementProductStock(ctx, database.IncrementProductStockParams{
+			ID:            item.ProductID,
+			StockQuantity: item.Quantity,
+		})
+		if err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	// Convert to service order
-	order := populateOrder(updatedOrder)
-	return order, nil
+// recordStatusChangeTx appends an entry to an order's status history. It runs inside the
+// caller's transaction so the history can never disagree with the order. A changedBy of 0
+// records a system change, fromStatus is empty for the entry recorded when the order is placed.
+func recordStatusChangeTx(ctx context.Context, qtx *database.Queries, orderID int32, fromStatus, toStatus string, changedBy int64, note string) error {
+	_, err := qtx.CreateOrderStatusHistory(ctx, database.CreateOrderStatusHistoryParams{
+		OrderID:    orderID,
+		FromStatus: sql.NullString{String: fromStatus, Valid: fromStatus != ""},
+		ToStatus:   toStatus,
+		ChangedBy:  sql.NullInt32{Int32: int32(changedBy), Valid: changedBy != 0},
+		Note:       note,
+	})
+	return err
+}
+
+// GetOrderStatusHistory returns every status change of an order, oldest first.
+func (m OrderModel) GetOrderStatusHistory(orderID int32) ([]*OrderStatusChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultOrderDBContextTimeout)
+	defer cancel()
+
+	rows, err := m.DB.GetOrderStatusHistory(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	history := []*OrderStatusChange{}
+	for _, row := range rows {
+		history = append(history, populateOrderStatusChange(row))
+	}
+	return history, nil
 }
@@ -1,11 +1,22 @@
 package data
 
 import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/Blue-Davinci/SavannaCart/internal/database"
 	"github.com/Blue-Davinci/SavannaCart/internal/validator"
 )
 
+// newTestOrderModel() builds an OrderModel on top of a real test database.
+func newTestOrderModel(db *sql.DB) OrderModel {
+	return OrderModel{DB: database.New(db), Conn: db}
+}
+
 func TestValidateCreateOrderRequest(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -152,6 +163,16 @@ func TestValidateOrderStatus(t *testing.T) {
 			status:         OrderStatusPlaced,
 			expectedErrors: []string{},
 		},
+		{
+			name:           "valid status - PENDING_PAYMENT",
+			status:         OrderStatusPendingPayment,
+			expectedErrors: []string{},
+		},
+		{
+			name:           "valid status - PAID",
+			status:         OrderStatusPaid,
+			expectedErrors: []string{},
+		},
 		{
 			name:           "valid status - PROCESSING",
 			status:         OrderStatusProcessing,
@@ -218,6 +239,8 @@ func TestOrderStatusConstants(t *testing.T) {
 	// We'll validate through the ValidateOrderStatus function
 	validStatuses := []string{
 		OrderStatusPlaced,
+		OrderStatusPendingPayment,
+		OrderStatusPaid,
 		OrderStatusProcessing,
 		OrderStatusShipped,
 		OrderStatusDelivered,
@@ -235,18 +258,20 @@ func TestOrderStatusConstants(t *testing.T) {
 		})
 	}
 
-	// Test that we have exactly 5 valid statuses
-	if len(validStatuses) != 5 {
-		t.Errorf("Expected 5 order statuses, got %d", len(validStatuses))
+	// Test that we have exactly 7 valid statuses
+	if len(validStatuses) != 7 {
+		t.Errorf("Expected 7 order statuses, got %d", len(validStatuses))
 	}
 
 	// Check for expected values
 	statusMap := map[string]bool{
-		"PLACED":     false,
-		"PROCESSING": false,
-		"SHIPPED":    false,
-		"DELIVERED":  false,
-		"CANCELLED":  false,
+		"PLACED":          false,
+		"PENDING_PAYMENT": false,
+		"PAID":            false,
+		"PROCESSING":      false,
+		"SHIPPED":         false,
+		"DELIVERED":       false,
+		"CANCELLED":       false,
 	}
 
 	for _, status := range validStatuses {
@@ -265,6 +290,40 @@ func TestOrderStatusConstants(t *testing.T) {
 	}
 }
 
+func TestIsValidStatusTransition(t *testing.T) {
+	tests := []struct {
+		from     string
+		to       string
+		expected bool
+	}{
+		{OrderStatusPlaced, OrderStatusPendingPayment, true},
+		{OrderStatusPlaced, OrderStatusProcessing, true},
+		{OrderStatusPlaced, OrderStatusCancelled, true},
+		{OrderStatusPlaced, OrderStatusPaid, false},
+		{OrderStatusPendingPayment, OrderStatusPaid, true},
+		{OrderStatusPendingPayment, OrderStatusPlaced, true},
+		{OrderStatusPendingPayment, OrderStatusCancelled, false},
+		{OrderStatusPendingPayment, OrderStatusProcessing, false},
+		{OrderStatusPaid, OrderStatusProcessing, true},
+		{OrderStatusPaid, OrderStatusPlaced, false},
+		{OrderStatusPaid, OrderStatusCancelled, false},
+		{OrderStatusProcessing, OrderStatusShipped, true},
+		{OrderStatusShipped, OrderStatusDelivered, true},
+		{OrderStatusShipped, OrderStatusCancelled, false},
+		{OrderStatusDelivered, OrderStatusPlaced, false},
+		{OrderStatusCancelled, OrderStatusPendingPayment, false},
+		{"UNKNOWN", OrderStatusPlaced, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+"_to_"+tt.to, func(t *testing.T) {
+			if got := isValidStatusTransition(tt.from, tt.to); got != tt.expected {
+				t.Errorf("Expected transition %s -> %s to be %v, got %v", tt.from, tt.to, tt.expected, got)
+			}
+		})
+	}
+}
+
 func TestValidateCreateOrderRequestEdgeCases(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -322,3 +381,508 @@ func TestValidateCreateOrderRequestEdgeCases(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateOrderConcurrentCheckoutsNeverOversell(t *testing.T) {
+	db := openTestDB(t)
+	orders := newTestOrderModel(db)
+
+	const initialStock = 5
+	const buyers = 20
+	userID := seedTestUser(t, db)
+	productID := seedTestProduct(t, db, "250.00", initialStock)
+
+	var (
+		wg           sync.WaitGroup
+		mu           sync.Mutex
+		successCount int
+		soldOutCount int
+		otherErrors  []error
+	)
+	for i := 0; i < buyers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := orders.CreateOrder(&CreateOrderRequest{
+				UserID: int32(userID),
+				Items:  []*CreateOrderItemRequest{{ProductID: productID, Quantity: 1}},
+			})
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				successCount++
+			case errors.Is(err, ErrInsufficientStock):
+				soldOutCount++
+			default:
+				otherErrors = append(otherErrors, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(otherErrors) > 0 {
+		t.Fatalf("Unexpected errors during concurrent checkout: %v", otherErrors)
+	}
+	if successCount != initialStock {
+		t.Errorf("Expected %d successful orders, got %d", initialStock, successCount)
+	}
+	if soldOutCount != buyers-initialStock {
+		t.Errorf("Expected %d insufficient stock errors, got %d", buyers-initialStock, soldOutCount)
+	}
+	if stock := productStock(t, db, productID); stock != 0 {
+		t.Errorf("Expected final stock of 0, got %d", stock)
+	}
+}
+
+func TestCreateOrderRollsBackOnFailure(t *testing.T) {
+	db := openTestDB(t)
+	orders := newTestOrderModel(db)
+
+	userID := seedTestUser(t, db)
+	inStockID := seedTestProduct(t, db, "100.00", 10)
+	lowStockID := seedTestProduct(t, db, "100.00", 1)
+
+	_, err := orders.CreateOrder(&CreateOrderRequest{
+		UserID: int32(userID),
+		Items: []*CreateOrderItemRequest{
+			{ProductID: inStockID, Quantity: 3},
+			{ProductID: lowStockID, Quantity: 2},
+		},
+	})
+	if !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("Expected ErrInsufficientStock, got %v", err)
+	}
+
+	if stock := productStock(t, db, inStockID); stock != 10 {
+		t.Errorf("Expected untouched stock of 10, got %d", stock)
+	}
+	var orderCount int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM orders WHERE user_id = $1`, userID).Scan(&orderCount); err != nil {
+		t.Fatalf("Failed to count orders: %v", err)
+	}
+	if orderCount != 0 {
+		t.Errorf("Expected no orders to be left behind, got %d", orderCount)
+	}
+}
+
+func TestCreateOrderMergesDuplicateProducts(t *testing.T) {
+	db := openTestDB(t)
+	orders := newTestOrderModel(db)
+
+	userID := seedTestUser(t, db)
+	productID := seedTestProduct(t, db, "100.00", 3)
+
+	// Two lines for the same product together exceed the stock
+	_, err := orders.CreateOrder(&CreateOrderRequest{
+		UserID: int32(userID),
+		Items: []*CreateOrderItemRequest{
+			{ProductID: productID, Quantity: 2},
+			{ProductID: productID, Quantity: 2},
+		},
+	})
+	if !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("Expected ErrInsufficientStock, got %v", err)
+	}
+	if stock := productStock(t, db, productID); stock != 3 {
+		t.Errorf("Expected untouched stock of 3, got %d", stock)
+	}
+}
+
+func TestCancelOrderRestocksItems(t *testing.T) {
+	db := openTestDB(t)
+	orders := newTestOrderModel(db)
+
+	userID := seedTestUser(t, db)
+	otherUserID := seedTestUser(t, db)
+	firstID := seedTestProduct(t, db, "100.00", 10)
+	secondID := seedTestProduct(t, db, "50.00", 4)
+
+	order, err := orders.CreateOrder(&CreateOrderRequest{
+		UserID: int32(userID),
+		Items: []*CreateOrderItemRequest{
+			{ProductID: firstID, Quantity: 3},
+			{ProductID: secondID, Quantity: 4},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+
+	// Someone else's order looks like it does not exist
+	if _, err := orders.CancelOrder(order.ID, int32(otherUserID)); !errors.Is(err, ErrOrderNotFound) {
+		t.Fatalf("Expected ErrOrderNotFound for another user, got %v", err)
+	}
+
+	cancelled, err := orders.CancelOrder(order.ID, int32(userID))
+	if err != nil {
+		t.Fatalf("Failed to cancel order: %v", err)
+	}
+	if cancelled.Status != OrderStatusCancelled {
+		t.Errorf("Expected status %s, got %s", OrderStatusCancelled, cancelled.Status)
+	}
+	if stock := productStock(t, db, firstID); stock != 10 {
+		t.Errorf("Expected first product stock back at 10, got %d", stock)
+	}
+	if stock := productStock(t, db, secondID); stock != 4 {
+		t.Errorf("Expected second product stock back at 4, got %d", stock)
+	}
+
+	// A cancelled order cannot be cancelled (and restocked) twice
+	if _, err := orders.CancelOrder(order.ID, int32(userID)); !errors.Is(err, ErrOrderCannotBeModified) {
+		t.Fatalf("Expected ErrOrderCannotBeModified, got %v", err)
+	}
+	if stock := productStock(t, db, firstID); stock != 10 {
+		t.Errorf("Expected first product stock to stay at 10, got %d", stock)
+	}
+}
+
+func TestUpdateOrderStatusCancelledRestocksItems(t *testing.T) {
+	db := openTestDB(t)
+	orders := newTestOrderModel(db)
+
+	userID := seedTestUser(t, db)
+	firstID := seedTestProduct(t, db, "100.00", 10)
+	secondID := seedTestProduct(t, db, "50.00", 6)
+
+	order, err := orders.CreateOrder(&CreateOrderRequest{
+		UserID: int32(userID),
+		Items: []*CreateOrderItemRequest{
+			{ProductID: firstID, Quantity: 2},
+			{ProductID: secondID, Quantity: 5},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+
+	// Moving to PROCESSING leaves the stock alone
+	processing, err := orders.UpdateOrderStatus(order.ID, OrderStatusProcessing, order.Version, userID, "")
+	if err != nil {
+		t.Fatalf("Failed to move order to processing: %v", err)
+	}
+	if stock := productStock(t, db, firstID); stock != 8 {
+		t.Errorf("Expected first product stock of 8, got %d", stock)
+	}
+
+	// A stale version is rejected without restocking
+	if _, err := orders.UpdateOrderStatus(order.ID, OrderStatusCancelled, order.Version, userID, ""); !errors.Is(err, ErrEditConflict) {
+		t.Fatalf("Expected ErrEditConflict, got %v", err)
+	}
+	if stock := productStock(t, db, secondID); stock != 1 {
+		t.Errorf("Expected second product stock of 1 after a rejected cancel, got %d", stock)
+	}
+
+	cancelled, err := orders.UpdateOrderStatus(order.ID, OrderStatusCancelled, processing.Version, userID, "")
+	if err != nil {
+		t.Fatalf("Failed to cancel order: %v", err)
+	}
+	if cancelled.Status != OrderStatusCancelled {
+		t.Errorf("Expected status %s, got %s", OrderStatusCancelled, cancelled.Status)
+	}
+	if stock := productStock(t, db, firstID); stock != 10 {
+		t.Errorf("Expected first product stock back at 10, got %d", stock)
+	}
+	if stock := productStock(t, db, secondID); stock != 6 {
+		t.Errorf("Expected second product stock back at 6, got %d", stock)
+	}
+}
+
+func TestIsPaymentStatusTransition(t *testing.T) {
+	tests := []struct {
+		from     string
+		to       string
+		expected bool
+	}{
+		{OrderStatusPlaced, OrderStatusPendingPayment, true},
+		{OrderStatusPendingPayment, OrderStatusPaid, true},
+		{OrderStatusPendingPayment, OrderStatusPlaced, true},
+		{OrderStatusPlaced, OrderStatusProcessing, false},
+		{OrderStatusPlaced, OrderStatusCancelled, false},
+		{OrderStatusPaid, OrderStatusProcessing, false},
+		{OrderStatusProcessing, OrderStatusShipped, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+"_to_"+tt.to, func(t *testing.T) {
+			if got := isPaymentStatusTransition(tt.from, tt.to); got != tt.expected {
+				t.Errorf("Expected transition %s -> %s to be reserved %v, got %v", tt.from, tt.to, tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestUpdateOrderStatusLeavesPaymentStatusesToPayments(t *testing.T) {
+	db := openTestDB(t)
+	orders := newTestOrderModel(db)
+	adminID := seedTestUser(t, db)
+	userID := seedTestUser(t, db)
+
+	// an admin can't start a payment for the customer
+	productID := seedTestProduct(t, db, "100.00", 5)
+	placed, err := orders.CreateOrder(&CreateOrderRequest{
+		UserID: int32(userID),
+		Items:  []*CreateOrderItemRequest{{ProductID: productID, Quantity: 1}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+	if _, err := orders.UpdateOrderStatus(placed.ID, OrderStatusPendingPayment, placed.Version, adminID, ""); !errors.Is(err, ErrOrderStatusReserved) {
+		t.Errorf("Expected ErrOrderStatusReserved for %s, got %v", OrderStatusPendingPayment, err)
+	}
+
+	// nor mark an order paid, or release it, while its payment is pending
+	order, _ := startTestPayment(t, db, userID, "100.00")
+	pending, err := orders.GetOrderByID(order.ID)
+	if err != nil {
+		t.Fatalf("Failed to get order: %v", err)
+	}
+	for _, status := range []string{OrderStatusPaid, OrderStatusPlaced} {
+		if _, err := orders.UpdateOrderStatus(order.ID, status, pending.Version, adminID, ""); !errors.Is(err, ErrOrderStatusReserved) {
+			t.Errorf("Expected ErrOrderStatusReserved for %s, got %v", status, err)
+		}
+	}
+	if status := orderStatus(t, db, order.ID); status != OrderStatusPendingPayment {
+		t.Errorf("Expected order to stay %s, got %s", OrderStatusPendingPayment, status)
+	}
+}
+
+func TestUpdateOrderStatusShippedOrderCannotBeCancelled(t *testing.T) {
+	db := openTestDB(t)
+	orders := newTestOrderModel(db)
+
+	userID := seedTestUser(t, db)
+	productID := seedTestProduct(t, db, "100.00", 5)
+
+	order, err := orders.CreateOrder(&CreateOrderRequest{
+		UserID: int32(userID),
+		Items:  []*CreateOrderItemRequest{{ProductID: productID, Quantity: 2}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+	version := order.Version
+	for _, status := range []string{OrderStatusProcessing, OrderStatusShipped} {
+		updated, err := orders.UpdateOrderStatus(order.ID, status, version, userID, "")
+		if err != nil {
+			t.Fatalf("Failed to move order to %s: %v", status, err)
+		}
+		version = updated.Version
+	}
+
+	if _, err := orders.UpdateOrderStatus(order.ID, OrderStatusCancelled, version, userID, ""); !errors.Is(err, ErrInvalidOrderStatus) {
+		t.Fatalf("Expected ErrInvalidOrderStatus, got %v", err)
+	}
+	if stock := productStock(t, db, productID); stock != 3 {
+		t.Errorf("Expected stock to stay at 3, got %d", stock)
+	}
+}
+
+func TestValidateOrderStatusNote(t *testing.T) {
+	tests := []struct {
+		name  string
+		note  string
+		valid bool
+	}{
+		{"empty note", "", true},
+		{"short note", "Dispatched with G4S, waybill 12345", true},
+		{"note at the limit", strings.Repeat("a", MaxOrderStatusNoteLength), true},
+		{"note too long", strings.Repeat("a", MaxOrderStatusNoteLength+1), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateOrderStatusNote(v, tt.note)
+			if v.Valid() != tt.valid {
+				t.Errorf("Expected valid=%v, got errors %v", tt.valid, v.Errors)
+			}
+		})
+	}
+}
+
+func TestOrderStatusHistoryRecordsEveryTransition(t *testing.T) {
+	db := openTestDB(t)
+	orders := newTestOrderModel(db)
+
+	userID := seedTestUser(t, db)
+	adminID := seedTestUser(t, db)
+	productID := seedTestProduct(t, db, "100.00", 5)
+
+	order, err := orders.CreateOrder(&CreateOrderRequest{
+		UserID: int32(userID),
+		Items:  []*CreateOrderItemRequest{{ProductID: productID, Quantity: 1}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+	processing, err := orders.UpdateOrderStatus(order.ID, OrderStatusProcessing, order.Version, adminID, "picked")
+	if err != nil {
+		t.Fatalf("Failed to move order to processing: %v", err)
+	}
+	// A rejected change leaves no trace
+	if _, err := orders.UpdateOrderStatus(order.ID, OrderStatusDelivered, processing.Version, adminID, ""); !errors.Is(err, ErrInvalidOrderStatus) {
+		t.Fatalf("Expected ErrInvalidOrderStatus, got %v", err)
+	}
+	if _, err := orders.CancelOrder(order.ID, int32(userID)); err != nil {
+		t.Fatalf("Failed to cancel order: %v", err)
+	}
+
+	history, err := orders.GetOrderStatusHistory(order.ID)
+	if err != nil {
+		t.Fatalf("Failed to get order history: %v", err)
+	}
+	expected := []struct {
+		from      string
+		to        string
+		changedBy int64
+		note      string
+	}{
+		{"", OrderStatusPlaced, userID, "order placed"},
+		{OrderStatusPlaced, OrderStatusProcessing, adminID, "picked"},
+		{OrderStatusProcessing, OrderStatusCancelled, userID, "cancelled by customer"},
+	}
+	if len(history) != len(expected) {
+		t.Fatalf("Expected %d history entries, got %d: %+v", len(expected), len(history), history)
+	}
+	for i, want := range expected {
+		got := history[i]
+		if got.FromStatus != want.from || got.ToStatus != want.to || got.Note != want.note {
+			t.Errorf("Entry %d: expected %s -> %s (%q), got %s -> %s (%q)", i, want.from, want.to, want.note, got.FromStatus, got.ToStatus, got.Note)
+		}
+		if got.ChangedBy == nil || int64(*got.ChangedBy) != want.changedBy {
+			t.Errorf("Entry %d: expected changed_by %d, got %v", i, want.changedBy, got.ChangedBy)
+		}
+	}
+}
+
+func TestGetUserOrdersWithItemsFollowsCursors(t *testing.T) {
+	db := openTestDB(t)
+	orders := newTestOrderModel(db)
+
+	userID := seedTestUser(t, db)
+	productID := seedTestProduct(t, db, "100.00", 10)
+
+	// orders placed within the same second are told apart by their ID
+	var placed []int32
+	for range 3 {
+		order, err := orders.CreateOrder(&CreateOrderRequest{
+			UserID: int32(userID),
+			Items:  []*CreateOrderItemRequest{{ProductID: productID, Quantity: 1}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create order: %v", err)
+		}
+		placed = append([]int32{order.ID}, placed...)
+	}
+
+	filters := Filters{Page: 1, PageSize: 1, CursorSecret: []byte("test-secret")}
+	listed := []int32{}
+	for range placed {
+		page, metadata, err := orders.GetUserOrdersWithItems(int32(userID), filters)
+		if err != nil {
+			t.Fatalf("Failed to list orders: %v", err)
+		}
+		for _, order := range page {
+			listed = append(listed, order.ID)
+		}
+		filters.Cursor = metadata.NextCursor
+	}
+	if !reflect.DeepEqual(listed, placed) {
+		t.Errorf("Expected orders %v newest first, got %v", placed, listed)
+	}
+	if filters.Cursor != "" {
+		t.Errorf("Expected no cursor after the last page, got %q", filters.Cursor)
+	}
+}
+
+func TestOrderListingsPageOverOrdersNotItems(t *testing.T) {
+	db := openTestDB(t)
+	orders := newTestOrderModel(db)
+
+	userID := seedTestUser(t, db)
+	productIDs := []int32{
+		seedTestProduct(t, db, "100.00", 10),
+		seedTestProduct(t, db, "250.00", 10),
+		seedTestProduct(t, db, "75.50", 10),
+	}
+
+	// three orders of three items each, newest first
+	var placed []int32
+	for range 3 {
+		request := &CreateOrderRequest{UserID: int32(userID)}
+		for _, productID := range productIDs {
+			request.Items = append(request.Items, &CreateOrderItemRequest{ProductID: productID, Quantity: 1})
+		}
+		order, err := orders.CreateOrder(request)
+		if err != nil {
+			t.Fatalf("Failed to create order: %v", err)
+		}
+		placed = append([]int32{order.ID}, placed...)
+	}
+
+	checkPage := func(t *testing.T, page []*Order, expected []int32) {
+		t.Helper()
+		listed := []int32{}
+		for _, order := range page {
+			listed = append(listed, order.ID)
+			if len(order.Items) != len(productIDs) {
+				t.Errorf("Expected order %d to have all %d items, got %d", order.ID, len(productIDs), len(order.Items))
+			}
+			for i := 1; i < len(order.Items); i++ {
+				if order.Items[i-1].ID > order.Items[i].ID {
+					t.Errorf("Expected the items of order %d in the order they were added", order.ID)
+				}
+			}
+		}
+		if !reflect.DeepEqual(listed, expected) {
+			t.Errorf("Expected orders %v, got %v", expected, listed)
+		}
+	}
+
+	t.Run("user orders by page", func(t *testing.T) {
+		filters := Filters{Page: 1, PageSize: 2, CursorSecret: []byte("test-secret")}
+		page, metadata, err := orders.GetUserOrdersWithItems(int32(userID), filters)
+		if err != nil {
+			t.Fatalf("Failed to list orders: %v", err)
+		}
+		checkPage(t, page, placed[:2])
+		if metadata.TotalRecords != 3 || metadata.LastPage != 2 {
+			t.Errorf("Expected 3 orders over 2 pages, got %+v", metadata)
+		}
+
+		filters.Page = 2
+		page, _, err = orders.GetUserOrdersWithItems(int32(userID), filters)
+		if err != nil {
+			t.Fatalf("Failed to list orders: %v", err)
+		}
+		checkPage(t, page, placed[2:])
+
+		// the first page's cursor leads to the same place
+		filters.Cursor = metadata.NextCursor
+		page, metadata, err = orders.GetUserOrdersWithItems(int32(userID), filters)
+		if err != nil {
+			t.Fatalf("Failed to list orders: %v", err)
+		}
+		checkPage(t, page, placed[2:])
+		if metadata.NextCursor != "" {
+			t.Errorf("Expected no cursor after the last page, got %q", metadata.NextCursor)
+		}
+	})
+
+	t.Run("admin listing", func(t *testing.T) {
+		page, metadata, err := orders.GetAllOrdersWithItems("", Filters{Page: 1, PageSize: 2})
+		if err != nil {
+			t.Fatalf("Failed to list orders: %v", err)
+		}
+		// nothing else is placing orders, so ours are the newest
+		checkPage(t, page, placed[:2])
+		if metadata.TotalRecords < 3 {
+			t.Errorf("Expected at least our 3 orders to be counted, got %d", metadata.TotalRecords)
+		}
+		for _, order := range page {
+			if order.User == nil || order.User.ID != int32(userID) {
+				t.Errorf("Expected order %d to come with its customer", order.ID)
+			}
+		}
+	})
+}
@@ -0,0 +1,594 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/database"
+	"github.com/Blue-Davinci/SavannaCart/internal/validator"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	ErrPaymentNotFound    = errors.New("payment not found")
+	ErrPaymentInProgress  = errors.New("a payment for this order is already in progress")
+	ErrPaymentNotInReview = errors.New("only payments in review can be resolved")
+)
+
+// Payment status constants. A payment is in REVIEW when the customer paid but the payment
+// can't settle its order, such as one for the wrong amount, and stays there until an admin
+// accepts it (SUCCESS) or refunds the customer (REFUNDED).
+const (
+	PaymentStatusPending  = "PENDING"
+	PaymentStatusSuccess  = "SUCCESS"
+	PaymentStatusFailed   = "FAILED"
+	PaymentStatusReview   = "REVIEW"
+	PaymentStatusRefunded = "REFUNDED"
+)
+
+// Define the PaymentModel type
+type PaymentModel struct {
+	DB   *database.Queries
+	Conn *sql.DB // used to change the payment and its order together
+}
+
+// Payment represents a single attempt at paying for an order
+type Payment struct {
+	ID                 int32           `json:"id"`
+	OrderID            int32           `json:"order_id"`
+	Provider           string          `json:"provider"`
+	PhoneNumber        string          `json:"phone_number"`
+	AmountKES          decimal.Decimal `json:"amount_kes"`
+	Status             string          `json:"status"`
+	MerchantRequestID  string          `json:"merchant_request_id,omitempty"`
+	CheckoutRequestID  string          `json:"checkout_request_id,omitempty"`
+	MpesaReceiptNumber string          `json:"mpesa_receipt_number,omitempty"`
+	ResultCode         *int32          `json:"result_code,omitempty"`
+	ResultDesc         string          `json:"result_desc,omitempty"`
+	CreatedAt          time.Time       `json:"created_at"`
+	UpdatedAt          time.Time       `json:"updated_at"`
+}
+
+// PaymentResult is the provider's final word on a payment, as received on the callback
+type PaymentResult struct {
+	CheckoutRequestID string
+	MerchantRequestID string
+	Successful        bool
+	ResultCode        int32
+	ResultDesc        string
+	AmountKES         decimal.Decimal
+	ReceiptNumber     string
+	PhoneNumber       string // who paid, only sent with successful results
+}
+
+// Timeout constants for our module
+const (
+	DefaultPaymentDBContextTimeout = 10 * time.Second
+	// DefaultPaymentReconcileBatchSize is how many stale payments a reconciliation run looks at
+	DefaultPaymentReconcileBatchSize = 50
+	// DefaultPaymentAbandonAfter is how long we keep asking M-Pesa about a payment before we
+	// give up on it and release its order. A late payment still shows on the M-Pesa statement.
+	DefaultPaymentAbandonAfter = 24 * time.Hour
+)
+
+// populatePayment converts a database payment row into a Payment struct.
+func populatePayment(paymentRow any) *Payment {
+	switch payment := paymentRow.(type) {
+	case database.Payment:
+		populated := &Payment{
+			ID:                 payment.ID,
+			OrderID:            payment.OrderID,
+			Provider:           payment.Provider,
+			PhoneNumber:        payment.PhoneNumber,
+			Status:             payment.Status,
+			MerchantRequestID:  payment.MerchantRequestID.String,
+			CheckoutRequestID:  payment.CheckoutRequestID.String,
+			MpesaReceiptNumber: payment.MpesaReceiptNumber.String,
+			ResultDesc:         payment.ResultDesc.String,
+			CreatedAt:          payment.CreatedAt,
+			UpdatedAt:          payment.UpdatedAt,
+		}
+		populated.AmountKES, _ = decimal.NewFromString(payment.AmountKes)
+		if payment.ResultCode.Valid {
+			populated.ResultCode = &payment.ResultCode.Int32
+		}
+		return populated
+	default:
+		return nil // Return nil if the type does not match
+	}
+}
+
+// chargeableAmount returns the amount to charge for an order total. M-Pesa only takes
+// whole shillings, so any cents are rounded up.
+func chargeableAmount(totalKES decimal.Decimal) decimal.Decimal {
+	return totalKES.Ceil()
+}
+
+// StartPayment opens a payment attempt for an order owned by userID and moves the order to
+// PENDING_PAYMENT. Only PLACED orders can be paid for, and only one attempt may be pending at a time.
+// The caller is expected to send the STK push next and then call AttachCheckoutRequest, or
+// FailPayment if the push was certainly not sent. Attempts that never hear back are settled by
+// reconciliation, see GetStalePendingPayments.
+func (m PaymentModel) StartPayment(orderID, userID int32, phoneNumber string) (*Payment, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultPaymentDBContextTimeout)
+	defer cancel()
+
+	var payment *Payment
+	err := withTransaction(ctx, m.Conn, func(qtx *database.Queries) error {
+		order, err := qtx.GetOrderForUpdate(ctx, orderID)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrOrderNotFound
+			default:
+				return err
+			}
+		}
+		if order.UserID != userID {
+			return ErrOrderNotFound
+		}
+		if order.Status == OrderStatusPendingPayment {
+			return ErrPaymentInProgress
+		}
+		if !isValidStatusTransition(order.Status, OrderStatusPendingPayment) {
+			return ErrOrderCannotBeModified
+		}
+		totalKES, err := decimal.NewFromString(order.TotalKes)
+		if err != nil {
+			return err
+		}
+		dbPayment, err := qtx.CreatePayment(ctx, database.CreatePaymentParams{
+			OrderID:     orderID,
+			PhoneNumber: phoneNumber,
+			AmountKes:   chargeableAmount(totalKES).StringFixed(2),
+		})
+		if err != nil {
+			switch {
+			case strings.Contains(err.Error(), "ux_payments_order_pending"):
+				return ErrPaymentInProgress
+			default:
+				return err
+			}
+		}
+		_, err = qtx.UpdateOrderStatus(ctx, database.UpdateOrderStatusParams{
+			ID:      orderID,
+			Status:  OrderStatusPendingPayment,
+			Version: order.Version,
+		})
+		if err != nil {
+			return err
+		}
+		if err := recordStatusChangeTx(ctx, qtx, orderID, order.Status, OrderStatusPendingPayment, int64(userID), "M-Pesa payment requested"); err != nil {
+			return err
+		}
+		payment = populatePayment(dbPayment)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
+
+// AttachCheckoutRequest stores the identifiers M-Pesa assigned to an STK push, which is how
+// the callback is matched back to the payment.
+func (m PaymentModel) AttachCheckoutRequest(paymentID int32, merchantRequestID, checkoutRequestID string) (*Payment, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultPaymentDBContextTimeout)
+	defer cancel()
+
+	dbPayment, err := m.DB.SetPaymentCheckoutRequest(ctx, database.SetPaymentCheckoutRequestParams{
+		ID:                paymentID,
+		MerchantRequestID: sql.NullString{String: merchantRequestID, Valid: merchantRequestID != ""},
+		CheckoutRequestID: sql.NullString{String: checkoutRequestID, Valid: checkoutRequestID != ""},
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrPaymentNotFound
+		default:
+			return nil, err
+		}
+	}
+	return populatePayment(dbPayment), nil
+}
+
+// FailPayment marks a pending payment as failed without hearing back from the provider,
+// for example when M-Pesa rejected the STK push. The order goes back to PLACED.
+func (m PaymentModel) FailPayment(paymentID int32, reason string) error {
+	_, _, err := m.SettlePendingPayment(paymentID, PaymentResult{ResultDesc: reason})
+	return err
+}
+
+// SettlePendingPayment applies a result to a payment found by its ID, such as one we got by
+// asking M-Pesa about a payment whose callback never came. Like RecordPaymentResult, payments
+// that are already settled are left alone and the returned order is nil.
+func (m PaymentModel) SettlePendingPayment(paymentID int32, result PaymentResult) (*Payment, *Order, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultPaymentDBContextTimeout)
+	defer cancel()
+
+	var settledPayment *Payment
+	var order *Order
+	err := withTransaction(ctx, m.Conn, func(qtx *database.Queries) error {
+		// only the order is needed here, settlePaymentTx locks the payment after its order
+		// like every other transaction that takes both
+		payment, err := qtx.GetPaymentByID(ctx, paymentID)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrPaymentNotFound
+			default:
+				return err
+			}
+		}
+		settledPayment, order, err = settlePaymentTx(ctx, qtx, payment.OrderID, payment.ID, result)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return settledPayment, order, nil
+}
+
+// GetStalePendingPayments returns up to limit payments that were still pending when created
+// before olderThan, oldest first. Their callback is late or lost, or the customer never
+// answered the prompt, and they keep their order in PENDING_PAYMENT until they are settled.
+func (m PaymentModel) GetStalePendingPayments(olderThan time.Time, limit int32) ([]*Payment, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultPaymentDBContextTimeout)
+	defer cancel()
+
+	rows, err := m.DB.GetStalePendingPayments(ctx, database.GetStalePendingPaymentsParams{
+		CreatedAt: olderThan,
+		Limit:     limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	payments := []*Payment{}
+	for _, row := range rows {
+		payments = append(payments, populatePayment(row))
+	}
+	return payments, nil
+}
+
+// RecordPaymentResult applies the result of an STK push to its payment and order. A successful
+// payment for the expected amount marks the order PAID, one that can't settle the order is put in
+// REVIEW, and anything else fails the payment and puts the order back to PLACED. Results for payments that are already settled are ignored, so a
+// repeated callback is harmless; in that case the returned order is nil.
+// A successful result for a checkout request we don't know is matched by phone number and
+// amount to a pending payment whose push we never got an answer for. Results that still can't
+// be matched are kept in unmatched_payment_callbacks and ErrPaymentNotFound is returned.
+func (m PaymentModel) RecordPaymentResult(result PaymentResult) (*Payment, *Order, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultPaymentDBContextTimeout)
+	defer cancel()
+
+	payment, err := m.DB.GetPaymentByCheckoutRequestID(ctx, sql.NullString{String: result.CheckoutRequestID, Valid: true})
+	if errors.Is(err, sql.ErrNoRows) && result.Successful && result.PhoneNumber != "" {
+		payment, err = m.DB.GetPendingPaymentWithoutCheckoutRequest(ctx, database.GetPendingPaymentWithoutCheckoutRequestParams{
+			PhoneNumber: result.PhoneNumber,
+			AmountKes:   result.AmountKES.StringFixed(2),
+		})
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			// The customer may have been charged, keep the receipt so the money can be traced
+			err = m.DB.CreateUnmatchedPaymentCallback(ctx, database.CreateUnmatchedPaymentCallbackParams{
+				CheckoutRequestID:  result.CheckoutRequestID,
+				MerchantRequestID:  result.MerchantRequestID,
+				ResultCode:         result.ResultCode,
+				ResultDesc:         result.ResultDesc,
+				AmountKes:          result.AmountKES.StringFixed(2),
+				MpesaReceiptNumber: result.ReceiptNumber,
+				PhoneNumber:        result.PhoneNumber,
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			return nil, nil, ErrPaymentNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+
+	var settledPayment *Payment
+	var order *Order
+	err = withTransaction(ctx, m.Conn, func(qtx *database.Queries) error {
+		settledPayment, order, err = settlePaymentTx(ctx, qtx, payment.OrderID, payment.ID, result)
+		if err != nil {
+			return err
+		}
+		// A payment matched by phone and amount learns its checkout request now, after
+		// settlePaymentTx has locked it, so repeats of this callback find it directly
+		if !payment.CheckoutRequestID.Valid {
+			dbPayment, err := qtx.SetPaymentCheckoutRequest(ctx, database.SetPaymentCheckoutRequestParams{
+				ID:                payment.ID,
+				MerchantRequestID: sql.NullString{String: result.MerchantRequestID, Valid: result.MerchantRequestID != ""},
+				CheckoutRequestID: sql.NullString{String: result.CheckoutRequestID, Valid: true},
+			})
+			if err != nil {
+				return err
+			}
+			settledPayment = populatePayment(dbPayment)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return settledPayment, order, nil
+}
+
+// settlePaymentTx moves a pending payment to SUCCESS or FAILED and its order to PAID or back
+// to PLACED. The order is locked before the payment, the same order StartPayment takes them in.
+// Money that can't settle the order, because the amount is wrong, the order moved on or we had
+// already given up on the payment, puts the payment in REVIEW instead, see reviewPaymentTx.
+func settlePaymentTx(ctx context.Context, qtx *database.Queries, orderID, paymentID int32, result PaymentResult) (*Payment, *Order, error) {
+	dbOrder, err := qtx.GetOrderForUpdate(ctx, orderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	dbPayment, err := qtx.GetPaymentForUpdate(ctx, paymentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if dbPayment.Status != PaymentStatusPending {
+		// The customer can still pay after reconciliation failed the payment
+		if result.Successful && dbPayment.Status == PaymentStatusFailed {
+			result.ResultDesc = "paid after the payment had failed"
+			return reviewPaymentTx(ctx, qtx, dbOrder, dbPayment, result)
+		}
+		return populatePayment(dbPayment), nil, nil
+	}
+
+	if result.Successful {
+		amountKES, _ := decimal.NewFromString(dbPayment.AmountKes)
+		switch {
+		case !result.AmountKES.Equal(amountKES):
+			// Never mark an order paid for the wrong amount
+			result.ResultDesc = fmt.Sprintf("amount mismatch: expected %s, received %s", amountKES.StringFixed(2), result.AmountKES.StringFixed(2))
+			return reviewPaymentTx(ctx, qtx, dbOrder, dbPayment, result)
+		case dbOrder.Status != OrderStatusPendingPayment:
+			result.ResultDesc = fmt.Sprintf("paid while the order was %s", dbOrder.Status)
+			return reviewPaymentTx(ctx, qtx, dbOrder, dbPayment, result)
+		}
+	}
+
+	status, orderStatus := PaymentStatusFailed, OrderStatusPlaced
+	if result.Successful {
+		status, orderStatus = PaymentStatusSuccess, OrderStatusPaid
+	}
+
+	settled, err := qtx.SettlePayment(ctx, database.SettlePaymentParams{
+		ID:                 paymentID,
+		Status:             status,
+		MpesaReceiptNumber: sql.NullString{String: result.ReceiptNumber, Valid: result.ReceiptNumber != ""},
+		ResultCode:         sql.NullInt32{Int32: result.ResultCode, Valid: result.CheckoutRequestID != ""},
+		ResultDesc:         sql.NullString{String: result.ResultDesc, Valid: result.ResultDesc != ""},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The order is only moved if it is still waiting on this payment
+	var order *Order
+	if dbOrder.Status == OrderStatusPendingPayment && isValidStatusTransition(dbOrder.Status, orderStatus) {
+		// and not on a payment in review, which holds the order until it is resolved
+		if orderStatus == OrderStatusPlaced {
+			inReview, err := orderHasPaymentTx(ctx, qtx, orderID, PaymentStatusReview)
+			if err != nil {
+				return nil, nil, err
+			}
+			if inReview {
+				return populatePayment(settled), nil, nil
+			}
+		}
+		updatedOrder, err := qtx.UpdateOrderStatus(ctx, database.UpdateOrderStatusParams{
+			ID:      orderID,
+			Status:  orderStatus,
+			Version: dbOrder.Version,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		// Payment results come from the provider, not a user
+		if err := recordStatusChangeTx(ctx, qtx, orderID, dbOrder.Status, orderStatus, 0, paymentStatusNote(status, result.ResultDesc)); err != nil {
+			return nil, nil, err
+		}
+		order = populateOrder(updatedOrder)
+		// Only a successful payment is worth telling the customer about
+		if orderStatus == OrderStatusPaid {
+			if err := enqueueOrderStatusNotificationTx(ctx, qtx, order); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return populatePayment(settled), order, nil
+}
+
+// reviewPaymentTx puts a payment the customer paid, but that can't settle its order, in REVIEW
+// and asks every admin to look at it. The order must not be paid for again or cancelled in the
+// meantime, so an order that was already released to PLACED goes back to PENDING_PAYMENT; the
+// returned order is nil when it isn't moved.
+func reviewPaymentTx(ctx context.Context, qtx *database.Queries, dbOrder database.Order, dbPayment database.Payment, result PaymentResult) (*Payment, *Order, error) {
+	settled, err := qtx.SettlePayment(ctx, database.SettlePaymentParams{
+		ID:                 dbPayment.ID,
+		Status:             PaymentStatusReview,
+		MpesaReceiptNumber: sql.NullString{String: result.ReceiptNumber, Valid: result.ReceiptNumber != ""},
+		ResultCode:         sql.NullInt32{Int32: result.ResultCode, Valid: true},
+		ResultDesc:         sql.NullString{String: result.ResultDesc, Valid: result.ResultDesc != ""},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var order *Order
+	if dbOrder.Status == OrderStatusPlaced {
+		updatedOrder, err := qtx.UpdateOrderStatus(ctx, database.UpdateOrderStatusParams{
+			ID:      dbOrder.ID,
+			Status:  OrderStatusPendingPayment,
+			Version: dbOrder.Version,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := recordStatusChangeTx(ctx, qtx, dbOrder.ID, dbOrder.Status, OrderStatusPendingPayment, 0, paymentStatusNote(PaymentStatusReview, result.ResultDesc)); err != nil {
+			return nil, nil, err
+		}
+		order = populateOrder(updatedOrder)
+	}
+	if err := enqueuePaymentReviewNotificationsTx(ctx, qtx, dbOrder.ID, dbPayment.ID); err != nil {
+		return nil, nil, err
+	}
+	return populatePayment(settled), order, nil
+}
+
+// orderHasPaymentTx reports whether any of an order's payments has one of the statuses
+func orderHasPaymentTx(ctx context.Context, qtx *database.Queries, orderID int32, statuses ...string) (bool, error) {
+	payments, err := qtx.GetPaymentsByOrderID(ctx, orderID)
+	if err != nil {
+		return false, err
+	}
+	for _, payment := range payments {
+		if slices.Contains(statuses, payment.Status) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ValidatePaymentResolution checks the status an admin resolves a payment in review with
+func ValidatePaymentResolution(v *validator.Validator, status string) {
+	v.Check(validator.PermittedValue(status, PaymentStatusSuccess, PaymentStatusRefunded), "status", "must be SUCCESS or REFUNDED")
+}
+
+// ResolvePaymentReview settles a payment in REVIEW on behalf of the admin changedBy, once the
+// money has been looked at. Accepting it (SUCCESS) marks its order PAID if the order is still
+// waiting. After a refund (REFUNDED) the order goes back to PLACED, unless another payment is
+// still pending or in review. The returned order is nil when the order isn't moved.
+func (m PaymentModel) ResolvePaymentReview(paymentID int32, status string, changedBy int64, note string) (*Payment, *Order, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultPaymentDBContextTimeout)
+	defer cancel()
+
+	var resolved *Payment
+	var order *Order
+	err := withTransaction(ctx, m.Conn, func(qtx *database.Queries) error {
+		// the order is locked before the payment, see settlePaymentTx
+		payment, err := qtx.GetPaymentByID(ctx, paymentID)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrPaymentNotFound
+			default:
+				return err
+			}
+		}
+		dbOrder, err := qtx.GetOrderForUpdate(ctx, payment.OrderID)
+		if err != nil {
+			return err
+		}
+		dbPayment, err := qtx.GetPaymentForUpdate(ctx, paymentID)
+		if err != nil {
+			return err
+		}
+		if dbPayment.Status != PaymentStatusReview {
+			return ErrPaymentNotInReview
+		}
+
+		settled, err := qtx.SettlePayment(ctx, database.SettlePaymentParams{
+			ID:                 paymentID,
+			Status:             status,
+			MpesaReceiptNumber: dbPayment.MpesaReceiptNumber,
+			ResultCode:         dbPayment.ResultCode,
+			ResultDesc:         dbPayment.ResultDesc,
+		})
+		if err != nil {
+			return err
+		}
+		resolved = populatePayment(settled)
+
+		if dbOrder.Status != OrderStatusPendingPayment {
+			return nil
+		}
+		orderStatus := OrderStatusPaid
+		if status == PaymentStatusRefunded {
+			held, err := orderHasPaymentTx(ctx, qtx, dbOrder.ID, PaymentStatusPending, PaymentStatusReview)
+			if err != nil {
+				return err
+			}
+			if held {
+				return nil
+			}
+			orderStatus = OrderStatusPlaced
+		}
+		updatedOrder, err := qtx.UpdateOrderStatus(ctx, database.UpdateOrderStatusParams{
+			ID:      dbOrder.ID,
+			Status:  orderStatus,
+			Version: dbOrder.Version,
+		})
+		if err != nil {
+			return err
+		}
+		if note == "" {
+			note = paymentStatusNote(status, "resolved after review")
+		}
+		if err := recordStatusChangeTx(ctx, qtx, dbOrder.ID, dbOrder.Status, orderStatus, changedBy, note); err != nil {
+			return err
+		}
+		order = populateOrder(updatedOrder)
+		if orderStatus == OrderStatusPaid {
+			return enqueueOrderStatusNotificationTx(ctx, qtx, order)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return resolved, order, nil
+}
+
+// GetPayment returns a single payment by its ID.
+func (m PaymentModel) GetPayment(paymentID int32) (*Payment, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultPaymentDBContextTimeout)
+	defer cancel()
+
+	dbPayment, err := m.DB.GetPaymentByID(ctx, paymentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrPaymentNotFound
+		default:
+			return nil, err
+		}
+	}
+	return populatePayment(dbPayment), nil
+}
+
+// paymentStatusNote describes a settled payment for the order's status history
+func paymentStatusNote(status, resultDesc string) string {
+	note := "M-Pesa payment " + strings.ToLower(status)
+	if resultDesc != "" {
+		note += ": " + resultDesc
+	}
+	return note
+}
+
+// GetPaymentsForOrder returns every payment attempt for an order, newest first.
+func (m PaymentModel) GetPaymentsForOrder(orderID int32) ([]*Payment, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultPaymentDBContextTimeout)
+	defer cancel()
+
+	rows, err := m.DB.GetPaymentsByOrderID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	payments := []*Payment{}
+	for _, row := range rows {
+		payments = append(payments, populatePayment(row))
+	}
+	return payments, nil
+}
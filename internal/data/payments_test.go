@@ -0,0 +1,456 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/database"
+	"github.com/shopspring/decimal"
+)
+
+// newTestPaymentModel() builds a PaymentModel on top of a real test database.
+func newTestPaymentModel(db *sql.DB) PaymentModel {
+	return PaymentModel{DB: database.New(db), Conn: db}
+}
+
+// startTestPayment() places an order for a fresh product and opens a payment for it, returning
+// the order and the payment with a checkout request ID attached.
+func startTestPayment(t *testing.T, db *sql.DB, userID int64, priceKES string) (*Order, *Payment) {
+	t.Helper()
+
+	productID := seedTestProduct(t, db, priceKES, 5)
+	order, err := newTestOrderModel(db).CreateOrder(&CreateOrderRequest{
+		UserID: int32(userID),
+		Items:  []*CreateOrderItemRequest{{ProductID: productID, Quantity: 1}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+
+	payments := newTestPaymentModel(db)
+	payment, err := payments.StartPayment(order.ID, int32(userID), "254712345678")
+	if err != nil {
+		t.Fatalf("Failed to start payment: %v", err)
+	}
+	checkoutRequestID := fmt.Sprintf("ws_CO_%s_%d", t.Name(), time.Now().UnixNano())
+	payment, err = payments.AttachCheckoutRequest(payment.ID, "merchant-1", checkoutRequestID)
+	if err != nil {
+		t.Fatalf("Failed to attach checkout request: %v", err)
+	}
+	return order, payment
+}
+
+func orderStatus(t *testing.T, db *sql.DB, orderID int32) string {
+	t.Helper()
+
+	order, err := newTestOrderModel(db).GetOrderByID(orderID)
+	if err != nil {
+		t.Fatalf("Failed to get order %d: %v", orderID, err)
+	}
+	return order.Status
+}
+
+// paymentReviewNotifications() counts the admin emails queued about a payment in review
+func paymentReviewNotifications(t *testing.T, db *sql.DB, paymentID int32) int {
+	t.Helper()
+
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM notifications_outbox WHERE kind = $1 AND idempotency_key LIKE $2",
+		NotificationPaymentReviewEmail, fmt.Sprintf("payment:%d:review:%%", paymentID)).Scan(&count)
+	if err != nil {
+		t.Fatalf("Failed to count notifications: %v", err)
+	}
+	return count
+}
+
+func TestChargeableAmount(t *testing.T) {
+	tests := []struct {
+		total    string
+		expected string
+	}{
+		{"1500.00", "1500"},
+		{"1500.01", "1501"},
+		{"99.50", "100"},
+		{"0.10", "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.total, func(t *testing.T) {
+			result := chargeableAmount(decimal.RequireFromString(tt.total))
+			if !result.Equal(decimal.RequireFromString(tt.expected)) {
+				t.Errorf("Expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestStartPayment(t *testing.T) {
+	db := openTestDB(t)
+	payments := newTestPaymentModel(db)
+
+	userID := seedTestUser(t, db)
+	otherUserID := seedTestUser(t, db)
+	order, payment := startTestPayment(t, db, userID, "99.50")
+
+	if payment.Status != PaymentStatusPending {
+		t.Errorf("Expected payment status %s, got %s", PaymentStatusPending, payment.Status)
+	}
+	if !payment.AmountKES.Equal(decimal.NewFromInt(100)) {
+		t.Errorf("Expected the amount to be rounded up to 100, got %s", payment.AmountKES)
+	}
+	if status := orderStatus(t, db, order.ID); status != OrderStatusPendingPayment {
+		t.Errorf("Expected order status %s, got %s", OrderStatusPendingPayment, status)
+	}
+
+	// Only one payment may be pending at a time
+	if _, err := payments.StartPayment(order.ID, int32(userID), "254712345678"); !errors.Is(err, ErrPaymentInProgress) {
+		t.Errorf("Expected ErrPaymentInProgress, got %v", err)
+	}
+	// Someone else's order looks like it does not exist
+	if _, err := payments.StartPayment(order.ID, int32(otherUserID), "254712345678"); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("Expected ErrOrderNotFound for another user, got %v", err)
+	}
+	// An order waiting on a payment cannot be cancelled
+	if _, err := newTestOrderModel(db).CancelOrder(order.ID, int32(userID)); !errors.Is(err, ErrOrderCannotBeModified) {
+		t.Errorf("Expected ErrOrderCannotBeModified, got %v", err)
+	}
+}
+
+func TestRecordPaymentResult(t *testing.T) {
+	db := openTestDB(t)
+	payments := newTestPaymentModel(db)
+	userID := seedTestUser(t, db)
+	// someone to notify about payments in review
+	adminID := seedTestUser(t, db)
+	if _, err := db.Exec("INSERT INTO users_permissions (user_id, permission_id) SELECT $1, id FROM permissions WHERE code = 'admin:read'", adminID); err != nil {
+		t.Fatalf("Failed to make user %d an admin: %v", adminID, err)
+	}
+
+	t.Run("successful payment marks the order paid", func(t *testing.T) {
+		order, payment := startTestPayment(t, db, userID, "1500.00")
+
+		settled, updatedOrder, err := payments.RecordPaymentResult(PaymentResult{
+			CheckoutRequestID: payment.CheckoutRequestID,
+			Successful:        true,
+			ResultDesc:        "The service request is processed successfully.",
+			AmountKES:         decimal.NewFromInt(1500),
+			ReceiptNumber:     fmt.Sprintf("R%d", time.Now().UnixNano()),
+		})
+		if err != nil {
+			t.Fatalf("Failed to record payment result: %v", err)
+		}
+		if settled.Status != PaymentStatusSuccess || settled.MpesaReceiptNumber == "" {
+			t.Errorf("Unexpected settled payment: %+v", settled)
+		}
+		if updatedOrder == nil || updatedOrder.Status != OrderStatusPaid {
+			t.Fatalf("Expected order to be %s, got %+v", OrderStatusPaid, updatedOrder)
+		}
+
+		// The callback is recorded as a system change
+		history, err := newTestOrderModel(db).GetOrderStatusHistory(order.ID)
+		if err != nil {
+			t.Fatalf("Failed to get order history: %v", err)
+		}
+		last := history[len(history)-1]
+		if last.FromStatus != OrderStatusPendingPayment || last.ToStatus != OrderStatusPaid || last.ChangedBy != nil {
+			t.Errorf("Unexpected history entry for the callback: %+v", last)
+		}
+
+		// A repeated callback is ignored
+		repeated, repeatedOrder, err := payments.RecordPaymentResult(PaymentResult{
+			CheckoutRequestID: payment.CheckoutRequestID,
+			ResultCode:        1032,
+			ResultDesc:        "Request cancelled by user",
+		})
+		if err != nil {
+			t.Fatalf("Failed to record repeated result: %v", err)
+		}
+		if repeated.Status != PaymentStatusSuccess || repeatedOrder != nil {
+			t.Errorf("Expected repeated callback to be a no-op, got %+v / %+v", repeated, repeatedOrder)
+		}
+		if status := orderStatus(t, db, order.ID); status != OrderStatusPaid {
+			t.Errorf("Expected order to stay %s, got %s", OrderStatusPaid, status)
+		}
+	})
+
+	t.Run("cancelled payment puts the order back", func(t *testing.T) {
+		order, payment := startTestPayment(t, db, userID, "250.00")
+
+		settled, updatedOrder, err := payments.RecordPaymentResult(PaymentResult{
+			CheckoutRequestID: payment.CheckoutRequestID,
+			ResultCode:        1032,
+			ResultDesc:        "Request cancelled by user",
+		})
+		if err != nil {
+			t.Fatalf("Failed to record payment result: %v", err)
+		}
+		if settled.Status != PaymentStatusFailed || settled.ResultCode == nil || *settled.ResultCode != 1032 {
+			t.Errorf("Unexpected settled payment: %+v", settled)
+		}
+		if updatedOrder == nil || updatedOrder.Status != OrderStatusPlaced {
+			t.Fatalf("Expected order to be %s, got %+v", OrderStatusPlaced, updatedOrder)
+		}
+
+		// The order can be paid for again
+		if _, err := payments.StartPayment(order.ID, int32(userID), "254712345678"); err != nil {
+			t.Errorf("Expected a new payment to be allowed, got %v", err)
+		}
+	})
+
+	t.Run("wrong amount is held for review", func(t *testing.T) {
+		order, payment := startTestPayment(t, db, userID, "500.00")
+
+		settled, _, err := payments.RecordPaymentResult(PaymentResult{
+			CheckoutRequestID: payment.CheckoutRequestID,
+			Successful:        true,
+			AmountKES:         decimal.NewFromInt(1),
+			ReceiptNumber:     fmt.Sprintf("R%d", time.Now().UnixNano()),
+		})
+		if err != nil {
+			t.Fatalf("Failed to record payment result: %v", err)
+		}
+		if settled.Status != PaymentStatusReview {
+			t.Errorf("Expected payment status %s, got %s", PaymentStatusReview, settled.Status)
+		}
+		// the customer can't be charged again while the money is looked at
+		if status := orderStatus(t, db, order.ID); status != OrderStatusPendingPayment {
+			t.Errorf("Expected order status %s, got %s", OrderStatusPendingPayment, status)
+		}
+		if _, err := payments.StartPayment(order.ID, int32(userID), "254712345678"); !errors.Is(err, ErrPaymentInProgress) {
+			t.Errorf("Expected ErrPaymentInProgress, got %v", err)
+		}
+		if count := paymentReviewNotifications(t, db, payment.ID); count == 0 {
+			t.Error("Expected the admins to be notified")
+		}
+	})
+
+	t.Run("payment after it failed is held for review", func(t *testing.T) {
+		order, payment := startTestPayment(t, db, userID, "300.00")
+		if err := payments.FailPayment(payment.ID, "no result from M-Pesa"); err != nil {
+			t.Fatalf("Failed to fail payment: %v", err)
+		}
+
+		settled, updatedOrder, err := payments.RecordPaymentResult(PaymentResult{
+			CheckoutRequestID: payment.CheckoutRequestID,
+			Successful:        true,
+			AmountKES:         decimal.NewFromInt(300),
+			ReceiptNumber:     fmt.Sprintf("R%d", time.Now().UnixNano()),
+		})
+		if err != nil {
+			t.Fatalf("Failed to record payment result: %v", err)
+		}
+		if settled.Status != PaymentStatusReview || settled.MpesaReceiptNumber == "" {
+			t.Errorf("Expected payment in %s with its receipt, got %+v", PaymentStatusReview, settled)
+		}
+		// the released order is held again
+		if updatedOrder == nil || updatedOrder.Status != OrderStatusPendingPayment {
+			t.Errorf("Expected order to be %s, got %+v", OrderStatusPendingPayment, updatedOrder)
+		}
+		if _, err := newTestOrderModel(db).CancelOrder(order.ID, int32(userID)); !errors.Is(err, ErrOrderCannotBeModified) {
+			t.Errorf("Expected ErrOrderCannotBeModified, got %v", err)
+		}
+	})
+
+	t.Run("unconfirmed push is matched by phone and amount", func(t *testing.T) {
+		// an amount no other pending payment has, the match is on phone number and amount
+		amountKES := decimal.NewFromInt(1000 + time.Now().UnixNano()%100000)
+		productID := seedTestProduct(t, db, amountKES.StringFixed(2), 5)
+		order, err := newTestOrderModel(db).CreateOrder(&CreateOrderRequest{
+			UserID: int32(userID),
+			Items:  []*CreateOrderItemRequest{{ProductID: productID, Quantity: 1}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create order: %v", err)
+		}
+		payment, err := payments.StartPayment(order.ID, int32(userID), "254712345678")
+		if err != nil {
+			t.Fatalf("Failed to start payment: %v", err)
+		}
+
+		checkoutRequestID := fmt.Sprintf("ws_CO_%s_%d", t.Name(), time.Now().UnixNano())
+		settled, updatedOrder, err := payments.RecordPaymentResult(PaymentResult{
+			CheckoutRequestID: checkoutRequestID,
+			Successful:        true,
+			AmountKES:         amountKES,
+			ReceiptNumber:     fmt.Sprintf("R%d", time.Now().UnixNano()),
+			PhoneNumber:       "254712345678",
+		})
+		if err != nil {
+			t.Fatalf("Failed to record payment result: %v", err)
+		}
+		if settled.ID != payment.ID || settled.Status != PaymentStatusSuccess || settled.CheckoutRequestID != checkoutRequestID {
+			t.Errorf("Expected payment %d to be paid under %s, got %+v", payment.ID, checkoutRequestID, settled)
+		}
+		if updatedOrder == nil || updatedOrder.Status != OrderStatusPaid {
+			t.Errorf("Expected order to be %s, got %+v", OrderStatusPaid, updatedOrder)
+		}
+	})
+
+	t.Run("unknown checkout request is kept", func(t *testing.T) {
+		checkoutRequestID := fmt.Sprintf("ws_CO_%s_%d", t.Name(), time.Now().UnixNano())
+		receipt := fmt.Sprintf("R%d", time.Now().UnixNano())
+		_, _, err := payments.RecordPaymentResult(PaymentResult{
+			CheckoutRequestID: checkoutRequestID,
+			Successful:        true,
+			AmountKES:         decimal.NewFromInt(7),
+			ReceiptNumber:     receipt,
+			PhoneNumber:       "254700000001",
+		})
+		if !errors.Is(err, ErrPaymentNotFound) {
+			t.Fatalf("Expected ErrPaymentNotFound, got %v", err)
+		}
+
+		var storedReceipt string
+		err = db.QueryRow("SELECT mpesa_receipt_number FROM unmatched_payment_callbacks WHERE checkout_request_id = $1", checkoutRequestID).Scan(&storedReceipt)
+		if err != nil {
+			t.Fatalf("Expected the callback to be stored: %v", err)
+		}
+		if storedReceipt != receipt {
+			t.Errorf("Expected receipt %s to be stored, got %s", receipt, storedReceipt)
+		}
+	})
+}
+
+func TestResolvePaymentReview(t *testing.T) {
+	db := openTestDB(t)
+	payments := newTestPaymentModel(db)
+	userID := seedTestUser(t, db)
+	adminID := seedTestUser(t, db)
+
+	reviewedPayment := func(t *testing.T) (*Order, *Payment) {
+		t.Helper()
+		order, payment := startTestPayment(t, db, userID, "200.00")
+		payment, _, err := payments.RecordPaymentResult(PaymentResult{
+			CheckoutRequestID: payment.CheckoutRequestID,
+			Successful:        true,
+			AmountKES:         decimal.NewFromInt(150),
+			ReceiptNumber:     fmt.Sprintf("R%d", time.Now().UnixNano()),
+		})
+		if err != nil {
+			t.Fatalf("Failed to record payment result: %v", err)
+		}
+		return order, payment
+	}
+
+	t.Run("refund releases the order", func(t *testing.T) {
+		order, payment := reviewedPayment(t)
+
+		resolved, updatedOrder, err := payments.ResolvePaymentReview(payment.ID, PaymentStatusRefunded, adminID, "refunded on the M-Pesa portal")
+		if err != nil {
+			t.Fatalf("Failed to resolve payment: %v", err)
+		}
+		if resolved.Status != PaymentStatusRefunded || resolved.MpesaReceiptNumber != payment.MpesaReceiptNumber {
+			t.Errorf("Expected a refunded payment keeping its receipt, got %+v", resolved)
+		}
+		if updatedOrder == nil || updatedOrder.Status != OrderStatusPlaced {
+			t.Errorf("Expected order to be %s, got %+v", OrderStatusPlaced, updatedOrder)
+		}
+		if _, err := payments.StartPayment(order.ID, int32(userID), "254712345678"); err != nil {
+			t.Errorf("Expected a new payment to be allowed, got %v", err)
+		}
+	})
+
+	t.Run("accepting marks the order paid", func(t *testing.T) {
+		_, payment := reviewedPayment(t)
+
+		_, updatedOrder, err := payments.ResolvePaymentReview(payment.ID, PaymentStatusSuccess, adminID, "")
+		if err != nil {
+			t.Fatalf("Failed to resolve payment: %v", err)
+		}
+		if updatedOrder == nil || updatedOrder.Status != OrderStatusPaid {
+			t.Errorf("Expected order to be %s, got %+v", OrderStatusPaid, updatedOrder)
+		}
+
+		// it can only be resolved once
+		if _, _, err := payments.ResolvePaymentReview(payment.ID, PaymentStatusRefunded, adminID, ""); !errors.Is(err, ErrPaymentNotInReview) {
+			t.Errorf("Expected ErrPaymentNotInReview, got %v", err)
+		}
+	})
+}
+
+func TestFailPayment(t *testing.T) {
+	db := openTestDB(t)
+	payments := newTestPaymentModel(db)
+	userID := seedTestUser(t, db)
+
+	order, payment := startTestPayment(t, db, userID, "120.00")
+	if err := payments.FailPayment(payment.ID, "STK push could not be sent"); err != nil {
+		t.Fatalf("Failed to fail payment: %v", err)
+	}
+	if status := orderStatus(t, db, order.ID); status != OrderStatusPlaced {
+		t.Errorf("Expected order status %s, got %s", OrderStatusPlaced, status)
+	}
+
+	history, err := payments.GetPaymentsForOrder(order.ID)
+	if err != nil {
+		t.Fatalf("Failed to get payments: %v", err)
+	}
+	if len(history) != 1 || history[0].Status != PaymentStatusFailed {
+		t.Errorf("Expected a single failed payment, got %+v", history)
+	}
+
+	if err := payments.FailPayment(-1, "STK push could not be sent"); !errors.Is(err, ErrPaymentNotFound) {
+		t.Errorf("Expected ErrPaymentNotFound, got %v", err)
+	}
+}
+
+func TestReconcileStalePendingPayments(t *testing.T) {
+	db := openTestDB(t)
+	payments := newTestPaymentModel(db)
+	userID := seedTestUser(t, db)
+
+	order, payment := startTestPayment(t, db, userID, "250.00")
+	isStale := func(olderThan time.Time) bool {
+		t.Helper()
+		stale, err := payments.GetStalePendingPayments(olderThan, 1000)
+		if err != nil {
+			t.Fatalf("Failed to get stale payments: %v", err)
+		}
+		for _, p := range stale {
+			if p.ID == payment.ID {
+				return true
+			}
+		}
+		return false
+	}
+
+	// the payment only goes stale once it has waited longer than the timeout
+	if isStale(time.Now().Add(-time.Hour)) {
+		t.Error("Expected a new payment not to be stale")
+	}
+	if !isStale(time.Now().Add(time.Minute)) {
+		t.Fatal("Expected the payment to be stale")
+	}
+
+	// a successful query result pays the order like the callback would
+	settled, paidOrder, err := payments.SettlePendingPayment(payment.ID, PaymentResult{
+		CheckoutRequestID: payment.CheckoutRequestID,
+		Successful:        true,
+		ResultDesc:        "The service request is processed successfully.",
+		AmountKES:         payment.AmountKES,
+	})
+	if err != nil {
+		t.Fatalf("Failed to settle payment: %v", err)
+	}
+	if settled.Status != PaymentStatusSuccess || paidOrder == nil || paidOrder.Status != OrderStatusPaid {
+		t.Errorf("Expected a successful payment and a paid order, got %+v and %+v", settled, paidOrder)
+	}
+	if isStale(time.Now().Add(time.Minute)) {
+		t.Error("Expected a settled payment not to be stale")
+	}
+
+	// settling it again, say after the callback finally arrives, changes nothing
+	settled, paidOrder, err = payments.SettlePendingPayment(payment.ID, PaymentResult{ResultDesc: "late"})
+	if err != nil {
+		t.Fatalf("Failed to settle payment again: %v", err)
+	}
+	if settled.Status != PaymentStatusSuccess || paidOrder != nil {
+		t.Errorf("Expected the settled payment to be left alone, got %+v and %+v", settled, paidOrder)
+	}
+	if status := orderStatus(t, db, order.ID); status != OrderStatusPaid {
+		t.Errorf("Expected order status %s, got %s", OrderStatusPaid, status)
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"database/sql"
 	"errors"
 	"regexp"
+	"strings"
 	"time"
 
+	"github.com/Blue-Davinci/SavannaCart/internal/cache"
 	"github.com/Blue-Davinci/SavannaCart/internal/database"
 	"github.com/Blue-Davinci/SavannaCart/internal/validator"
 )
@@ -15,6 +17,13 @@ var (
 	ErrDuplicatePermission = errors.New("duplicate permission")
 	ErrPermissionNotFound  = errors.New("permission not found")
 )
+
+// Permission audit actions
+const (
+	PermissionActionGrant  = "GRANT"
+	PermissionActionRevoke = "REVOKE"
+)
+
 var (
 	PermissionAdminWrite = "admin:write"
 	PermissionAdminRead  = "admin:read"
@@ -22,7 +31,15 @@ var (
 
 // Define the PermissionModel type.
 type PermissionModel struct {
-	DB *database.Queries
+	DB    *database.Queries
+	Conn  *sql.DB                          // used to write permission changes and their audit entries together
+	Cache *cache.Cache[int64, Permissions] // each user's permissions, dropped whenever they change
+}
+
+// Permission is a permission code known to the system
+type Permission struct {
+	ID   int64  `json:"id"`
+	Code string `json:"code"`
 }
 
 type UserPermission struct {
@@ -32,15 +49,32 @@ type UserPermission struct {
 }
 
 type SuperUsersWithPermissions struct {
-	UserID        int64  `json:"user_id"`
-	UserFirstName string `json:"user_first_name"`
-	UserLastName  string `json:"user_last_name"`
-	UserEmail     string `json:"user_email"`
+	UserID        int64    `json:"user_id"`
+	UserFirstName string   `json:"user_first_name"`
+	UserLastName  string   `json:"user_last_name"`
+	UserEmail     string   `json:"user_email"`
+	Permissions   []string `json:"permissions"`
+}
+
+// PermissionAuditEntry records a single permission being granted to or revoked from a user
+type PermissionAuditEntry struct {
+	ID             int64     `json:"id"`
+	ActorID        *int64    `json:"actor_id,omitempty"` // nil once the acting admin's account is deleted
+	UserID         *int64    `json:"user_id,omitempty"`
+	Action         string    `json:"action"`
+	PermissionCode string    `json:"permission_code"`
+	CreatedAt      time.Time `json:"created_at"`
 }
 
 func ValidatePermissionsAddition(v *validator.Validator, permissions *UserPermission) {
 	v.Check(len(permissions.Permissions) != 0, "permissions", "must be provided")
-	//v.Check()
+	v.Check(validator.Unique(permissions.Permissions), "permissions", "must not contain duplicate values")
+	for _, code := range permissions.Permissions {
+		if !IsValidPermissionFormat(code) {
+			v.AddError("permissions", "must be in the format 'permission:code'")
+			break
+		}
+	}
 	v.Check(permissions.UserID > 0, "user_id", "must be provided")
 }
 func ValidatePermissionsDeletion(v *validator.Validator, userID int64, permissionCode string) {
@@ -80,8 +114,42 @@ func (p Permissions) Include(code string) bool {
 	return false
 }
 
+// IncludeAny() checks whether the Permissions slice contains at least one of the given
+// permission codes.
+func (p Permissions) IncludeAny(codes ...string) bool {
+	for _, code := range codes {
+		if p.Include(code) {
+			return true
+		}
+	}
+	return false
+}
+
+// IncludeAll() checks whether the Permissions slice contains every one of the given
+// permission codes.
+func (p Permissions) IncludeAll(codes ...string) bool {
+	for _, code := range codes {
+		if !p.Include(code) {
+			return false
+		}
+	}
+	return len(codes) > 0
+}
+
+// Restrict() returns the permission codes that are also in allowed. API keys use it to limit
+// their owner's permissions to the ones the key was given.
+func (p Permissions) Restrict(allowed Permissions) Permissions {
+	restricted := Permissions{}
+	for _, code := range p {
+		if allowed.Include(code) {
+			restricted = append(restricted, code)
+		}
+	}
+	return restricted
+}
+
 // GetAllSuperUsersWithPermissions() is a method that retrieves all super users with their permissions
-// from the database. It returns a slice of UserPermission pointers and an error if any occurs.
+// from the database. Each user appears once, with all of their permission codes.
 func (m PermissionModel) GetAllSuperUsersWithPermissions() ([]*SuperUsersWithPermissions, error) {
 	// set up context
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -93,19 +161,28 @@ func (m PermissionModel) GetAllSuperUsersWithPermissions() ([]*SuperUsersWithPer
 	if err != nil {
 		return nil, err
 	}
+	// the query returns a row per user and permission, group them by user
+	superUsers := make(map[int64]*SuperUsersWithPermissions)
 	for _, user := range dbSuperUsers {
-		superUsersWithPermissions = append(superUsersWithPermissions, &SuperUsersWithPermissions{
-			UserID:        user.UserID,
-			UserFirstName: user.FirstName,
-			UserLastName:  user.LastName,
-			UserEmail:     user.Email,
-		})
+		superUser, exists := superUsers[user.UserID]
+		if !exists {
+			superUser = &SuperUsersWithPermissions{
+				UserID:        user.UserID,
+				UserFirstName: user.FirstName,
+				UserLastName:  user.LastName,
+				UserEmail:     user.Email,
+				Permissions:   []string{},
+			}
+			superUsers[user.UserID] = superUser
+			superUsersWithPermissions = append(superUsersWithPermissions, superUser)
+		}
+		superUser.Permissions = append(superUser.Permissions, user.PermissionCode)
 	}
 	return superUsersWithPermissions, nil
 }
 
 // GetAllPermissions() just returns all available permissions currently in the system.
-func (m PermissionModel) GetAllPermissions() ([]*UserPermission, error) {
+func (m PermissionModel) GetAllPermissions() ([]*Permission, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -113,11 +190,11 @@ func (m PermissionModel) GetAllPermissions() ([]*UserPermission, error) {
 	if err != nil {
 		return nil, err
 	}
-	var allPermissions []*UserPermission
+	allPermissions := []*Permission{}
 	for _, permission := range permissions {
-		allPermissions = append(allPermissions, &UserPermission{
-			PermissionID: permission.ID,
-			Permissions:  []string{permission.Code},
+		allPermissions = append(allPermissions, &Permission{
+			ID:   permission.ID,
+			Code: permission.Code,
 		})
 	}
 
@@ -126,7 +203,11 @@ func (m PermissionModel) GetAllPermissions() ([]*UserPermission, error) {
 
 // GetAllPermissionsForUser() is a method that retrieves all permissions for a specific user
 // from the database. It expects the user's ID as input and returns a slice of permission codes.
+// Results are cached per user until their permissions change or the cache entry expires.
 func (m PermissionModel) GetAllPermissionsForUser(userID int64) (Permissions, error) {
+	if permissions, ok := m.Cache.Get(userID); ok {
+		return permissions, nil
+	}
 	// set up context
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -140,59 +221,134 @@ func (m PermissionModel) GetAllPermissionsForUser(userID int64) (Permissions, er
 	for _, permission := range dbPermissions {
 		permissions = append(permissions, permission)
 	}
+	m.Cache.Set(userID, permissions)
 	// return permissions
 	return permissions, nil
 }
 
-// AddPermissionsForUser() is an admin method that adds permissions for a specific user
-// in the database. It expects the user's ID and a slice of permission codes as input.
-func (m PermissionModel) AddPermissionsForUser(userID int64, codes ...string) (*UserPermission, error) {
+// AddPermissionsForUser() is an admin method that grants permissions to a specific user
+// in the database. It expects the ID of the admin making the change, the user's ID and the
+// permission codes as input. Every granted code is written to the audit log in the same
+// transaction. Codes that do not exist return ErrPermissionNotFound.
+func (m PermissionModel) AddPermissionsForUser(actorID, userID int64, codes ...string) (*UserPermission, error) {
 	// setup our context timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	// insert our permissions
-	queryResult, err := m.DB.AddPermissionsForUser(ctx, database.AddPermissionsForUserParams{
-		UserID:  userID,
-		Column2: codes,
+
+	var userPermission *UserPermission
+	err := withTransaction(ctx, m.Conn, func(qtx *database.Queries) error {
+		// insert our permissions
+		queryResult, err := qtx.AddPermissionsForUser(ctx, database.AddPermissionsForUserParams{
+			UserID:  userID,
+			Column2: codes,
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrPermissionNotFound
+			case strings.Contains(err.Error(), "users_permissions_pkey"):
+				return ErrDuplicatePermission
+			default:
+				return err
+			}
+		}
+		for _, code := range codes {
+			if err := recordPermissionChangeTx(ctx, qtx, actorID, userID, PermissionActionGrant, code); err != nil {
+				return err
+			}
+		}
+		// create our permissions
+		userPermission = &UserPermission{
+			PermissionID: queryResult.PermissionID,
+			UserID:       queryResult.UserID,
+			Permissions:  codes,
+		}
+		return nil
 	})
 	if err != nil {
-		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_permissions_pkey"`:
-			return nil, ErrDuplicatePermission
-		default:
-			return nil, err
-		}
-	}
-	// create our permissions
-	userPermission := &UserPermission{
-		PermissionID: queryResult.PermissionID,
-		UserID:       queryResult.UserID,
-		Permissions:  codes,
+		return nil, err
 	}
+	m.Cache.Delete(userID)
 	// return the permissions
 	return userPermission, nil
 }
 
-// DeletePermissionsForUser() is an admin method that deletes permissions for a specific user
-// in the database. It expects the user's ID and a permission code as input.
-func (m PermissionModel) DeletePermissionsForUser(userID int64, permissionCode string) (int64, error) {
+// DeletePermissionsForUser() is an admin method that revokes a permission from a specific user
+// in the database. It expects the ID of the admin making the change, the user's ID and a
+// permission code as input. The revocation is written to the audit log in the same transaction.
+func (m PermissionModel) DeletePermissionsForUser(actorID, userID int64, permissionCode string) (int64, error) {
 	// Setup our context timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	// Execute the deletion query
-	permissionID, err := m.DB.DeletePermissionsForUser(ctx, database.DeletePermissionsForUserParams{
-		UserID: userID,
-		Code:   permissionCode,
+	var permissionID int64
+	err := withTransaction(ctx, m.Conn, func(qtx *database.Queries) error {
+		// Execute the deletion query
+		var err error
+		permissionID, err = qtx.DeletePermissionsForUser(ctx, database.DeletePermissionsForUserParams{
+			UserID: userID,
+			Code:   permissionCode,
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrPermissionNotFound
+			default:
+				return err
+			}
+		}
+		return recordPermissionChangeTx(ctx, qtx, actorID, userID, PermissionActionRevoke, permissionCode)
 	})
 	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return 0, ErrPermissionNotFound
-		default:
-			return 0, err
-		}
+		return 0, err
 	}
+	m.Cache.Delete(userID)
 
 	return permissionID, nil
 }
+
+// recordPermissionChangeTx writes a single entry to the permission audit log
+func recordPermissionChangeTx(ctx context.Context, qtx *database.Queries, actorID, userID int64, action, code string) error {
+	return qtx.CreatePermissionAuditLog(ctx, database.CreatePermissionAuditLogParams{
+		ActorID:        sql.NullInt64{Int64: actorID, Valid: actorID != 0},
+		UserID:         sql.NullInt64{Int64: userID, Valid: true},
+		Action:         action,
+		PermissionCode: code,
+	})
+}
+
+// GetPermissionAuditLog() returns the permission audit log, newest first. A userID of 0
+// returns the changes for every user, otherwise only those made to that user.
+func (m PermissionModel) GetPermissionAuditLog(userID int64, filters Filters) ([]*PermissionAuditEntry, Metadata, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.GetPermissionAuditLog(ctx, database.GetPermissionAuditLogParams{
+		Column1: userID,
+		Limit:   int32(filters.limit()),
+		Offset:  int32(filters.offset()),
+	})
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	entries := []*PermissionAuditEntry{}
+	totalEntries := 0
+	for _, row := range rows {
+		totalEntries = int(row.TotalCount)
+		entry := &PermissionAuditEntry{
+			ID:             row.ID,
+			Action:         row.Action,
+			PermissionCode: row.PermissionCode,
+			CreatedAt:      row.CreatedAt,
+		}
+		if row.ActorID.Valid {
+			entry.ActorID = &row.ActorID.Int64
+		}
+		if row.UserID.Valid {
+			entry.UserID = &row.UserID.Int64
+		}
+		entries = append(entries, entry)
+	}
+	metadata := calculateMetadata(totalEntries, filters.Page, filters.PageSize)
+	return entries, metadata, nil
+}
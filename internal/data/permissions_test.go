@@ -1,8 +1,12 @@
 package data
 
 import (
+	"errors"
+	"reflect"
 	"testing"
+	"time"
 
+	"github.com/Blue-Davinci/SavannaCart/internal/database"
 	"github.com/Blue-Davinci/SavannaCart/internal/validator"
 )
 
@@ -194,6 +198,32 @@ func TestPermissionsInclude(t *testing.T) {
 	}
 }
 
+func TestPermissionsIncludeAnyAndAll(t *testing.T) {
+	permissions := Permissions{"admin:read", "orders:read"}
+	tests := []struct {
+		name        string
+		codes       []string
+		expectedAny bool
+		expectedAll bool
+	}{
+		{"every code held", []string{"admin:read", "orders:read"}, true, true},
+		{"one code held", []string{"admin:read", "admin:write"}, true, false},
+		{"no code held", []string{"admin:write"}, false, false},
+		{"no codes", nil, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := permissions.IncludeAny(tt.codes...); result != tt.expectedAny {
+				t.Errorf("Permissions.IncludeAny(%q) = %v, want %v", tt.codes, result, tt.expectedAny)
+			}
+			if result := permissions.IncludeAll(tt.codes...); result != tt.expectedAll {
+				t.Errorf("Permissions.IncludeAll(%q) = %v, want %v", tt.codes, result, tt.expectedAll)
+			}
+		})
+	}
+}
+
 func TestValidatePermission(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -311,6 +341,22 @@ func TestValidatePermissionsAddition(t *testing.T) {
 			},
 			expectedErrors: []string{"permissions", "user_id"},
 		},
+		{
+			name: "badly formatted permission",
+			permissions: &UserPermission{
+				UserID:      1,
+				Permissions: []string{"admin:read", "admin"},
+			},
+			expectedErrors: []string{"permissions"},
+		},
+		{
+			name: "duplicate permissions",
+			permissions: &UserPermission{
+				UserID:      1,
+				Permissions: []string{"admin:read", "admin:read"},
+			},
+			expectedErrors: []string{"permissions"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -391,3 +437,138 @@ func TestValidatePermissionsDeletion(t *testing.T) {
 		})
 	}
 }
+
+func TestPermissionGrantAndRevokeAreAudited(t *testing.T) {
+	db := openTestDB(t)
+	permissions := PermissionModel{DB: database.New(db), Conn: db}
+
+	adminID := seedTestUser(t, db)
+	userID := seedTestUser(t, db)
+
+	granted, err := permissions.AddPermissionsForUser(adminID, userID, PermissionAdminRead, PermissionAdminWrite)
+	if err != nil {
+		t.Fatalf("Failed to grant permissions: %v", err)
+	}
+	if granted.UserID != userID {
+		t.Errorf("Expected user %d, got %d", userID, granted.UserID)
+	}
+	// Granting a permission the user already holds fails without writing anything
+	if _, err := permissions.AddPermissionsForUser(adminID, userID, PermissionAdminRead); !errors.Is(err, ErrDuplicatePermission) {
+		t.Errorf("Expected ErrDuplicatePermission, got %v", err)
+	}
+	if _, err := permissions.AddPermissionsForUser(adminID, userID, "reports:read"); !errors.Is(err, ErrPermissionNotFound) {
+		t.Errorf("Expected ErrPermissionNotFound, got %v", err)
+	}
+
+	// The user is listed once with both permissions
+	superUsers, err := permissions.GetAllSuperUsersWithPermissions()
+	if err != nil {
+		t.Fatalf("Failed to list super users: %v", err)
+	}
+	found := 0
+	for _, superUser := range superUsers {
+		if superUser.UserID == userID {
+			found++
+			if len(superUser.Permissions) != 2 {
+				t.Errorf("Expected 2 permissions, got %v", superUser.Permissions)
+			}
+		}
+	}
+	if found != 1 {
+		t.Errorf("Expected the user to be listed once, got %d", found)
+	}
+
+	if _, err := permissions.DeletePermissionsForUser(adminID, userID, PermissionAdminWrite); err != nil {
+		t.Fatalf("Failed to revoke permission: %v", err)
+	}
+	if _, err := permissions.DeletePermissionsForUser(adminID, userID, PermissionAdminWrite); !errors.Is(err, ErrPermissionNotFound) {
+		t.Errorf("Expected ErrPermissionNotFound, got %v", err)
+	}
+	userPermissions, err := permissions.GetAllPermissionsForUser(userID)
+	if err != nil {
+		t.Fatalf("Failed to get user permissions: %v", err)
+	}
+	if !userPermissions.Include(PermissionAdminRead) || userPermissions.Include(PermissionAdminWrite) {
+		t.Errorf("Unexpected permissions after revoke: %v", userPermissions)
+	}
+
+	entries, metadata, err := permissions.GetPermissionAuditLog(userID, Filters{Page: 1, PageSize: 20})
+	if err != nil {
+		t.Fatalf("Failed to get audit log: %v", err)
+	}
+	if metadata.TotalRecords != 3 || len(entries) != 3 {
+		t.Fatalf("Expected 3 audit entries, got %d: %+v", metadata.TotalRecords, entries)
+	}
+	// newest first
+	if entries[0].Action != PermissionActionRevoke || entries[0].PermissionCode != PermissionAdminWrite {
+		t.Errorf("Unexpected latest audit entry: %+v", entries[0])
+	}
+	for _, entry := range entries {
+		if entry.ActorID == nil || *entry.ActorID != adminID {
+			t.Errorf("Expected actor %d, got %v", adminID, entry.ActorID)
+		}
+	}
+}
+
+func TestPermissionCacheIsInvalidatedOnChange(t *testing.T) {
+	db := openTestDB(t)
+	permissions := NewModels(db, time.Minute).Permissions
+
+	adminID := seedTestUser(t, db)
+	userID := seedTestUser(t, db)
+
+	// Load and cache the user's (empty) permissions
+	if _, err := permissions.GetAllPermissionsForUser(userID); err != nil {
+		t.Fatalf("Failed to get user permissions: %v", err)
+	}
+	if _, err := permissions.GetAllPermissionsForUser(userID); err != nil {
+		t.Fatalf("Failed to get user permissions: %v", err)
+	}
+	if permissions.Cache.Hits() != 1 {
+		t.Errorf("Expected the second lookup to be cached, got %d hits", permissions.Cache.Hits())
+	}
+
+	if _, err := permissions.AddPermissionsForUser(adminID, userID, PermissionAdminRead); err != nil {
+		t.Fatalf("Failed to grant permission: %v", err)
+	}
+	userPermissions, err := permissions.GetAllPermissionsForUser(userID)
+	if err != nil {
+		t.Fatalf("Failed to get user permissions: %v", err)
+	}
+	if !userPermissions.Include(PermissionAdminRead) {
+		t.Errorf("Expected the grant to be visible straight away, got %v", userPermissions)
+	}
+
+	if _, err := permissions.DeletePermissionsForUser(adminID, userID, PermissionAdminRead); err != nil {
+		t.Fatalf("Failed to revoke permission: %v", err)
+	}
+	userPermissions, err = permissions.GetAllPermissionsForUser(userID)
+	if err != nil {
+		t.Fatalf("Failed to get user permissions: %v", err)
+	}
+	if userPermissions.Include(PermissionAdminRead) {
+		t.Errorf("Expected the revoke to be visible straight away, got %v", userPermissions)
+	}
+}
+
+func TestPermissionsRestrict(t *testing.T) {
+	permissions := Permissions{"admin:read", "admin:write"}
+	tests := []struct {
+		name     string
+		allowed  Permissions
+		expected Permissions
+	}{
+		{"allowed subset", Permissions{"admin:read"}, Permissions{"admin:read"}},
+		{"allowed codes not held", Permissions{"admin:read", "orders:read"}, Permissions{"admin:read"}},
+		{"nothing allowed", nil, Permissions{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := permissions.Restrict(tt.allowed)
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("Permissions.Restrict(%q) = %q, want %q", tt.allowed, result, tt.expected)
+			}
+		})
+	}
+}
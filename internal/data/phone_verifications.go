@@ -0,0 +1,149 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"time"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/cache"
+	"github.com/Blue-Davinci/SavannaCart/internal/database"
+	"github.com/Blue-Davinci/SavannaCart/internal/validator"
+)
+
+// MaxPhoneVerificationAttempts is how many wrong codes can be entered before the code stops
+// working and a new one has to be requested
+const MaxPhoneVerificationAttempts = 5
+
+// phoneVerificationCodeRX matches the codes we send, six digits
+var phoneVerificationCodeRX = regexp.MustCompile(`^[0-9]{6}$`)
+
+var (
+	ErrPhoneVerificationNotFound        = errors.New("no phone verification code has been requested or it has expired")
+	ErrInvalidPhoneVerificationCode     = errors.New("invalid phone verification code")
+	ErrTooManyPhoneVerificationAttempts = errors.New("too many phone verification attempts")
+)
+
+// PhoneVerificationModel verifies users' phone numbers with a one time code sent to them by
+// SMS. The code is kept as a token in the phone_verification scope, hashed together with the
+// user and the number it was sent to.
+type PhoneVerificationModel struct {
+	DB         *database.Queries
+	Conn       *sql.DB                           // attempts are counted and codes used up in a transaction
+	TokenCache *cache.Cache[tokenCacheKey, User] // shared with UserModel, cleared once a number is verified
+}
+
+// ValidatePhoneVerificationCode() checks a code looks like one we sent
+func ValidatePhoneVerificationCode(v *validator.Validator, code string) {
+	v.Check(code != "", "code", "must be provided")
+	v.Check(validator.Matches(code, phoneVerificationCodeRX), "code", "must be 6 digits")
+}
+
+// phoneVerificationHash() hashes a code together with the user and number it was sent to,
+// so a code only verifies that number. Codes are short, the user ID keeps their hashes
+// from clashing in the tokens table.
+func phoneVerificationHash(userID int64, phoneNumber, code string) []byte {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%d:%s:%s", userID, phoneNumber, code)))
+	return hash[:]
+}
+
+// New() creates a 6 digit code for the user's phone number, replacing any code they were
+// sent before, and returns it so it can be texted to them.
+func (m PhoneVerificationModel) New(userID int64, phoneNumber string) (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	ctx, cancel := contextGenerator(context.Background(), DefaultTokenDBContextTimeout)
+	defer cancel()
+	err = withTransaction(ctx, m.Conn, func(qtx *database.Queries) error {
+		err := qtx.DeletAllTokensForUser(ctx, database.DeletAllTokensForUserParams{
+			UserID: userID,
+			Scope:  ScopePhoneVerification,
+		})
+		if err != nil {
+			return err
+		}
+		return insertTokenTx(ctx, qtx, &Token{
+			Hash:   phoneVerificationHash(userID, phoneNumber, code),
+			UserID: userID,
+			Expiry: time.Now().Add(DefaultPhoneVerificationExpiryTime),
+			Scope:  ScopePhoneVerification,
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// Verify() checks the code the user entered and marks their phone number as verified. Every
+// try counts towards MaxPhoneVerificationAttempts, after which ErrTooManyPhoneVerificationAttempts
+// is returned and the code is gone. Wrong codes return ErrInvalidPhoneVerificationCode, and
+// users without a code, or whose code has expired or was sent to a number they have since
+// changed, get ErrPhoneVerificationNotFound.
+func (m PhoneVerificationModel) Verify(userID int64, phoneNumber, code string) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultTokenDBContextTimeout)
+	defer cancel()
+
+	var failed error
+	err := withTransaction(ctx, m.Conn, func(qtx *database.Queries) error {
+		// counting the attempt locks the token, so parallel guesses are all counted
+		row, err := qtx.IncrementTokenAttempts(ctx, database.IncrementTokenAttemptsParams{
+			UserID: userID,
+			Scope:  ScopePhoneVerification,
+			Expiry: time.Now(),
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrPhoneVerificationNotFound
+			default:
+				return err
+			}
+		}
+		deleteParams := database.DeletAllTokensForUserParams{UserID: userID, Scope: ScopePhoneVerification}
+		if row.Attempts > MaxPhoneVerificationAttempts {
+			failed = ErrTooManyPhoneVerificationAttempts
+			return qtx.DeletAllTokensForUser(ctx, deleteParams)
+		}
+		if subtle.ConstantTimeCompare(row.Hash, phoneVerificationHash(userID, phoneNumber, code)) != 1 {
+			// The attempt has to be committed, so this isn't returned as an error here
+			failed = ErrInvalidPhoneVerificationCode
+			return nil
+		}
+
+		err = qtx.DeletAllTokensForUser(ctx, deleteParams)
+		if err != nil {
+			return err
+		}
+		updated, err := qtx.SetUserPhoneVerified(ctx, database.SetUserPhoneVerifiedParams{
+			ID:          userID,
+			PhoneNumber: sql.NullString{String: phoneNumber, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		if updated == 0 {
+			return ErrPhoneVerificationNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if failed != nil {
+		return failed
+	}
+	// cached token lookups still say the number isn't verified
+	forgetUserTokens(m.TokenCache, userID, "")
+	return nil
+}
@@ -0,0 +1,90 @@
+package data
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/validator"
+)
+
+func TestValidatePhoneVerificationCode(t *testing.T) {
+	tests := []struct {
+		name  string
+		code  string
+		valid bool
+	}{
+		{"six digits", "012345", true},
+		{"empty", "", false},
+		{"too short", "12345", false},
+		{"too long", "1234567", false},
+		{"letters", "12345a", false},
+		{"spaces", " 12345", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidatePhoneVerificationCode(v, tt.code)
+			if v.Valid() != tt.valid {
+				t.Errorf("Expected valid to be %v, got %v: %v", tt.valid, v.Valid(), v.Errors)
+			}
+		})
+	}
+}
+
+func TestPhoneVerification(t *testing.T) {
+	db := openTestDB(t)
+	models := NewModels(db, 0)
+	userID := seedTestUser(t, db)
+	const phoneNumber = "+254700000000"
+	if _, err := db.Exec(`UPDATE users SET phone_number = $1 WHERE id = $2`, phoneNumber, userID); err != nil {
+		t.Fatalf("Failed to set phone number: %v", err)
+	}
+
+	if err := models.PhoneVerifications.Verify(userID, phoneNumber, "123456"); !errors.Is(err, ErrPhoneVerificationNotFound) {
+		t.Fatalf("Expected ErrPhoneVerificationNotFound before a code is sent, got %v", err)
+	}
+
+	// Wrong codes are counted until the code stops working altogether
+	code, err := models.PhoneVerifications.New(userID, phoneNumber)
+	if err != nil {
+		t.Fatalf("Failed to create code: %v", err)
+	}
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	for range MaxPhoneVerificationAttempts {
+		if err := models.PhoneVerifications.Verify(userID, phoneNumber, wrong); !errors.Is(err, ErrInvalidPhoneVerificationCode) {
+			t.Fatalf("Expected ErrInvalidPhoneVerificationCode, got %v", err)
+		}
+	}
+	if err := models.PhoneVerifications.Verify(userID, phoneNumber, code); !errors.Is(err, ErrTooManyPhoneVerificationAttempts) {
+		t.Fatalf("Expected ErrTooManyPhoneVerificationAttempts, got %v", err)
+	}
+	if err := models.PhoneVerifications.Verify(userID, phoneNumber, code); !errors.Is(err, ErrPhoneVerificationNotFound) {
+		t.Fatalf("Expected the code to be gone after too many attempts, got %v", err)
+	}
+
+	// A code only verifies the number it was sent to
+	code, err = models.PhoneVerifications.New(userID, phoneNumber)
+	if err != nil {
+		t.Fatalf("Failed to create code: %v", err)
+	}
+	if err := models.PhoneVerifications.Verify(userID, "+254711111111", code); !errors.Is(err, ErrInvalidPhoneVerificationCode) {
+		t.Errorf("Expected ErrInvalidPhoneVerificationCode for another number, got %v", err)
+	}
+	if err := models.PhoneVerifications.Verify(userID, phoneNumber, code); err != nil {
+		t.Fatalf("Failed to verify phone number: %v", err)
+	}
+	user, err := models.Users.GetUserByID(userID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if !user.PhoneVerified {
+		t.Errorf("Expected the phone number to be verified")
+	}
+	if err := models.PhoneVerifications.Verify(userID, phoneNumber, code); !errors.Is(err, ErrPhoneVerificationNotFound) {
+		t.Errorf("Expected the code to only work once, got %v", err)
+	}
+}
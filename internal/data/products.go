@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"math"
 	"strings"
 	"time"
 
@@ -15,11 +16,13 @@ import (
 var (
 	ErrDuplicateProductName = errors.New("product with this name already exists, please choose a different name")
 	ErrInvalidCategoryID    = errors.New("invalid category ID provided")
+	ErrProductHasOrders     = errors.New("product has been ordered and cannot be deleted")
 )
 
 // Define the TokenModel type.
 type ProductModel struct {
-	DB *database.Queries
+	DB   *database.Queries
+	Conn *sql.DB // used to open transactions for stock adjustments
 }
 
 type Product struct {
@@ -41,6 +44,18 @@ type CategoryInfo struct {
 	ParentID *int32 `json:"parent_id,omitempty"` // Category's parent ID (can be null for root)
 }
 
+// StockAdjustment is a recorded manual change to a product's stock made by an admin
+type StockAdjustment struct {
+	ID               int32     `json:"id"`
+	ProductID        int32     `json:"product_id"`
+	AdjustedBy       int32     `json:"adjusted_by,omitempty"` // Admin who made the change, 0 if the user was deleted
+	QuantityChange   int32     `json:"quantity_change"`
+	PreviousQuantity int32     `json:"previous_quantity"`
+	NewQuantity      int32     `json:"new_quantity"`
+	Reason           string    `json:"reason"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
 // Timeout constants for our module
 const (
 	DefaultProductDBContextTimeout = 5 * time.Second
@@ -54,6 +69,29 @@ const (
 	LowStockThreshold     = 10 // Below this is considered low stock
 )
 
+// Product limits, matching the products table
+const (
+	MaxProductNameLength        = 160
+	MaxProductDescriptionLength = 5000
+	MaxStockAdjustment          = 1_000_000 // largest single stock change an admin can make
+	MaxStockAdjustmentReason    = 500
+)
+
+// MaxProductPriceKES is the largest price that fits in a NUMERIC(12, 2) column
+var MaxProductPriceKES = decimal.RequireFromString("9999999999.99")
+
+// MaxProductSearchLength is the longest search GetAllProducts() accepts
+const MaxProductSearchLength = 200
+
+// ProductSearch narrows down the products GetAllProducts() lists, the zero value lists them all
+type ProductSearch struct {
+	Search     string          // matched against the name, and less strongly the description
+	CategoryID int             // also includes the category's subcategories, 0 for every category
+	MinPrice   decimal.Decimal // inclusive
+	MaxPrice   decimal.Decimal // inclusive, 0 for no upper bound
+	InStock    bool            // leaves out products that are out of stock
+}
+
 // generateStockStatus determines the stock status based on quantity
 func generateStockStatus(quantity int32) string {
 	switch {
@@ -69,25 +107,65 @@ func generateStockStatus(quantity int32) string {
 func ValidateProduct(v *validator.Validator, product *Product) {
 	// Validate the product name
 	v.Check(product.Name != "", "name", "must be provided")
+	v.Check(len(product.Name) <= MaxProductNameLength, "name", "must not be more than 160 bytes long")
 	// Validate the price
 	v.Check(product.PriceKES.GreaterThanOrEqual(decimal.NewFromInt(0)), "price_kes", "must be greater than or equal to 0")
+	v.Check(product.PriceKES.LessThanOrEqual(MaxProductPriceKES), "price_kes", "must not be more than 9999999999.99")
+	v.Check(product.PriceKES.Equal(product.PriceKES.Round(2)), "price_kes", "must not have more than 2 decimal places")
 	// Validate the category ID
 	v.Check(product.CategoryID > 0, "category_id", "must be a valid ID")
+	// Validate the description
+	v.Check(len(product.Description) <= MaxProductDescriptionLength, "description", "must not be more than 5000 bytes long")
 	// Validate the stock quantity
 	v.Check(product.StockQuantity >= 0, "stock_quantity", "must be greater than or equal to 0")
 }
 
-// GetAllProducts() is a method that retrieves all products from the database.
-// It takes a category name and filters as parameters and returns a slice of Product pointers,
+// ValidateProductSearch checks the search and filters a customer browses products with
+func ValidateProductSearch(v *validator.Validator, search ProductSearch) {
+	v.Check(len(search.Search) <= MaxProductSearchLength, "search", "must not be more than 200 bytes long")
+	v.Check(search.CategoryID >= 0 && search.CategoryID <= math.MaxInt32, "category_id", "must be a valid ID")
+	v.Check(!search.MinPrice.IsNegative(), "min_price", "must be greater than or equal to 0")
+	v.Check(!search.MaxPrice.IsNegative(), "max_price", "must be greater than or equal to 0")
+	if search.MaxPrice.IsPositive() {
+		v.Check(search.MaxPrice.GreaterThanOrEqual(search.MinPrice), "max_price", "must be greater than or equal to min_price")
+	}
+}
+
+// ValidateStockAdjustment checks a manual stock change requested by an admin.
+// The resulting product should also be passed through ValidateProduct.
+func ValidateStockAdjustment(v *validator.Validator, quantityChange int32, reason string) {
+	v.Check(quantityChange != 0, "quantity_change", "must not be 0")
+	v.Check(quantityChange >= -MaxStockAdjustment && quantityChange <= MaxStockAdjustment, "quantity_change", "must be between -1000000 and 1000000")
+	v.Check(strings.TrimSpace(reason) != "", "reason", "must be provided")
+	v.Check(len(reason) <= MaxStockAdjustmentReason, "reason", "must not be more than 500 bytes long")
+}
+
+// GetAllProducts() is a method that retrieves the products matching a search from the database.
+// It takes the search and filters as parameters and returns a slice of Product pointers,
 // metadata for pagination, and an error if any.
-func (m ProductModel) GetAllProducts(name string, filters Filters) ([]*Product, Metadata, error) {
+func (m ProductModel) GetAllProducts(search ProductSearch, filters Filters) ([]*Product, Metadata, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), DefaultProductDBContextTimeout)
 	defer cancel()
-	// Get all products from the database
+	// Listings sorted by created_at can be paged with a cursor
+	after, hasCursor, err := filters.after()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	// Get the matching products from the database, sorted by the filters. An empty sort
+	// lists the best matches of a search first, and products by name otherwise.
 	products, err := m.DB.GetAllProductsWithCategory(ctx, database.GetAllProductsWithCategoryParams{
-		Column1: name,
-		Limit:   int32(filters.limit()),
-		Offset:  int32(filters.offset()),
+		Column1:  search.Search,
+		Column2:  int32(search.CategoryID),
+		Column3:  search.MinPrice.String(),
+		Column4:  search.MaxPrice.String(),
+		Column5:  search.InStock,
+		Column6:  filters.sortColumn(),
+		Column7:  filters.sortDirection(),
+		Column8:  hasCursor,
+		Column9:  after.CreatedAt,
+		Column10: after.ID,
+		Limit:    int32(filters.limit()),
+		Offset:   int32(filters.offset()),
 	})
 	if err != nil {
 		switch {
@@ -108,8 +186,14 @@ func (m ProductModel) GetAllProducts(name string, filters Filters) ([]*Product,
 		totalProducts = int(productRow.TotalCount)
 		populatedProducts = append(populatedProducts, populateProducts(productRow))
 	}
-	// Create metadata for pagination
+	// Create metadata for pagination, listings by created_at also get the next page's cursor
 	metadata := calculateMetadata(totalProducts, filters.Page, filters.PageSize)
+	if filters.sortColumn() == "created_at" {
+		fetched := len(products)
+		products, populatedProducts = keysetPage(filters, products), keysetPage(filters, populatedProducts)
+		last := products[len(products)-1]
+		metadata = filters.keysetMetadata(totalProducts, fetched, Cursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
 	return populatedProducts, metadata, nil
 }
 
@@ -148,6 +232,209 @@ func (m ProductModel) CreateNewProducts(product *Product) error {
 	return nil
 }
 
+// GetProductByID() retrieves a single product, along with its category details.
+// It returns ErrGeneralRecordNotFound if the product does not exist.
+func (m ProductModel) GetProductByID(productID int32) (*Product, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultProductDBContextTimeout)
+	defer cancel()
+
+	product, err := m.DB.GetProductWithCategoryById(ctx, productID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrGeneralRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return populateProducts(product), nil
+}
+
+// GetProductByIDAndVersion() retrieves a product only if it is still at the supplied version.
+// It is used before an update so that stale edits are turned away early.
+func (m ProductModel) GetProductByIDAndVersion(productID, productVersion int32) (*Product, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultProductDBContextTimeout)
+	defer cancel()
+
+	product, err := m.DB.GetProductById(ctx, database.GetProductByIdParams{
+		ID:      productID,
+		Version: productVersion,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrGeneralRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return populateProducts(product), nil
+}
+
+// UpdateProduct() updates a product's details using optimistic locking on its version.
+// Stock is not changed here, that goes through AdjustProductStock so every change has a reason.
+// On success the product's version and updated_at fields are refreshed.
+func (m ProductModel) UpdateProduct(product *Product) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultProductDBContextTimeout)
+	defer cancel()
+
+	updatedProduct, err := m.DB.UpdateProduct(ctx, database.UpdateProductParams{
+		ID:          product.ID,
+		Name:        product.Name,
+		PriceKes:    product.PriceKES.String(),
+		CategoryID:  product.CategoryID,
+		Description: sql.NullString{String: product.Description, Valid: true},
+		Version:     product.Version,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case strings.Contains(err.Error(), "ux_products_name_cat"):
+			return ErrDuplicateProductName
+		case strings.Contains(err.Error(), "products_category_id_fkey"):
+			return ErrInvalidCategoryID
+		default:
+			return err
+		}
+	}
+	product.Version = updatedProduct.Version
+	product.UpdatedAt = updatedProduct.UpdatedAt.Format(time.RFC3339)
+	return nil
+}
+
+// DeleteProductByID() deletes a product. Products that appear on any order are protected
+// by the order_items foreign key, in which case ErrProductHasOrders is returned.
+func (m ProductModel) DeleteProductByID(productID int32) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultProductDBContextTimeout)
+	defer cancel()
+
+	_, err := m.DB.DeleteProduct(ctx, productID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrGeneralRecordNotFound
+		case strings.Contains(err.Error(), "order_items_product_id_fkey"):
+			return ErrProductHasOrders
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// AdjustProductStock() changes a product's stock by quantityChange and records who made the
+// change and why. The product row is locked for the duration so the recorded previous and
+// new quantities always line up with concurrent checkouts. A change that would take the stock
+// below zero returns ErrInsufficientStock.
+func (m ProductModel) AdjustProductStock(productID, adjustedBy, quantityChange int32, reason string) (*StockAdjustment, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultProductDBContextTimeout)
+	defer cancel()
+
+	var adjustment *StockAdjustment
+	err := withTransaction(ctx, m.Conn, func(qtx *database.Queries) error {
+		product, err := qtx.GetProductForUpdate(ctx, productID)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrGeneralRecordNotFound
+			default:
+				return err
+			}
+		}
+		newQuantity := product.StockQuantity + quantityChange
+		if newQuantity < 0 {
+			return ErrInsufficientStock
+		}
+		err = qtx.UpdateProductStockQuantity(ctx, database.UpdateProductStockQuantityParams{
+			ID:            productID,
+			StockQuantity: newQuantity,
+		})
+		if err != nil {
+			return err
+		}
+		record, err := qtx.CreateProductStockAdjustment(ctx, database.CreateProductStockAdjustmentParams{
+			ProductID:        productID,
+			AdjustedBy:       convertValueToNullInt32(adjustedBy),
+			QuantityChange:   quantityChange,
+			PreviousQuantity: product.StockQuantity,
+			NewQuantity:      newQuantity,
+			Reason:           strings.TrimSpace(reason),
+		})
+		if err != nil {
+			return err
+		}
+		adjustment = populateStockAdjustment(record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return adjustment, nil
+}
+
+// GetProductStockAdjustments() returns the recorded stock adjustments for a product, newest first.
+// A product that was never adjusted has an empty list, only a missing product returns
+// ErrGeneralRecordNotFound.
+func (m ProductModel) GetProductStockAdjustments(productID int32, filters Filters) ([]*StockAdjustment, Metadata, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultProductDBContextTimeout)
+	defer cancel()
+
+	rows, err := m.DB.GetProductStockAdjustments(ctx, database.GetProductStockAdjustmentsParams{
+		ProductID: productID,
+		Limit:     int32(filters.limit()),
+		Offset:    int32(filters.offset()),
+	})
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	adjustments := []*StockAdjustment{}
+	if len(rows) == 0 {
+		// tell a product without adjustments apart from one that doesn't exist
+		if _, err := m.GetProductByID(productID); err != nil {
+			return nil, Metadata{}, err
+		}
+		return adjustments, Metadata{}, nil
+	}
+	totalAdjustments := 0
+	for _, row := range rows {
+		totalAdjustments = int(row.TotalCount)
+		adjustments = append(adjustments, populateStockAdjustment(row))
+	}
+	metadata := calculateMetadata(totalAdjustments, filters.Page, filters.PageSize)
+	return adjustments, metadata, nil
+}
+
+// populateStockAdjustment converts a database row into a StockAdjustment struct.
+func populateStockAdjustment(adjustmentRow any) *StockAdjustment {
+	switch adjustment := adjustmentRow.(type) {
+	case database.ProductStockAdjustment:
+		return &StockAdjustment{
+			ID:               adjustment.ID,
+			ProductID:        adjustment.ProductID,
+			AdjustedBy:       adjustment.AdjustedBy.Int32,
+			QuantityChange:   adjustment.QuantityChange,
+			PreviousQuantity: adjustment.PreviousQuantity,
+			NewQuantity:      adjustment.NewQuantity,
+			Reason:           adjustment.Reason,
+			CreatedAt:        adjustment.CreatedAt,
+		}
+	case database.GetProductStockAdjustmentsRow:
+		return &StockAdjustment{
+			ID:               adjustment.ID,
+			ProductID:        adjustment.ProductID,
+			AdjustedBy:       adjustment.AdjustedBy.Int32,
+			QuantityChange:   adjustment.QuantityChange,
+			PreviousQuantity: adjustment.PreviousQuantity,
+			NewQuantity:      adjustment.NewQuantity,
+			Reason:           adjustment.Reason,
+			CreatedAt:        adjustment.CreatedAt,
+		}
+	default:
+		return nil // Return nil if the type does not match
+	}
+}
+
 // populateProducts converts a database row into a Product struct.
 func populateProducts(productRow any) *Product {
 	switch product := productRow.(type) {
@@ -171,6 +458,37 @@ func populateProducts(productRow any) *Product {
 			CreatedAt:     product.CreatedAt.Format(time.RFC3339),
 			UpdatedAt:     product.UpdatedAt.Format(time.RFC3339),
 		}
+	case database.GetProductWithCategoryByIdRow:
+		return &Product{
+			ID:         product.ID,
+			Name:       product.Name,
+			PriceKES:   decimal.RequireFromString(product.PriceKes),
+			CategoryID: product.CategoryID,
+			Category: &CategoryInfo{
+				ID:       product.CategoryIDInfo.Int32,
+				Name:     product.CategoryName.String,
+				ParentID: &product.CategoryParentID.Int32,
+			},
+			Description:   product.Description.String,
+			StockQuantity: product.StockQuantity,
+			StockStatus:   generateStockStatus(product.StockQuantity),
+			Version:       product.Version,
+			CreatedAt:     product.CreatedAt.Format(time.RFC3339),
+			UpdatedAt:     product.UpdatedAt.Format(time.RFC3339),
+		}
+	case database.Product:
+		return &Product{
+			ID:            product.ID,
+			Name:          product.Name,
+			PriceKES:      decimal.RequireFromString(product.PriceKes),
+			CategoryID:    product.CategoryID,
+			Description:   product.Description.String,
+			StockQuantity: product.StockQuantity,
+			StockStatus:   generateStockStatus(product.StockQuantity),
+			Version:       product.Version,
+			CreatedAt:     product.CreatedAt.Format(time.RFC3339),
+			UpdatedAt:     product.UpdatedAt.Format(time.RFC3339),
+		}
 	default:
 		return nil // Return nil if the type does not match
 	}
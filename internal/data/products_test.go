@@ -1,8 +1,14 @@
 package data
 
 import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/Blue-Davinci/SavannaCart/internal/database"
 	"github.com/Blue-Davinci/SavannaCart/internal/validator"
 	"github.com/shopspring/decimal"
 )
@@ -242,6 +248,36 @@ func TestValidateProductEdgeCases(t *testing.T) {
 			},
 			valid: true,
 		},
+		{
+			name: "product name over 160 bytes",
+			product: &Product{
+				Name:          strings.Repeat("a", 161),
+				PriceKES:      decimal.NewFromFloat(100.50),
+				CategoryID:    1,
+				StockQuantity: 50,
+			},
+			valid: false,
+		},
+		{
+			name: "price too large for the column",
+			product: &Product{
+				Name:          "Too Expensive Product",
+				PriceKES:      decimal.RequireFromString("10000000000.00"),
+				CategoryID:    1,
+				StockQuantity: 1,
+			},
+			valid: false,
+		},
+		{
+			name: "price with more than 2 decimal places",
+			product: &Product{
+				Name:          "Fractional Product",
+				PriceKES:      decimal.RequireFromString("10.005"),
+				CategoryID:    1,
+				StockQuantity: 1,
+			},
+			valid: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -256,3 +292,260 @@ func TestValidateProductEdgeCases(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateStockAdjustment(t *testing.T) {
+	tests := []struct {
+		name           string
+		quantityChange int32
+		reason         string
+		expectedErrors []string
+	}{
+		{"restock", 25, "supplier delivery", []string{}},
+		{"write off", -3, "damaged in transit", []string{}},
+		{"zero change", 0, "no-op", []string{"quantity_change"}},
+		{"change too large", MaxStockAdjustment + 1, "bulk import", []string{"quantity_change"}},
+		{"missing reason", 5, "   ", []string{"reason"}},
+		{"reason too long", 5, strings.Repeat("r", MaxStockAdjustmentReason+1), []string{"reason"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateStockAdjustment(v, tt.quantityChange, tt.reason)
+
+			if len(tt.expectedErrors) == 0 && !v.Valid() {
+				t.Errorf("Expected no validation errors, got %v", v.Errors)
+			}
+			for _, field := range tt.expectedErrors {
+				if _, exists := v.Errors[field]; !exists {
+					t.Errorf("Expected validation error for field %q, got %v", field, v.Errors)
+				}
+			}
+		})
+	}
+}
+
+func TestAdjustProductStockRecordsReason(t *testing.T) {
+	db := openTestDB(t)
+	products := ProductModel{DB: database.New(db), Conn: db}
+
+	adminID := int32(seedTestUser(t, db))
+	productID := seedTestProduct(t, db, "100.00", 5)
+
+	adjustment, err := products.AdjustProductStock(productID, adminID, -2, "  damaged in transit ")
+	if err != nil {
+		t.Fatalf("Failed to adjust stock: %v", err)
+	}
+	if adjustment.PreviousQuantity != 5 || adjustment.NewQuantity != 3 {
+		t.Errorf("Expected 5 -> 3, got %d -> %d", adjustment.PreviousQuantity, adjustment.NewQuantity)
+	}
+	if adjustment.Reason != "damaged in transit" || adjustment.AdjustedBy != adminID {
+		t.Errorf("Unexpected adjustment record: %+v", adjustment)
+	}
+
+	// Going below zero is rejected and leaves the stock untouched
+	if _, err := products.AdjustProductStock(productID, adminID, -4, "recount"); !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("Expected ErrInsufficientStock, got %v", err)
+	}
+	if stock := productStock(t, db, productID); stock != 3 {
+		t.Errorf("Expected stock of 3, got %d", stock)
+	}
+}
+
+func TestGetProductStockAdjustmentsWithoutAdjustments(t *testing.T) {
+	db := openTestDB(t)
+	products := ProductModel{DB: database.New(db), Conn: db}
+	filters := Filters{Page: 1, PageSize: 20, SortSafelist: []string{""}}
+
+	// a product that was never adjusted has an empty list
+	productID := seedTestProduct(t, db, "100.00", 5)
+	adjustments, _, err := products.GetProductStockAdjustments(productID, filters)
+	if err != nil {
+		t.Fatalf("Failed to get stock adjustments: %v", err)
+	}
+	if adjustments == nil || len(adjustments) != 0 {
+		t.Errorf("Expected an empty list of adjustments, got %v", adjustments)
+	}
+
+	// a product that doesn't exist is still not found
+	if _, _, err := products.GetProductStockAdjustments(-1, filters); !errors.Is(err, ErrGeneralRecordNotFound) {
+		t.Errorf("Expected ErrGeneralRecordNotFound, got %v", err)
+	}
+}
+
+func TestDeleteProductWithOrdersIsRestricted(t *testing.T) {
+	db := openTestDB(t)
+	products := ProductModel{DB: database.New(db), Conn: db}
+	orders := newTestOrderModel(db)
+
+	userID := seedTestUser(t, db)
+	productID := seedTestProduct(t, db, "100.00", 5)
+
+	_, err := orders.CreateOrder(&CreateOrderRequest{
+		UserID: int32(userID),
+		Items:  []*CreateOrderItemRequest{{ProductID: productID, Quantity: 1}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create order: %v", err)
+	}
+	if err := products.DeleteProductByID(productID); !errors.Is(err, ErrProductHasOrders) {
+		t.Fatalf("Expected ErrProductHasOrders, got %v", err)
+	}
+}
+
+func TestValidateProductSearch(t *testing.T) {
+	tests := []struct {
+		name           string
+		search         ProductSearch
+		expectedErrors []string
+	}{
+		{"everything", ProductSearch{}, nil},
+		{"all filters", ProductSearch{Search: "kikoi", CategoryID: 3, MinPrice: decimal.NewFromInt(100), MaxPrice: decimal.NewFromInt(500), InStock: true}, nil},
+		{"min price without a maximum", ProductSearch{MinPrice: decimal.NewFromInt(1000)}, nil},
+		{"equal min and max price", ProductSearch{MinPrice: decimal.NewFromInt(500), MaxPrice: decimal.NewFromInt(500)}, nil},
+		{"search too long", ProductSearch{Search: strings.Repeat("a", MaxProductSearchLength+1)}, []string{"search"}},
+		{"negative category", ProductSearch{CategoryID: -1}, []string{"category_id"}},
+		{"category out of range", ProductSearch{CategoryID: 1 << 31}, []string{"category_id"}},
+		{"negative prices", ProductSearch{MinPrice: decimal.NewFromInt(-1), MaxPrice: decimal.NewFromInt(-1)}, []string{"min_price", "max_price"}},
+		{"max below min", ProductSearch{MinPrice: decimal.NewFromInt(500), MaxPrice: decimal.NewFromInt(100)}, []string{"max_price"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateProductSearch(v, tt.search)
+
+			if len(v.Errors) != len(tt.expectedErrors) {
+				t.Errorf("Expected %d errors, got %v", len(tt.expectedErrors), v.Errors)
+			}
+			for _, expectedField := range tt.expectedErrors {
+				if _, exists := v.Errors[expectedField]; !exists {
+					t.Errorf("Expected error for field '%s', but it was not found", expectedField)
+				}
+			}
+		})
+	}
+}
+
+func TestGetAllProductsSearchAndFilters(t *testing.T) {
+	db := openTestDB(t)
+	products := ProductModel{DB: database.New(db), Conn: db}
+
+	// a category with a subcategory, and one that isn't related to them
+	suffix := fmt.Sprintf("%s_%d", t.Name(), time.Now().UnixNano())
+	seedCategory := func(name string, parentID *int32) int32 {
+		t.Helper()
+		var categoryID int32
+		if err := db.QueryRow(`INSERT INTO categories (name, parent_id) VALUES ($1, $2) RETURNING id`, name+"_"+suffix, parentID).Scan(&categoryID); err != nil {
+			t.Fatalf("Failed to seed category: %v", err)
+		}
+		return categoryID
+	}
+	textiles := seedCategory("textiles", nil)
+	towels := seedCategory("towels", &textiles)
+	coffee := seedCategory("coffee", nil)
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM products WHERE category_id IN ($1, $2, $3)`, textiles, towels, coffee)
+		db.Exec(`DELETE FROM categories WHERE id IN ($1, $2)`, towels, coffee)
+		db.Exec(`DELETE FROM categories WHERE id = $1`, textiles)
+	})
+
+	// the search term is unique to this test, so other products in the database never match
+	term := fmt.Sprintf("zq%d", time.Now().UnixNano())
+	seedProduct := func(name, price string, categoryID, stock int32, description string, hoursAgo int) int32 {
+		t.Helper()
+		var productID int32
+		err := db.QueryRow(`
+			INSERT INTO products (name, price_kes, category_id, stock_quantity, description, created_at)
+			VALUES ($1, $2, $3, $4, $5, NOW() - $6::integer * INTERVAL '1 hour')
+			RETURNING id`, name, price, categoryID, stock, description, hoursAgo).Scan(&productID)
+		if err != nil {
+			t.Fatalf("Failed to seed product: %v", err)
+		}
+		return productID
+	}
+	kikoi := seedProduct("Kikoi "+term, "1500.00", textiles, 10, "Handwoven cotton", 3)
+	towel := seedProduct("Beach Towel", "800.00", towels, 0, "Soft and light, a "+term+" favourite", 2)
+	beans := seedProduct("Coffee Beans "+term, "2250.00", coffee, 5, "", 1)
+
+	ids := func(list []*Product) []int32 {
+		got := []int32{}
+		for _, product := range list {
+			got = append(got, product.ID)
+		}
+		return got
+	}
+	filters := func(sort string) Filters {
+		return Filters{Page: 1, PageSize: 20, Sort: sort, SortSafelist: []string{"", "name", "-name", "price_kes", "-price_kes", "created_at", "-created_at"}}
+	}
+
+	tests := []struct {
+		name     string
+		search   ProductSearch
+		sort     string
+		expected []int32
+	}{
+		// equally good matches are listed by name
+		{"name matches rank above description matches", ProductSearch{Search: term}, "", []int32{beans, kikoi, towel}},
+		{"sorted by price", ProductSearch{Search: term}, "price_kes", []int32{towel, kikoi, beans}},
+		{"sorted by price descending", ProductSearch{Search: term}, "-price_kes", []int32{beans, kikoi, towel}},
+		{"sorted by name descending", ProductSearch{Search: term}, "-name", []int32{kikoi, beans, towel}},
+		{"newest first", ProductSearch{Search: term}, "-created_at", []int32{beans, towel, kikoi}},
+		{"category includes its subcategories", ProductSearch{Search: term, CategoryID: int(textiles)}, "name", []int32{towel, kikoi}},
+		{"subcategory only", ProductSearch{Search: term, CategoryID: int(towels)}, "", []int32{towel}},
+		{"price range", ProductSearch{Search: term, MinPrice: decimal.NewFromInt(1000), MaxPrice: decimal.NewFromInt(2000)}, "", []int32{kikoi}},
+		{"minimum price only", ProductSearch{Search: term, MinPrice: decimal.NewFromInt(1000)}, "price_kes", []int32{kikoi, beans}},
+		{"in stock only", ProductSearch{Search: term, InStock: true}, "price_kes", []int32{kikoi, beans}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, metadata, err := products.GetAllProducts(tt.search, filters(tt.sort))
+			if err != nil {
+				t.Fatalf("Failed to get products: %v", err)
+			}
+			if got := ids(list); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected products %v, got %v", tt.expected, got)
+			}
+			if metadata.TotalRecords != len(tt.expected) {
+				t.Errorf("Expected %d total records, got %d", len(tt.expected), metadata.TotalRecords)
+			}
+		})
+	}
+
+	// nothing matching is reported as not found, like before
+	_, _, err := products.GetAllProducts(ProductSearch{Search: term, CategoryID: int(coffee), InStock: true, MaxPrice: decimal.NewFromInt(1)}, filters(""))
+	if !errors.Is(err, ErrGeneralRecordNotFound) {
+		t.Errorf("Expected ErrGeneralRecordNotFound, got %v", err)
+	}
+
+	// listings by created_at can be followed one cursor at a time
+	for _, tt := range []struct {
+		sort     string
+		expected []int32
+	}{
+		{"-created_at", []int32{beans, towel, kikoi}},
+		{"created_at", []int32{kikoi, towel, beans}},
+	} {
+		t.Run("cursor "+tt.sort, func(t *testing.T) {
+			page := filters(tt.sort)
+			page.PageSize = 1
+			page.CursorSecret = []byte("test-secret")
+			got := []int32{}
+			for range tt.expected {
+				list, metadata, err := products.GetAllProducts(ProductSearch{Search: term}, page)
+				if err != nil {
+					t.Fatalf("Failed to get products: %v", err)
+				}
+				got = append(got, ids(list)...)
+				page.Cursor = metadata.NextCursor
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected products %v, got %v", tt.expected, got)
+			}
+			if page.Cursor != "" {
+				t.Errorf("Expected no cursor after the last page, got %q", page.Cursor)
+			}
+		})
+	}
+}
@@ -0,0 +1,324 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/cache"
+	"github.com/Blue-Davinci/SavannaCart/internal/database"
+	"github.com/Blue-Davinci/SavannaCart/internal/validator"
+)
+
+var (
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used")
+)
+
+// maxUserAgentLength caps how much of a client's user agent we keep
+const maxUserAgentLength = 512
+
+// SessionModel manages login sessions. Every login starts a new session, so a user can be
+// signed in on several devices at once, each with its own authentication and refresh token.
+type SessionModel struct {
+	DB         *database.Queries
+	Conn       *sql.DB                           // refreshing and revoking change several rows together
+	TokenCache *cache.Cache[tokenCacheKey, User] // shared with UserModel, cleared when tokens are deleted
+}
+
+// Session is a single signed in device
+type Session struct {
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"-"`
+	Device     string    `json:"device"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Expiry     time.Time `json:"expiry"`
+	Current    bool      `json:"current"` // whether the request listing the sessions was made with it
+}
+
+// SessionMetadata describes the client a session is started from
+type SessionMetadata struct {
+	UserAgent string
+	IPAddress string
+}
+
+// SessionTokens is what a client receives when it logs in or refreshes its session
+type SessionTokens struct {
+	Session             *Session
+	AuthenticationToken *Token
+	RefreshToken        *Token
+}
+
+// DescribeDevice() turns a user agent into a short description of the device, so users can
+// tell their sessions apart.
+func DescribeDevice(userAgent string) string {
+	devices := []struct {
+		marker string
+		device string
+	}{
+		// order matters, iPad and iPhone user agents also mention Mac OS X and Android ones Linux
+		{"iPad", "iPad"},
+		{"iPhone", "iPhone"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Macintosh", "Mac"},
+		{"CrOS", "Chromebook"},
+		{"Linux", "Linux"},
+	}
+	for _, d := range devices {
+		if strings.Contains(userAgent, d.marker) {
+			return d.device
+		}
+	}
+	return "Unknown device"
+}
+
+// ValidateRefreshToken() checks a refresh token looks like one we issued
+func ValidateRefreshToken(v *validator.Validator, refreshToken string) {
+	v.Check(refreshToken != "", "refresh_token", "must be provided")
+	v.Check(len(refreshToken) == 26, "refresh_token", "must be valid")
+}
+
+// New() starts a session for the user and issues its first authentication and refresh tokens.
+func (m SessionModel) New(userID int64, metadata SessionMetadata) (*SessionTokens, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultTokenDBContextTimeout)
+	defer cancel()
+
+	userAgent := metadata.UserAgent
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	var tokens *SessionTokens
+	err := withTransaction(ctx, m.Conn, func(qtx *database.Queries) error {
+		session, err := qtx.CreateSession(ctx, database.CreateSessionParams{
+			UserID:    userID,
+			Device:    DescribeDevice(metadata.UserAgent),
+			UserAgent: userAgent,
+			IpAddress: metadata.IPAddress,
+			Expiry:    time.Now().Add(DefaultSessionExpiryTime),
+		})
+		if err != nil {
+			return err
+		}
+		tokens, err = issueSessionTokensTx(ctx, qtx, populateSession(session))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// issueSessionTokensTx() creates a new authentication and refresh token for the session.
+func issueSessionTokensTx(ctx context.Context, qtx *database.Queries, session *Session) (*SessionTokens, error) {
+	authenticationToken, err := generateToken(session.UserID, DefaultAuthenticationTokenExpiryTime, ScopeAuthentication)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := generateToken(session.UserID, time.Until(session.Expiry), ScopeRefresh)
+	if err != nil {
+		return nil, err
+	}
+	for _, token := range []*Token{authenticationToken, refreshToken} {
+		token.SessionID = session.ID
+		if err := insertTokenTx(ctx, qtx, token); err != nil {
+			return nil, err
+		}
+	}
+	return &SessionTokens{
+		Session:             session,
+		AuthenticationToken: authenticationToken,
+		RefreshToken:        refreshToken,
+	}, nil
+}
+
+// Refresh() exchanges a refresh token for a new authentication and refresh token, rotating
+// both. The used refresh token is kept, so if it is ever presented again we know it has
+// leaked: the whole session is revoked and ErrRefreshTokenReused is returned.
+func (m SessionModel) Refresh(refreshTokenPlaintext string) (*SessionTokens, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultTokenDBContextTimeout)
+	defer cancel()
+
+	tokenHash := sha256.Sum256([]byte(refreshTokenPlaintext))
+	var (
+		tokens *SessionTokens
+		userID int64
+		reused bool
+	)
+	err := withTransaction(ctx, m.Conn, func(qtx *database.Queries) error {
+		// lock the token so two refreshes with the same token can't both succeed
+		row, err := qtx.GetRefreshTokenForUpdate(ctx, database.GetRefreshTokenForUpdateParams{
+			Hash:  tokenHash[:],
+			Scope: ScopeRefresh,
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrInvalidRefreshToken
+			default:
+				return err
+			}
+		}
+		userID = row.UserID
+		if row.RevokedAt.Valid || !time.Now().Before(row.Expiry) {
+			return ErrInvalidRefreshToken
+		}
+		if row.UsedAt.Valid {
+			// The revocation has to be committed, so this isn't returned as an error here
+			reused = true
+			return revokeSessionTx(ctx, qtx, userID, row.SessionID.Int64)
+		}
+
+		err = qtx.MarkTokenUsed(ctx, tokenHash[:])
+		if err != nil {
+			return err
+		}
+		// the old authentication token is replaced along with the refresh token
+		err = qtx.DeleteTokensForSession(ctx, database.DeleteTokensForSessionParams{
+			SessionID: row.SessionID,
+			Scope:     ScopeAuthentication,
+		})
+		if err != nil {
+			return err
+		}
+		session, err := qtx.TouchSession(ctx, database.TouchSessionParams{
+			ID:     row.SessionID.Int64,
+			Expiry: time.Now().Add(DefaultSessionExpiryTime),
+		})
+		if err != nil {
+			return err
+		}
+		tokens, err = issueSessionTokensTx(ctx, qtx, populateSession(session))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	forgetUserTokens(m.TokenCache, userID, ScopeAuthentication)
+	if reused {
+		return nil, ErrRefreshTokenReused
+	}
+	return tokens, nil
+}
+
+// revokeSessionTx() marks the session as revoked and deletes every token that belongs to it.
+func revokeSessionTx(ctx context.Context, qtx *database.Queries, userID, sessionID int64) error {
+	_, err := qtx.RevokeSession(ctx, database.RevokeSessionParams{
+		ID:     sessionID,
+		UserID: userID,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrSessionNotFound
+		default:
+			return err
+		}
+	}
+	return qtx.DeleteAllTokensForSession(ctx, sql.NullInt64{Int64: sessionID, Valid: true})
+}
+
+// GetAllForUser() returns the user's active sessions, most recently used first.
+func (m SessionModel) GetAllForUser(userID int64) ([]*Session, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultTokenDBContextTimeout)
+	defer cancel()
+
+	rows, err := m.DB.GetActiveSessionsForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	sessions := []*Session{}
+	for _, row := range rows {
+		sessions = append(sessions, populateSession(row))
+	}
+	return sessions, nil
+}
+
+// GetForToken() returns the active session a token belongs to. Tokens issued before
+// sessions existed don't belong to one and return ErrSessionNotFound.
+func (m SessionModel) GetForToken(tokenScope, tokenPlaintext string) (*Session, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultTokenDBContextTimeout)
+	defer cancel()
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	session, err := m.DB.GetSessionForToken(ctx, database.GetSessionForTokenParams{
+		Hash:  tokenHash[:],
+		Scope: tokenScope,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrSessionNotFound
+		default:
+			return nil, err
+		}
+	}
+	return populateSession(session), nil
+}
+
+// Revoke() signs the user out of one of their sessions. Sessions that don't exist, belong
+// to someone else or are already revoked return ErrSessionNotFound.
+func (m SessionModel) Revoke(userID, sessionID int64) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultTokenDBContextTimeout)
+	defer cancel()
+
+	err := withTransaction(ctx, m.Conn, func(qtx *database.Queries) error {
+		return revokeSessionTx(ctx, qtx, userID, sessionID)
+	})
+	if err != nil {
+		return err
+	}
+	forgetUserTokens(m.TokenCache, userID, "")
+	return nil
+}
+
+// RevokeAllForUser() signs the user out everywhere, including any authentication tokens
+// issued before sessions existed.
+func (m SessionModel) RevokeAllForUser(userID int64) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultTokenDBContextTimeout)
+	defer cancel()
+
+	err := withTransaction(ctx, m.Conn, func(qtx *database.Queries) error {
+		err := qtx.RevokeAllSessionsForUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+		for _, scope := range []string{ScopeAuthentication, ScopeRefresh} {
+			err = qtx.DeletAllTokensForUser(ctx, database.DeletAllTokensForUserParams{
+				Scope:  scope,
+				UserID: userID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	forgetUserTokens(m.TokenCache, userID, "")
+	return nil
+}
+
+// populateSession() converts a database session into a Session
+func populateSession(session database.Session) *Session {
+	return &Session{
+		ID:         session.ID,
+		UserID:     session.UserID,
+		Device:     session.Device,
+		UserAgent:  session.UserAgent,
+		IPAddress:  session.IpAddress,
+		CreatedAt:  session.CreatedAt,
+		LastUsedAt: session.LastUsedAt,
+		Expiry:     session.Expiry,
+	}
+}
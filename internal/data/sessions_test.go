@@ -0,0 +1,150 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDescribeDevice(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		expected  string
+	}{
+		{"iPhone", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15", "iPhone"},
+		{"iPad", "Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15", "iPad"},
+		{"Android", "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36", "Android"},
+		{"Windows", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36", "Windows"},
+		{"Mac", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15", "Mac"},
+		{"Chromebook", "Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36", "Chromebook"},
+		{"Linux", "Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/115.0", "Linux"},
+		{"API client", "curl/8.4.0", "Unknown device"},
+		{"empty", "", "Unknown device"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DescribeDevice(tt.userAgent); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSessionRefreshRotatesTokens(t *testing.T) {
+	db := openTestDB(t)
+	models := NewModels(db, time.Minute)
+	userID := seedTestUser(t, db)
+
+	started, err := models.Sessions.New(userID, SessionMetadata{UserAgent: "Mozilla/5.0 (iPhone)", IPAddress: "10.0.0.1"})
+	if err != nil {
+		t.Fatalf("Failed to start session: %v", err)
+	}
+	if started.Session.Device != "iPhone" {
+		t.Errorf("Expected device iPhone, got %q", started.Session.Device)
+	}
+
+	refreshed, err := models.Sessions.Refresh(started.RefreshToken.Plaintext)
+	if err != nil {
+		t.Fatalf("Failed to refresh session: %v", err)
+	}
+	if refreshed.Session.ID != started.Session.ID {
+		t.Errorf("Expected the same session, got %d and %d", started.Session.ID, refreshed.Session.ID)
+	}
+	if refreshed.RefreshToken.Plaintext == started.RefreshToken.Plaintext {
+		t.Error("Expected a new refresh token")
+	}
+
+	// The old authentication token is replaced, the new one works
+	if _, err := models.Users.GetForToken(ScopeAuthentication, started.AuthenticationToken.Plaintext); !errors.Is(err, ErrGeneralRecordNotFound) {
+		t.Errorf("Expected the old authentication token to stop working, got %v", err)
+	}
+	if _, err := models.Users.GetForToken(ScopeAuthentication, refreshed.AuthenticationToken.Plaintext); err != nil {
+		t.Errorf("Expected the new authentication token to work, got %v", err)
+	}
+
+	if _, err := models.Sessions.Refresh("ABCDEFGHIJKLMNOPQRSTUVWXYZ"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Expected ErrInvalidRefreshToken for an unknown token, got %v", err)
+	}
+}
+
+func TestSessionRefreshTokenReuseRevokesSession(t *testing.T) {
+	db := openTestDB(t)
+	models := NewModels(db, time.Minute)
+	userID := seedTestUser(t, db)
+
+	started, err := models.Sessions.New(userID, SessionMetadata{})
+	if err != nil {
+		t.Fatalf("Failed to start session: %v", err)
+	}
+	refreshed, err := models.Sessions.Refresh(started.RefreshToken.Plaintext)
+	if err != nil {
+		t.Fatalf("Failed to refresh session: %v", err)
+	}
+
+	// Someone presents the first refresh token again, so it must have leaked
+	if _, err := models.Sessions.Refresh(started.RefreshToken.Plaintext); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("Expected ErrRefreshTokenReused, got %v", err)
+	}
+	if _, err := models.Sessions.Refresh(refreshed.RefreshToken.Plaintext); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Expected the latest refresh token to be revoked too, got %v", err)
+	}
+	if _, err := models.Users.GetForToken(ScopeAuthentication, refreshed.AuthenticationToken.Plaintext); !errors.Is(err, ErrGeneralRecordNotFound) {
+		t.Errorf("Expected the session's authentication token to be revoked, got %v", err)
+	}
+}
+
+func TestSessionsAreIndependent(t *testing.T) {
+	db := openTestDB(t)
+	models := NewModels(db, time.Minute)
+	userID := seedTestUser(t, db)
+
+	phone, err := models.Sessions.New(userID, SessionMetadata{UserAgent: "Mozilla/5.0 (Linux; Android 14)"})
+	if err != nil {
+		t.Fatalf("Failed to start session: %v", err)
+	}
+	laptop, err := models.Sessions.New(userID, SessionMetadata{UserAgent: "Mozilla/5.0 (Windows NT 10.0)"})
+	if err != nil {
+		t.Fatalf("Failed to start session: %v", err)
+	}
+
+	// Logging in on the laptop must not log the phone out
+	if _, err := models.Users.GetForToken(ScopeAuthentication, phone.AuthenticationToken.Plaintext); err != nil {
+		t.Errorf("Expected the phone to stay signed in, got %v", err)
+	}
+	sessions, err := models.Sessions.GetAllForUser(userID)
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("Expected 2 sessions, got %d", len(sessions))
+	}
+
+	if err := models.Sessions.Revoke(userID, phone.Session.ID); err != nil {
+		t.Fatalf("Failed to revoke session: %v", err)
+	}
+	if err := models.Sessions.Revoke(userID, phone.Session.ID); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Expected ErrSessionNotFound for a revoked session, got %v", err)
+	}
+	if err := models.Sessions.Revoke(userID+1, laptop.Session.ID); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Expected ErrSessionNotFound for someone else's session, got %v", err)
+	}
+	if _, err := models.Users.GetForToken(ScopeAuthentication, laptop.AuthenticationToken.Plaintext); err != nil {
+		t.Errorf("Expected the laptop to stay signed in, got %v", err)
+	}
+
+	if err := models.Sessions.RevokeAllForUser(userID); err != nil {
+		t.Fatalf("Failed to revoke all sessions: %v", err)
+	}
+	if _, err := models.Users.GetForToken(ScopeAuthentication, laptop.AuthenticationToken.Plaintext); !errors.Is(err, ErrGeneralRecordNotFound) {
+		t.Errorf("Expected the laptop to be signed out, got %v", err)
+	}
+	sessions, err = models.Sessions.GetAllForUser(userID)
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("Expected no active sessions, got %d", len(sessions))
+	}
+}
@@ -4,28 +4,45 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
+	"database/sql"
 	"encoding/base32"
 	"time"
 
+	"github.com/Blue-Davinci/SavannaCart/internal/cache"
 	"github.com/Blue-Davinci/SavannaCart/internal/database"
 	"github.com/Blue-Davinci/SavannaCart/internal/validator"
 )
 
 // Define the TokenModel type.
 type TokenModel struct {
-	DB *database.Queries
+	DB         *database.Queries
+	TokenCache *cache.Cache[tokenCacheKey, User] // shared with UserModel
 }
 
 // Timeout constants for our module
 const (
 	DefaultTokenExpiryTime       = 72 * time.Hour
 	DefaultTokenDBContextTimeout = 5 * time.Second
+	// Authentication tokens are short lived, clients renew them with their refresh token
+	DefaultAuthenticationTokenExpiryTime = time.Hour
+	// Refresh tokens, and the session they belong to, live this long after the last refresh
+	DefaultSessionExpiryTime = 30 * 24 * time.Hour
+	// Password reset links have to be used quickly
+	DefaultPasswordResetTokenExpiryTime = 45 * time.Minute
+	// Phone verification codes are texted, so they are short and short lived
+	DefaultPhoneVerificationExpiryTime = 10 * time.Minute
+	// Expired tokens are purged this many at a time, so the table isn't locked for long
+	DefaultTokenPurgeBatchSize = 1000
 )
 
 // Define constants for the token scope.
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopeRefresh        = "refresh"
+	ScopePasswordReset  = "password_reset"
+	// Phone verification tokens hold the hash of a 6 digit code texted to the user
+	ScopePhoneVerification = "phone_verification"
 )
 
 // Define a Token struct to hold the data for an individual token. This includes the
@@ -37,6 +54,22 @@ type Token struct {
 	UserID    int64     `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	SessionID int64     `json:"-"` // set for authentication and refresh tokens
+}
+
+// tokenCacheKey identifies a cached UserModel.GetForToken() lookup. Only the token's
+// hash is kept, never the plaintext.
+type tokenCacheKey struct {
+	scope string
+	hash  [sha256.Size]byte
+}
+
+// forgetUserTokens() drops every cached token lookup for the user in the given scope. An
+// empty scope drops the lookups for every scope.
+func forgetUserTokens(tokenCache *cache.Cache[tokenCacheKey, User], userID int64, scope string) {
+	tokenCache.DeleteFunc(func(key tokenCacheKey, user User) bool {
+		return user.ID == userID && (scope == "" || key.scope == scope)
+	})
 }
 
 // Check that the plaintext token has been provided and is exactly 26 bytes long.
@@ -86,16 +119,45 @@ func (m TokenModel) Insert(api_key *Token) error {
 	// create our timeout context. All of them will just be 5 seconds
 	ctx, cancel := contextGenerator(context.Background(), DefaultTokenDBContextTimeout)
 	defer cancel()
-	_, err := m.DB.CreateNewToken(ctx, database.CreateNewTokenParams{
-		Hash:   api_key.Hash,
-		UserID: api_key.UserID,
-		Expiry: api_key.Expiry,
-		Scope:  api_key.Scope,
+	return insertTokenTx(ctx, m.DB, api_key)
+}
+
+// insertTokenTx() saves a token using the given queries, which may be bound to a transaction.
+func insertTokenTx(ctx context.Context, qtx *database.Queries, token *Token) error {
+	_, err := qtx.CreateNewToken(ctx, database.CreateNewTokenParams{
+		Hash:      token.Hash,
+		UserID:    token.UserID,
+		Expiry:    token.Expiry,
+		Scope:     token.Scope,
+		SessionID: sql.NullInt64{Int64: token.SessionID, Valid: token.SessionID != 0},
 	})
 	return err
 }
 
-// DeleteAllForUser() deletes all tokens for a specific user and scope.
+// DeleteExpired() deletes every expired token, batchSize tokens at a time, and returns how
+// many were deleted. Used refresh tokens are kept until they expire, so they go too.
+func (m TokenModel) DeleteExpired(batchSize int) (int64, error) {
+	var deleted int64
+	now := time.Now()
+	for {
+		ctx, cancel := contextGenerator(context.Background(), DefaultTokenDBContextTimeout)
+		count, err := m.DB.DeleteExpiredTokens(ctx, database.DeleteExpiredTokensParams{
+			Expiry: now,
+			Limit:  int32(batchSize),
+		})
+		cancel()
+		if err != nil {
+			return deleted, err
+		}
+		deleted += count
+		if count < int64(batchSize) {
+			return deleted, nil
+		}
+	}
+}
+
+// DeleteAllForUser() deletes all tokens for a specific user and scope, and forgets any
+// cached lookups of them so they stop working straight away.
 func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	// create our timeout context. All of them will just be 5 seconds
 	ctx, cancel := contextGenerator(context.Background(), DefaultTokenDBContextTimeout)
@@ -104,5 +166,9 @@ func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
 		UserID: userID,
 		Scope:  scope,
 	})
-	return err
+	if err != nil {
+		return err
+	}
+	forgetUserTokens(m.TokenCache, userID, scope)
+	return nil
 }
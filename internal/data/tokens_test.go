@@ -0,0 +1,104 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTokenLookupsAreCachedUntilDeleted(t *testing.T) {
+	db := openTestDB(t)
+	models := NewModels(db, time.Minute)
+	userID := seedTestUser(t, db)
+
+	token, err := models.Tokens.New(userID, time.Hour, ScopeAuthentication)
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+
+	user, err := models.Users.GetForToken(ScopeAuthentication, token.Plaintext)
+	if err != nil {
+		t.Fatalf("Failed to get user for token: %v", err)
+	}
+	// Changing the returned user must not change what is cached
+	user.FirstName = "Changed"
+	cachedUser, err := models.Users.GetForToken(ScopeAuthentication, token.Plaintext)
+	if err != nil {
+		t.Fatalf("Failed to get user for token: %v", err)
+	}
+	if models.Users.TokenCache.Hits() != 1 {
+		t.Errorf("Expected the second lookup to be cached, got %d hits", models.Users.TokenCache.Hits())
+	}
+	if cachedUser.ID != userID || cachedUser.FirstName != "Test" {
+		t.Errorf("Unexpected cached user: %+v", cachedUser)
+	}
+
+	// Logging out deletes the tokens, which must stop working straight away
+	if err := models.Tokens.DeleteAllForUser(ScopeAuthentication, userID); err != nil {
+		t.Fatalf("Failed to delete tokens: %v", err)
+	}
+	if _, err := models.Users.GetForToken(ScopeAuthentication, token.Plaintext); !errors.Is(err, ErrGeneralRecordNotFound) {
+		t.Errorf("Expected ErrGeneralRecordNotFound after deleting the tokens, got %v", err)
+	}
+}
+
+func TestCachedTokensStopWorkingWhenTheyExpire(t *testing.T) {
+	db := openTestDB(t)
+	models := NewModels(db, time.Hour)
+	userID := seedTestUser(t, db)
+
+	// the token expires long before the cache entry would
+	token, err := models.Tokens.New(userID, 2*time.Second, ScopeAuthentication)
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	if _, err := models.Users.GetForToken(ScopeAuthentication, token.Plaintext); err != nil {
+		t.Fatalf("Failed to get user for token: %v", err)
+	}
+
+	time.Sleep(time.Until(token.Expiry) + 100*time.Millisecond)
+	if _, err := models.Users.GetForToken(ScopeAuthentication, token.Plaintext); !errors.Is(err, ErrGeneralRecordNotFound) {
+		t.Errorf("Expected ErrGeneralRecordNotFound once the token expired, got %v", err)
+	}
+	if models.Users.TokenCache.Hits() != 0 {
+		t.Errorf("Expected the expired token not to be answered from the cache, got %d hits", models.Users.TokenCache.Hits())
+	}
+}
+
+func TestDeleteExpiredTokens(t *testing.T) {
+	db := openTestDB(t)
+	models := NewModels(db, 0)
+	userID := seedTestUser(t, db)
+
+	var expired []*Token
+	for range 3 {
+		token, err := models.Tokens.New(userID, -time.Minute, ScopeActivation)
+		if err != nil {
+			t.Fatalf("Failed to create token: %v", err)
+		}
+		expired = append(expired, token)
+	}
+	valid, err := models.Tokens.New(userID, time.Hour, ScopeActivation)
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+
+	// A batch smaller than the number of expired tokens still deletes them all
+	deleted, err := models.Tokens.DeleteExpired(2)
+	if err != nil {
+		t.Fatalf("Failed to delete expired tokens: %v", err)
+	}
+	if deleted < int64(len(expired)) {
+		t.Errorf("Expected at least %d tokens to be deleted, got %d", len(expired), deleted)
+	}
+	var remaining int
+	if err := db.QueryRow(`SELECT count(*) FROM tokens WHERE user_id = $1`, userID).Scan(&remaining); err != nil {
+		t.Fatalf("Failed to count tokens: %v", err)
+	}
+	if remaining != 1 {
+		t.Errorf("Expected only the valid token to be left, got %d tokens", remaining)
+	}
+	if _, err := models.Users.GetForToken(ScopeActivation, valid.Plaintext); err != nil {
+		t.Errorf("Expected the valid token to still work, got %v", err)
+	}
+}
@@ -0,0 +1,212 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/cache"
+	"github.com/Blue-Davinci/SavannaCart/internal/database"
+)
+
+var (
+	ErrDuplicateUserIdentity = errors.New("provider account is already linked to a user")
+	ErrLastUserIdentity      = errors.New("cannot unlink the only way a user can sign in")
+)
+
+// UserIdentityModel links users to the accounts they sign in with. One user can sign in
+// through several OIDC providers, each identified by its (provider, subject) pair.
+type UserIdentityModel struct {
+	DB         *database.Queries
+	Conn       *sql.DB                           // signing up creates the user and their identity together
+	TokenCache *cache.Cache[tokenCacheKey, User] // shared with UserModel, cleared when an unactivated user's tokens are dropped
+}
+
+// UserIdentity is a provider account linked to a user
+type UserIdentity struct {
+	ID          int64     `json:"id"`
+	UserID      int64     `json:"-"`
+	Provider    string    `json:"provider"`
+	Subject     string    `json:"-"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+// GetForSubject() returns the identity a provider's subject is linked to, or
+// ErrGeneralRecordNotFound if it isn't linked to anyone yet.
+func (m UserIdentityModel) GetForSubject(provider, subject string) (*UserIdentity, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultUserDBContextTimeout)
+	defer cancel()
+
+	identity, err := m.DB.GetUserIdentity(ctx, database.GetUserIdentityParams{
+		Provider: provider,
+		Subject:  subject,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrGeneralRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return populateUserIdentity(identity), nil
+}
+
+// GetAllForUser() returns every provider linked to the user, oldest first.
+func (m UserIdentityModel) GetAllForUser(userID int64) ([]*UserIdentity, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultUserDBContextTimeout)
+	defer cancel()
+
+	rows, err := m.DB.GetUserIdentitiesForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	identities := []*UserIdentity{}
+	for _, row := range rows {
+		identities = append(identities, populateUserIdentity(row))
+	}
+	return identities, nil
+}
+
+// Link() links a provider account to an existing user. Accounts that are already linked,
+// to this or any other user, return ErrDuplicateUserIdentity.
+func (m UserIdentityModel) Link(userID int64, provider string, claims *OAuthClaims) (*UserIdentity, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultUserDBContextTimeout)
+	defer cancel()
+
+	return createUserIdentity(ctx, m.DB, userID, provider, claims)
+}
+
+// LinkUnactivated() links a provider account with a verified email to the never activated
+// user with that email. Anyone can sign up with an email they don't own, so whatever the
+// person who signed up chose is thrown away: the password and every token issued for the
+// account, including the activation link that was emailed. Otherwise the activation link
+// would hand the owner of the email an account that the password still signs into.
+func (m UserIdentityModel) LinkUnactivated(user *User, provider string, claims *OAuthClaims) (*UserIdentity, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultUserDBContextTimeout)
+	defer cancel()
+
+	var identity *UserIdentity
+	err := withTransaction(ctx, m.Conn, func(qtx *database.Queries) error {
+		var err error
+		identity, err = createUserIdentity(ctx, qtx, user.ID, provider, claims)
+		if err != nil {
+			return err
+		}
+		err = qtx.ClearUserPassword(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		return qtx.DeleteTokensForUser(ctx, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	forgetUserTokens(m.TokenCache, user.ID, "")
+	user.Password = password{}
+	user.Version++
+	return identity, nil
+}
+
+// CreateUser() signs up a new user together with the provider account they signed up with.
+func (m UserIdentityModel) CreateUser(user *User, provider string, claims *OAuthClaims) (*UserIdentity, error) {
+	ctx, cancel := contextGenerator(context.Background(), DefaultUserDBContextTimeout)
+	defer cancel()
+
+	var identity *UserIdentity
+	err := withTransaction(ctx, m.Conn, func(qtx *database.Queries) error {
+		err := createUser(ctx, qtx, user)
+		if err != nil {
+			return err
+		}
+		identity, err = createUserIdentity(ctx, qtx, user.ID, provider, claims)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// createUserIdentity() inserts the identity with the given queries, so it can also be used
+// inside a transaction.
+func createUserIdentity(ctx context.Context, q *database.Queries, userID int64, provider string, claims *OAuthClaims) (*UserIdentity, error) {
+	identity, err := q.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		UserID:   userID,
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "duplicate key"):
+			return nil, ErrDuplicateUserIdentity
+		default:
+			return nil, err
+		}
+	}
+	return populateUserIdentity(identity), nil
+}
+
+// RecordLogin() notes that the identity was just used to sign in, keeping the email the
+// provider reported.
+func (m UserIdentityModel) RecordLogin(identityID int64, email string) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultUserDBContextTimeout)
+	defer cancel()
+
+	return m.DB.TouchUserIdentity(ctx, database.TouchUserIdentityParams{
+		ID:    identityID,
+		Email: email,
+	})
+}
+
+// Unlink() removes a provider from the user's account. Identities that don't exist or belong
+// to someone else return ErrGeneralRecordNotFound. The last identity of a user without a
+// password can't be removed as they would no longer be able to sign in, that returns
+// ErrLastUserIdentity.
+func (m UserIdentityModel) Unlink(userID, identityID int64) error {
+	ctx, cancel := contextGenerator(context.Background(), DefaultUserDBContextTimeout)
+	defer cancel()
+
+	return withTransaction(ctx, m.Conn, func(qtx *database.Queries) error {
+		// lock the user's identities so two unlinks can't remove the last two together
+		identityIDs, err := qtx.LockUserIdentitiesForUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(identityIDs, identityID) {
+			return ErrGeneralRecordNotFound
+		}
+		if len(identityIDs) == 1 {
+			user, err := qtx.GetUserByID(ctx, userID)
+			if err != nil {
+				return err
+			}
+			if len(user.Password) == 0 {
+				return ErrLastUserIdentity
+			}
+		}
+		return qtx.DeleteUserIdentity(ctx, database.DeleteUserIdentityParams{
+			ID:     identityID,
+			UserID: userID,
+		})
+	})
+}
+
+// populateUserIdentity() converts a database identity into a UserIdentity
+func populateUserIdentity(identity database.UserIdentity) *UserIdentity {
+	return &UserIdentity{
+		ID:          identity.ID,
+		UserID:      identity.UserID,
+		Provider:    identity.Provider,
+		Subject:     identity.Subject,
+		Email:       identity.Email,
+		CreatedAt:   identity.CreatedAt,
+		LastLoginAt: identity.LastLoginAt,
+	}
+}
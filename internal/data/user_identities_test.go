@@ -0,0 +1,173 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestUserIdentitiesLinkSeveralProviders(t *testing.T) {
+	db := openTestDB(t)
+	models := NewModels(db, 0)
+
+	suffix := fmt.Sprintf("%d", time.Now().UnixNano())
+	claims := &OAuthClaims{Subject: "google-" + suffix, Email: "identities_" + suffix + "@example.com", EmailVerified: true}
+	user := &User{
+		FirstName:        "Jane",
+		LastName:         "Doe",
+		Email:            claims.Email,
+		ProfileAvatarURL: "https://example.com/avatar.png",
+		OIDCSubject:      claims.Subject,
+	}
+	if _, err := models.Identities.CreateUser(user, "google", claims); err != nil {
+		t.Fatalf("Failed to sign up user: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM users WHERE id = $1`, user.ID)
+	})
+
+	// The same subject at another provider is a different account
+	microsoftClaims := &OAuthClaims{Subject: claims.Subject, Email: "jane_" + suffix + "@corp.example"}
+	microsoft, err := models.Identities.Link(user.ID, "microsoft", microsoftClaims)
+	if err != nil {
+		t.Fatalf("Failed to link microsoft: %v", err)
+	}
+	if _, err := models.Identities.Link(user.ID, "microsoft", microsoftClaims); !errors.Is(err, ErrDuplicateUserIdentity) {
+		t.Errorf("Expected ErrDuplicateUserIdentity when linking twice, got %v", err)
+	}
+
+	for _, provider := range []string{"google", "microsoft"} {
+		identity, err := models.Identities.GetForSubject(provider, claims.Subject)
+		if err != nil {
+			t.Fatalf("Failed to get %s identity: %v", provider, err)
+		}
+		if identity.UserID != user.ID {
+			t.Errorf("Expected the %s identity to belong to user %d, got %d", provider, user.ID, identity.UserID)
+		}
+	}
+	if _, err := models.Identities.GetForSubject("keycloak", claims.Subject); !errors.Is(err, ErrGeneralRecordNotFound) {
+		t.Errorf("Expected ErrGeneralRecordNotFound for an unlinked provider, got %v", err)
+	}
+
+	if err := models.Identities.Unlink(user.ID+1, microsoft.ID); !errors.Is(err, ErrGeneralRecordNotFound) {
+		t.Errorf("Expected ErrGeneralRecordNotFound for someone else's identity, got %v", err)
+	}
+	if err := models.Identities.Unlink(user.ID, microsoft.ID); err != nil {
+		t.Fatalf("Failed to unlink microsoft: %v", err)
+	}
+	identities, err := models.Identities.GetAllForUser(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to list identities: %v", err)
+	}
+	if len(identities) != 1 || identities[0].Provider != "google" {
+		t.Fatalf("Expected only the google identity to be left, got %+v", identities)
+	}
+	if err := models.Identities.Unlink(user.ID, identities[0].ID); !errors.Is(err, ErrLastUserIdentity) {
+		t.Errorf("Expected ErrLastUserIdentity when unlinking the last provider, got %v", err)
+	}
+}
+
+func TestUserIdentitiesSignUpRollsBackOnDuplicateIdentity(t *testing.T) {
+	db := openTestDB(t)
+	models := NewModels(db, 0)
+	userID := seedTestUser(t, db)
+
+	suffix := fmt.Sprintf("%d", time.Now().UnixNano())
+	claims := &OAuthClaims{Subject: "taken-" + suffix, Email: "taken_" + suffix + "@example.com"}
+	if _, err := models.Identities.Link(userID, "google", claims); err != nil {
+		t.Fatalf("Failed to link identity: %v", err)
+	}
+
+	user := &User{FirstName: "Jo", LastName: "Doe", Email: claims.Email, ProfileAvatarURL: "https://example.com/a.png"}
+	if err := user.Password.Set("password"); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	if _, err := models.Identities.CreateUser(user, "google", claims); !errors.Is(err, ErrDuplicateUserIdentity) {
+		t.Fatalf("Expected ErrDuplicateUserIdentity, got %v", err)
+	}
+	if _, err := models.Users.GetByEmail(claims.Email, ""); !errors.Is(err, ErrGeneralRecordNotFound) {
+		t.Errorf("Expected the user not to be created, got %v", err)
+	}
+}
+
+func TestUserIdentitiesUnlinkLastWithPassword(t *testing.T) {
+	db := openTestDB(t)
+	models := NewModels(db, 0)
+	userID := seedTestUser(t, db)
+
+	suffix := fmt.Sprintf("%d", time.Now().UnixNano())
+	identity, err := models.Identities.Link(userID, "google", &OAuthClaims{Subject: "only-" + suffix, Email: "only_" + suffix + "@example.com"})
+	if err != nil {
+		t.Fatalf("Failed to link identity: %v", err)
+	}
+	if err := models.Identities.Unlink(userID, identity.ID); !errors.Is(err, ErrLastUserIdentity) {
+		t.Fatalf("Expected ErrLastUserIdentity without a password, got %v", err)
+	}
+
+	// Once the user has a password they can still sign in without any provider
+	user, err := models.Users.GetUserByID(userID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if err := user.Password.Set("correct horse battery"); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	if err := models.Users.UpdateUser(user); err != nil {
+		t.Fatalf("Failed to update user: %v", err)
+	}
+	if err := models.Identities.Unlink(userID, identity.ID); err != nil {
+		t.Errorf("Expected the last provider to be unlinked, got %v", err)
+	}
+}
+
+func TestUserIdentitiesLinkUnactivatedDropsPasswordAndTokens(t *testing.T) {
+	db := openTestDB(t)
+	models := NewModels(db, 0)
+
+	// someone signs up with an email they don't own and a password of their choosing
+	suffix := fmt.Sprintf("%d", time.Now().UnixNano())
+	claims := &OAuthClaims{Subject: "owner-" + suffix, Email: "preclaimed_" + suffix + "@example.com", EmailVerified: true}
+	user := &User{FirstName: "Mallory", LastName: "Doe", Email: claims.Email, RoleLevel: "user"}
+	if err := user.Password.Set("mallorys password"); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	if err := models.Users.CreateNewUser(user); err != nil {
+		t.Fatalf("Failed to sign up user: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM users WHERE id = $1`, user.ID)
+	})
+	activation, err := models.Tokens.New(user.ID, time.Hour, ScopeActivation)
+	if err != nil {
+		t.Fatalf("Failed to create activation token: %v", err)
+	}
+
+	// the owner of the email then signs in with a provider that verified it
+	unactivated, err := models.Users.GetByEmail(claims.Email, "")
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if unactivated.Activated || !unactivated.Password.IsSet() {
+		t.Fatalf("Expected an unactivated user with a password, got %+v", unactivated)
+	}
+	if _, err := models.Identities.LinkUnactivated(unactivated, "google", claims); err != nil {
+		t.Fatalf("Failed to link identity: %v", err)
+	}
+
+	identity, err := models.Identities.GetForSubject("google", claims.Subject)
+	if err != nil || identity.UserID != user.ID {
+		t.Fatalf("Expected the provider account to be linked to user %d, got %+v (%v)", user.ID, identity, err)
+	}
+	linked, err := models.Users.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if linked.Password.IsSet() {
+		t.Error("Expected the password chosen at sign up to be dropped")
+	}
+	// the activation link the sign up emailed must not activate the account any more
+	if _, err := models.Users.GetForToken(ScopeActivation, activation.Plaintext); !errors.Is(err, ErrGeneralRecordNotFound) {
+		t.Errorf("Expected the old activation token to be gone, got %v", err)
+	}
+}
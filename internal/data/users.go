@@ -2,12 +2,15 @@ package data
 
 import (
 	"context"
+	"crypto/md5"
 	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"strings"
 	"time"
 
+	"github.com/Blue-Davinci/SavannaCart/internal/cache"
 	"github.com/Blue-Davinci/SavannaCart/internal/database"
 	"github.com/Blue-Davinci/SavannaCart/internal/validator"
 	"golang.org/x/crypto/bcrypt"
@@ -36,7 +39,8 @@ const (
 )
 */
 type UserModel struct {
-	DB *database.Queries
+	DB         *database.Queries
+	TokenCache *cache.Cache[tokenCacheKey, User] // shared with TokenModel, which invalidates it
 }
 
 type User struct {
@@ -46,6 +50,7 @@ type User struct {
 	Email            string    `json:"email"`
 	ProfileAvatarURL string    `json:"profile_avatar_url"`
 	PhoneNumber      string    `json:"phone_number,omitempty"`
+	PhoneVerified    bool      `json:"phone_verified"` // only verified numbers are sent SMS
 	Password         password  `json:"-"`
 	OIDCSubject      string    `json:"-"`
 	RoleLevel        string    `json:"role_level"`
@@ -83,8 +88,12 @@ func (p *password) Set(plaintextPassword string) error {
 
 // The Matches() method checks whether the provided plaintext password matches the
 // hashed password stored in the struct, returning true if it matches and false
-// otherwise.
+// otherwise. Users who only sign in through an OIDC provider have no password, nothing
+// matches for them.
 func (p *password) Matches(plaintextPassword string) (bool, error) {
+	if !p.IsSet() {
+		return false, nil
+	}
 	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintextPassword))
 	if err != nil {
 		//fmt.Printf(">>>>> Plain text: %s\nHash: %v\n", plaintextPassword, p.hash)
@@ -98,6 +107,11 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 	return true, nil
 }
 
+// IsSet() reports whether the user has a password they can log in with
+func (p *password) IsSet() bool {
+	return len(p.hash) > 0
+}
+
 // OAuthClaims represents the claims extracted from OAuth ID tokens
 type OAuthClaims struct {
 	Email         string `json:"email"`
@@ -191,6 +205,21 @@ func ValidateName(v *validator.Validator, name, keyvalue string) {
 	v.Check(len(name) <= 500, "name", "must not be more than 500 bytes long")
 }
 
+// ValidatePasswordPlaintext() checks a password is long enough to be worth having and
+// short enough for bcrypt, which only looks at the first 72 bytes.
+func ValidatePasswordPlaintext(v *validator.Validator, password string) {
+	v.Check(password != "", "password", "must be provided")
+	v.Check(len(password) >= 8, "password", "must be at least 8 bytes long")
+	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
+}
+
+// GravatarURL() returns the Gravatar image for an email, which is the profile picture of
+// users who didn't sign up through a provider that gave us one.
+func GravatarURL(email string) string {
+	hash := md5.Sum([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return "https://www.gravatar.com/avatar/" + hex.EncodeToString(hash[:]) + "?d=identicon"
+}
+
 // ValidateUser() is a helper function that validates the fields of a User struct.
 // It uses the validator package to check the validity of the user's first name, last name,
 // email, and profile avatar URL.
@@ -209,7 +238,13 @@ func (m UserModel) CreateNewUser(User *User) error {
 	ctx, cancel := contextGenerator(context.Background(), DefaultUserDBContextTimeout)
 	defer cancel()
 
-	createdUser, err := m.DB.CreateNewUser(ctx, database.CreateNewUserParams{
+	return createUser(ctx, m.DB, User)
+}
+
+// createUser() inserts the user with the given queries, so it can also be used inside a
+// transaction, and fills in the fields the database sets.
+func createUser(ctx context.Context, q *database.Queries, User *User) error {
+	createdUser, err := q.CreateNewUser(ctx, database.CreateNewUserParams{
 		FirstName:        User.FirstName,
 		LastName:         User.LastName,
 		Email:            User.Email,
@@ -240,9 +275,16 @@ func (m UserModel) CreateNewUser(User *User) error {
 }
 
 // GetForToken() retrieves the details of a user based on a token, scope, and encryption key.
+// Lookups are cached by the token's hash, so every authenticated request doesn't hit the database.
+// Entries never outlive the token, an expired token stops working even if it is still cached.
 func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
 	// Calculate sha256 hash of plaintext
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	key := tokenCacheKey{scope: tokenScope, hash: tokenHash}
+	// the cache holds copies, so callers are free to modify the user they get back
+	if cachedUser, ok := m.TokenCache.Get(key); ok {
+		return &cachedUser, nil
+	}
 	ctx, cancel := contextGenerator(context.Background(), DefaultUserDBContextTimeout)
 	defer cancel()
 	// get the user
@@ -262,6 +304,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	}
 	// make a user
 	tokenuser := populateUser(user)
+	m.TokenCache.SetUntil(key, *tokenuser, user.Expiry)
 	// fill in the user data
 	return tokenuser, nil
 }
@@ -280,6 +323,7 @@ func (m UserModel) UpdateUser(user *User) error {
 		Email:            user.Email,
 		ProfileAvatarUrl: user.ProfileAvatarURL,
 		PhoneNumber:      sql.NullString{String: user.PhoneNumber, Valid: true},
+		PhoneVerified:    user.PhoneVerified,
 		Password:         user.Password.hash,
 		RoleLevel:        user.RoleLevel,
 		Activated:        user.Activated,
@@ -301,6 +345,8 @@ func (m UserModel) UpdateUser(user *User) error {
 	// fill in the version and update time as well
 	user.Version = updatedUser.Version
 	user.UpdatedAt = updatedUser.UpdatedAt
+	// cached token lookups still hold the old details
+	forgetUserTokens(m.TokenCache, user.ID, "")
 	// we are good
 	return nil
 }
@@ -328,6 +374,7 @@ func populateUser(userRow interface{}) *User {
 			Email:            user.Email,
 			ProfileAvatarURL: user.ProfileAvatarUrl,
 			PhoneNumber:      user.PhoneNumber.String,
+			PhoneVerified:    user.PhoneVerified,
 			Password:         userPassword,
 			OIDCSubject:      user.OidcSub,
 			RoleLevel:        user.RoleLevel,
@@ -348,6 +395,7 @@ func populateUser(userRow interface{}) *User {
 			Email:            user.Email,
 			ProfileAvatarURL: user.ProfileAvatarUrl,
 			PhoneNumber:      user.PhoneNumber.String,
+			PhoneVerified:    user.PhoneVerified,
 			Password:         userPassword,
 			OIDCSubject:      user.OidcSub,
 			RoleLevel:        user.RoleLevel,
@@ -368,6 +416,7 @@ func populateUser(userRow interface{}) *User {
 			Email:            user.Email,
 			ProfileAvatarURL: user.ProfileAvatarUrl,
 			PhoneNumber:      user.PhoneNumber.String,
+			PhoneVerified:    user.PhoneVerified,
 			Password:         userPassword,
 			OIDCSubject:      user.OidcSub,
 			RoleLevel:        user.RoleLevel,
@@ -388,6 +437,7 @@ func populateUser(userRow interface{}) *User {
 			Email:            user.Email,
 			ProfileAvatarURL: user.ProfileAvatarUrl,
 			PhoneNumber:      user.PhoneNumber.String,
+			PhoneVerified:    user.PhoneVerified,
 			Password:         userPassword,
 			OIDCSubject:      user.OidcSub,
 			RoleLevel:        user.RoleLevel,
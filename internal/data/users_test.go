@@ -0,0 +1,69 @@
+package data
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Blue-Davinci/SavannaCart/internal/validator"
+)
+
+func TestValidatePasswordPlaintext(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		valid    bool
+	}{
+		{"valid", "correct horse battery", true},
+		{"exactly 8 bytes", "12345678", true},
+		{"exactly 72 bytes", strings.Repeat("a", 72), true},
+		{"empty", "", false},
+		{"too short", "1234567", false},
+		{"too long for bcrypt", strings.Repeat("a", 73), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidatePasswordPlaintext(v, tt.password)
+			if v.Valid() != tt.valid {
+				t.Errorf("Expected valid=%v, got errors %v", tt.valid, v.Errors)
+			}
+		})
+	}
+}
+
+func TestPasswordMatches(t *testing.T) {
+	var p password
+	if p.IsSet() {
+		t.Error("Expected a new password not to be set")
+	}
+	// Users who sign in through a provider have no password, nothing may match it
+	for _, attempt := range []string{"", "oauth_user_12345"} {
+		if match, err := p.Matches(attempt); match || err != nil {
+			t.Errorf("Expected %q not to match an unset password, got %v, %v", attempt, match, err)
+		}
+	}
+
+	if err := p.Set("correct horse battery"); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	if !p.IsSet() {
+		t.Error("Expected the password to be set")
+	}
+	if match, err := p.Matches("correct horse battery"); !match || err != nil {
+		t.Errorf("Expected the password to match, got %v, %v", match, err)
+	}
+	if match, err := p.Matches("wrong horse battery"); match || err != nil {
+		t.Errorf("Expected a wrong password not to match, got %v, %v", match, err)
+	}
+}
+
+func TestGravatarURL(t *testing.T) {
+	// The example from Gravatar's documentation, emails are trimmed and lowercased first
+	expected := "https://www.gravatar.com/avatar/0bc83cb571cd1c50ba6f3e8a78ef1346?d=identicon"
+	for _, email := range []string{"MyEmailAddress@example.com ", "myemailaddress@example.com"} {
+		if got := GravatarURL(email); got != expected {
+			t.Errorf("GravatarURL(%q) = %q, expected %q", email, got, expected)
+		}
+	}
+}
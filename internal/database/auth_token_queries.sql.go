@@ -12,16 +12,17 @@ import (
 )
 
 const createNewToken = `-- name: CreateNewToken :one
-INSERT INTO tokens (hash, user_id, expiry, scope)
-VALUES ($1, $2, $3, $4)
+INSERT INTO tokens (hash, user_id, expiry, scope, session_id)
+VALUES ($1, $2, $3, $4, $5)
 RETURNING user_id
 `
 
 type CreateNewTokenParams struct {
-	Hash   []byte
-	UserID int64
-	Expiry time.Time
-	Scope  string
+	Hash      []byte
+	UserID    int64
+	Expiry    time.Time
+	Scope     string
+	SessionID sql.NullInt64
 }
 
 func (q *Queries) CreateNewToken(ctx context.Context, arg CreateNewTokenParams) (int64, error) {
@@ -30,6 +31,7 @@ func (q *Queries) CreateNewToken(ctx context.Context, arg CreateNewTokenParams)
 		arg.UserID,
 		arg.Expiry,
 		arg.Scope,
+		arg.SessionID,
 	)
 	var user_id int64
 	err := row.Scan(&user_id)
@@ -51,6 +53,64 @@ func (q *Queries) DeletAllTokensForUser(ctx context.Context, arg DeletAllTokensF
 	return err
 }
 
+const deleteAllTokensForSession = `-- name: DeleteAllTokensForSession :exec
+DELETE FROM tokens
+WHERE session_id = $1
+`
+
+func (q *Queries) DeleteAllTokensForSession(ctx context.Context, sessionID sql.NullInt64) error {
+	_, err := q.db.ExecContext(ctx, deleteAllTokensForSession, sessionID)
+	return err
+}
+
+const deleteExpiredTokens = `-- name: DeleteExpiredTokens :execrows
+DELETE FROM tokens
+WHERE hash IN (
+    SELECT hash
+    FROM tokens
+    WHERE expiry <= $1
+    LIMIT $2
+)
+`
+
+type DeleteExpiredTokensParams struct {
+	Expiry time.Time
+	Limit  int32
+}
+
+func (q *Queries) DeleteExpiredTokens(ctx context.Context, arg DeleteExpiredTokensParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteExpiredTokens, arg.Expiry, arg.Limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteTokensForSession = `-- name: DeleteTokensForSession :exec
+DELETE FROM tokens
+WHERE session_id = $1 AND scope = $2
+`
+
+type DeleteTokensForSessionParams struct {
+	SessionID sql.NullInt64
+	Scope     string
+}
+
+func (q *Queries) DeleteTokensForSession(ctx context.Context, arg DeleteTokensForSessionParams) error {
+	_, err := q.db.ExecContext(ctx, deleteTokensForSession, arg.SessionID, arg.Scope)
+	return err
+}
+
+const deleteTokensForUser = `-- name: DeleteTokensForUser :exec
+DELETE FROM tokens
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteTokensForUser(ctx context.Context, userID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteTokensForUser, userID)
+	return err
+}
+
 const getForToken = `-- name: GetForToken :one
 SELECT
     users.id,
@@ -60,13 +120,15 @@ SELECT
     users.profile_avatar_url,
     users.password,
     users.phone_number,
+    users.phone_verified,
     users.oidc_sub,
     users.role_level,
     users.activated,
     users.version,
     users.created_at,
     users.updated_at,
-    users.last_login
+    users.last_login,
+    tokens.expiry
 FROM users
 INNER JOIN tokens
 ON users.id = tokens.user_id
@@ -89,6 +151,7 @@ type GetForTokenRow struct {
 	ProfileAvatarUrl string
 	Password         []byte
 	PhoneNumber      sql.NullString
+	PhoneVerified    bool
 	OidcSub          string
 	RoleLevel        string
 	Activated        bool
@@ -96,6 +159,7 @@ type GetForTokenRow struct {
 	CreatedAt        time.Time
 	UpdatedAt        time.Time
 	LastLogin        time.Time
+	Expiry           time.Time
 }
 
 func (q *Queries) GetForToken(ctx context.Context, arg GetForTokenParams) (GetForTokenRow, error) {
@@ -109,6 +173,7 @@ func (q *Queries) GetForToken(ctx context.Context, arg GetForTokenParams) (GetFo
 		&i.ProfileAvatarUrl,
 		&i.Password,
 		&i.PhoneNumber,
+		&i.PhoneVerified,
 		&i.OidcSub,
 		&i.RoleLevel,
 		&i.Activated,
@@ -116,6 +181,86 @@ func (q *Queries) GetForToken(ctx context.Context, arg GetForTokenParams) (GetFo
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.LastLogin,
+		&i.Expiry,
+	)
+	return i, err
+}
+
+const getRefreshTokenForUpdate = `-- name: GetRefreshTokenForUpdate :one
+SELECT
+    tokens.user_id,
+    tokens.session_id,
+    tokens.expiry,
+    tokens.used_at,
+    sessions.revoked_at
+FROM tokens
+INNER JOIN sessions
+ON sessions.id = tokens.session_id
+WHERE tokens.hash = $1
+AND tokens.scope = $2
+FOR UPDATE OF tokens
+`
+
+type GetRefreshTokenForUpdateParams struct {
+	Hash  []byte
+	Scope string
+}
+
+type GetRefreshTokenForUpdateRow struct {
+	UserID    int64
+	SessionID sql.NullInt64
+	Expiry    time.Time
+	UsedAt    sql.NullTime
+	RevokedAt sql.NullTime
+}
+
+func (q *Queries) GetRefreshTokenForUpdate(ctx context.Context, arg GetRefreshTokenForUpdateParams) (GetRefreshTokenForUpdateRow, error) {
+	row := q.db.QueryRowContext(ctx, getRefreshTokenForUpdate, arg.Hash, arg.Scope)
+	var i GetRefreshTokenForUpdateRow
+	err := row.Scan(
+		&i.UserID,
+		&i.SessionID,
+		&i.Expiry,
+		&i.UsedAt,
+		&i.RevokedAt,
 	)
 	return i, err
 }
+
+const incrementTokenAttempts = `-- name: IncrementTokenAttempts :one
+UPDATE tokens
+SET attempts = attempts + 1
+WHERE user_id = $1
+AND scope = $2
+AND expiry > $3
+RETURNING hash, attempts
+`
+
+type IncrementTokenAttemptsParams struct {
+	UserID int64
+	Scope  string
+	Expiry time.Time
+}
+
+type IncrementTokenAttemptsRow struct {
+	Hash     []byte
+	Attempts int32
+}
+
+func (q *Queries) IncrementTokenAttempts(ctx context.Context, arg IncrementTokenAttemptsParams) (IncrementTokenAttemptsRow, error) {
+	row := q.db.QueryRowContext(ctx, incrementTokenAttempts, arg.UserID, arg.Scope, arg.Expiry)
+	var i IncrementTokenAttemptsRow
+	err := row.Scan(&i.Hash, &i.Attempts)
+	return i, err
+}
+
+const markTokenUsed = `-- name: MarkTokenUsed :exec
+UPDATE tokens
+SET used_at = NOW()
+WHERE hash = $1
+`
+
+func (q *Queries) MarkTokenUsed(ctx context.Context, hash []byte) error {
+	_, err := q.db.ExecContext(ctx, markTokenUsed, hash)
+	return err
+}
@@ -111,6 +111,63 @@ func (q *Queries) GetAllCategories(ctx context.Context, arg GetAllCategoriesPara
 	return items, nil
 }
 
+const getCategoryAncestors = `-- name: GetCategoryAncestors :many
+WITH RECURSIVE ancestors AS (
+    -- Base case: start with the given category
+    SELECT c.id, c.name, c.parent_id, c.version, c.created_at, c.updated_at
+    FROM categories c
+    WHERE c.id = $1
+
+    UNION
+
+    -- Recursive case: get the parent of every category we have
+    SELECT c.id, c.name, c.parent_id, c.version, c.created_at, c.updated_at
+    FROM categories c
+    INNER JOIN ancestors a ON c.id = a.parent_id
+)
+SELECT id, name, parent_id, version, created_at, updated_at
+FROM ancestors
+`
+
+type GetCategoryAncestorsRow struct {
+	ID        int32
+	Name      string
+	ParentID  sql.NullInt32
+	Version   int32
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (q *Queries) GetCategoryAncestors(ctx context.Context, id int32) ([]GetCategoryAncestorsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getCategoryAncestors, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetCategoryAncestorsRow
+	for rows.Next() {
+		var i GetCategoryAncestorsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.ParentID,
+			&i.Version,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getCategoryAveragePrice = `-- name: GetCategoryAveragePrice :one
 WITH RECURSIVE category_tree AS (
     -- Base case: start with the given category
@@ -173,6 +230,84 @@ func (q *Queries) GetCategoryById(ctx context.Context, arg GetCategoryByIdParams
 	return i, err
 }
 
+const getCategoryTree = `-- name: GetCategoryTree :many
+SELECT
+    id,
+    name,
+    parent_id,
+    version,
+    created_at,
+    updated_at
+FROM categories
+ORDER BY name, id
+`
+
+func (q *Queries) GetCategoryTree(ctx context.Context) ([]Category, error) {
+	rows, err := q.db.QueryContext(ctx, getCategoryTree)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Category
+	for rows.Next() {
+		var i Category
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.ParentID,
+			&i.Version,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const isCategoryInSubtree = `-- name: IsCategoryInSubtree :one
+WITH RECURSIVE category_tree AS (
+    SELECT c.id FROM categories c WHERE c.id = $1::integer
+
+    UNION
+
+    SELECT c.id
+    FROM categories c
+    INNER JOIN category_tree ct ON c.parent_id = ct.id
+)
+SELECT EXISTS (
+    SELECT 1 FROM category_tree WHERE id = $2::integer
+)::boolean AS in_subtree
+`
+
+type IsCategoryInSubtreeParams struct {
+	Column1 int32
+	Column2 int32
+}
+
+func (q *Queries) IsCategoryInSubtree(ctx context.Context, arg IsCategoryInSubtreeParams) (bool, error) {
+	row := q.db.QueryRowContext(ctx, isCategoryInSubtree, arg.Column1, arg.Column2)
+	var in_subtree bool
+	err := row.Scan(&in_subtree)
+	return in_subtree, err
+}
+
+const lockCategoryMoves = `-- name: LockCategoryMoves :exec
+SELECT pg_advisory_xact_lock(hashtext('categories_parent_id'))
+`
+
+func (q *Queries) LockCategoryMoves(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, lockCategoryMoves)
+	return err
+}
+
 const updateCategory = `-- name: UpdateCategory :one
 UPDATE categories
 SET
@@ -6,9 +6,43 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 )
 
+type ApiKey struct {
+	ID         int64
+	UserID     int64
+	Name       string
+	Prefix     string
+	Hash       []byte
+	CreatedAt  time.Time
+	LastUsedAt sql.NullTime
+	Expiry     time.Time
+	RevokedAt  sql.NullTime
+}
+
+type ApiKeysPermission struct {
+	ApiKeyID     int64
+	PermissionID int64
+}
+
+type Cart struct {
+	ID        int32
+	UserID    int32
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type CartItem struct {
+	ID        int32
+	CartID    int32
+	ProductID int32
+	Quantity  int32
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
 type Category struct {
 	ID        int32
 	Name      string
@@ -18,6 +52,42 @@ type Category struct {
 	UpdatedAt time.Time
 }
 
+type NotificationPreference struct {
+	UserID           int64
+	EmailOrderPlaced bool
+	EmailOrderStatus bool
+	EmailMarketing   bool
+	SmsOrderPlaced   bool
+	SmsOrderStatus   bool
+	SmsMarketing     bool
+	UpdatedAt        time.Time
+	Language         string
+}
+
+type NotificationsOutbox struct {
+	ID             int64
+	IdempotencyKey string
+	Kind           string
+	Payload        json.RawMessage
+	Status         string
+	Attempts       int32
+	MaxAttempts    int32
+	NextAttemptAt  time.Time
+	LastError      string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	SentAt         sql.NullTime
+}
+
+type OauthState struct {
+	StateHash    []byte
+	CodeVerifier string
+	Expiry       time.Time
+	CreatedAt    time.Time
+	Provider     string
+	LinkUserID   sql.NullInt64
+}
+
 type Order struct {
 	ID        int32
 	UserID    int32
@@ -37,11 +107,46 @@ type OrderItem struct {
 	CreatedAt    time.Time
 }
 
+type OrderStatusHistory struct {
+	ID         int32
+	OrderID    int32
+	FromStatus sql.NullString
+	ToStatus   string
+	ChangedBy  sql.NullInt32
+	Note       string
+	CreatedAt  time.Time
+}
+
+type Payment struct {
+	ID                 int32
+	OrderID            int32
+	Provider           string
+	PhoneNumber        string
+	AmountKes          string
+	Status             string
+	MerchantRequestID  sql.NullString
+	CheckoutRequestID  sql.NullString
+	MpesaReceiptNumber sql.NullString
+	ResultCode         sql.NullInt32
+	ResultDesc         sql.NullString
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+}
+
 type Permission struct {
 	ID   int64
 	Code string
 }
 
+type PermissionAuditLog struct {
+	ID             int64
+	ActorID        sql.NullInt64
+	UserID         sql.NullInt64
+	Action         string
+	PermissionCode string
+	CreatedAt      time.Time
+}
+
 type Product struct {
 	ID            int32
 	Name          string
@@ -54,11 +159,49 @@ type Product struct {
 	UpdatedAt     time.Time
 }
 
+type ProductStockAdjustment struct {
+	ID               int32
+	ProductID        int32
+	AdjustedBy       sql.NullInt32
+	QuantityChange   int32
+	PreviousQuantity int32
+	NewQuantity      int32
+	Reason           string
+	CreatedAt        time.Time
+}
+
+type Session struct {
+	ID         int64
+	UserID     int64
+	Device     string
+	UserAgent  string
+	IpAddress  string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	Expiry     time.Time
+	RevokedAt  sql.NullTime
+}
+
 type Token struct {
-	Hash   []byte
-	UserID int64
-	Expiry time.Time
-	Scope  string
+	Hash      []byte
+	UserID    int64
+	Expiry    time.Time
+	Scope     string
+	SessionID sql.NullInt64
+	UsedAt    sql.NullTime
+	Attempts  int32
+}
+
+type UnmatchedPaymentCallback struct {
+	ID                 int64
+	CheckoutRequestID  string
+	MerchantRequestID  string
+	ResultCode         int32
+	ResultDesc         string
+	AmountKes          string
+	MpesaReceiptNumber string
+	PhoneNumber        string
+	CreatedAt          time.Time
 }
 
 type User struct {
@@ -76,6 +219,17 @@ type User struct {
 	UpdatedAt        time.Time
 	LastLogin        time.Time
 	PhoneNumber      sql.NullString
+	PhoneVerified    bool
+}
+
+type UserIdentity struct {
+	ID          int64
+	UserID      int64
+	Provider    string
+	Subject     string
+	Email       string
+	CreatedAt   time.Time
+	LastLoginAt time.Time
 }
 
 type UsersPermission struct {
@@ -115,6 +115,21 @@ func (q *Queries) CreateOrderItem(ctx context.Context, arg CreateOrderItemParams
 }
 
 const getAllOrdersWithItems = `-- name: GetAllOrdersWithItems :many
+WITH order_page AS (
+    SELECT
+        o.id,
+        o.user_id,
+        o.total_kes,
+        o.status,
+        o.version,
+        o.created_at,
+        o.updated_at
+    FROM orders o
+    WHERE ($1 = '' OR o.status = $1)
+    AND ($2::boolean = FALSE OR (o.created_at, o.id) < ($3::timestamptz, $4::integer))
+    ORDER BY o.created_at DESC, o.id DESC
+    LIMIT $5 OFFSET $6
+)
 SELECT 
     o.id as order_id,
     o.user_id,
@@ -132,18 +147,21 @@ SELECT
     oi.quantity,
     oi.unit_price_kes,
     oi.created_at as item_created_at,
-    count(*) OVER() AS total_count
-FROM orders o
+    (CASE WHEN $2::boolean THEN 0 ELSE (
+        SELECT count(*) FROM orders WHERE $1 = '' OR status = $1
+    ) END)::bigint AS total_count
+FROM order_page o
 INNER JOIN users u ON o.user_id = u.id
 LEFT JOIN order_items oi ON o.id = oi.order_id
 LEFT JOIN products p ON oi.product_id = p.id
-WHERE ($1 = '' OR o.status = $1)
-ORDER BY o.created_at DESC, oi.id ASC
-LIMIT $2 OFFSET $3
+ORDER BY o.created_at DESC, o.id DESC, oi.id ASC
 `
 
 type GetAllOrdersWithItemsParams struct {
 	Column1 interface{}
+	Column2 bool
+	Column3 time.Time
+	Column4 int32
 	Limit   int32
 	Offset  int32
 }
@@ -168,8 +186,18 @@ type GetAllOrdersWithItemsRow struct {
 	TotalCount     int64
 }
 
+// The page is picked from the orders first, so an order is never split across pages and
+// total_count counts orders, then every item of those orders is joined in. Pages after a
+// cursor ($2) aren't counted, their total_count is 0.
 func (q *Queries) GetAllOrdersWithItems(ctx context.Context, arg GetAllOrdersWithItemsParams) ([]GetAllOrdersWithItemsRow, error) {
-	rows, err := q.db.QueryContext(ctx, getAllOrdersWithItems, arg.Column1, arg.Limit, arg.Offset)
+	rows, err := q.db.QueryContext(ctx, getAllOrdersWithItems,
+		arg.Column1,
+		arg.Column2,
+		arg.Column3,
+		arg.Column4,
+		arg.Limit,
+		arg.Offset,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -315,6 +343,73 @@ func (q *Queries) GetOrderByIdWithItems(ctx context.Context, id int32) ([]GetOrd
 	return items, nil
 }
 
+const getOrderForUpdate = `-- name: GetOrderForUpdate :one
+SELECT
+    id,
+    user_id,
+    total_kes,
+    status,
+    version,
+    created_at,
+    updated_at
+FROM orders
+WHERE id = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetOrderForUpdate(ctx context.Context, id int32) (Order, error) {
+	row := q.db.QueryRowContext(ctx, getOrderForUpdate, id)
+	var i Order
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.TotalKes,
+		&i.Status,
+		&i.Version,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getOrderItemQuantities = `-- name: GetOrderItemQuantities :many
+SELECT
+    product_id,
+    SUM(quantity)::int AS quantity
+FROM order_items
+WHERE order_id = $1
+GROUP BY product_id
+ORDER BY product_id ASC
+`
+
+type GetOrderItemQuantitiesRow struct {
+	ProductID int32
+	Quantity  int32
+}
+
+func (q *Queries) GetOrderItemQuantities(ctx context.Context, orderID int32) ([]GetOrderItemQuantitiesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getOrderItemQuantities, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetOrderItemQuantitiesRow
+	for rows.Next() {
+		var i GetOrderItemQuantitiesRow
+		if err := rows.Scan(&i.ProductID, &i.Quantity); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getOrderStatistics = `-- name: GetOrderStatistics :one
 SELECT 
     COUNT(*) as total_orders,
@@ -362,6 +457,21 @@ func (q *Queries) GetOrderStatistics(ctx context.Context, arg GetOrderStatistics
 }
 
 const getUserOrdersWithItems = `-- name: GetUserOrdersWithItems :many
+WITH order_page AS (
+    SELECT
+        o.id,
+        o.user_id,
+        o.total_kes,
+        o.status,
+        o.version,
+        o.created_at,
+        o.updated_at
+    FROM orders o
+    WHERE o.user_id = $1
+    AND ($2::boolean = FALSE OR (o.created_at, o.id) < ($3::timestamptz, $4::integer))
+    ORDER BY o.created_at DESC, o.id DESC
+    LIMIT $5 OFFSET $6
+)
 SELECT 
     o.id as order_id,
     o.user_id,
@@ -376,19 +486,22 @@ SELECT
     oi.quantity,
     oi.unit_price_kes,
     oi.created_at as item_created_at,
-    count(*) OVER() AS total_count
-FROM orders o
+    (CASE WHEN $2::boolean THEN 0 ELSE (
+        SELECT count(*) FROM orders WHERE user_id = $1
+    ) END)::bigint AS total_count
+FROM order_page o
 LEFT JOIN order_items oi ON o.id = oi.order_id
 LEFT JOIN products p ON oi.product_id = p.id
-WHERE o.user_id = $1
-ORDER BY o.created_at DESC, oi.id ASC
-LIMIT $2 OFFSET $3
+ORDER BY o.created_at DESC, o.id DESC, oi.id ASC
 `
 
 type GetUserOrdersWithItemsParams struct {
-	UserID int32
-	Limit  int32
-	Offset int32
+	UserID  int32
+	Column2 bool
+	Column3 time.Time
+	Column4 int32
+	Limit   int32
+	Offset  int32
 }
 
 type GetUserOrdersWithItemsRow struct {
@@ -408,8 +521,17 @@ type GetUserOrdersWithItemsRow struct {
 	TotalCount     int64
 }
 
+// Like GetAllOrdersWithItems, the page is picked from the user's orders before their items
+// are joined in and pages after a cursor aren't counted.
 func (q *Queries) GetUserOrdersWithItems(ctx context.Context, arg GetUserOrdersWithItemsParams) ([]GetUserOrdersWithItemsRow, error) {
-	rows, err := q.db.QueryContext(ctx, getUserOrdersWithItems, arg.UserID, arg.Limit, arg.Offset)
+	rows, err := q.db.QueryContext(ctx, getUserOrdersWithItems,
+		arg.UserID,
+		arg.Column2,
+		arg.Column3,
+		arg.Column4,
+		arg.Limit,
+		arg.Offset,
+	)
 	if err != nil {
 		return nil, err
 	}
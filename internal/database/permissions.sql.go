@@ -7,6 +7,8 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/lib/pq"
 )
@@ -31,6 +33,32 @@ func (q *Queries) AddPermissionsForUser(ctx context.Context, arg AddPermissionsF
 	return i, err
 }
 
+const createPermissionAuditLog = `-- name: CreatePermissionAuditLog :exec
+INSERT INTO permission_audit_log (
+    actor_id,
+    user_id,
+    action,
+    permission_code
+) VALUES ($1, $2, $3, $4)
+`
+
+type CreatePermissionAuditLogParams struct {
+	ActorID        sql.NullInt64
+	UserID         sql.NullInt64
+	Action         string
+	PermissionCode string
+}
+
+func (q *Queries) CreatePermissionAuditLog(ctx context.Context, arg CreatePermissionAuditLogParams) error {
+	_, err := q.db.ExecContext(ctx, createPermissionAuditLog,
+		arg.ActorID,
+		arg.UserID,
+		arg.Action,
+		arg.PermissionCode,
+	)
+	return err
+}
+
 const deletePermissionsForUser = `-- name: DeletePermissionsForUser :one
 DELETE FROM users_permissions
 USING permissions
@@ -165,3 +193,65 @@ func (q *Queries) GetAllSuperUsersWithPermissions(ctx context.Context) ([]GetAll
 	}
 	return items, nil
 }
+
+const getPermissionAuditLog = `-- name: GetPermissionAuditLog :many
+SELECT
+    count(*) OVER() AS total_count,
+    id,
+    actor_id,
+    user_id,
+    action,
+    permission_code,
+    created_at
+FROM permission_audit_log
+WHERE ($1::bigint = 0 OR user_id = $1)
+ORDER BY created_at DESC, id DESC
+LIMIT $2 OFFSET $3
+`
+
+type GetPermissionAuditLogParams struct {
+	Column1 int64
+	Limit   int32
+	Offset  int32
+}
+
+type GetPermissionAuditLogRow struct {
+	TotalCount     int64
+	ID             int64
+	ActorID        sql.NullInt64
+	UserID         sql.NullInt64
+	Action         string
+	PermissionCode string
+	CreatedAt      time.Time
+}
+
+func (q *Queries) GetPermissionAuditLog(ctx context.Context, arg GetPermissionAuditLogParams) ([]GetPermissionAuditLogRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPermissionAuditLog, arg.Column1, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPermissionAuditLogRow
+	for rows.Next() {
+		var i GetPermissionAuditLogRow
+		if err := rows.Scan(
+			&i.TotalCount,
+			&i.ID,
+			&i.ActorID,
+			&i.UserID,
+			&i.Action,
+			&i.PermissionCode,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -55,9 +55,111 @@ func (q *Queries) CreateNewProducts(ctx context.Context, arg CreateNewProductsPa
 	return i, err
 }
 
+const createProductStockAdjustment = `-- name: CreateProductStockAdjustment :one
+INSERT INTO product_stock_adjustments (
+    product_id,
+    adjusted_by,
+    quantity_change,
+    previous_quantity,
+    new_quantity,
+    reason
+) VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, product_id, adjusted_by, quantity_change, previous_quantity, new_quantity, reason, created_at
+`
+
+type CreateProductStockAdjustmentParams struct {
+	ProductID        int32
+	AdjustedBy       sql.NullInt32
+	QuantityChange   int32
+	PreviousQuantity int32
+	NewQuantity      int32
+	Reason           string
+}
+
+func (q *Queries) CreateProductStockAdjustment(ctx context.Context, arg CreateProductStockAdjustmentParams) (ProductStockAdjustment, error) {
+	row := q.db.QueryRowContext(ctx, createProductStockAdjustment,
+		arg.ProductID,
+		arg.AdjustedBy,
+		arg.QuantityChange,
+		arg.PreviousQuantity,
+		arg.NewQuantity,
+		arg.Reason,
+	)
+	var i ProductStockAdjustment
+	err := row.Scan(
+		&i.ID,
+		&i.ProductID,
+		&i.AdjustedBy,
+		&i.QuantityChange,
+		&i.PreviousQuantity,
+		&i.NewQuantity,
+		&i.Reason,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const decrementProductStock = `-- name: DecrementProductStock :one
+UPDATE products
+SET stock_quantity = stock_quantity - $2, updated_at = NOW()
+WHERE id = $1 AND stock_quantity >= $2
+RETURNING stock_quantity
+`
+
+type DecrementProductStockParams struct {
+	ID            int32
+	StockQuantity int32
+}
+
+func (q *Queries) DecrementProductStock(ctx context.Context, arg DecrementProductStockParams) (int32, error) {
+	row := q.db.QueryRowContext(ctx, decrementProductStock, arg.ID, arg.StockQuantity)
+	var stock_quantity int32
+	err := row.Scan(&stock_quantity)
+	return stock_quantity, err
+}
+
+const deleteProduct = `-- name: DeleteProduct :one
+DELETE FROM products
+WHERE id = $1
+RETURNING id
+`
+
+func (q *Queries) DeleteProduct(ctx context.Context, id int32) (int32, error) {
+	row := q.db.QueryRowContext(ctx, deleteProduct, id)
+	err := row.Scan(&id)
+	return id, err
+}
+
 const getAllProductsWithCategory = `-- name: GetAllProductsWithCategory :many
+WITH RECURSIVE category_tree AS (
+    SELECT c.id FROM categories c WHERE c.id = $2::integer
+
+    UNION ALL
+
+    SELECT c.id
+    FROM categories c
+    INNER JOIN category_tree ct ON c.parent_id = ct.id
+),
+matching_products AS NOT MATERIALIZED (
+    SELECT
+        p.id,
+        p.name,
+        p.price_kes,
+        p.category_id,
+        p.description,
+        p.stock_quantity,
+        p.version,
+        p.created_at,
+        p.updated_at
+    FROM products p
+    WHERE ($1::text = '' OR (setweight(to_tsvector('simple', p.name), 'A') || setweight(to_tsvector('simple', coalesce(p.description, '')), 'B')) @@ plainto_tsquery('simple', $1))
+    AND ($2::integer = 0 OR p.category_id IN (SELECT id FROM category_tree))
+    AND p.price_kes >= $3::numeric
+    AND ($4::numeric = 0 OR p.price_kes <= $4)
+    AND ($5::boolean = FALSE OR p.stock_quantity > 0)
+)
 SELECT 
-    count(*) OVER() AS total_count,
+    (CASE WHEN $8::boolean THEN 0 ELSE (SELECT count(*) FROM matching_products) END)::bigint AS total_count,
     p.id,
     p.name,
     p.price_kes,
@@ -71,17 +173,39 @@ SELECT
     c.id as category_id_info,        -- Category's own ID
     c.name as category_name,
     c.parent_id as category_parent_id -- Category's parent ID (correct!)
-FROM products p
+FROM matching_products p
 LEFT JOIN categories c ON p.category_id = c.id
-WHERE ($1 = '' OR to_tsvector('simple', p.name) @@ plainto_tsquery('simple', $1))
-ORDER BY p.name
-LIMIT $2 OFFSET $3
+WHERE ($8::boolean = FALSE
+    OR ($7::text = 'ASC' AND (p.created_at, p.id) > ($9::timestamptz, $10::integer))
+    OR ($7::text = 'DESC' AND (p.created_at, p.id) < ($9::timestamptz, $10::integer)))
+ORDER BY
+    CASE WHEN $6::text = 'price_kes' AND $7::text = 'ASC' THEN p.price_kes END ASC,
+    CASE WHEN $6::text = 'price_kes' AND $7::text = 'DESC' THEN p.price_kes END DESC,
+    CASE WHEN $6::text = 'created_at' AND $7::text = 'ASC' THEN p.created_at END ASC,
+    CASE WHEN $6::text = 'created_at' AND $7::text = 'ASC' THEN p.id END ASC,
+    CASE WHEN $6::text = 'created_at' AND $7::text = 'DESC' THEN p.created_at END DESC,
+    CASE WHEN $6::text = 'created_at' AND $7::text = 'DESC' THEN p.id END DESC,
+    CASE WHEN $6::text = 'name' AND $7::text = 'DESC' THEN p.name END DESC,
+    -- without a sort, searches list the best matches first
+    CASE WHEN $6::text = '' AND $1::text <> '' THEN ts_rank(setweight(to_tsvector('simple', p.name), 'A') || setweight(to_tsvector('simple', coalesce(p.description, '')), 'B'), plainto_tsquery('simple', $1)) END DESC,
+    p.name ASC,
+    p.id ASC
+LIMIT $11 OFFSET $12
 `
 
 type GetAllProductsWithCategoryParams struct {
-	Column1 interface{}
-	Limit   int32
-	Offset  int32
+	Column1  string
+	Column2  int32
+	Column3  string
+	Column4  string
+	Column5  bool
+	Column6  string
+	Column7  string
+	Column8  bool
+	Column9  time.Time
+	Column10 int32
+	Limit    int32
+	Offset   int32
 }
 
 type GetAllProductsWithCategoryRow struct {
@@ -100,8 +224,26 @@ type GetAllProductsWithCategoryRow struct {
 	CategoryParentID sql.NullInt32
 }
 
+// $1 searches the name and description, $2 is a category whose subcategories are included
+// too (0 for all), $3 and $4 the price range ($4 of 0 has no upper bound), $5 only keeps
+// products in stock and $6 and $7 are the sort column and direction. When $8 is set, a
+// listing sorted by created_at continues after ($9, $10), the created_at and id of the last
+// product of the previous page. Those pages aren't counted, their total_count is 0.
 func (q *Queries) GetAllProductsWithCategory(ctx context.Context, arg GetAllProductsWithCategoryParams) ([]GetAllProductsWithCategoryRow, error) {
-	rows, err := q.db.QueryContext(ctx, getAllProductsWithCategory, arg.Column1, arg.Limit, arg.Offset)
+	rows, err := q.db.QueryContext(ctx, getAllProductsWithCategory,
+		arg.Column1,
+		arg.Column2,
+		arg.Column3,
+		arg.Column4,
+		arg.Column5,
+		arg.Column6,
+		arg.Column7,
+		arg.Column8,
+		arg.Column9,
+		arg.Column10,
+		arg.Limit,
+		arg.Offset,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -206,6 +348,216 @@ func (q *Queries) GetProductByIdOnly(ctx context.Context, id int32) (Product, er
 	return i, err
 }
 
+const getProductForUpdate = `-- name: GetProductForUpdate :one
+SELECT
+    id,
+    name,
+    price_kes,
+    stock_quantity
+FROM products
+WHERE id = $1
+FOR UPDATE
+`
+
+type GetProductForUpdateRow struct {
+	ID            int32
+	Name          string
+	PriceKes      string
+	StockQuantity int32
+}
+
+func (q *Queries) GetProductForUpdate(ctx context.Context, id int32) (GetProductForUpdateRow, error) {
+	row := q.db.QueryRowContext(ctx, getProductForUpdate, id)
+	var i GetProductForUpdateRow
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.PriceKes,
+		&i.StockQuantity,
+	)
+	return i, err
+}
+
+const getProductStockAdjustments = `-- name: GetProductStockAdjustments :many
+SELECT
+    count(*) OVER() AS total_count,
+    id,
+    product_id,
+    adjusted_by,
+    quantity_change,
+    previous_quantity,
+    new_quantity,
+    reason,
+    created_at
+FROM product_stock_adjustments
+WHERE product_id = $1
+ORDER BY created_at DESC, id DESC
+LIMIT $2 OFFSET $3
+`
+
+type GetProductStockAdjustmentsParams struct {
+	ProductID int32
+	Limit     int32
+	Offset    int32
+}
+
+type GetProductStockAdjustmentsRow struct {
+	TotalCount       int64
+	ID               int32
+	ProductID        int32
+	AdjustedBy       sql.NullInt32
+	QuantityChange   int32
+	PreviousQuantity int32
+	NewQuantity      int32
+	Reason           string
+	CreatedAt        time.Time
+}
+
+func (q *Queries) GetProductStockAdjustments(ctx context.Context, arg GetProductStockAdjustmentsParams) ([]GetProductStockAdjustmentsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getProductStockAdjustments, arg.ProductID, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetProductStockAdjustmentsRow
+	for rows.Next() {
+		var i GetProductStockAdjustmentsRow
+		if err := rows.Scan(
+			&i.TotalCount,
+			&i.ID,
+			&i.ProductID,
+			&i.AdjustedBy,
+			&i.QuantityChange,
+			&i.PreviousQuantity,
+			&i.NewQuantity,
+			&i.Reason,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getProductWithCategoryById = `-- name: GetProductWithCategoryById :one
+SELECT
+    p.id,
+    p.name,
+    p.price_kes,
+    p.category_id,
+    p.description,
+    p.stock_quantity,
+    p.version,
+    p.created_at,
+    p.updated_at,
+    -- Category details
+    c.id as category_id_info,
+    c.name as category_name,
+    c.parent_id as category_parent_id
+FROM products p
+LEFT JOIN categories c ON p.category_id = c.id
+WHERE p.id = $1
+`
+
+type GetProductWithCategoryByIdRow struct {
+	ID               int32
+	Name             string
+	PriceKes         string
+	CategoryID       int32
+	Description      sql.NullString
+	StockQuantity    int32
+	Version          int32
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	CategoryIDInfo   sql.NullInt32
+	CategoryName     sql.NullString
+	CategoryParentID sql.NullInt32
+}
+
+func (q *Queries) GetProductWithCategoryById(ctx context.Context, id int32) (GetProductWithCategoryByIdRow, error) {
+	row := q.db.QueryRowContext(ctx, getProductWithCategoryById, id)
+	var i GetProductWithCategoryByIdRow
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.PriceKes,
+		&i.CategoryID,
+		&i.Description,
+		&i.StockQuantity,
+		&i.Version,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.CategoryIDInfo,
+		&i.CategoryName,
+		&i.CategoryParentID,
+	)
+	return i, err
+}
+
+const incrementProductStock = `-- name: IncrementProductStock :exec
+UPDATE products
+SET stock_quantity = stock_quantity + $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type IncrementProductStockParams struct {
+	ID            int32
+	StockQuantity int32
+}
+
+func (q *Queries) IncrementProductStock(ctx context.Context, arg IncrementProductStockParams) error {
+	_, err := q.db.ExecContext(ctx, incrementProductStock, arg.ID, arg.StockQuantity)
+	return err
+}
+
+const updateProduct = `-- name: UpdateProduct :one
+UPDATE products
+SET
+    name = $2,
+    price_kes = $3,
+    category_id = $4,
+    description = $5,
+    version = version + 1,
+    updated_at = NOW()
+WHERE id = $1 AND version = $6
+RETURNING version, updated_at
+`
+
+type UpdateProductParams struct {
+	ID          int32
+	Name        string
+	PriceKes    string
+	CategoryID  int32
+	Description sql.NullString
+	Version     int32
+}
+
+type UpdateProductRow struct {
+	Version   int32
+	UpdatedAt time.Time
+}
+
+func (q *Queries) UpdateProduct(ctx context.Context, arg UpdateProductParams) (UpdateProductRow, error) {
+	row := q.db.QueryRowContext(ctx, updateProduct,
+		arg.ID,
+		arg.Name,
+		arg.PriceKes,
+		arg.CategoryID,
+		arg.Description,
+		arg.Version,
+	)
+	var i UpdateProductRow
+	err := row.Scan(&i.Version, &i.UpdatedAt)
+	return i, err
+}
+
 const updateProductStockQuantity = `-- name: UpdateProductStockQuantity :exec
 UPDATE products
 SET stock_quantity = $2, updated_at = NOW()
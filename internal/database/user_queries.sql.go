@@ -11,6 +11,20 @@ import (
 	"time"
 )
 
+const clearUserPassword = `-- name: ClearUserPassword :exec
+UPDATE users
+SET
+    password = NULL,
+    version = version + 1,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) ClearUserPassword(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, clearUserPassword, id)
+	return err
+}
+
 const createNewUser = `-- name: CreateNewUser :one
 INSERT INTO users (
     first_name,
@@ -75,6 +89,7 @@ SELECT
     email,
     profile_avatar_url,
     phone_number,
+    phone_verified,
     password,
     oidc_sub,
     role_level,
@@ -94,6 +109,7 @@ type GetUserByEmailRow struct {
 	Email            string
 	ProfileAvatarUrl string
 	PhoneNumber      sql.NullString
+	PhoneVerified    bool
 	Password         []byte
 	OidcSub          string
 	RoleLevel        string
@@ -114,6 +130,7 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (GetUserByEm
 		&i.Email,
 		&i.ProfileAvatarUrl,
 		&i.PhoneNumber,
+		&i.PhoneVerified,
 		&i.Password,
 		&i.OidcSub,
 		&i.RoleLevel,
@@ -134,6 +151,7 @@ SELECT
     email,
     profile_avatar_url,
     phone_number,
+    phone_verified,
     password,
     oidc_sub,
     role_level,
@@ -153,6 +171,7 @@ type GetUserByIDRow struct {
 	Email            string
 	ProfileAvatarUrl string
 	PhoneNumber      sql.NullString
+	PhoneVerified    bool
 	Password         []byte
 	OidcSub          string
 	RoleLevel        string
@@ -173,6 +192,7 @@ func (q *Queries) GetUserByID(ctx context.Context, id int64) (GetUserByIDRow, er
 		&i.Email,
 		&i.ProfileAvatarUrl,
 		&i.PhoneNumber,
+		&i.PhoneVerified,
 		&i.Password,
 		&i.OidcSub,
 		&i.RoleLevel,
@@ -185,6 +205,28 @@ func (q *Queries) GetUserByID(ctx context.Context, id int64) (GetUserByIDRow, er
 	return i, err
 }
 
+const setUserPhoneVerified = `-- name: SetUserPhoneVerified :execrows
+UPDATE users
+SET
+    phone_verified = TRUE,
+    version = version + 1,
+    updated_at = NOW()
+WHERE id = $1 AND phone_number = $2
+`
+
+type SetUserPhoneVerifiedParams struct {
+	ID          int64
+	PhoneNumber sql.NullString
+}
+
+func (q *Queries) SetUserPhoneVerified(ctx context.Context, arg SetUserPhoneVerifiedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setUserPhoneVerified, arg.ID, arg.PhoneNumber)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const updateUser = `-- name: UpdateUser :one
 UPDATE users
 SET
@@ -193,6 +235,7 @@ SET
     email = $3,
     profile_avatar_url = $4,
     phone_number = $5,
+    phone_verified = $12,
     password = $6,
     role_level = $7,
     activated = $8,
@@ -215,6 +258,7 @@ type UpdateUserParams struct {
 	LastLogin        time.Time
 	ID               int64
 	Version          int32
+	PhoneVerified    bool
 }
 
 type UpdateUserRow struct {
@@ -235,6 +279,7 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (UpdateU
 		arg.LastLogin,
 		arg.ID,
 		arg.Version,
+		arg.PhoneVerified,
 	)
 	var i UpdateUserRow
 	err := row.Scan(&i.UpdatedAt, &i.Version)
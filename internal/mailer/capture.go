@@ -0,0 +1,87 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Capture renders emails just like Mailer but keeps them instead of sending them, for local
+// development and tests. When it has a directory every email is also written to it, the HTML
+// body as a .html file to open in a browser and everything else in a .txt file next to it.
+type Capture struct {
+	dir    string
+	mu     sync.Mutex
+	emails []Email
+}
+
+// NewCapture creates a Capture. Emails are only kept in memory when dir is empty, otherwise the
+// directory is created if it doesn't exist.
+func NewCapture(dir string) (*Capture, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &Capture{dir: dir}, nil
+}
+
+// Send renders and keeps the email
+func (c *Capture) Send(recipient, templateFile string, data any) error {
+	return c.SendWithHeaders(recipient, templateFile, data, nil)
+}
+
+// SendWithHeaders renders and keeps the email with its extra headers
+func (c *Capture) SendWithHeaders(recipient, templateFile string, data any, headers map[string]string) error {
+	email, err := Render(templateFile, data)
+	if err != nil {
+		return err
+	}
+	email.Recipient = recipient
+	email.Headers = headers
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.emails = append(c.emails, *email)
+	if c.dir == "" {
+		return nil
+	}
+	return c.write(len(c.emails), email)
+}
+
+// Emails returns a copy of the emails sent so far, oldest first
+func (c *Capture) Emails() []Email {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	emails := make([]Email, len(c.emails))
+	copy(emails, c.emails)
+	return emails
+}
+
+// write saves the email as <time>_<n>_<template>.html and .txt
+func (c *Capture) write(n int, email *Email) error {
+	name := fmt.Sprintf("%s_%04d_%s", time.Now().UTC().Format("20060102T150405"), n,
+		strings.ReplaceAll(strings.TrimSuffix(email.Template, ".tmpl"), "/", "_"))
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "To: %s\nSubject: %s\n", email.Recipient, email.Subject)
+	headerNames := make([]string, 0, len(email.Headers))
+	for headerName := range email.Headers {
+		headerNames = append(headerNames, headerName)
+	}
+	sort.Strings(headerNames)
+	for _, headerName := range headerNames {
+		fmt.Fprintf(&text, "%s: %s\n", headerName, email.Headers[headerName])
+	}
+	fmt.Fprintf(&text, "\n%s", email.PlainBody)
+
+	if err := os.WriteFile(filepath.Join(c.dir, name+".txt"), []byte(text.String()), 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(c.dir, name+".html"), []byte(email.HTMLBody), 0o644)
+}
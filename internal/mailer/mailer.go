@@ -1,9 +1,7 @@
 package mailer
 
 import (
-	"bytes"
 	"embed"
-	"html/template"
 	"time"
 
 	"github.com/go-mail/mail/v2"
@@ -15,6 +13,13 @@ import (
 //go:embed "templates/*"
 var templateFS embed.FS
 
+// Sender sends emails rendered from our templates. Mailer sends them through an SMTP server,
+// Capture keeps them for local development and tests.
+type Sender interface {
+	Send(recipient, templateFile string, data any) error
+	SendWithHeaders(recipient, templateFile string, data any, headers map[string]string) error
+}
+
 // Define a Mailer struct which contains a mail.Dialer instance (used to connect to a
 // SMTP server) and the sender information for your emails
 type Mailer struct {
@@ -38,29 +43,15 @@ func New(host string, port int, username, password, sender string) Mailer {
 // as the first parameter, the name of the file containing the templates, and any
 // dynamic data for the templates as an any parameter.
 func (m Mailer) Send(recipient, templateFile string, data any) error {
-	// Use the ParseFS() method to parse the required template file from the embedded
-	// file system.
-	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
-	if err != nil {
-		return err
-	}
-	// Execute the named template "subject", passing in the dynamic data and storing the
-	// result in a bytes.Buffer variable.
-	subject := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(subject, "subject", data)
-	if err != nil {
-		return err
-	}
-	// Follow the same pattern to execute the "plainBody" template and store the result
-	// in the plainBody variable.
-	plainBody := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(plainBody, "plainBody", data)
-	if err != nil {
-		return err
-	}
-	// And likewise with the "htmlBody" template.
-	htmlBody := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
+	return m.SendWithHeaders(recipient, templateFile, data, nil)
+}
+
+// SendWithHeaders() sends an email just like Send() with extra headers, such as the
+// List-Unsubscribe headers of notifications users can opt out of.
+func (m Mailer) SendWithHeaders(recipient, templateFile string, data any, headers map[string]string) error {
+	// Render the template's "subject", "plainBody" and "htmlBody" with the dynamic data.
+	// Templates are parsed the first time they are sent and kept for the next emails.
+	email, err := Render(templateFile, data)
 	if err != nil {
 		return err
 	}
@@ -72,9 +63,12 @@ func (m Mailer) Send(recipient, templateFile string, data any) error {
 	msg := mail.NewMessage()
 	msg.SetHeader("To", recipient)
 	msg.SetHeader("From", m.sender)
-	msg.SetHeader("Subject", subject.String())
-	msg.SetBody("text/plain", plainBody.String())
-	msg.AddAlternative("text/html", htmlBody.String())
+	msg.SetHeader("Subject", email.Subject)
+	for name, value := range headers {
+		msg.SetHeader(name, value)
+	}
+	msg.SetBody("text/plain", email.PlainBody)
+	msg.AddAlternative("text/html", email.HTMLBody)
 	// Call the DialAndSend() method on the dialer, passing in the message to send. This
 	// opens a connection to the SMTP server, sends the message, then closes the
 	// connection. If there is a timeout, it will return a "dial tcp: i/o timeout"
@@ -0,0 +1,165 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+)
+
+// The locales we have templates for. English templates live in templates/, the translations in
+// a directory named after their locale, such as templates/sw/.
+const (
+	LocaleEnglish = "en"
+	LocaleSwahili = "sw"
+	DefaultLocale = LocaleEnglish
+)
+
+var (
+	ErrTemplateNotFound = errors.New("email template not found")
+)
+
+// Email is an email rendered from one of our templates
+type Email struct {
+	Recipient string            `json:"recipient,omitempty"`
+	Template  string            `json:"template"`
+	Subject   string            `json:"subject"`
+	PlainBody string            `json:"plain_body"`
+	HTMLBody  string            `json:"html_body"`
+	Headers   map[string]string `json:"headers,omitempty"`
+}
+
+// templateCache parses every template the first time it is used and keeps it, templates are
+// embedded in the binary so they never change while we run.
+type templateCache struct {
+	fsys      fs.FS
+	mu        sync.RWMutex
+	templates map[string]*template.Template
+}
+
+func newTemplateCache(fsys fs.FS) *templateCache {
+	return &templateCache{fsys: fsys, templates: make(map[string]*template.Template)}
+}
+
+// defaultTemplates are the templates embedded in templateFS
+var defaultTemplates = newTemplateCache(templateFS)
+
+// get returns the parsed template, parsing it if this is the first time it is asked for
+func (c *templateCache) get(templateFile string) (*template.Template, error) {
+	c.mu.RLock()
+	tmpl, ok := c.templates[templateFile]
+	c.mu.RUnlock()
+	if ok {
+		return tmpl, nil
+	}
+
+	if !c.exists(templateFile) {
+		return nil, ErrTemplateNotFound
+	}
+	tmpl, err := template.New("email").ParseFS(c.fsys, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.templates[templateFile] = tmpl
+	c.mu.Unlock()
+	return tmpl, nil
+}
+
+func (c *templateCache) exists(templateFile string) bool {
+	if !fs.ValidPath(templateFile) || path.Ext(templateFile) != ".tmpl" {
+		return false
+	}
+	info, err := fs.Stat(c.fsys, "templates/"+templateFile)
+	return err == nil && !info.IsDir()
+}
+
+// localize returns the locale's translation of the template if there is one, otherwise the
+// English template
+func (c *templateCache) localize(locale, templateFile string) string {
+	if locale == "" || locale == DefaultLocale {
+		return templateFile
+	}
+	localized := locale + "/" + templateFile
+	if c.exists(localized) {
+		return localized
+	}
+	return templateFile
+}
+
+// render executes the template's subject, plainBody and htmlBody
+func (c *templateCache) render(templateFile string, data any) (*Email, error) {
+	tmpl, err := c.get(templateFile)
+	if err != nil {
+		return nil, err
+	}
+	email := &Email{Template: templateFile}
+	for name, dst := range map[string]*string{"subject": &email.Subject, "plainBody": &email.PlainBody, "htmlBody": &email.HTMLBody} {
+		buf := new(bytes.Buffer)
+		if err := tmpl.ExecuteTemplate(buf, name, data); err != nil {
+			return nil, err
+		}
+		*dst = buf.String()
+	}
+	return email, nil
+}
+
+// names lists the English templates, the ones senders ask for by name, sorted by name
+func (c *templateCache) names() ([]string, error) {
+	entries, err := fs.ReadDir(c.fsys, "templates")
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".tmpl") {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// locales lists the locales templates are available in, English first and the rest sorted
+func (c *templateCache) locales() ([]string, error) {
+	entries, err := fs.ReadDir(c.fsys, "templates")
+	if err != nil {
+		return nil, err
+	}
+	locales := []string{DefaultLocale}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		// only directories of templates are translations, templates/test holds rendered examples
+		translated, err := fs.Glob(c.fsys, "templates/"+entry.Name()+"/*.tmpl")
+		if err == nil && len(translated) > 0 {
+			locales = append(locales, entry.Name())
+		}
+	}
+	return locales, nil
+}
+
+// LocalizedTemplate returns the name of the template to send in the locale, falling back to the
+// English template when it hasn't been translated. Pass the result to Send.
+func LocalizedTemplate(locale, templateFile string) string {
+	return defaultTemplates.localize(locale, templateFile)
+}
+
+// Render renders one of our templates without sending it. Unknown templates return
+// ErrTemplateNotFound.
+func Render(templateFile string, data any) (*Email, error) {
+	return defaultTemplates.render(templateFile, data)
+}
+
+// Templates lists the names of the templates emails can be sent with
+func Templates() ([]string, error) {
+	return defaultTemplates.names()
+}
+
+// Locales lists the locales our templates are translated to, English first
+func Locales() ([]string, error) {
+	return defaultTemplates.locales()
+}
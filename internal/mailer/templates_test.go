@@ -0,0 +1,225 @@
+package mailer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func sampleOrderData(status string) map[string]any {
+	return map[string]any{
+		"firstName":      "Wanjiru",
+		"lastName":       "Kamau",
+		"orderID":        1024,
+		"status":         status,
+		"statusLower":    strings.ToLower(status),
+		"totalAmount":    "4750.00",
+		"orderDate":      "March 14, 2025",
+		"items":          []map[string]any{{"productName": "Kikoi Beach Towel", "quantity": 2, "unitPrice": "1250.00", "totalPrice": "2500.00"}},
+		"unsubscribeURL": "https://savannacart.com/unsubscribe?token=abc",
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name         string
+		templateFile string
+		status       string
+		wantSubject  string
+		wantPlain    string
+		wantErr      error
+	}{
+		{
+			name:         "english order update",
+			templateFile: "order_status_update.tmpl",
+			status:       "SHIPPED",
+			wantSubject:  "Order Update: Your SavannaCart Order #1024 is SHIPPED",
+			wantPlain:    "Kikoi Beach Towel",
+		},
+		{
+			name:         "swahili order update translates the status",
+			templateFile: "sw/order_status_update.tmpl",
+			status:       "DELIVERED",
+			wantSubject:  "Taarifa ya Oda: Oda Yako ya SavannaCart #1024 Imewasilishwa",
+			wantPlain:    "Jiondoe: https://savannacart.com/unsubscribe?token=abc",
+		},
+		{
+			name:         "unknown template",
+			templateFile: "missing.tmpl",
+			wantErr:      ErrTemplateNotFound,
+		},
+		{
+			name:         "path outside the templates",
+			templateFile: "../mailer.go",
+			wantErr:      ErrTemplateNotFound,
+		},
+		{
+			name:         "not a template",
+			templateFile: "test",
+			wantErr:      ErrTemplateNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			email, err := Render(tt.templateFile, sampleOrderData(tt.status))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if email.Template != tt.templateFile {
+				t.Errorf("expected template %q, got %q", tt.templateFile, email.Template)
+			}
+			if email.Subject != tt.wantSubject {
+				t.Errorf("expected subject %q, got %q", tt.wantSubject, email.Subject)
+			}
+			if !strings.Contains(email.PlainBody, tt.wantPlain) {
+				t.Errorf("expected plain body to contain %q, got %q", tt.wantPlain, email.PlainBody)
+			}
+			if email.HTMLBody == "" {
+				t.Error("expected an HTML body")
+			}
+		})
+	}
+}
+
+func TestTemplateCacheParsesOnce(t *testing.T) {
+	cache := newTemplateCache(templateFS)
+
+	first, err := cache.get("user_welcome.tmpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := cache.get("user_welcome.tmpl")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first != second {
+		t.Error("expected the cached template to be reused")
+	}
+}
+
+func TestLocalizedTemplate(t *testing.T) {
+	tests := []struct {
+		name         string
+		locale       string
+		templateFile string
+		want         string
+	}{
+		{"english", LocaleEnglish, "user_welcome.tmpl", "user_welcome.tmpl"},
+		{"no locale", "", "user_welcome.tmpl", "user_welcome.tmpl"},
+		{"swahili", LocaleSwahili, "user_welcome.tmpl", "sw/user_welcome.tmpl"},
+		{"untranslated template", LocaleSwahili, "admin_order_notification.tmpl", "admin_order_notification.tmpl"},
+		{"unknown locale", "fr", "user_welcome.tmpl", "user_welcome.tmpl"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LocalizedTemplate(tt.locale, tt.templateFile); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestTemplatesAndLocales(t *testing.T) {
+	templates, err := Templates()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantTemplates := []string{
+		"admin_order_notification.tmpl",
+		"admin_payment_review.tmpl",
+		"order_status_update.tmpl",
+		"user_password_reset.tmpl",
+		"user_succesful_activation.tmpl",
+		"user_welcome.tmpl",
+	}
+	if !reflect.DeepEqual(templates, wantTemplates) {
+		t.Errorf("expected templates %v, got %v", wantTemplates, templates)
+	}
+
+	locales, err := Locales()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{LocaleEnglish, LocaleSwahili}; !reflect.DeepEqual(locales, want) {
+		t.Errorf("expected locales %v, got %v", want, locales)
+	}
+
+	// every translation must render with the data its English template gets
+	for _, templateFile := range templates {
+		localized := LocalizedTemplate(LocaleSwahili, templateFile)
+		if _, err := Render(localized, sampleOrderData("PAID")); err != nil {
+			t.Errorf("failed to render %s: %v", localized, err)
+		}
+	}
+}
+
+func TestCapture(t *testing.T) {
+	t.Run("in memory", func(t *testing.T) {
+		capture, err := NewCapture("")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := capture.Send("wanjiru@example.com", "order_status_update.tmpl", sampleOrderData("PAID")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		headers := map[string]string{"List-Unsubscribe": "<https://savannacart.com/unsubscribe?token=abc>"}
+		if err := capture.SendWithHeaders("wanjiru@example.com", "sw/order_status_update.tmpl", sampleOrderData("PAID"), headers); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := capture.Send("wanjiru@example.com", "missing.tmpl", nil); !errors.Is(err, ErrTemplateNotFound) {
+			t.Fatalf("expected ErrTemplateNotFound, got %v", err)
+		}
+
+		emails := capture.Emails()
+		if len(emails) != 2 {
+			t.Fatalf("expected 2 emails, got %d", len(emails))
+		}
+		if emails[0].Recipient != "wanjiru@example.com" || emails[0].Template != "order_status_update.tmpl" {
+			t.Errorf("unexpected first email: %+v", emails[0])
+		}
+		if !reflect.DeepEqual(emails[1].Headers, headers) {
+			t.Errorf("expected headers %v, got %v", headers, emails[1].Headers)
+		}
+	})
+
+	t.Run("to a directory", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "emails")
+		capture, err := NewCapture(dir)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		headers := map[string]string{"List-Unsubscribe": "<https://savannacart.com/unsubscribe?token=abc>"}
+		if err := capture.SendWithHeaders("wanjiru@example.com", "sw/order_status_update.tmpl", sampleOrderData("SHIPPED"), headers); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for _, pattern := range []string{"*_0001_sw_order_status_update.txt", "*_0001_sw_order_status_update.html"} {
+			matches, err := filepath.Glob(filepath.Join(dir, pattern))
+			if err != nil || len(matches) != 1 {
+				t.Fatalf("expected one file matching %s, got %v (%v)", pattern, matches, err)
+			}
+			if strings.HasSuffix(pattern, ".txt") {
+				text, err := os.ReadFile(matches[0])
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				for _, want := range []string{"To: wanjiru@example.com", "Subject: Taarifa ya Oda", "List-Unsubscribe: <https://savannacart.com/unsubscribe?token=abc>"} {
+					if !strings.Contains(string(text), want) {
+						t.Errorf("expected %s to contain %q", matches[0], want)
+					}
+				}
+			}
+		}
+	})
+}
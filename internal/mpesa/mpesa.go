@@ -0,0 +1,409 @@
+package mpesa
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrDisabled           = errors.New("M-Pesa payments are disabled")
+	ErrInvalidPhoneNumber = errors.New("phone number must be a valid Safaricom number")
+	ErrInvalidCallback    = errors.New("invalid STK callback payload")
+	ErrPaymentProcessing  = errors.New("the STK push is still being processed")
+	// ErrSTKPushNotSent is wrapped by STKPush when the customer certainly got no prompt,
+	// because Daraja rejected the push or we never got as far as sending it. Any other
+	// error leaves that open, the push may have gone through before it failed.
+	ErrSTKPushNotSent = errors.New("the STK push was not sent")
+)
+
+// errorCodeProcessing is what Daraja answers a status query with while the customer hasn't
+// responded to the prompt yet
+const errorCodeProcessing = "500.001.1001"
+
+// DefaultBaseURL is the Daraja sandbox, production deployments override it via config
+const DefaultBaseURL = "https://sandbox.safaricom.co.ke"
+
+// Client is the interface the rest of the application uses to take M-Pesa payments.
+// DarajaClient is the real implementation, tests can swap in their own.
+type Client interface {
+	STKPush(ctx context.Context, req STKPushRequest) (*STKPushResponse, error)
+	STKQuery(ctx context.Context, checkoutRequestID string) (*STKQueryResponse, error)
+	Enabled() bool
+}
+
+// Config holds the Daraja credentials and the settings for the paybill/till being charged
+type Config struct {
+	BaseURL        string
+	ConsumerKey    string
+	ConsumerSecret string
+	ShortCode      string
+	PassKey        string
+	CallbackURL    string
+}
+
+// STKPushRequest is a request to prompt a customer's phone for payment
+type STKPushRequest struct {
+	PhoneNumber      string // any Kenyan format, normalised to 2547XXXXXXXX before sending
+	Amount           int64  // whole shillings, Daraja does not accept cents
+	AccountReference string // shown to the customer on the prompt, max 12 characters
+	TransactionDesc  string
+}
+
+// STKPushResponse is Daraja's acknowledgement that the prompt was sent
+type STKPushResponse struct {
+	MerchantRequestID   string `json:"MerchantRequestID"`
+	CheckoutRequestID   string `json:"CheckoutRequestID"`
+	ResponseCode        string `json:"ResponseCode"`
+	ResponseDescription string `json:"ResponseDescription"`
+	CustomerMessage     string `json:"CustomerMessage"`
+}
+
+// STKQueryResponse is the outcome of an STK push as reported by a status query. Unlike the
+// callback it doesn't include the receipt number or the amount paid.
+type STKQueryResponse struct {
+	ResponseCode        string `json:"ResponseCode"`
+	ResponseDescription string `json:"ResponseDescription"`
+	MerchantRequestID   string `json:"MerchantRequestID"`
+	CheckoutRequestID   string `json:"CheckoutRequestID"`
+	ResultCode          string `json:"ResultCode"` // a string here, a number on the callback
+	ResultDesc          string `json:"ResultDesc"`
+}
+
+// Successful reports whether the customer completed the payment
+func (r *STKQueryResponse) Successful() bool {
+	return r.ResultCode == "0"
+}
+
+// CallbackResult is the outcome of an STK push as reported on the callback URL
+type CallbackResult struct {
+	MerchantRequestID  string
+	CheckoutRequestID  string
+	ResultCode         int
+	ResultDesc         string
+	Amount             int64
+	MpesaReceiptNumber string
+	PhoneNumber        string
+	TransactionDate    string
+}
+
+// Successful reports whether the customer completed the payment
+func (c *CallbackResult) Successful() bool {
+	return c.ResultCode == 0
+}
+
+// DarajaClient talks to Safaricom's Daraja API
+type DarajaClient struct {
+	config     Config
+	httpClient *http.Client
+	logger     *zap.Logger
+	enabled    bool
+
+	mu          sync.Mutex
+	accessToken string
+	tokenExpiry time.Time
+}
+
+// New creates a new Daraja client. The client is disabled when any of the credentials
+// are missing, in which case STKPush returns ErrDisabled.
+func New(cfg Config, logger *zap.Logger) *DarajaClient {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultBaseURL
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	client := &DarajaClient{
+		config:     cfg,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		logger:     logger,
+	}
+	if cfg.ConsumerKey == "" || cfg.ConsumerSecret == "" || cfg.ShortCode == "" || cfg.PassKey == "" || cfg.CallbackURL == "" {
+		logger.Warn("M-Pesa payments disabled: missing Daraja credentials or callback URL")
+		return client
+	}
+	client.enabled = true
+	logger.Info("M-Pesa payments initialized", zap.String("base_url", cfg.BaseURL), zap.String("short_code", cfg.ShortCode))
+	return client
+}
+
+// Enabled reports whether the client has everything it needs to send STK pushes
+func (c *DarajaClient) Enabled() bool {
+	return c.enabled
+}
+
+// STKPush sends a Lipa Na M-Pesa Online prompt to the customer's phone. Check errors for
+// ErrSTKPushNotSent before treating the payment as failed.
+func (c *DarajaClient) STKPush(ctx context.Context, req STKPushRequest) (*STKPushResponse, error) {
+	if !c.enabled {
+		return nil, ErrDisabled
+	}
+	phoneNumber, err := FormatPhoneNumber(req.PhoneNumber)
+	if err != nil {
+		return nil, err
+	}
+	if req.Amount < 1 {
+		return nil, fmt.Errorf("amount must be at least 1 KES, got %d", req.Amount)
+	}
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSTKPushNotSent, err)
+	}
+
+	timestamp := time.Now().Format("20060102150405")
+	payload := map[string]any{
+		"BusinessShortCode": c.config.ShortCode,
+		"Password":          Password(c.config.ShortCode, c.config.PassKey, timestamp),
+		"Timestamp":         timestamp,
+		"TransactionType":   "CustomerPayBillOnline",
+		"Amount":            req.Amount,
+		"PartyA":            phoneNumber,
+		"PartyB":            c.config.ShortCode,
+		"PhoneNumber":       phoneNumber,
+		"CallBackURL":       c.config.CallbackURL,
+		"AccountReference":  req.AccountReference,
+		"TransactionDesc":   req.TransactionDesc,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.BaseURL+"/mpesa/stkpush/v1/processrequest", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+token)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send STK push: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			ErrorCode    string `json:"errorCode"`
+			ErrorMessage string `json:"errorMessage"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		// an expired token is dropped so the next call fetches a fresh one
+		if resp.StatusCode == http.StatusUnauthorized {
+			c.resetAccessToken()
+		}
+		// only an answer from Daraja itself says the push was turned down, a bare error
+		// status could just as well come from a proxy after the push went through
+		if apiErr.ErrorCode != "" {
+			return nil, fmt.Errorf("%w: rejected with status %d: %s %s", ErrSTKPushNotSent, resp.StatusCode, apiErr.ErrorCode, apiErr.ErrorMessage)
+		}
+		return nil, fmt.Errorf("STK push failed with status %d", resp.StatusCode)
+	}
+	var stkResp STKPushResponse
+	if err := json.NewDecoder(resp.Body).Decode(&stkResp); err != nil {
+		return nil, fmt.Errorf("failed to decode STK push response: %w", err)
+	}
+	if stkResp.ResponseCode != "0" {
+		return nil, fmt.Errorf("%w: not accepted: %s", ErrSTKPushNotSent, stkResp.ResponseDescription)
+	}
+
+	c.logger.Info("STK push sent",
+		zap.String("checkout_request_id", stkResp.CheckoutRequestID),
+		zap.String("account_reference", req.AccountReference),
+		zap.Int64("amount", req.Amount))
+	return &stkResp, nil
+}
+
+// STKQuery asks Daraja for the result of an STK push, for when its callback never arrived.
+// It returns ErrPaymentProcessing while the customer can still respond to the prompt.
+func (c *DarajaClient) STKQuery(ctx context.Context, checkoutRequestID string) (*STKQueryResponse, error) {
+	if !c.enabled {
+		return nil, ErrDisabled
+	}
+	token, err := c.getAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := time.Now().Format("20060102150405")
+	payload := map[string]any{
+		"BusinessShortCode": c.config.ShortCode,
+		"Password":          Password(c.config.ShortCode, c.config.PassKey, timestamp),
+		"Timestamp":         timestamp,
+		"CheckoutRequestID": checkoutRequestID,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.BaseURL+"/mpesa/stkpushquery/v1/query", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+token)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query STK push: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			ErrorCode    string `json:"errorCode"`
+			ErrorMessage string `json:"errorMessage"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		if apiErr.ErrorCode == errorCodeProcessing {
+			return nil, ErrPaymentProcessing
+		}
+		if resp.StatusCode == http.StatusUnauthorized {
+			c.resetAccessToken()
+		}
+		return nil, fmt.Errorf("STK query rejected with status %d: %s %s", resp.StatusCode, apiErr.ErrorCode, apiErr.ErrorMessage)
+	}
+	var queryResp STKQueryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&queryResp); err != nil {
+		return nil, fmt.Errorf("failed to decode STK query response: %w", err)
+	}
+	if queryResp.ResponseCode != "0" || queryResp.ResultCode == "" {
+		return nil, fmt.Errorf("STK query not accepted: %s", queryResp.ResponseDescription)
+	}
+	return &queryResp, nil
+}
+
+// getAccessToken returns a cached OAuth token, fetching a new one when it is about to expire.
+func (c *DarajaClient) getAccessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.accessToken != "" && time.Now().Before(c.tokenExpiry) {
+		return c.accessToken, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.config.BaseURL+"/oauth/v1/generate?grant_type=client_credentials", nil)
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(c.config.ConsumerKey, c.config.ConsumerSecret)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get Daraja access token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get Daraja access token: status %d", resp.StatusCode)
+	}
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   string `json:"expires_in"` // Daraja sends the lifetime in seconds as a string
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return "", fmt.Errorf("failed to decode Daraja access token: %w", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return "", errors.New("Daraja returned an empty access token")
+	}
+	lifetime, err := time.ParseDuration(tokenResp.ExpiresIn + "s")
+	if err != nil || lifetime <= 0 {
+		lifetime = time.Hour
+	}
+	// refresh a minute early so a token never expires mid-request
+	c.accessToken = tokenResp.AccessToken
+	c.tokenExpiry = time.Now().Add(lifetime - time.Minute)
+	return c.accessToken, nil
+}
+
+func (c *DarajaClient) resetAccessToken() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.accessToken = ""
+}
+
+// Password builds the STK push password, base64(shortcode + passkey + timestamp)
+func Password(shortCode, passKey, timestamp string) string {
+	return base64.StdEncoding.EncodeToString([]byte(shortCode + passKey + timestamp))
+}
+
+// FormatPhoneNumber normalises a Kenyan mobile number to the 2547XXXXXXXX / 2541XXXXXXXX
+// format Daraja expects.
+func FormatPhoneNumber(phoneNumber string) (string, error) {
+	cleaned := strings.NewReplacer(" ", "", "-", "", "(", "", ")", "").Replace(phoneNumber)
+	cleaned = strings.TrimPrefix(cleaned, "+")
+	switch {
+	case strings.HasPrefix(cleaned, "0") && len(cleaned) == 10:
+		cleaned = "254" + cleaned[1:]
+	case (strings.HasPrefix(cleaned, "7") || strings.HasPrefix(cleaned, "1")) && len(cleaned) == 9:
+		cleaned = "254" + cleaned
+	}
+	if len(cleaned) != 12 || !strings.HasPrefix(cleaned, "254") || (cleaned[3] != '7' && cleaned[3] != '1') {
+		return "", ErrInvalidPhoneNumber
+	}
+	for _, r := range cleaned {
+		if r < '0' || r > '9' {
+			return "", ErrInvalidPhoneNumber
+		}
+	}
+	return cleaned, nil
+}
+
+// ParseCallback decodes the body Daraja posts to the STK callback URL.
+func ParseCallback(body []byte) (*CallbackResult, error) {
+	var payload struct {
+		Body struct {
+			STKCallback struct {
+				MerchantRequestID string `json:"MerchantRequestID"`
+				CheckoutRequestID string `json:"CheckoutRequestID"`
+				ResultCode        *int   `json:"ResultCode"`
+				ResultDesc        string `json:"ResultDesc"`
+				CallbackMetadata  struct {
+					Item []struct {
+						Name  string          `json:"Name"`
+						Value json.RawMessage `json:"Value"`
+					} `json:"Item"`
+				} `json:"CallbackMetadata"`
+			} `json:"stkCallback"`
+		} `json:"Body"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCallback, err)
+	}
+	callback := payload.Body.STKCallback
+	if callback.CheckoutRequestID == "" || callback.ResultCode == nil {
+		return nil, ErrInvalidCallback
+	}
+	result := &CallbackResult{
+		MerchantRequestID: callback.MerchantRequestID,
+		CheckoutRequestID: callback.CheckoutRequestID,
+		ResultCode:        *callback.ResultCode,
+		ResultDesc:        callback.ResultDesc,
+	}
+	// metadata values are a mix of JSON numbers and strings, keep them as their literal text
+	for _, item := range callback.CallbackMetadata.Item {
+		value := strings.Trim(string(item.Value), `"`)
+		switch item.Name {
+		case "Amount":
+			var amount float64
+			if err := json.Unmarshal(item.Value, &amount); err != nil {
+				return nil, fmt.Errorf("%w: bad amount %s", ErrInvalidCallback, value)
+			}
+			result.Amount = int64(amount)
+		case "MpesaReceiptNumber":
+			result.MpesaReceiptNumber = value
+		case "PhoneNumber":
+			result.PhoneNumber = value
+		case "TransactionDate":
+			result.TransactionDate = value
+		}
+	}
+	if result.Successful() && result.MpesaReceiptNumber == "" {
+		return nil, fmt.Errorf("%w: successful payment without a receipt number", ErrInvalidCallback)
+	}
+	return result, nil
+}
@@ -0,0 +1,282 @@
+package mpesa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// fakeDaraja is an in-process stand-in for the Daraja API covering the OAuth, STK push and
+// STK query endpoints.
+type fakeDaraja struct {
+	server      *httptest.Server
+	tokenCalls  atomic.Int32
+	pushCalls   atomic.Int32
+	lastPayload map[string]any
+	rejectPush  bool
+	// pushStatus makes the push endpoint answer with a bare error status, like a gateway would
+	pushStatus int
+	// queryResultCode is what a status query answers with, empty while still processing
+	queryResultCode string
+}
+
+func newFakeDaraja(t *testing.T) *fakeDaraja {
+	t.Helper()
+
+	fake := &fakeDaraja{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/v1/generate", func(w http.ResponseWriter, r *http.Request) {
+		key, secret, ok := r.BasicAuth()
+		if !ok || key != "test-key" || secret != "test-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fake.tokenCalls.Add(1)
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "fake-token", "expires_in": "3599"})
+	})
+	mux.HandleFunc("/mpesa/stkpush/v1/processrequest", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer fake-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"errorCode": "404.001.03", "errorMessage": "Invalid Access Token"})
+			return
+		}
+		fake.pushCalls.Add(1)
+		json.NewDecoder(r.Body).Decode(&fake.lastPayload)
+		if fake.pushStatus != 0 {
+			w.WriteHeader(fake.pushStatus)
+			return
+		}
+		if fake.rejectPush {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"errorCode": "400.002.02", "errorMessage": "Bad Request - Invalid Amount"})
+			return
+		}
+		json.NewEncoder(w).Encode(STKPushResponse{
+			MerchantRequestID:   "29115-34620561-1",
+			CheckoutRequestID:   "ws_CO_191220191020363925",
+			ResponseCode:        "0",
+			ResponseDescription: "Success. Request accepted for processing",
+			CustomerMessage:     "Success. Request accepted for processing",
+		})
+	})
+	mux.HandleFunc("/mpesa/stkpushquery/v1/query", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer fake-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&fake.lastPayload)
+		if fake.queryResultCode == "" {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"errorCode": "500.001.1001", "errorMessage": "The transaction is being processed"})
+			return
+		}
+		json.NewEncoder(w).Encode(STKQueryResponse{
+			ResponseCode:        "0",
+			ResponseDescription: "The service request has been accepted successsfully",
+			MerchantRequestID:   "29115-34620561-1",
+			CheckoutRequestID:   "ws_CO_191220191020363925",
+			ResultCode:          fake.queryResultCode,
+			ResultDesc:          "Request cancelled by user",
+		})
+	})
+	fake.server = httptest.NewServer(mux)
+	t.Cleanup(fake.server.Close)
+	return fake
+}
+
+func newTestClient(baseURL string) *DarajaClient {
+	return New(Config{
+		BaseURL:        baseURL,
+		ConsumerKey:    "test-key",
+		ConsumerSecret: "test-secret",
+		ShortCode:      "174379",
+		PassKey:        "test-passkey",
+		CallbackURL:    "https://example.com/v1/payments/mpesa/callback?token=secret",
+	}, zap.NewNop())
+}
+
+func TestNew(t *testing.T) {
+	if client := New(Config{}, zap.NewNop()); client.Enabled() {
+		t.Error("Expected a client without credentials to be disabled")
+	}
+	if client := newTestClient("http://localhost"); !client.Enabled() {
+		t.Error("Expected a fully configured client to be enabled")
+	}
+
+	_, err := New(Config{}, zap.NewNop()).STKPush(context.Background(), STKPushRequest{PhoneNumber: "0712345678", Amount: 10})
+	if !errors.Is(err, ErrDisabled) {
+		t.Errorf("Expected ErrDisabled, got %v", err)
+	}
+}
+
+func TestSTKPush(t *testing.T) {
+	fake := newFakeDaraja(t)
+	client := newTestClient(fake.server.URL)
+
+	resp, err := client.STKPush(context.Background(), STKPushRequest{
+		PhoneNumber:      "0712 345 678",
+		Amount:           1500,
+		AccountReference: "ORDER-42",
+		TransactionDesc:  "SavannaCart order 42",
+	})
+	if err != nil {
+		t.Fatalf("STK push failed: %v", err)
+	}
+	if resp.CheckoutRequestID != "ws_CO_191220191020363925" {
+		t.Errorf("Unexpected checkout request ID %q", resp.CheckoutRequestID)
+	}
+
+	payload := fake.lastPayload
+	if payload["PhoneNumber"] != "254712345678" || payload["PartyA"] != "254712345678" {
+		t.Errorf("Expected normalised phone number, got %v / %v", payload["PhoneNumber"], payload["PartyA"])
+	}
+	if payload["Amount"] != float64(1500) {
+		t.Errorf("Expected amount 1500, got %v", payload["Amount"])
+	}
+	timestamp, _ := payload["Timestamp"].(string)
+	if payload["Password"] != Password("174379", "test-passkey", timestamp) {
+		t.Errorf("Password does not match shortcode, passkey and timestamp %q", timestamp)
+	}
+
+	// The access token is cached between pushes
+	if _, err := client.STKPush(context.Background(), STKPushRequest{PhoneNumber: "254712345678", Amount: 10}); err != nil {
+		t.Fatalf("Second STK push failed: %v", err)
+	}
+	if calls := fake.tokenCalls.Load(); calls != 1 {
+		t.Errorf("Expected a single token request, got %d", calls)
+	}
+}
+
+func TestSTKPushErrors(t *testing.T) {
+	fake := newFakeDaraja(t)
+	client := newTestClient(fake.server.URL)
+
+	if _, err := client.STKPush(context.Background(), STKPushRequest{PhoneNumber: "12345", Amount: 10}); !errors.Is(err, ErrInvalidPhoneNumber) {
+		t.Errorf("Expected ErrInvalidPhoneNumber, got %v", err)
+	}
+	if _, err := client.STKPush(context.Background(), STKPushRequest{PhoneNumber: "0712345678", Amount: 0}); err == nil {
+		t.Error("Expected an error for a zero amount")
+	}
+	if fake.pushCalls.Load() != 0 {
+		t.Error("Expected invalid requests not to reach Daraja")
+	}
+
+	fake.rejectPush = true
+	if _, err := client.STKPush(context.Background(), STKPushRequest{PhoneNumber: "0712345678", Amount: 10}); !errors.Is(err, ErrSTKPushNotSent) {
+		t.Errorf("Expected ErrSTKPushNotSent when Daraja rejects the push, got %v", err)
+	}
+
+	// the push may have gone through behind a failing gateway
+	fake.pushStatus = http.StatusGatewayTimeout
+	_, err := client.STKPush(context.Background(), STKPushRequest{PhoneNumber: "0712345678", Amount: 10})
+	if err == nil || errors.Is(err, ErrSTKPushNotSent) {
+		t.Errorf("Expected an error that doesn't rule out a sent push, got %v", err)
+	}
+
+	badCredentials := newTestClient(fake.server.URL)
+	badCredentials.config.ConsumerSecret = "wrong"
+	if _, err := badCredentials.STKPush(context.Background(), STKPushRequest{PhoneNumber: "0712345678", Amount: 10}); !errors.Is(err, ErrSTKPushNotSent) {
+		t.Errorf("Expected ErrSTKPushNotSent when the OAuth request fails, got %v", err)
+	}
+}
+
+func TestSTKQuery(t *testing.T) {
+	fake := newFakeDaraja(t)
+	client := newTestClient(fake.server.URL)
+
+	// the customer hasn't answered the prompt yet
+	if _, err := client.STKQuery(context.Background(), "ws_CO_191220191020363925"); !errors.Is(err, ErrPaymentProcessing) {
+		t.Fatalf("Expected ErrPaymentProcessing, got %v", err)
+	}
+
+	fake.queryResultCode = "1032"
+	resp, err := client.STKQuery(context.Background(), "ws_CO_191220191020363925")
+	if err != nil {
+		t.Fatalf("STK query failed: %v", err)
+	}
+	if resp.Successful() || resp.ResultCode != "1032" {
+		t.Errorf("Unexpected query result: %+v", resp)
+	}
+	payload := fake.lastPayload
+	if payload["CheckoutRequestID"] != "ws_CO_191220191020363925" || payload["BusinessShortCode"] != "174379" {
+		t.Errorf("Unexpected query payload: %v", payload)
+	}
+
+	fake.queryResultCode = "0"
+	if resp, err := client.STKQuery(context.Background(), "ws_CO_191220191020363925"); err != nil || !resp.Successful() {
+		t.Errorf("Expected a successful payment, got %+v (err %v)", resp, err)
+	}
+
+	if _, err := New(Config{}, zap.NewNop()).STKQuery(context.Background(), "ws_CO_1"); !errors.Is(err, ErrDisabled) {
+		t.Errorf("Expected ErrDisabled, got %v", err)
+	}
+}
+
+func TestFormatPhoneNumber(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		valid    bool
+	}{
+		{"0712345678", "254712345678", true},
+		{"0112345678", "254112345678", true},
+		{"+254712345678", "254712345678", true},
+		{"254712345678", "254712345678", true},
+		{"712345678", "254712345678", true},
+		{"0712-345-678", "254712345678", true},
+		{"0212345678", "", false},
+		{"+15551234567", "", false},
+		{"07123456", "", false},
+		{"07123456ab", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := FormatPhoneNumber(tt.input)
+			if tt.valid && (err != nil || result != tt.expected) {
+				t.Errorf("Expected %q, got %q (err %v)", tt.expected, result, err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidPhoneNumber) {
+				t.Errorf("Expected ErrInvalidPhoneNumber, got %q (err %v)", result, err)
+			}
+		})
+	}
+}
+
+func TestParseCallback(t *testing.T) {
+	success := `{"Body":{"stkCallback":{"MerchantRequestID":"29115-34620561-1","CheckoutRequestID":"ws_CO_191220191020363925","ResultCode":0,"ResultDesc":"The service request is processed successfully.","CallbackMetadata":{"Item":[{"Name":"Amount","Value":1500.00},{"Name":"MpesaReceiptNumber","Value":"NLJ7RT61SV"},{"Name":"TransactionDate","Value":20191219102115},{"Name":"PhoneNumber","Value":254712345678}]}}}}`
+	result, err := ParseCallback([]byte(success))
+	if err != nil {
+		t.Fatalf("Failed to parse successful callback: %v", err)
+	}
+	if !result.Successful() || result.Amount != 1500 || result.MpesaReceiptNumber != "NLJ7RT61SV" || result.PhoneNumber != "254712345678" {
+		t.Errorf("Unexpected callback result: %+v", result)
+	}
+
+	cancelled := `{"Body":{"stkCallback":{"MerchantRequestID":"29115-34620561-1","CheckoutRequestID":"ws_CO_191220191020363925","ResultCode":1032,"ResultDesc":"Request cancelled by user"}}}`
+	result, err = ParseCallback([]byte(cancelled))
+	if err != nil {
+		t.Fatalf("Failed to parse cancelled callback: %v", err)
+	}
+	if result.Successful() || result.ResultCode != 1032 {
+		t.Errorf("Unexpected callback result: %+v", result)
+	}
+
+	invalid := []string{
+		`not json`,
+		`{"Body":{"stkCallback":{"ResultCode":0}}}`,
+		`{"Body":{"stkCallback":{"CheckoutRequestID":"ws_CO_1"}}}`,
+		`{"Body":{"stkCallback":{"CheckoutRequestID":"ws_CO_1","ResultCode":0,"CallbackMetadata":{"Item":[{"Name":"Amount","Value":10}]}}}}`,
+	}
+	for _, body := range invalid {
+		if _, err := ParseCallback([]byte(body)); !errors.Is(err, ErrInvalidCallback) {
+			t.Errorf("Expected ErrInvalidCallback for %s, got %v", body, err)
+		}
+	}
+}
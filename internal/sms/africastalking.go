@@ -0,0 +1,123 @@
+package sms
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Africa's Talking API hosts, the sandbox only works with the "sandbox" username
+const (
+	DefaultAfricasTalkingBaseURL = "https://api.africastalking.com"
+	AfricasTalkingSandboxBaseURL = "https://api.sandbox.africastalking.com"
+)
+
+// africasTalkingSuccessCodes are the recipient status codes of accepted messages:
+// Processed, Sent and Queued
+var africasTalkingSuccessCodes = map[int]bool{100: true, 101: true, 102: true}
+
+// AfricasTalkingConfig holds the Africa's Talking app credentials. SenderID is the
+// registered alphanumeric sender or short code, messages come from the shared one if empty.
+type AfricasTalkingConfig struct {
+	BaseURL  string
+	Username string
+	APIKey   string
+	SenderID string
+}
+
+// AfricasTalkingProvider sends SMS through Africa's Talking, which is cheaper and more
+// reliable than Twilio for Kenyan numbers
+type AfricasTalkingProvider struct {
+	config     AfricasTalkingConfig
+	httpClient *http.Client
+	logger     *zap.Logger
+}
+
+// NewAfricasTalkingProvider creates an Africa's Talking provider, returning
+// ErrMissingCredentials when the username or API key is missing.
+func NewAfricasTalkingProvider(cfg AfricasTalkingConfig, logger *zap.Logger) (*AfricasTalkingProvider, error) {
+	if cfg.Username == "" || cfg.APIKey == "" {
+		return nil, fmt.Errorf("%w: Africa's Talking needs a username and API key", ErrMissingCredentials)
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultAfricasTalkingBaseURL
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	logger.Info("SMS provider initialized with Africa's Talking",
+		zap.String("base_url", cfg.BaseURL),
+		zap.String("username", cfg.Username),
+		zap.String("sender_id", cfg.SenderID))
+
+	return &AfricasTalkingProvider{
+		config:     cfg,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		logger:     logger,
+	}, nil
+}
+
+// Name returns the provider's name
+func (p *AfricasTalkingProvider) Name() string {
+	return ProviderAfricasTalking
+}
+
+// Send sends an SMS message through the Africa's Talking bulk messaging API
+func (p *AfricasTalkingProvider) Send(phoneNumber, message string) (*SMSResponse, error) {
+	form := url.Values{}
+	form.Set("username", p.config.Username)
+	form.Set("to", phoneNumber)
+	form.Set("message", message)
+	if p.config.SenderID != "" {
+		form.Set("from", p.config.SenderID)
+	}
+	req, err := http.NewRequest(http.MethodPost, p.config.BaseURL+"/version1/messaging", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("apiKey", p.config.APIKey)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("Africa's Talking rejected the message with status %d", resp.StatusCode)
+	}
+
+	var atResp struct {
+		SMSMessageData struct {
+			Message    string `json:"Message"`
+			Recipients []struct {
+				StatusCode int    `json:"statusCode"`
+				Number     string `json:"number"`
+				Status     string `json:"status"`
+				MessageID  string `json:"messageId"`
+			} `json:"Recipients"`
+		} `json:"SMSMessageData"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&atResp); err != nil {
+		return nil, fmt.Errorf("failed to decode Africa's Talking response: %w", err)
+	}
+	// one number was sent to, so there is at most one recipient
+	if len(atResp.SMSMessageData.Recipients) == 0 {
+		return nil, fmt.Errorf("Africa's Talking did not send the message: %s", atResp.SMSMessageData.Message)
+	}
+	recipient := atResp.SMSMessageData.Recipients[0]
+	if !africasTalkingSuccessCodes[recipient.StatusCode] {
+		return nil, fmt.Errorf("Africa's Talking did not send the message: %s (%d)", recipient.Status, recipient.StatusCode)
+	}
+
+	return &SMSResponse{
+		MessageSID: recipient.MessageID,
+		Status:     recipient.Status,
+		From:       p.config.SenderID,
+		To:         recipient.Number,
+	}, nil
+}
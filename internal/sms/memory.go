@@ -0,0 +1,61 @@
+package sms
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Message is an SMS recorded by MemoryProvider
+type Message struct {
+	To     string
+	Body   string
+	SentAt time.Time
+}
+
+// MemoryProvider records messages instead of sending them, for tests and local development
+type MemoryProvider struct {
+	mu       sync.Mutex
+	messages []Message
+	err      error
+}
+
+// NewMemoryProvider creates an empty MemoryProvider
+func NewMemoryProvider() *MemoryProvider {
+	return &MemoryProvider{}
+}
+
+// Name returns the provider's name
+func (p *MemoryProvider) Name() string {
+	return ProviderMemory
+}
+
+// Send records the message, or returns the error set with Fail without recording it
+func (p *MemoryProvider) Send(phoneNumber, message string) (*SMSResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return nil, p.err
+	}
+	p.messages = append(p.messages, Message{To: phoneNumber, Body: message, SentAt: time.Now()})
+	return &SMSResponse{
+		MessageSID: fmt.Sprintf("memory-%d", len(p.messages)),
+		Status:     "sent",
+		To:         phoneNumber,
+	}, nil
+}
+
+// Fail makes every following Send return err, a nil err makes sends succeed again
+func (p *MemoryProvider) Fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+// Messages returns a copy of the messages recorded so far, oldest first
+func (p *MemoryProvider) Messages() []Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Message(nil), p.messages...)
+}
@@ -0,0 +1,210 @@
+package sms
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestSendFallsBackToTheNextProvider(t *testing.T) {
+	primary := NewMemoryProvider()
+	fallback := NewMemoryProvider()
+	service := NewWithProviders(zap.NewNop(), primary, fallback)
+
+	resp, err := service.Send("0712345678", "hello")
+	if err != nil {
+		t.Fatalf("Failed to send SMS: %v", err)
+	}
+	if len(primary.Messages()) != 1 || len(fallback.Messages()) != 0 {
+		t.Fatalf("Expected only the primary to send, got %d and %d messages", len(primary.Messages()), len(fallback.Messages()))
+	}
+	if got := primary.Messages()[0]; got.To != "+254712345678" || got.Body != "hello" {
+		t.Errorf("Unexpected message %+v", got)
+	}
+	if resp.Provider != ProviderMemory {
+		t.Errorf("Expected the response to name the provider, got %q", resp.Provider)
+	}
+
+	primary.Fail(errors.New("gateway down"))
+	if _, err := service.Send("0712345678", "hello again"); err != nil {
+		t.Fatalf("Expected the fallback to send the SMS, got %v", err)
+	}
+	if len(primary.Messages()) != 1 || len(fallback.Messages()) != 1 {
+		t.Errorf("Expected the fallback to send, got %d and %d messages", len(primary.Messages()), len(fallback.Messages()))
+	}
+
+	fallback.Fail(errors.New("out of credit"))
+	_, err = service.Send("0712345678", "nobody gets this")
+	if err == nil {
+		t.Fatal("Expected an error when every provider fails")
+	}
+	for _, want := range []string{"gateway down", "out of credit"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected the error to include %q, got %v", want, err)
+		}
+	}
+}
+
+func TestSendWithoutProviders(t *testing.T) {
+	service := NewWithProviders(zap.NewNop())
+	if service.IsEnabled() {
+		t.Error("Expected a service without providers to be disabled")
+	}
+	if _, err := service.Send("0712345678", "hello"); !errors.Is(err, ErrDisabled) {
+		t.Errorf("Expected ErrDisabled, got %v", err)
+	}
+}
+
+func TestNewFromConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       Config
+		providers []string
+		wantErr   bool
+	}{
+		{
+			name:      "primary with fallback",
+			cfg:       Config{Providers: []string{"africastalking", "twilio"}, Twilio: TwilioConfig{AccountSID: "AC123", AuthToken: "token", FromNumber: "+15551234567"}, AfricasTalking: AfricasTalkingConfig{Username: "sandbox", APIKey: "key"}},
+			providers: []string{ProviderAfricasTalking, ProviderTwilio},
+		},
+		{
+			name:      "providers without credentials are skipped",
+			cfg:       Config{Providers: []string{"africastalking", "twilio"}, Twilio: TwilioConfig{AccountSID: "AC123", AuthToken: "token", FromNumber: "+15551234567"}},
+			providers: []string{ProviderTwilio},
+		},
+		{
+			name: "nothing configured",
+			cfg:  Config{Providers: []string{"twilio"}},
+		},
+		{
+			name:      "memory",
+			cfg:       Config{Providers: []string{"memory"}},
+			providers: []string{ProviderMemory},
+		},
+		{
+			name:    "unknown provider",
+			cfg:     Config{Providers: []string{"carrier-pigeon"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, err := NewFromConfig(tt.cfg, zap.NewNop())
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var names []string
+			for _, provider := range service.providers {
+				names = append(names, provider.Name())
+			}
+			if len(names) != len(tt.providers) {
+				t.Fatalf("Expected providers %v, got %v", tt.providers, names)
+			}
+			for i := range names {
+				if names[i] != tt.providers[i] {
+					t.Errorf("Expected providers %v, got %v", tt.providers, names)
+				}
+			}
+			if service.IsEnabled() != (len(tt.providers) > 0) {
+				t.Errorf("Expected enabled to be %v, got %v", len(tt.providers) > 0, service.IsEnabled())
+			}
+		})
+	}
+}
+
+func TestAfricasTalkingProviderSend(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		response string
+		wantErr  bool
+	}{
+		{
+			name:     "sent",
+			status:   http.StatusCreated,
+			response: `{"SMSMessageData":{"Message":"Sent to 1/1 Total Cost: KES 0.8000","Recipients":[{"statusCode":101,"number":"+254712345678","status":"Success","cost":"KES 0.8000","messageId":"ATXid_1"}]}}`,
+		},
+		{
+			name:     "blacklisted number",
+			status:   http.StatusCreated,
+			response: `{"SMSMessageData":{"Message":"Sent to 0/1 Total Cost: 0","Recipients":[{"statusCode":406,"number":"+254712345678","status":"UserInBlacklist","cost":"0","messageId":"None"}]}}`,
+			wantErr:  true,
+		},
+		{
+			name:     "no recipients",
+			status:   http.StatusCreated,
+			response: `{"SMSMessageData":{"Message":"InvalidSenderId","Recipients":[]}}`,
+			wantErr:  true,
+		},
+		{
+			name:     "bad API key",
+			status:   http.StatusUnauthorized,
+			response: `The supplied authentication is invalid`,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/version1/messaging" || r.Header.Get("apiKey") != "test-key" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				if err := r.ParseForm(); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				if r.PostForm.Get("username") != "sandbox" || r.PostForm.Get("to") != "+254712345678" || r.PostForm.Get("message") != "hello" || r.PostForm.Get("from") != "SAVANNA" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.response))
+			}))
+			t.Cleanup(server.Close)
+
+			provider, err := NewAfricasTalkingProvider(AfricasTalkingConfig{
+				BaseURL:  server.URL + "/",
+				Username: "sandbox",
+				APIKey:   "test-key",
+				SenderID: "SAVANNA",
+			}, zap.NewNop())
+			if err != nil {
+				t.Fatalf("Failed to create provider: %v", err)
+			}
+
+			resp, err := provider.Send("+254712345678", "hello")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Expected an error, got %+v", resp)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to send SMS: %v", err)
+			}
+			if resp.MessageSID != "ATXid_1" || resp.To != "+254712345678" {
+				t.Errorf("Unexpected response %+v", resp)
+			}
+		})
+	}
+}
+
+func TestNewAfricasTalkingProviderMissingCredentials(t *testing.T) {
+	_, err := NewAfricasTalkingProvider(AfricasTalkingConfig{Username: "sandbox"}, zap.NewNop())
+	if !errors.Is(err, ErrMissingCredentials) {
+		t.Errorf("Expected ErrMissingCredentials, got %v", err)
+	}
+}
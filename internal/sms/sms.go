@@ -1,20 +1,47 @@
 package sms
 
 import (
+	"errors"
 	"fmt"
-	"strings"
+	"time"
 
-	"github.com/twilio/twilio-go"
-	openapi "github.com/twilio/twilio-go/rest/api/v2010"
 	"go.uber.org/zap"
 )
 
-// SMSService represents the SMS service configuration and client
+// Names of the providers that can be picked in Config.Providers
+const (
+	ProviderTwilio         = "twilio"
+	ProviderAfricasTalking = "africastalking"
+	ProviderMemory         = "memory"
+)
+
+var (
+	ErrDisabled           = errors.New("SMS service is disabled")
+	ErrMissingCredentials = errors.New("SMS provider is missing its credentials")
+)
+
+// Provider is a gateway SMS messages are sent through. SMSService sends through its providers
+// in order, falling back to the next one when a provider fails.
+type Provider interface {
+	Name() string
+	// Send sends message to a phone number that is already in international format
+	Send(phoneNumber, message string) (*SMSResponse, error)
+}
+
+// Config selects the providers SMS are sent through. Providers are tried in the order they
+// are listed, the first is the primary and the rest are fallbacks. Providers without
+// credentials are left out.
+type Config struct {
+	Providers      []string
+	Twilio         TwilioConfig
+	AfricasTalking AfricasTalkingConfig
+}
+
+// SMSService sends SMS through one or more providers
 type SMSService struct {
-	client     *twilio.RestClient
-	fromNumber string
-	logger     *zap.Logger
-	enabled    bool
+	providers []Provider
+	logger    *zap.Logger
+	enabled   bool
 }
 
 // SMSResponse represents the response from sending an SMS
@@ -23,50 +50,80 @@ type SMSResponse struct {
 	Status     string `json:"status"`
 	From       string `json:"from"`
 	To         string `json:"to"`
+	Provider   string `json:"provider"`
 }
 
-// New creates a new Twilio SMS service instance
+// New creates a new SMS service that sends through Twilio only
 func New(accountSID, authToken, fromNumber string, logger *zap.Logger) *SMSService {
-	// Validate required parameters
-	if accountSID == "" || authToken == "" {
-		logger.Warn("SMS service disabled: missing Account SID or Auth Token")
-		return &SMSService{
-			enabled: false,
-			logger:  logger,
-		}
+	provider, err := NewTwilioProvider(TwilioConfig{
+		AccountSID: accountSID,
+		AuthToken:  authToken,
+		FromNumber: fromNumber,
+	}, logger)
+	if err != nil {
+		logger.Warn("SMS service disabled", zap.Error(err))
+		return NewWithProviders(logger)
 	}
+	return NewWithProviders(logger, provider)
+}
 
-	if fromNumber == "" {
-		logger.Warn("SMS service disabled: missing From Number")
-		return &SMSService{
-			enabled: false,
-			logger:  logger,
-		}
+// NewWithProviders creates an SMS service that sends through the given providers in order.
+// The service is disabled when there are none.
+func NewWithProviders(logger *zap.Logger, providers ...Provider) *SMSService {
+	return &SMSService{
+		providers: providers,
+		logger:    logger,
+		enabled:   len(providers) > 0,
 	}
+}
 
-	// Create the Twilio client
-	client := twilio.NewRestClientWithParams(twilio.ClientParams{
-		Username: accountSID,
-		Password: authToken,
-	})
-
-	logger.Info("SMS service initialized with Twilio",
-		zap.String("account_sid", accountSID),
-		zap.String("from_number", fromNumber))
+// NewFromConfig creates an SMS service with the providers named in the config. Unknown
+// provider names are an error, providers that are missing credentials are skipped with a
+// warning and the service is disabled if none are left.
+func NewFromConfig(cfg Config, logger *zap.Logger) (*SMSService, error) {
+	var providers []Provider
+	for _, name := range cfg.Providers {
+		var provider Provider
+		var err error
+		switch name {
+		case ProviderTwilio:
+			provider, err = NewTwilioProvider(cfg.Twilio, logger)
+		case ProviderAfricasTalking:
+			provider, err = NewAfricasTalkingProvider(cfg.AfricasTalking, logger)
+		case ProviderMemory:
+			logger.Warn("SMS provider memory only records messages, nothing will be delivered")
+			provider = NewMemoryProvider()
+		default:
+			return nil, fmt.Errorf("unknown SMS provider %q, expected one of %s, %s or %s", name, ProviderTwilio, ProviderAfricasTalking, ProviderMemory)
+		}
+		if err != nil {
+			if errors.Is(err, ErrMissingCredentials) {
+				logger.Warn("Skipping SMS provider", zap.String("provider", name), zap.Error(err))
+				continue
+			}
+			return nil, err
+		}
+		providers = append(providers, provider)
+	}
 
-	return &SMSService{
-		client:     client,
-		fromNumber: fromNumber,
-		logger:     logger,
-		enabled:    true,
+	if len(providers) == 0 {
+		logger.Warn("SMS service disabled: no SMS provider is configured")
+	} else {
+		names := make([]string, len(providers))
+		for i, provider := range providers {
+			names[i] = provider.Name()
+		}
+		logger.Info("SMS service initialized", zap.Strings("providers", names))
 	}
+	return NewWithProviders(logger, providers...), nil
 }
 
-// Send sends an SMS message to the specified phone number
+// Send sends an SMS message to the specified phone number through the first provider that
+// accepts it. The errors of every provider are returned when they all fail.
 func (s *SMSService) Send(phoneNumber, message string) (*SMSResponse, error) {
 	if !s.enabled {
 		s.logger.Warn("SMS service is disabled, skipping SMS send")
-		return nil, fmt.Errorf("SMS service is disabled")
+		return nil, ErrDisabled
 	}
 
 	// Validate inputs
@@ -80,54 +137,37 @@ func (s *SMSService) Send(phoneNumber, message string) (*SMSResponse, error) {
 	// Ensure phone number is in international format
 	phoneNumber = s.formatPhoneNumber(phoneNumber)
 
-	s.logger.Info("Sending SMS via Twilio",
-		zap.String("phone_number", phoneNumber),
-		zap.String("message_preview", s.truncateMessage(message, 50)))
-
-	// Create SMS parameters
-	params := &openapi.CreateMessageParams{}
-	params.SetTo(phoneNumber)
-	params.SetFrom(s.fromNumber)
-	params.SetBody(message)
-	// Send SMS using Twilio
-	resp, err := s.client.Api.CreateMessage(params)
-	if err != nil {
-		// Handle specific Twilio errors gracefully
-		errorMsg := err.Error()
-		if strings.Contains(errorMsg, "21612") {
-			s.logger.Warn("SMS sending restricted - likely trial account limitation",
-				zap.String("phone_number", phoneNumber),
-				zap.String("from_number", s.fromNumber),
-				zap.String("twilio_error", "21612"),
-				zap.String("solution", "Verify phone number in Twilio console or upgrade account"))
-			return nil, fmt.Errorf("SMS sending restricted: Trial accounts can only send to verified numbers. Please verify %s in Twilio console", phoneNumber)
-		} else if strings.Contains(errorMsg, "21608") {
-			s.logger.Warn("SMS sending to unverified number",
+	var errs []error
+	for i, provider := range s.providers {
+		s.logger.Info("Sending SMS",
+			zap.String("provider", provider.Name()),
+			zap.String("phone_number", phoneNumber),
+			zap.String("message_preview", s.truncateMessage(message, 50)))
+
+		resp, err := provider.Send(phoneNumber, message)
+		if err == nil {
+			resp.Provider = provider.Name()
+			s.logger.Info("SMS sent successfully",
+				zap.String("provider", provider.Name()),
 				zap.String("phone_number", phoneNumber),
-				zap.String("twilio_error", "21608"))
-			return nil, fmt.Errorf("SMS sending restricted: Phone number %s must be verified in Twilio console for trial accounts", phoneNumber)
+				zap.String("message_sid", resp.MessageSID),
+				zap.String("status", resp.Status))
+			return resp, nil
 		}
 
-		s.logger.Error("Failed to send SMS via Twilio",
-			zap.String("phone_number", phoneNumber),
-			zap.Error(err))
-		return nil, fmt.Errorf("failed to send SMS: %w", err)
-	}
-
-	s.logger.Info("SMS sent successfully via Twilio",
-		zap.String("phone_number", phoneNumber),
-		zap.String("message_sid", *resp.Sid),
-		zap.String("status", *resp.Status))
-
-	// Convert Twilio response to our format
-	smsResponse := &SMSResponse{
-		MessageSID: *resp.Sid,
-		Status:     *resp.Status,
-		From:       *resp.From,
-		To:         *resp.To,
+		errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+		if i < len(s.providers)-1 {
+			s.logger.Warn("Failed to send SMS, falling back to the next provider",
+				zap.String("provider", provider.Name()),
+				zap.String("next_provider", s.providers[i+1].Name()),
+				zap.String("phone_number", phoneNumber),
+				zap.Error(err))
+		}
 	}
 
-	return smsResponse, nil
+	err := errors.Join(errs...)
+	s.logger.Error("Failed to send SMS", zap.String("phone_number", phoneNumber), zap.Error(err))
+	return nil, fmt.Errorf("failed to send SMS: %w", err)
 }
 
 // SendOrderConfirmation sends a simple order confirmation SMS
@@ -138,6 +178,14 @@ func (s *SMSService) SendOrderConfirmation(phoneNumber string, orderID int32, to
 	return err
 }
 
+// SendVerificationCode sends the one time code a user enters to verify their phone number
+func (s *SMSService) SendVerificationCode(phoneNumber, code string, validFor time.Duration) error {
+	message := fmt.Sprintf("Your SavannaCart verification code is %s. It expires in %d minutes. Don't share it with anyone.", code, int(validFor.Minutes()))
+
+	_, err := s.Send(phoneNumber, message)
+	return err
+}
+
 // formatPhoneNumber ensures the phone number is in international format
 func (s *SMSService) formatPhoneNumber(phoneNumber string) string {
 	// Remove any whitespace and special characters (spaces, dashes, parentheses)
@@ -2,6 +2,7 @@ package sms
 
 import (
 	"testing"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -166,6 +167,14 @@ func TestSendOrderConfirmation(t *testing.T) {
 	// This would require more complex testing setup with interfaces and dependency injection
 }
 
+func TestSendVerificationCode(t *testing.T) {
+	disabledService := New("", "", "", zap.NewNop())
+	err := disabledService.SendVerificationCode("+254712345678", "123456", 10*time.Minute)
+	if err == nil {
+		t.Error("Expected error for disabled service, got none")
+	}
+}
+
 func TestSendSMSWithRealNumber(t *testing.T) {
 	// Skip this test by default to avoid sending real SMS in CI
 	if testing.Short() {
@@ -0,0 +1,90 @@
+package sms
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/twilio/twilio-go"
+	openapi "github.com/twilio/twilio-go/rest/api/v2010"
+	"go.uber.org/zap"
+)
+
+// TwilioConfig holds the Twilio account and the number messages are sent from
+type TwilioConfig struct {
+	AccountSID string
+	AuthToken  string
+	FromNumber string
+}
+
+// TwilioProvider sends SMS through Twilio
+type TwilioProvider struct {
+	client     *twilio.RestClient
+	fromNumber string
+	logger     *zap.Logger
+}
+
+// NewTwilioProvider creates a Twilio provider, returning ErrMissingCredentials when any of
+// the config is missing.
+func NewTwilioProvider(cfg TwilioConfig, logger *zap.Logger) (*TwilioProvider, error) {
+	if cfg.AccountSID == "" || cfg.AuthToken == "" {
+		return nil, fmt.Errorf("%w: Twilio needs an Account SID and Auth Token", ErrMissingCredentials)
+	}
+	if cfg.FromNumber == "" {
+		return nil, fmt.Errorf("%w: Twilio needs a From Number", ErrMissingCredentials)
+	}
+
+	client := twilio.NewRestClientWithParams(twilio.ClientParams{
+		Username: cfg.AccountSID,
+		Password: cfg.AuthToken,
+	})
+	logger.Info("SMS provider initialized with Twilio",
+		zap.String("account_sid", cfg.AccountSID),
+		zap.String("from_number", cfg.FromNumber))
+
+	return &TwilioProvider{
+		client:     client,
+		fromNumber: cfg.FromNumber,
+		logger:     logger,
+	}, nil
+}
+
+// Name returns the provider's name
+func (p *TwilioProvider) Name() string {
+	return ProviderTwilio
+}
+
+// Send sends an SMS message through Twilio
+func (p *TwilioProvider) Send(phoneNumber, message string) (*SMSResponse, error) {
+	params := &openapi.CreateMessageParams{}
+	params.SetTo(phoneNumber)
+	params.SetFrom(p.fromNumber)
+	params.SetBody(message)
+
+	resp, err := p.client.Api.CreateMessage(params)
+	if err != nil {
+		// Trial accounts can only text numbers verified in the Twilio console
+		errorMsg := err.Error()
+		if strings.Contains(errorMsg, "21612") {
+			p.logger.Warn("SMS sending restricted - likely trial account limitation",
+				zap.String("phone_number", phoneNumber),
+				zap.String("from_number", p.fromNumber),
+				zap.String("twilio_error", "21612"),
+				zap.String("solution", "Verify phone number in Twilio console or upgrade account"))
+			return nil, fmt.Errorf("SMS sending restricted: Trial accounts can only send to verified numbers. Please verify %s in Twilio console", phoneNumber)
+		} else if strings.Contains(errorMsg, "21608") {
+			p.logger.Warn("SMS sending to unverified number",
+				zap.String("phone_number", phoneNumber),
+				zap.String("twilio_error", "21608"))
+			return nil, fmt.Errorf("SMS sending restricted: Phone number %s must be verified in Twilio console for trial accounts", phoneNumber)
+		}
+		return nil, err
+	}
+
+	// Convert Twilio response to our format
+	return &SMSResponse{
+		MessageSID: *resp.Sid,
+		Status:     *resp.Status,
+		From:       *resp.From,
+		To:         *resp.To,
+	}, nil
+}
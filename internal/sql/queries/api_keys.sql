@@ -0,0 +1,62 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (user_id, name, prefix, hash, expiry)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, user_id, name, prefix, hash, created_at, last_used_at, expiry, revoked_at;
+
+-- name: AddPermissionsForAPIKey :many
+INSERT INTO api_keys_permissions (api_key_id, permission_id)
+SELECT $1, permissions.id
+FROM permissions
+WHERE permissions.code = ANY($2::text[])
+RETURNING permission_id;
+
+-- name: GetAPIKeysForUser :many
+SELECT
+    api_keys.id,
+    api_keys.user_id,
+    api_keys.name,
+    api_keys.prefix,
+    api_keys.created_at,
+    api_keys.last_used_at,
+    api_keys.expiry,
+    COALESCE(array_agg(permissions.code ORDER BY permissions.code) FILTER (WHERE permissions.code IS NOT NULL), '{}')::text[] AS permissions
+FROM api_keys
+LEFT JOIN api_keys_permissions ON api_keys_permissions.api_key_id = api_keys.id
+LEFT JOIN permissions ON permissions.id = api_keys_permissions.permission_id
+WHERE api_keys.user_id = $1
+AND api_keys.revoked_at IS NULL
+AND api_keys.expiry > NOW()
+GROUP BY api_keys.id
+ORDER BY api_keys.created_at DESC, api_keys.id DESC;
+
+-- name: GetAPIKeyForHash :one
+SELECT
+    api_keys.id,
+    api_keys.user_id,
+    api_keys.name,
+    api_keys.prefix,
+    api_keys.created_at,
+    api_keys.last_used_at,
+    api_keys.expiry,
+    COALESCE(array_agg(permissions.code ORDER BY permissions.code) FILTER (WHERE permissions.code IS NOT NULL), '{}')::text[] AS permissions
+FROM api_keys
+LEFT JOIN api_keys_permissions ON api_keys_permissions.api_key_id = api_keys.id
+LEFT JOIN permissions ON permissions.id = api_keys_permissions.permission_id
+WHERE api_keys.hash = $1
+AND api_keys.revoked_at IS NULL
+AND api_keys.expiry > $2
+GROUP BY api_keys.id;
+
+-- name: TouchAPIKey :exec
+UPDATE api_keys
+SET last_used_at = NOW()
+WHERE id = $1
+AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute');
+
+-- name: RevokeAPIKey :one
+UPDATE api_keys
+SET revoked_at = NOW()
+WHERE id = $1
+AND user_id = $2
+AND revoked_at IS NULL
+RETURNING id;
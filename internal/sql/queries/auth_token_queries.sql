@@ -1,6 +1,6 @@
 -- name: CreateNewToken :one
-INSERT INTO tokens (hash, user_id, expiry, scope)
-VALUES ($1, $2, $3, $4)
+INSERT INTO tokens (hash, user_id, expiry, scope, session_id)
+VALUES ($1, $2, $3, $4, $5)
 RETURNING user_id;
 
 -- name: DeletAllTokensForUser :exec
@@ -16,16 +16,66 @@ SELECT
     users.profile_avatar_url,
     users.password,
     users.phone_number,
+    users.phone_verified,
     users.oidc_sub,
     users.role_level,
     users.activated,
     users.version,
     users.created_at,
     users.updated_at,
-    users.last_login
+    users.last_login,
+    tokens.expiry
 FROM users
 INNER JOIN tokens
 ON users.id = tokens.user_id
 WHERE tokens.hash = $1
 AND tokens.scope = $2
-AND tokens.expiry > $3;
\ No newline at end of file
+AND tokens.expiry > $3;
+
+-- name: GetRefreshTokenForUpdate :one
+SELECT
+    tokens.user_id,
+    tokens.session_id,
+    tokens.expiry,
+    tokens.used_at,
+    sessions.revoked_at
+FROM tokens
+INNER JOIN sessions
+ON sessions.id = tokens.session_id
+WHERE tokens.hash = $1
+AND tokens.scope = $2
+FOR UPDATE OF tokens;
+
+-- name: MarkTokenUsed :exec
+UPDATE tokens
+SET used_at = NOW()
+WHERE hash = $1;
+
+-- name: DeleteTokensForSession :exec
+DELETE FROM tokens
+WHERE session_id = $1 AND scope = $2;
+
+-- name: DeleteAllTokensForSession :exec
+DELETE FROM tokens
+WHERE session_id = $1;
+
+-- name: DeleteExpiredTokens :execrows
+DELETE FROM tokens
+WHERE hash IN (
+    SELECT hash
+    FROM tokens
+    WHERE expiry <= $1
+    LIMIT $2
+);
+
+-- name: IncrementTokenAttempts :one
+UPDATE tokens
+SET attempts = attempts + 1
+WHERE user_id = $1
+AND scope = $2
+AND expiry > $3
+RETURNING hash, attempts;
+
+-- name: DeleteTokensForUser :exec
+DELETE FROM tokens
+WHERE user_id = $1;
\ No newline at end of file
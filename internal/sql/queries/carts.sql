@@ -0,0 +1,54 @@
+-- name: UpsertCartForUser :one
+INSERT INTO carts (user_id)
+VALUES ($1)
+ON CONFLICT (user_id) DO UPDATE SET updated_at = NOW()
+RETURNING id, user_id, created_at, updated_at;
+
+-- name: GetCartByUserID :one
+SELECT
+    id,
+    user_id,
+    created_at,
+    updated_at
+FROM carts
+WHERE user_id = $1;
+
+-- name: AddCartItem :one
+INSERT INTO cart_items (
+    cart_id,
+    product_id,
+    quantity
+) VALUES ($1, $2, $3)
+ON CONFLICT (cart_id, product_id) DO UPDATE
+SET quantity = cart_items.quantity + EXCLUDED.quantity, updated_at = NOW()
+RETURNING id, cart_id, product_id, quantity, created_at, updated_at;
+
+-- name: UpdateCartItemQuantity :one
+UPDATE cart_items
+SET quantity = $3, updated_at = NOW()
+WHERE cart_id = $1 AND product_id = $2
+RETURNING id, cart_id, product_id, quantity, created_at, updated_at;
+
+-- name: DeleteCartItem :one
+DELETE FROM cart_items
+WHERE cart_id = $1 AND product_id = $2
+RETURNING id;
+
+-- name: ClearCart :exec
+DELETE FROM cart_items
+WHERE cart_id = $1;
+
+-- name: GetCartItemsWithProducts :many
+SELECT
+    ci.id,
+    ci.product_id,
+    p.name as product_name,
+    p.price_kes,
+    p.stock_quantity,
+    ci.quantity,
+    ci.created_at,
+    ci.updated_at
+FROM cart_items ci
+INNER JOIN products p ON ci.product_id = p.id
+WHERE ci.cart_id = $1
+ORDER BY ci.created_at ASC, ci.id ASC;
@@ -60,4 +60,49 @@ SELECT
     COALESCE(AVG(p.price_kes), 0)::text as average_price,
     COUNT(p.id) as product_count
 FROM category_tree ct
-LEFT JOIN products p ON p.category_id = ct.id;
\ No newline at end of file
+LEFT JOIN products p ON p.category_id = ct.id;
+
+-- name: GetCategoryTree :many
+SELECT
+    id,
+    name,
+    parent_id,
+    version,
+    created_at,
+    updated_at
+FROM categories
+ORDER BY name, id;
+
+-- name: GetCategoryAncestors :many
+WITH RECURSIVE ancestors AS (
+    -- Base case: start with the given category
+    SELECT c.id, c.name, c.parent_id, c.version, c.created_at, c.updated_at
+    FROM categories c
+    WHERE c.id = $1
+
+    UNION
+
+    -- Recursive case: get the parent of every category we have
+    SELECT c.id, c.name, c.parent_id, c.version, c.created_at, c.updated_at
+    FROM categories c
+    INNER JOIN ancestors a ON c.id = a.parent_id
+)
+SELECT id, name, parent_id, version, created_at, updated_at
+FROM ancestors;
+
+-- name: IsCategoryInSubtree :one
+WITH RECURSIVE category_tree AS (
+    SELECT c.id FROM categories c WHERE c.id = $1::integer
+
+    UNION
+
+    SELECT c.id
+    FROM categories c
+    INNER JOIN category_tree ct ON c.parent_id = ct.id
+)
+SELECT EXISTS (
+    SELECT 1 FROM category_tree WHERE id = $2::integer
+)::boolean AS in_subtree;
+
+-- name: LockCategoryMoves :exec
+SELECT pg_advisory_xact_lock(hashtext('categories_parent_id'));
\ No newline at end of file
@@ -0,0 +1,18 @@
+-- name: GetNotificationPreferences :one
+SELECT user_id, email_order_placed, email_order_status, email_marketing, sms_order_placed, sms_order_status, sms_marketing, language, updated_at
+FROM notification_preferences
+WHERE user_id = $1;
+
+-- name: UpsertNotificationPreferences :one
+INSERT INTO notification_preferences (user_id, email_order_placed, email_order_status, email_marketing, sms_order_placed, sms_order_status, sms_marketing, language)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (user_id) DO UPDATE
+SET email_order_placed = EXCLUDED.email_order_placed,
+    email_order_status = EXCLUDED.email_order_status,
+    email_marketing = EXCLUDED.email_marketing,
+    sms_order_placed = EXCLUDED.sms_order_placed,
+    sms_order_status = EXCLUDED.sms_order_status,
+    sms_marketing = EXCLUDED.sms_marketing,
+    language = EXCLUDED.language,
+    updated_at = NOW()
+RETURNING user_id, email_order_placed, email_order_status, email_marketing, sms_order_placed, sms_order_status, sms_marketing, language, updated_at;
@@ -0,0 +1,52 @@
+-- name: EnqueueNotification :execrows
+INSERT INTO notifications_outbox (idempotency_key, kind, payload, max_attempts)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (idempotency_key) DO NOTHING;
+
+-- name: ClaimDueNotifications :many
+UPDATE notifications_outbox
+SET
+    attempts = attempts + 1,
+    next_attempt_at = NOW() + ($2::integer * INTERVAL '1 second'),
+    updated_at = NOW()
+WHERE id IN (
+    SELECT id
+    FROM notifications_outbox
+    WHERE status = 'pending' AND next_attempt_at <= NOW()
+    ORDER BY next_attempt_at, id
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, idempotency_key, kind, payload, status, attempts, max_attempts, next_attempt_at, last_error, created_at, updated_at, sent_at;
+
+-- name: CompleteNotification :execrows
+UPDATE notifications_outbox
+SET status = $2, last_error = $3, sent_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND status = 'pending' AND attempts = $4;
+
+-- name: RescheduleNotification :execrows
+UPDATE notifications_outbox
+SET status = $2, next_attempt_at = $3, last_error = $4, updated_at = NOW()
+WHERE id = $1 AND status = 'pending' AND attempts = $5;
+
+-- name: GetNotificationByID :one
+SELECT id, idempotency_key, kind, payload, status, attempts, max_attempts, next_attempt_at, last_error, created_at, updated_at, sent_at
+FROM notifications_outbox
+WHERE id = $1;
+
+-- name: GetNotifications :many
+SELECT
+    count(*) OVER() AS total_count,
+    id, idempotency_key, kind, payload, status, attempts, max_attempts, next_attempt_at, last_error, created_at, updated_at, sent_at
+FROM notifications_outbox
+WHERE ($1::text = '' OR status = $1)
+ORDER BY created_at DESC, id DESC
+LIMIT $2 OFFSET $3;
+
+-- name: RetryNotification :one
+UPDATE notifications_outbox
+SET status = 'pending', attempts = 0, next_attempt_at = NOW(), last_error = '', updated_at = NOW()
+WHERE id = $1
+    -- a pending notification whose next attempt is still ahead may be out with a worker
+    AND (status = 'dead' OR (status = 'pending' AND next_attempt_at <= NOW()))
+RETURNING id, idempotency_key, kind, payload, status, attempts, max_attempts, next_attempt_at, last_error, created_at, updated_at, sent_at;
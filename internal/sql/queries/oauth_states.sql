@@ -0,0 +1,12 @@
+-- name: CreateOAuthState :exec
+INSERT INTO oauth_states (state_hash, code_verifier, expiry, provider, link_user_id)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: ConsumeOAuthState :one
+DELETE FROM oauth_states
+WHERE state_hash = $1
+RETURNING code_verifier, expiry, provider, link_user_id;
+
+-- name: DeleteExpiredOAuthStates :exec
+DELETE FROM oauth_states
+WHERE expiry <= $1;
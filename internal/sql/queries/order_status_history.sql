@@ -0,0 +1,35 @@
+-- name: CreateOrderStatusHistory :one
+INSERT INTO order_status_history (
+    order_id,
+    from_status,
+    to_status,
+    changed_by,
+    note
+) VALUES ($1, $2, $3, $4, $5)
+RETURNING id, order_id, from_status, to_status, changed_by, note, created_at;
+
+-- name: GetOrderStatusHistory :many
+SELECT
+    id,
+    order_id,
+    from_status,
+    to_status,
+    changed_by,
+    note,
+    created_at
+FROM order_status_history
+WHERE order_id = $1
+ORDER BY created_at ASC, id ASC;
+
+-- name: GetOrderStatusHistoryForOrders :many
+SELECT
+    id,
+    order_id,
+    from_status,
+    to_status,
+    changed_by,
+    note,
+    created_at
+FROM order_status_history
+WHERE order_id = ANY($1::int[])
+ORDER BY order_id ASC, created_at ASC, id ASC;
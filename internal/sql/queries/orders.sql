@@ -17,6 +17,24 @@ INSERT INTO order_items (
 RETURNING id, order_id, product_id, quantity, unit_price_kes, created_at;
 
 -- name: GetAllOrdersWithItems :many
+-- The page is picked from the orders first, so an order is never split across pages and
+-- total_count counts orders, then every item of those orders is joined in. Pages after a
+-- cursor ($2) aren't counted, their total_count is 0.
+WITH order_page AS (
+    SELECT
+        o.id,
+        o.user_id,
+        o.total_kes,
+        o.status,
+        o.version,
+        o.created_at,
+        o.updated_at
+    FROM orders o
+    WHERE ($1 = '' OR o.status = $1)
+    AND ($2::boolean = FALSE OR (o.created_at, o.id) < ($3::timestamptz, $4::integer))
+    ORDER BY o.created_at DESC, o.id DESC
+    LIMIT $5 OFFSET $6
+)
 SELECT 
     o.id as order_id,
     o.user_id,
@@ -34,16 +52,33 @@ SELECT
     oi.quantity,
     oi.unit_price_kes,
     oi.created_at as item_created_at,
-    count(*) OVER() AS total_count
-FROM orders o
+    (CASE WHEN $2::boolean THEN 0 ELSE (
+        SELECT count(*) FROM orders WHERE $1 = '' OR status = $1
+    ) END)::bigint AS total_count
+FROM order_page o
 INNER JOIN users u ON o.user_id = u.id
 LEFT JOIN order_items oi ON o.id = oi.order_id
 LEFT JOIN products p ON oi.product_id = p.id
-WHERE ($1 = '' OR o.status = $1)
-ORDER BY o.created_at DESC, oi.id ASC
-LIMIT $2 OFFSET $3;
+ORDER BY o.created_at DESC, o.id DESC, oi.id ASC;
 
 -- name: GetUserOrdersWithItems :many
+-- Like GetAllOrdersWithItems, the page is picked from the user's orders before their items
+-- are joined in and pages after a cursor aren't counted.
+WITH order_page AS (
+    SELECT
+        o.id,
+        o.user_id,
+        o.total_kes,
+        o.status,
+        o.version,
+        o.created_at,
+        o.updated_at
+    FROM orders o
+    WHERE o.user_id = $1
+    AND ($2::boolean = FALSE OR (o.created_at, o.id) < ($3::timestamptz, $4::integer))
+    ORDER BY o.created_at DESC, o.id DESC
+    LIMIT $5 OFFSET $6
+)
 SELECT 
     o.id as order_id,
     o.user_id,
@@ -58,13 +93,13 @@ SELECT
     oi.quantity,
     oi.unit_price_kes,
     oi.created_at as item_created_at,
-    count(*) OVER() AS total_count
-FROM orders o
+    (CASE WHEN $2::boolean THEN 0 ELSE (
+        SELECT count(*) FROM orders WHERE user_id = $1
+    ) END)::bigint AS total_count
+FROM order_page o
 LEFT JOIN order_items oi ON o.id = oi.order_id
 LEFT JOIN products p ON oi.product_id = p.id
-WHERE o.user_id = $1
-ORDER BY o.created_at DESC, oi.id ASC
-LIMIT $2 OFFSET $3;
+ORDER BY o.created_at DESC, o.id DESC, oi.id ASC;
 
 -- name: GetOrderById :one
 SELECT 
@@ -78,6 +113,28 @@ SELECT
 FROM orders
 WHERE id = $1;
 
+-- name: GetOrderForUpdate :one
+SELECT
+    id,
+    user_id,
+    total_kes,
+    status,
+    version,
+    created_at,
+    updated_at
+FROM orders
+WHERE id = $1
+FOR UPDATE;
+
+-- name: GetOrderItemQuantities :many
+SELECT
+    product_id,
+    SUM(quantity)::int AS quantity
+FROM order_items
+WHERE order_id = $1
+GROUP BY product_id
+ORDER BY product_id ASC;
+
 -- name: GetOrderByIdWithItems :many
 SELECT 
     o.id as order_id,
@@ -0,0 +1,152 @@
+-- name: CreatePayment :one
+INSERT INTO payments (
+    order_id,
+    phone_number,
+    amount_kes
+) VALUES ($1, $2, $3)
+RETURNING id, order_id, provider, phone_number, amount_kes, status, merchant_request_id, checkout_request_id, mpesa_receipt_number, result_code, result_desc, created_at, updated_at;
+
+-- name: SetPaymentCheckoutRequest :one
+UPDATE payments
+SET merchant_request_id = $2, checkout_request_id = $3, updated_at = NOW()
+WHERE id = $1
+RETURNING id, order_id, provider, phone_number, amount_kes, status, merchant_request_id, checkout_request_id, mpesa_receipt_number, result_code, result_desc, created_at, updated_at;
+
+-- name: GetPaymentByCheckoutRequestID :one
+SELECT
+    id,
+    order_id,
+    provider,
+    phone_number,
+    amount_kes,
+    status,
+    merchant_request_id,
+    checkout_request_id,
+    mpesa_receipt_number,
+    result_code,
+    result_desc,
+    created_at,
+    updated_at
+FROM payments
+WHERE checkout_request_id = $1;
+
+-- name: GetPaymentByID :one
+SELECT
+    id,
+    order_id,
+    provider,
+    phone_number,
+    amount_kes,
+    status,
+    merchant_request_id,
+    checkout_request_id,
+    mpesa_receipt_number,
+    result_code,
+    result_desc,
+    created_at,
+    updated_at
+FROM payments
+WHERE id = $1;
+
+-- name: GetPaymentForUpdate :one
+SELECT
+    id,
+    order_id,
+    provider,
+    phone_number,
+    amount_kes,
+    status,
+    merchant_request_id,
+    checkout_request_id,
+    mpesa_receipt_number,
+    result_code,
+    result_desc,
+    created_at,
+    updated_at
+FROM payments
+WHERE id = $1
+FOR UPDATE;
+
+-- name: GetStalePendingPayments :many
+SELECT
+    id,
+    order_id,
+    provider,
+    phone_number,
+    amount_kes,
+    status,
+    merchant_request_id,
+    checkout_request_id,
+    mpesa_receipt_number,
+    result_code,
+    result_desc,
+    created_at,
+    updated_at
+FROM payments
+WHERE status = 'PENDING' AND created_at < $1
+ORDER BY created_at, id
+LIMIT $2;
+
+-- name: SettlePayment :one
+UPDATE payments
+SET
+    status = $2,
+    mpesa_receipt_number = $3,
+    result_code = $4,
+    result_desc = $5,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING id, order_id, provider, phone_number, amount_kes, status, merchant_request_id, checkout_request_id, mpesa_receipt_number, result_code, result_desc, created_at, updated_at;
+
+-- name: GetPaymentsByOrderID :many
+SELECT
+    id,
+    order_id,
+    provider,
+    phone_number,
+    amount_kes,
+    status,
+    merchant_request_id,
+    checkout_request_id,
+    mpesa_receipt_number,
+    result_code,
+    result_desc,
+    created_at,
+    updated_at
+FROM payments
+WHERE order_id = $1
+ORDER BY created_at DESC, id DESC;
+
+-- name: GetPendingPaymentWithoutCheckoutRequest :one
+-- A pending payment whose STK push may have gone out without us hearing its checkout
+-- request ID back, oldest first
+SELECT
+    id,
+    order_id,
+    provider,
+    phone_number,
+    amount_kes,
+    status,
+    merchant_request_id,
+    checkout_request_id,
+    mpesa_receipt_number,
+    result_code,
+    result_desc,
+    created_at,
+    updated_at
+FROM payments
+WHERE status = 'PENDING' AND checkout_request_id IS NULL AND phone_number = $1 AND amount_kes = $2
+ORDER BY created_at, id
+LIMIT 1;
+
+-- name: CreateUnmatchedPaymentCallback :exec
+INSERT INTO unmatched_payment_callbacks (
+    checkout_request_id,
+    merchant_request_id,
+    result_code,
+    result_desc,
+    amount_kes,
+    mpesa_receipt_number,
+    phone_number
+) VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (checkout_request_id) DO NOTHING;
@@ -39,3 +39,25 @@ WHERE users_permissions.user_id = $1
 AND permissions.code = $2
 AND users_permissions.permission_id = permissions.id
 RETURNING permission_id;
+
+-- name: CreatePermissionAuditLog :exec
+INSERT INTO permission_audit_log (
+    actor_id,
+    user_id,
+    action,
+    permission_code
+) VALUES ($1, $2, $3, $4);
+
+-- name: GetPermissionAuditLog :many
+SELECT
+    count(*) OVER() AS total_count,
+    id,
+    actor_id,
+    user_id,
+    action,
+    permission_code,
+    created_at
+FROM permission_audit_log
+WHERE ($1::bigint = 0 OR user_id = $1)
+ORDER BY created_at DESC, id DESC
+LIMIT $2 OFFSET $3;
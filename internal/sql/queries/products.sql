@@ -9,8 +9,40 @@ INSERT INTO products (
  RETURNING id, version, created_at, updated_at;
 
 -- name: GetAllProductsWithCategory :many
+-- $1 searches the name and description, $2 is a category whose subcategories are included
+-- too (0 for all), $3 and $4 the price range ($4 of 0 has no upper bound), $5 only keeps
+-- products in stock and $6 and $7 are the sort column and direction. When $8 is set, a
+-- listing sorted by created_at continues after ($9, $10), the created_at and id of the last
+-- product of the previous page. Those pages aren't counted, their total_count is 0.
+WITH RECURSIVE category_tree AS (
+    SELECT c.id FROM categories c WHERE c.id = $2::integer
+
+    UNION ALL
+
+    SELECT c.id
+    FROM categories c
+    INNER JOIN category_tree ct ON c.parent_id = ct.id
+),
+matching_products AS NOT MATERIALIZED (
+    SELECT
+        p.id,
+        p.name,
+        p.price_kes,
+        p.category_id,
+        p.description,
+        p.stock_quantity,
+        p.version,
+        p.created_at,
+        p.updated_at
+    FROM products p
+    WHERE ($1::text = '' OR (setweight(to_tsvector('simple', p.name), 'A') || setweight(to_tsvector('simple', coalesce(p.description, '')), 'B')) @@ plainto_tsquery('simple', $1))
+    AND ($2::integer = 0 OR p.category_id IN (SELECT id FROM category_tree))
+    AND p.price_kes >= $3::numeric
+    AND ($4::numeric = 0 OR p.price_kes <= $4)
+    AND ($5::boolean = FALSE OR p.stock_quantity > 0)
+)
 SELECT 
-    count(*) OVER() AS total_count,
+    (CASE WHEN $8::boolean THEN 0 ELSE (SELECT count(*) FROM matching_products) END)::bigint AS total_count,
     p.id,
     p.name,
     p.price_kes,
@@ -24,11 +56,24 @@ SELECT
     c.id as category_id_info,        -- Category's own ID
     c.name as category_name,
     c.parent_id as category_parent_id -- Category's parent ID (correct!)
-FROM products p
+FROM matching_products p
 LEFT JOIN categories c ON p.category_id = c.id
-WHERE ($1 = '' OR to_tsvector('simple', p.name) @@ plainto_tsquery('simple', $1))
-ORDER BY p.name
-LIMIT $2 OFFSET $3;
+WHERE ($8::boolean = FALSE
+    OR ($7::text = 'ASC' AND (p.created_at, p.id) > ($9::timestamptz, $10::integer))
+    OR ($7::text = 'DESC' AND (p.created_at, p.id) < ($9::timestamptz, $10::integer)))
+ORDER BY
+    CASE WHEN $6::text = 'price_kes' AND $7::text = 'ASC' THEN p.price_kes END ASC,
+    CASE WHEN $6::text = 'price_kes' AND $7::text = 'DESC' THEN p.price_kes END DESC,
+    CASE WHEN $6::text = 'created_at' AND $7::text = 'ASC' THEN p.created_at END ASC,
+    CASE WHEN $6::text = 'created_at' AND $7::text = 'ASC' THEN p.id END ASC,
+    CASE WHEN $6::text = 'created_at' AND $7::text = 'DESC' THEN p.created_at END DESC,
+    CASE WHEN $6::text = 'created_at' AND $7::text = 'DESC' THEN p.id END DESC,
+    CASE WHEN $6::text = 'name' AND $7::text = 'DESC' THEN p.name END DESC,
+    -- without a sort, searches list the best matches first
+    CASE WHEN $6::text = '' AND $1::text <> '' THEN ts_rank(setweight(to_tsvector('simple', p.name), 'A') || setweight(to_tsvector('simple', coalesce(p.description, '')), 'B'), plainto_tsquery('simple', $1)) END DESC,
+    p.name ASC,
+    p.id ASC
+LIMIT $11 OFFSET $12;
 
 -- name: GetProductById :one
 SELECT
@@ -63,3 +108,87 @@ UPDATE products
 SET stock_quantity = $2, updated_at = NOW()
 WHERE id = $1;
 
+
+-- name: GetProductForUpdate :one
+SELECT
+    id,
+    name,
+    price_kes,
+    stock_quantity
+FROM products
+WHERE id = $1
+FOR UPDATE;
+
+-- name: DecrementProductStock :one
+UPDATE products
+SET stock_quantity = stock_quantity - $2, updated_at = NOW()
+WHERE id = $1 AND stock_quantity >= $2
+RETURNING stock_quantity;
+
+-- name: IncrementProductStock :exec
+UPDATE products
+SET stock_quantity = stock_quantity + $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: GetProductWithCategoryById :one
+SELECT
+    p.id,
+    p.name,
+    p.price_kes,
+    p.category_id,
+    p.description,
+    p.stock_quantity,
+    p.version,
+    p.created_at,
+    p.updated_at,
+    -- Category details
+    c.id as category_id_info,
+    c.name as category_name,
+    c.parent_id as category_parent_id
+FROM products p
+LEFT JOIN categories c ON p.category_id = c.id
+WHERE p.id = $1;
+
+-- name: UpdateProduct :one
+UPDATE products
+SET
+    name = $2,
+    price_kes = $3,
+    category_id = $4,
+    description = $5,
+    version = version + 1,
+    updated_at = NOW()
+WHERE id = $1 AND version = $6
+RETURNING version, updated_at;
+
+-- name: DeleteProduct :one
+DELETE FROM products
+WHERE id = $1
+RETURNING id;
+
+-- name: CreateProductStockAdjustment :one
+INSERT INTO product_stock_adjustments (
+    product_id,
+    adjusted_by,
+    quantity_change,
+    previous_quantity,
+    new_quantity,
+    reason
+) VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: GetProductStockAdjustments :many
+SELECT
+    count(*) OVER() AS total_count,
+    id,
+    product_id,
+    adjusted_by,
+    quantity_change,
+    previous_quantity,
+    new_quantity,
+    reason,
+    created_at
+FROM product_stock_adjustments
+WHERE product_id = $1
+ORDER BY created_at DESC, id DESC
+LIMIT $2 OFFSET $3;
@@ -0,0 +1,50 @@
+-- name: CreateSession :one
+INSERT INTO sessions (user_id, device, user_agent, ip_address, expiry)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, user_id, device, user_agent, ip_address, created_at, last_used_at, expiry, revoked_at;
+
+-- name: TouchSession :one
+UPDATE sessions
+SET last_used_at = NOW(), expiry = $2
+WHERE id = $1
+RETURNING id, user_id, device, user_agent, ip_address, created_at, last_used_at, expiry, revoked_at;
+
+-- name: GetActiveSessionsForUser :many
+SELECT id, user_id, device, user_agent, ip_address, created_at, last_used_at, expiry, revoked_at
+FROM sessions
+WHERE user_id = $1
+AND revoked_at IS NULL
+AND expiry > NOW()
+ORDER BY last_used_at DESC, id DESC;
+
+-- name: GetSessionForToken :one
+SELECT
+    sessions.id,
+    sessions.user_id,
+    sessions.device,
+    sessions.user_agent,
+    sessions.ip_address,
+    sessions.created_at,
+    sessions.last_used_at,
+    sessions.expiry,
+    sessions.revoked_at
+FROM sessions
+INNER JOIN tokens
+ON tokens.session_id = sessions.id
+WHERE tokens.hash = $1
+AND tokens.scope = $2
+AND sessions.revoked_at IS NULL;
+
+-- name: RevokeSession :one
+UPDATE sessions
+SET revoked_at = NOW()
+WHERE id = $1
+AND user_id = $2
+AND revoked_at IS NULL
+RETURNING id;
+
+-- name: RevokeAllSessionsForUser :exec
+UPDATE sessions
+SET revoked_at = NOW()
+WHERE user_id = $1
+AND revoked_at IS NULL;
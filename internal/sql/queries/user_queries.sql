@@ -18,6 +18,7 @@ SELECT
     email,
     profile_avatar_url,
     phone_number,
+    phone_verified,
     password,
     oidc_sub,
     role_level,
@@ -37,6 +38,7 @@ SELECT
     email,
     profile_avatar_url,
     phone_number,
+    phone_verified,
     password,
     oidc_sub,
     role_level,
@@ -56,6 +58,7 @@ SET
     email = $3,
     profile_avatar_url = $4,
     phone_number = $5,
+    phone_verified = $12,
     password = $6,
     role_level = $7,
     activated = $8,
@@ -63,4 +66,20 @@ SET
     updated_at = NOW(),
     last_login = $9
 WHERE id = $10 AND version = $11
-RETURNING updated_at, version;
\ No newline at end of file
+RETURNING updated_at, version;
+
+-- name: SetUserPhoneVerified :execrows
+UPDATE users
+SET
+    phone_verified = TRUE,
+    version = version + 1,
+    updated_at = NOW()
+WHERE id = $1 AND phone_number = $2;
+
+-- name: ClearUserPassword :exec
+UPDATE users
+SET
+    password = NULL,
+    version = version + 1,
+    updated_at = NOW()
+WHERE id = $1;
\ No newline at end of file
@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE carts (
+    id            SERIAL PRIMARY KEY,
+    user_id       INTEGER NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE, -- One persistent cart per user
+    created_at    TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE cart_items (
+    id            SERIAL PRIMARY KEY,
+    cart_id       INTEGER NOT NULL REFERENCES carts(id) ON DELETE CASCADE,
+    product_id    INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    quantity      INTEGER NOT NULL CHECK (quantity > 0),
+    created_at    TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- A product appears at most once per cart, adding it again bumps the quantity
+CREATE UNIQUE INDEX ux_cart_items_cart_product ON cart_items(cart_id, product_id);
+CREATE INDEX idx_cart_items_product ON cart_items(product_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS cart_items CASCADE;
+DROP TABLE IF EXISTS carts CASCADE;
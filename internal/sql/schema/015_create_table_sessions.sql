@@ -0,0 +1,31 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS sessions (
+    id           BIGSERIAL PRIMARY KEY,
+    user_id      BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device       TEXT NOT NULL DEFAULT '',       -- Device description derived from the user agent
+    user_agent   TEXT NOT NULL DEFAULT '',
+    ip_address   TEXT NOT NULL DEFAULT '',
+    created_at   TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(), -- Last login or refresh
+    expiry       TIMESTAMP(0) WITH TIME ZONE NOT NULL,               -- Pushed back on every refresh
+    revoked_at   TIMESTAMP(0) WITH TIME ZONE                         -- Set on logout, revoke or refresh token reuse
+);
+
+CREATE INDEX idx_sessions_user_id ON sessions(user_id);
+
+-- Authentication and refresh tokens belong to a session. Used refresh tokens are kept
+-- until they expire so a second use can be detected.
+ALTER TABLE tokens
+    ADD COLUMN session_id BIGINT REFERENCES sessions(id) ON DELETE CASCADE,
+    ADD COLUMN used_at    TIMESTAMP(0) WITH TIME ZONE;
+
+CREATE INDEX idx_tokens_session_id ON tokens(session_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_tokens_session_id;
+
+ALTER TABLE tokens
+    DROP COLUMN IF EXISTS used_at,
+    DROP COLUMN IF EXISTS session_id;
+
+DROP TABLE IF EXISTS sessions;
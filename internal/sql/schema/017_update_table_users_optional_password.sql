@@ -0,0 +1,12 @@
+-- +goose Up
+-- Users who sign up through an OIDC provider don't have a password
+ALTER TABLE users ALTER COLUMN password DROP NOT NULL;
+
+-- Every password so far was a placeholder derived from the user's OIDC subject, which
+-- isn't secret, so none of them may be used to log in
+UPDATE users SET password = NULL;
+
+-- +goose Down
+UPDATE users SET password = '\x00' WHERE password IS NULL;
+
+ALTER TABLE users ALTER COLUMN password SET NOT NULL;
@@ -0,0 +1,26 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS api_keys (
+    id           BIGSERIAL PRIMARY KEY,
+    user_id      BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name         TEXT NOT NULL,
+    prefix       TEXT NOT NULL,                   -- Start of the key, shown so users can tell keys apart
+    hash         BYTEA NOT NULL UNIQUE,           -- SHA-256 of the whole key, the key itself is never stored
+    created_at   TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMP(0) WITH TIME ZONE,
+    expiry       TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    revoked_at   TIMESTAMP(0) WITH TIME ZONE
+);
+
+CREATE INDEX idx_api_keys_user_id ON api_keys(user_id);
+
+-- The permissions a key is limited to, a key never has more than its owner
+CREATE TABLE IF NOT EXISTS api_keys_permissions (
+    api_key_id    BIGINT NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+    permission_id BIGINT NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    PRIMARY KEY (api_key_id, permission_id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS api_keys_permissions;
+DROP INDEX IF EXISTS idx_api_keys_user_id;
+DROP TABLE IF EXISTS api_keys;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- Numbers are only texted once their owner proves they can receive SMS at them
+ALTER TABLE users ADD COLUMN phone_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Wrong guesses at a one time code, the code stops working after a few of them
+ALTER TABLE tokens ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE tokens DROP COLUMN IF EXISTS attempts;
+ALTER TABLE users DROP COLUMN IF EXISTS phone_verified;
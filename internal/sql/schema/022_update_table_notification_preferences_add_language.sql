@@ -0,0 +1,6 @@
+-- +goose Up
+-- The language emails are sent to the user in, templates without a translation are sent in English
+ALTER TABLE notification_preferences ADD COLUMN language TEXT NOT NULL DEFAULT 'en';
+
+-- +goose Down
+ALTER TABLE notification_preferences DROP COLUMN IF EXISTS language;
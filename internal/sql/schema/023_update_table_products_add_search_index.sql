@@ -0,0 +1,13 @@
+-- +goose Up
+-- Product search matches the name first and the description second. The expression has to be
+-- repeated exactly in GetAllProductsWithCategory for this index to be used.
+CREATE INDEX idx_products_search ON products USING GIN (
+    (setweight(to_tsvector('simple', name), 'A') || setweight(to_tsvector('simple', coalesce(description, '')), 'B'))
+);
+
+-- Newest first is a common sort when browsing products
+CREATE INDEX idx_products_created_at ON products (created_at, id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_products_created_at;
+DROP INDEX IF EXISTS idx_products_search;
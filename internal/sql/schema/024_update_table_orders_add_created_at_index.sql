@@ -0,0 +1,9 @@
+-- +goose Up
+-- Order listings are paged newest first by (created_at, id), with or without a cursor
+CREATE INDEX idx_orders_created_at ON orders (created_at DESC, id DESC);
+
+CREATE INDEX idx_orders_user_created_at ON orders (user_id, created_at DESC, id DESC);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_orders_user_created_at;
+DROP INDEX IF EXISTS idx_orders_created_at;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- M-Pesa callbacks we couldn't tie to a payment. The customer may well have been charged,
+-- so the receipt is kept for the money to be traced and refunded.
+CREATE TABLE IF NOT EXISTS unmatched_payment_callbacks (
+    id                   BIGSERIAL PRIMARY KEY,
+    checkout_request_id  TEXT NOT NULL UNIQUE,          -- Daraja retries callbacks, the first one is kept
+    merchant_request_id  TEXT NOT NULL DEFAULT '',
+    result_code          INTEGER NOT NULL,
+    result_desc          TEXT NOT NULL DEFAULT '',
+    amount_kes           NUMERIC(14,2) NOT NULL DEFAULT 0, -- Only sent for successful payments, like the receipt and phone
+    mpesa_receipt_number TEXT NOT NULL DEFAULT '',
+    phone_number         VARCHAR(20) NOT NULL DEFAULT '',
+    created_at           TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_unmatched_payment_callbacks_created_at ON unmatched_payment_callbacks(created_at DESC);
+
+-- +goose Down
+DROP TABLE IF EXISTS unmatched_payment_callbacks;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- REVIEW payments took the customer's money but couldn't settle their order, an admin
+-- accepts them (SUCCESS) or refunds the customer (REFUNDED)
+ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_status_check;
+ALTER TABLE payments ADD CONSTRAINT payments_status_check CHECK (status IN ('PENDING', 'SUCCESS', 'FAILED', 'REVIEW', 'REFUNDED'));
+
+-- +goose Down
+ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_status_check;
+ALTER TABLE payments ADD CONSTRAINT payments_status_check CHECK (status IN ('PENDING', 'SUCCESS', 'FAILED'));